@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"example.com/mod/result"
+	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	"github.com/alibabacloud-go/tea/tea"
+	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/aliyun/credentials-go/credentials/providers"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 多账号的参数
+var accountFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "accounts",
+		Usage: tr("多账号配置文件（YAML）：每个账号有自己的凭证和域名，一次分析查询全部账号的日志，结果按账号标注", "multi-account config file (YAML): each account has its own credentials and domains; one run analyzes the logs of all accounts and labels results by account"),
+	},
+}
+
+// 一个CDN账号及其域名
+type account struct {
+	Name string `yaml:"name"`
+	// CDN厂商，同 --provider，为空时使用 --provider
+	Provider string `yaml:"provider"`
+	// 凭证文件（阿里云为 ~/.alibabacloud/credentials，腾讯云为 ~/.tencentcloud/credentials，华为云为 ~/.huaweicloud/credentials）中的 profile 名，为空时使用默认凭证
+	Profile string `yaml:"profile"`
+	// 从这两个环境变量读取 AccessKey，优先于 profile
+	AccessKeyIDEnv     string   `yaml:"access_key_id_env"`
+	AccessKeySecretEnv string   `yaml:"access_key_secret_env"`
+	Domains            []string `yaml:"domains"`
+}
+
+// --accounts 中的账号，为空表示只使用默认凭证和 --domain
+var accounts []account
+
+// 本地日志文件对应的账号名，多账号时用于结果标注
+var logAccounts struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func loadAccounts(c *cli.Context) error {
+	accounts = nil
+	logAccounts.m = nil
+	path := c.String("accounts")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf(tr("读取账号配置失败: %w", "read accounts file: %w"), err)
+	}
+	var file struct {
+		Accounts []account `yaml:"accounts"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf(tr("解析账号配置 %s 失败: %w", "parse accounts file %s: %w"), path, err)
+	}
+	if len(file.Accounts) == 0 {
+		return fmt.Errorf(tr("账号配置 %s 中没有账号", "no accounts in %s"), path)
+	}
+	seen := make(map[string]bool)
+	for _, a := range file.Accounts {
+		switch {
+		case a.Name == "":
+			return errors.New(tr("每个账号都需要 name", "every account needs a name"))
+		case seen[a.Name]:
+			return fmt.Errorf(tr("账号 %q 重复", "duplicate account %q"), a.Name)
+		case len(a.Domains) == 0:
+			return fmt.Errorf(tr("账号 %q 没有域名", "account %q has no domains"), a.Name)
+		case (a.AccessKeyIDEnv == "") != (a.AccessKeySecretEnv == ""):
+			return fmt.Errorf(tr("账号 %q 需要同时设置 access_key_id_env 和 access_key_secret_env", "account %q needs both access_key_id_env and access_key_secret_env"), a.Name)
+		case a.Provider != "" && logProviders[a.Provider] == nil:
+			return fmt.Errorf(tr("账号 %q 的CDN厂商 %q 不支持", "account %q: unsupported CDN provider %q"), a.Name, a.Provider)
+		}
+		seen[a.Name] = true
+	}
+
+	// 以下功能只针对单个域名，多账号时不支持
+	if c.IsSet("domain") {
+		return errors.New(tr("--accounts 不能与 --domain 同时使用，域名写在账号配置中", "--accounts cannot be combined with --domain; list domains in the accounts file"))
+	}
+	for _, name := range []string{"urls-file", "oss-bucket", "cross-check", "push-blacklist"} {
+		if c.IsSet(name) {
+			return fmt.Errorf(tr("--accounts 不能与 --%s 同时使用", "--accounts cannot be combined with --%s"), name)
+		}
+	}
+	accounts = file.Accounts
+	// 报告和结果中的域名为全部账号的域名
+	var domains []string
+	for _, a := range accounts {
+		domains = append(domains, a.Domains...)
+	}
+	config.domainName = strings.Join(domains, ",")
+	return nil
+}
+
+// 账号的凭证：环境变量中的 AccessKey、credentials 文件中的 profile 或默认凭证链
+func (a *account) credential() (credential.Credential, error) {
+	if a.AccessKeyIDEnv != "" {
+		id, secret := os.Getenv(a.AccessKeyIDEnv), os.Getenv(a.AccessKeySecretEnv)
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf(tr("环境变量 %s 或 %s 未设置", "environment variable %s or %s is not set"), a.AccessKeyIDEnv, a.AccessKeySecretEnv)
+		}
+		return credential.NewCredential(&credential.Config{
+			Type:            tea.String("access_key"),
+			AccessKeyId:     tea.String(id),
+			AccessKeySecret: tea.String(secret),
+		})
+	}
+	if a.Profile != "" {
+		p, err := providers.NewProfileCredentialsProviderBuilder().WithProfileName(a.Profile).Build()
+		if err != nil {
+			return nil, err
+		}
+		return credential.FromCredentialsProvider("profile", p), nil
+	}
+	return credential.NewCredential(nil)
+}
+
+// 账号的CDN厂商，未指定时为 --provider
+func (a *account) provider() string {
+	if a.Provider != "" {
+		return a.Provider
+	}
+	return providerName
+}
+
+// 使用账号的凭证创建日志来源
+func (a *account) logProvider() (logProvider, error) {
+	p, err := logProviders[a.provider()](a)
+	if err != nil {
+		return nil, fmt.Errorf(tr("账号 %s 的凭证: %w", "credentials of account %s: %w"), a.Name, err)
+	}
+	return p, nil
+}
+
+// 使用指定凭证创建CDN客户端
+func newCDNClient(cred credential.Credential) (*cdn20180510.Client, error) {
+	return cdn20180510.NewClient(&openapi.Config{
+		Credential: cred,
+		Endpoint:   tea.String("cdn.aliyuncs.com"),
+	})
+}
+
+// 记录日志链接所属的账号，下载后按本地文件路径查找
+func setURLAccount(url, name string) {
+	logAccounts.mu.Lock()
+	defer logAccounts.mu.Unlock()
+	if logAccounts.m == nil {
+		logAccounts.m = make(map[string]string)
+	}
+	logAccounts.m[localLogPath(url)] = name
+}
+
+// 日志文件所属的账号，单账号时为空
+func fileAccount(file string) string {
+	logAccounts.mu.Lock()
+	defer logAccounts.mu.Unlock()
+	return logAccounts.m[file]
+}
+
+// 结果中显示的文件名，多账号时带账号前缀，如 prod/example.com_2025_05_15.gz
+func fileLabel(file string) string {
+	if name := fileAccount(file); name != "" {
+		return name + "/" + filepath.Base(file)
+	}
+	return filepath.Base(file)
+}
+
+// 结果中的账号列表
+func accountsResult() []result.Account {
+	var list []result.Account
+	for _, a := range accounts {
+		list = append(list, result.Account{Name: a.Name, Domains: a.Domains})
+	}
+	return list
+}
+
+// 账号及域名的文本形式，如 prod (a.com, b.com); test (t.com)
+func accountsSummary() string {
+	parts := make([]string, len(accounts))
+	for i, a := range accounts {
+		parts[i] = fmt.Sprintf("%s (%s)", a.Name, strings.Join(a.Domains, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,111 @@
+package main
+
+// 需要处理全部日志行（而不只是命中行）的统计：检测规则、流量统计等。
+// 每次扫描（单个文件或分块）创建一个 lineAnalysis，每行只解析一次再交给各项统计，
+// 扫描结束后合并到全局结果
+type lineAnalysis struct {
+	rules   *ruleState
+	traffic *trafficState
+	groupBy []*groupByState
+	export  *exportState
+	period  map[string]*domainPeriod
+	params  *queryParamState
+	streams map[string]*streamData
+	rec     logRecord
+	// 解析的行数和无法解析的行数，合并时累加到运行信息
+	parsed, parseErrors int64
+}
+
+// 是否有需要处理全部日志行的统计；有时达到命中数上限后仍需读完文件
+func analysisEnabled() bool {
+	return ruleSet != nil || trafficCounter != nil || weekCurrent != nil || queryParams != nil || streams != nil || len(aggregateReports) > 0 || logExport != nil && logExport.all
+}
+
+// 为一次扫描创建统计状态，没有启用任何统计时返回 nil
+func newLineAnalysis() *lineAnalysis {
+	if !analysisEnabled() {
+		return nil
+	}
+	a := &lineAnalysis{
+		rules:   ruleSet.newState(),
+		traffic: trafficCounter.newState(),
+		export:  logExport.newState(),
+		params:  queryParams.newState(),
+		streams: streams.newState(),
+	}
+	if weekCurrent != nil {
+		a.period = make(map[string]*domainPeriod)
+	}
+	for _, g := range aggregateReports {
+		a.groupBy = append(a.groupBy, g.newState())
+	}
+	return a
+}
+
+// 解析一行日志并更新各项统计，无法解析的行跳过
+func (a *lineAnalysis) observe(line string) {
+	if a == nil {
+		return
+	}
+	a.parsed++
+	if parseLogLine(line, &a.rec) != nil {
+		a.parseErrors++
+		return
+	}
+	a.rules.observe(&a.rec)
+	a.traffic.observe(&a.rec)
+	a.export.observe(&a.rec)
+	if a.period != nil {
+		observePeriod(a.period, &a.rec)
+	}
+	a.params.observe(&a.rec)
+	observeStream(a.streams, &a.rec)
+	for _, st := range a.groupBy {
+		st.observe(&a.rec)
+	}
+}
+
+// 一次扫描（单个文件或分块）的统计状态。扫描成功后才合并到全局结果，
+// 失败的扫描（如损坏后重新下载、重新扫描的文件）直接丢弃，以免部分结果被重复统计
+type scanState struct {
+	detect *lineAnalysis
+	ips    *matchedIPState
+	// 读取的行数（包括采样跳过的行），合并时累加到运行信息
+	lines int64
+}
+
+func newScanState() *scanState {
+	return &scanState{detect: newLineAnalysis(), ips: newMatchedIPState()}
+}
+
+// 统计一行日志，matched 表示该行命中搜索条件
+func (s *scanState) observe(line string, matched bool) {
+	s.detect.observe(line)
+	if matched {
+		s.ips.observe(line)
+	}
+}
+
+func (s *scanState) merge() {
+	runStats.linesProcessed.Add(s.lines)
+	s.detect.merge()
+	s.ips.merge()
+}
+
+// 将本次扫描的统计合并到全局结果
+func (a *lineAnalysis) merge() {
+	if a == nil {
+		return
+	}
+	runStats.linesParsed.Add(a.parsed)
+	runStats.parseErrors.Add(a.parseErrors)
+	ruleSet.merge(a.rules)
+	trafficCounter.merge(a.traffic)
+	logExport.merge(a.export)
+	weekCurrent.merge(a.period)
+	queryParams.merge(a.params)
+	streams.merge(a.streams)
+	for i, g := range aggregateReports {
+		g.merge(a.groupBy[i])
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 隐私模式：在所有结果和导出中隐去客户端IP，便于把汇总报表分享给安全团队以外的人
+var anonymizeFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "anonymize-ip",
+		Usage: tr("匿名化结果和导出中的客户端IP和代理IP: mask（IPv4 保留 /24、IPv6 保留 /48）或 hmac（用 --anonymize-key 计算的 HMAC-SHA256，同一IP始终得到相同的值）", "anonymize client and proxy IPs in all results and exports: mask (keep the /24 of IPv4 and the /48 of IPv6) or hmac (HMAC-SHA256 with --anonymize-key; the same IP always maps to the same value)"),
+	},
+	&cli.StringFlag{
+		Name:    "anonymize-key",
+		EnvVars: []string{"CDN_LOG_ANONYMIZE_KEY"},
+		Usage:   tr("--anonymize-ip hmac 使用的密钥；多次运行使用同一密钥时结果可以相互对照", "key of --anonymize-ip hmac; runs with the same key produce comparable results"),
+	},
+}
+
+// mask 模式保留的前缀长度
+const (
+	anonymizeBits4 = 24
+	anonymizeBits6 = 48
+)
+
+// IP匿名化配置，mode 为空表示未启用
+var anonymizeConfig struct {
+	mode string
+	key  []byte
+}
+
+func loadAnonymizeConfig(c *cli.Context) error {
+	anonymizeConfig.mode, anonymizeConfig.key = "", nil
+	mode := c.String("anonymize-ip")
+	switch mode {
+	case "":
+		return nil
+	case "mask":
+	case "hmac":
+		key := c.String("anonymize-key")
+		if key == "" {
+			return errors.New(tr("--anonymize-ip hmac 需要指定 --anonymize-key", "--anonymize-ip hmac requires --anonymize-key"))
+		}
+		anonymizeConfig.key = []byte(key)
+	default:
+		return fmt.Errorf(tr("不支持的 --anonymize-ip %q，可选 mask 或 hmac", "unsupported --anonymize-ip %q, use mask or hmac"), mode)
+	}
+	// 这些功能需要查询或列出真实的IP，匿名化后无法使用
+	conflicts := []struct {
+		flag string
+		set  bool
+	}{
+		{"--ip-file", config.ipFile != ""},
+		{"--intel-feed", len(intelFeeds) > 0},
+		{"--rdns", rdnsConfig.enabled},
+		{"--abuseipdb-key/--reputation-list", reputationConfig.apiKey != "" || len(reputationConfig.lists) > 0},
+		{"--blocklist/--push-blacklist", blocklistConfig.dir != "" || blocklistConfig.push},
+	}
+	for _, f := range conflicts {
+		if f.set {
+			return fmt.Errorf(tr("--anonymize-ip 不能与 %s 同时使用", "--anonymize-ip cannot be combined with %s"), f.flag)
+		}
+	}
+	anonymizeConfig.mode = mode
+	return nil
+}
+
+// 匿名化一个IP字段；字段可能是逗号分隔的多个IP，不是IP的内容（如 -）原样返回
+func anonymizeIP(s string) string {
+	if anonymizeConfig.mode == "" || s == "" || s == "-" {
+		return s
+	}
+	if strings.IndexByte(s, ',') >= 0 {
+		parts := strings.Split(s, ",")
+		for i, p := range parts {
+			parts[i] = anonymizeIP(strings.TrimSpace(p))
+		}
+		return strings.Join(parts, ",")
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return s
+	}
+	addr = addr.Unmap().WithZone("")
+	if anonymizeConfig.mode == "hmac" {
+		return anonymizeHash(addr.String())
+	}
+	bits := anonymizeBits6
+	if addr.Is4() {
+		bits = anonymizeBits4
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.Addr().String()
+}
+
+// HMAC-SHA256 的前 8 字节，十六进制表示
+func anonymizeHash(s string) string {
+	mac := hmac.New(sha256.New, anonymizeConfig.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// 改写日志行中的客户端IP和代理IP字段，其余内容不变；未启用或行格式无法识别时原样返回
+func anonymizeLine(line string) string {
+	if anonymizeConfig.mode == "" {
+		return line
+	}
+	// 腾讯云的日志没有代理IP，客户端IP在请求时间之后
+	if isTencentLine(line) {
+		head, rest := line[:len(tencentTimeLayout)+1], line[len(tencentTimeLayout)+1:]
+		client, rest, ok := strings.Cut(rest, " ")
+		if !ok {
+			return line
+		}
+		return head + anonymizeIP(client) + " " + rest
+	}
+	i := strings.Index(line, "] ")
+	if i < 0 {
+		return line
+	}
+	head, rest := line[:i+2], line[i+2:]
+	client, rest, ok := strings.Cut(rest, " ")
+	if !ok {
+		return line
+	}
+	// 华为云的日志在客户端IP之后是响应时间，末尾的服务端IP是CDN节点的地址，不需要改写
+	if isHuaweiLine(line) {
+		return head + anonymizeIP(client) + " " + rest
+	}
+	proxy, rest, ok := strings.Cut(rest, " ")
+	if !ok {
+		return line
+	}
+	return head + anonymizeIP(client) + " " + anonymizeIP(proxy) + " " + rest
+}
+
+// 结果中显示的搜索模式：IP和网段按同样的方式匿名化，hmac 模式下其他模式也只显示哈希值
+func anonymizePatterns(patterns []string) []string {
+	if anonymizeConfig.mode == "" {
+		return patterns
+	}
+	out := make([]string, len(patterns))
+	for i, p := range patterns {
+		prefix, prefixErr := netip.ParsePrefix(p)
+		_, addrErr := netip.ParseAddr(strings.Trim(p, "[]"))
+		switch {
+		case addrErr == nil:
+			out[i] = anonymizeIP(p)
+		case prefixErr == nil && anonymizeConfig.mode == "mask":
+			out[i] = anonymizeIP(prefix.Addr().String()) + "/" + strconv.Itoa(prefix.Bits())
+		case anonymizeConfig.mode == "hmac":
+			out[i] = anonymizeHash(p)
+		default:
+			out[i] = p
+		}
+	}
+	return out
+}
+
+// 结果中显示的 --ip
+func displaySearchIP() string {
+	return strings.Join(anonymizePatterns(splitPatterns(config.searchIP)), ",")
+}
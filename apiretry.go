@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/urfave/cli/v2"
+)
+
+// OpenAPI 限流重试的参数
+var apiRetryFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "api-retries",
+		Value: 5,
+		Usage: tr("OpenAPI 调用被限流（Throttling/FlowControl）时的最大重试次数，0 表示不重试", "maximum retries of an OpenAPI call that is throttled (Throttling/FlowControl); 0 disables retrying"),
+	},
+	&cli.DurationFlag{
+		Name:  "api-retry-max-wait",
+		Value: time.Minute,
+		Usage: tr("限流重试的单次最长等待时间", "longest wait before a single retry of a throttled call"),
+	},
+}
+
+// 限流重试配置
+var apiRetryConfig struct {
+	retries int
+	maxWait time.Duration
+}
+
+func loadAPIRetryConfig(c *cli.Context) error {
+	apiRetryConfig.retries = c.Int("api-retries")
+	apiRetryConfig.maxWait = c.Duration("api-retry-max-wait")
+	if apiRetryConfig.retries < 0 {
+		return errors.New(tr("--api-retries 不能为负数", "--api-retries must not be negative"))
+	}
+	if apiRetryConfig.maxWait <= 0 {
+		return errors.New(tr("--api-retry-max-wait 必须大于0", "--api-retry-max-wait must be positive"))
+	}
+	return nil
+}
+
+// 第一次重试前的等待时间，之后每次翻倍
+const apiRetryBaseWait = time.Second
+
+// 调用 OpenAPI，被限流时按退避时间重试；其他错误直接返回
+func withAPIRetry(ctx context.Context, action string, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		throttled, hint := throttleHint(err)
+		if !throttled || attempt >= apiRetryConfig.retries {
+			return err
+		}
+		wait := hint
+		if wait <= 0 {
+			// 指数退避，先限制在最长等待时间内（重试次数很多时移位会溢出），
+			// 再加上随机抖动避免多个调用同时重试
+			wait = apiRetryConfig.maxWait
+			if attempt < 30 {
+				wait = min(apiRetryBaseWait<<attempt, wait)
+			}
+			if jitter := int64(wait / 2); jitter > 0 {
+				wait += time.Duration(rand.Int64N(jitter))
+			}
+		}
+		wait = min(wait, apiRetryConfig.maxWait)
+		fmt.Fprintf(os.Stderr, tr("%s 被限流，%s 后重试（第 %d/%d 次）\n", "%s throttled, retrying in %s (%d/%d)\n"),
+			action, wait.Round(100*time.Millisecond), attempt+1, apiRetryConfig.retries)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// 判断是否为限流错误，并返回错误响应中建议的等待时间（没有时为0）
+func throttleHint(err error) (bool, time.Duration) {
+	var apiErr *cloudAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.throttled(), 0
+	}
+	var sdkErr *tea.SDKError
+	if !errors.As(err, &sdkErr) {
+		return false, 0
+	}
+	code := tea.StringValue(sdkErr.Code)
+	if !strings.HasPrefix(code, "Throttling") && !strings.Contains(code, "FlowControl") && tea.IntValue(sdkErr.StatusCode) != 429 {
+		return false, 0
+	}
+	var data map[string]any
+	if json.Unmarshal([]byte(tea.StringValue(sdkErr.Data)), &data) != nil {
+		return true, 0
+	}
+	for _, key := range []string{"RetryAfter", "Retry-After", "retryAfter"} {
+		switch v := data[key].(type) {
+		case float64:
+			return true, time.Duration(v * float64(time.Second))
+		case string:
+			if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+				return true, time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return true, 0
+}
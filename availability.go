@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/mod/result"
+)
+
+// CDN离线日志的保留天数（阿里云、腾讯云相同），更早的日志无法再通过API查询
+const cdnLogRetentionDays = 30
+
+// 某天没有日志文件的原因
+const (
+	// 超出离线日志的保留期
+	missingExpired = "expired"
+	// 当天尚未结束，日志可能还未发布
+	missingPending = "pending"
+	// 保留期内但没有日志，通常是当天没有访问
+	missingEmpty = "empty"
+)
+
+// 接口没有返回任何日志文件的一天（UTC）
+type missingLogDay struct {
+	domain string
+	day    time.Time
+	reason string
+}
+
+// 最近一次通过API查询日志列表时没有日志文件的日期，按查询顺序排列
+var missingLogDays []missingLogDay
+
+// 记录没有日志文件的一天，并按当前时间判断原因
+func recordMissingLogDay(domain string, day time.Time) {
+	now := time.Now()
+	reason := missingEmpty
+	switch {
+	case day.Add(24 * time.Hour).Before(now.AddDate(0, 0, -cdnLogRetentionDays)):
+		reason = missingExpired
+	case day.Add(24 * time.Hour).After(now):
+		reason = missingPending
+	}
+	missingLogDays = append(missingLogDays, missingLogDay{domain: domain, day: day, reason: reason})
+}
+
+func missingReasonText(reason string) string {
+	switch reason {
+	case missingExpired:
+		return fmt.Sprintf(tr("超出CDN离线日志的保留期（%d 天），已无法查询", "beyond the %d-day retention of CDN offline logs, no longer available"), cdnLogRetentionDays)
+	case missingPending:
+		return tr("当天尚未结束，日志可能还未发布", "the day has not ended yet, logs may not be published")
+	default:
+		return tr("没有日志，可能当天没有访问", "no logs, possibly no traffic that day")
+	}
+}
+
+// 连续且原因相同的日期合并为一段
+type missingLogRange struct {
+	domain     string
+	start, end time.Time
+	reason     string
+}
+
+func missingLogRanges() []missingLogRange {
+	var ranges []missingLogRange
+	for _, m := range missingLogDays {
+		if n := len(ranges); n > 0 {
+			last := &ranges[n-1]
+			if last.domain == m.domain && last.reason == m.reason && last.end.Add(24*time.Hour).Equal(m.day) {
+				last.end = m.day
+				continue
+			}
+		}
+		ranges = append(ranges, missingLogRange{domain: m.domain, start: m.day, end: m.day, reason: m.reason})
+	}
+	return ranges
+}
+
+func (r missingLogRange) String() string {
+	if r.start.Equal(r.end) {
+		return r.start.Format(time.DateOnly)
+	}
+	days := int(r.end.Sub(r.start).Hours()/24) + 1
+	return fmt.Sprintf(tr("%s 至 %s（%d 天）", "%s to %s (%d days)"), r.start.Format(time.DateOnly), r.end.Format(time.DateOnly), days)
+}
+
+// 在标准错误输出没有日志文件的日期，避免结果偏少时误以为没有命中
+func printMissingLogDays() {
+	ranges := missingLogRanges()
+	for i, r := range ranges {
+		if i == 0 || ranges[i-1].domain != r.domain {
+			fmt.Fprintf(os.Stderr, tr("警告: 域名 %s 在以下日期（UTC）没有日志文件，结果可能不完整:\n", "Warning: domain %s has no log files on these days (UTC); results may be incomplete:\n"), r.domain)
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", r, missingReasonText(r.reason))
+	}
+}
+
+// 文本结果头部中的一行，没有缺少日志的日期时为空
+func missingLogDaysHeader() string {
+	ranges := missingLogRanges()
+	if len(ranges) == 0 {
+		return ""
+	}
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		dates := r.start.Format(time.DateOnly)
+		if !r.start.Equal(r.end) {
+			dates += "~" + r.end.Format(time.DateOnly)
+		}
+		parts[i] = fmt.Sprintf("%s %s %s", r.domain, dates, r.reason)
+	}
+	return fmt.Sprintf(tr("# 没有日志文件的日期: %s\n", "# Days without log files: %s\n"), strings.Join(parts, "; "))
+}
+
+// 转换为结果格式
+func missingLogDaysResult() []result.MissingLogDay {
+	var days []result.MissingLogDay
+	for _, m := range missingLogDays {
+		days = append(days, result.MissingLogDay{Domain: m.domain, Date: m.day.Format(time.DateOnly), Reason: m.reason})
+	}
+	return days
+}
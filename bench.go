@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// bench 子命令：在本地日志上测试解析和匹配速度
+var benchCommand = &cli.Command{
+	Name:  "bench",
+	Usage: tr("在本地日志文件上测试不同协程数下的解析和匹配速度，用于调整 --workers", "benchmark parsing and matching on local log files with different worker counts, to tune --workers"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "dir",
+			Value: logDir,
+			Usage: tr("测试使用的日志目录", "log directory to benchmark on"),
+		},
+		&cli.StringFlag{
+			Name:  "workers",
+			Usage: tr("要测试的协程数列表，逗号分隔 (默认 1,2,4...直到CPU核数)", "comma-separated worker counts to test (default 1,2,4... up to the CPU count)"),
+		},
+		&cli.StringFlag{
+			Name:  "pattern",
+			Value: "127.0.0.1",
+			Usage: tr("匹配使用的模式，多个用逗号分隔", "pattern(s) to match, comma-separated"),
+		},
+	},
+	Action: runBench,
+}
+
+// 单轮测试的结果
+type benchResult struct {
+	workers  int
+	lines    int64
+	parsed   int64
+	matches  int64
+	duration time.Duration
+}
+
+func runBench(c *cli.Context) error {
+	files := walkLogFiles(c.String("dir"))
+	if len(files) == 0 {
+		return fmt.Errorf(tr("目录 %s 中没有日志文件", "no log files in directory %s"), c.String("dir"))
+	}
+
+	workerCounts, err := parseWorkerCounts(c.String("workers"))
+	if err != nil {
+		return err
+	}
+	lineMatcher = newMatcher(splitPatterns(c.String("pattern")), false)
+
+	fmt.Printf(tr("测试文件: %d 个，CPU核数: %d\n", "Files: %d, CPUs: %d\n"), len(files), runtime.NumCPU())
+	if len(files) < slices.Max(workerCounts) {
+		fmt.Print(tr("注意: 文件数少于协程数，多出的协程不会带来提升\n", "Note: fewer files than workers, extra workers will not help\n"))
+	}
+
+	// 预先读一遍，避免第一轮测试受磁盘缓存影响
+	if _, err := benchOnce(files, 1); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%-8s %-14s %-14s %-10s %-10s\n", tr("协程数", "Workers"), tr("处理行数", "Lines"), tr("行/秒", "Lines/s"), tr("解析失败", "Unparsed"), tr("耗时", "Elapsed"))
+	for _, w := range workerCounts {
+		res, err := benchOnce(files, w)
+		if err != nil {
+			return err
+		}
+		rate := float64(res.lines) / res.duration.Seconds()
+		fmt.Printf("%-8d %-14d %-14.0f %-10d %-10s\n",
+			res.workers, res.lines, rate, res.lines-res.parsed, res.duration.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// 用 workers 个协程解析并匹配所有文件一遍
+func benchOnce(files []string, workers int) (*benchResult, error) {
+	res := &benchResult{workers: workers}
+	var lines, parsed, matches atomic.Int64
+
+	jobs := make(chan string)
+	errChan := make(chan error, len(files))
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var rec logRecord
+			for file := range jobs {
+				reader, closeReader, err := openLogReader(file, nil)
+				if err != nil {
+					errChan <- err
+					continue
+				}
+
+				var l, p, m int64
+				scanner := bufio.NewScanner(reader)
+				scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+				for scanner.Scan() {
+					line := scanner.Text()
+					l++
+					if parseLogLine(line, &rec) == nil {
+						p++
+					}
+					if lineMatcher.Match(line) {
+						m++
+					}
+				}
+				if err := scanner.Err(); err != nil {
+					errChan <- fmt.Errorf(tr("读取 %s 失败: %w", "read %s: %w"), file, err)
+				}
+				closeReader()
+				lines.Add(l)
+				parsed.Add(p)
+				matches.Add(m)
+			}
+		}()
+	}
+
+	for _, file := range files {
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+	close(errChan)
+
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+
+	res.duration = time.Since(start)
+	res.lines, res.parsed, res.matches = lines.Load(), parsed.Load(), matches.Load()
+	return res, nil
+}
+
+// 解析协程数列表，为空时使用 1,2,4... 直到CPU核数
+func parseWorkerCounts(s string) ([]int, error) {
+	var counts []int
+	if strings.TrimSpace(s) == "" {
+		for n := 1; n < runtime.NumCPU(); n *= 2 {
+			counts = append(counts, n)
+		}
+		return append(counts, runtime.NumCPU()), nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf(tr("无效的协程数 %q", "invalid worker count %q"), part)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
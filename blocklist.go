@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 生成封禁列表的参数
+var blocklistFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "blocklist",
+		Usage: tr("根据规则告警中的 client_ip 生成封禁列表，写入该目录: blocklist.txt、nginx-deny.conf、ipset.sh", "write blocklists built from the client_ip of rule findings into this directory: blocklist.txt, nginx-deny.conf, ipset.sh"),
+	},
+	&cli.StringFlag{
+		Name:  "blocklist-severity",
+		Value: "medium",
+		Usage: tr("加入封禁列表的最低告警级别", "minimum finding severity to include in blocklists"),
+	},
+	&cli.IntFlag{
+		Name:  "blocklist-cidr-min",
+		Usage: tr("同一 /24（IPv6 为 /64）网段中至少有N个IP时合并为网段，0 表示不合并", "merge IPs into their /24 (/64 for IPv6) when at least N of them share it; 0 disables merging"),
+	},
+	&cli.BoolFlag{
+		Name:  "push-blacklist",
+		Usage: tr("将封禁IP追加到CDN域名的IP黑名单（ip_black_list_set），默认只预览配置变更", "append blocked IPs to the CDN domain's IP blacklist (ip_black_list_set); only previews the change by default"),
+	},
+	&cli.BoolFlag{
+		Name:  "confirm",
+		Usage: tr("确认修改域名配置，配合 --push-blacklist 使用", "actually change the domain config, used with --push-blacklist"),
+	},
+}
+
+// ipset 集合名
+const (
+	ipsetName  = "cdn_blocklist"
+	ipset6Name = "cdn_blocklist6"
+)
+
+// 封禁列表中的一项及触发它的规则
+type blockEntry struct {
+	prefix netip.Prefix
+	rules  []string
+}
+
+// 封禁列表配置，dir 为空表示不生成
+var blocklistConfig struct {
+	dir      string
+	severity string
+	cidrMin  int
+	// 推送到CDN域名的IP黑名单，confirm 为 false 时只预览
+	push    bool
+	confirm bool
+}
+
+func loadBlocklistConfig(c *cli.Context) error {
+	blocklistConfig.dir = c.String("blocklist")
+	blocklistConfig.severity = c.String("blocklist-severity")
+	blocklistConfig.cidrMin = c.Int("blocklist-cidr-min")
+	blocklistConfig.push = c.Bool("push-blacklist")
+	blocklistConfig.confirm = c.Bool("confirm")
+	if !slices.Contains(severities, blocklistConfig.severity) {
+		return fmt.Errorf(tr("无效的级别 %q，可选 %s", "invalid severity %q, use one of %s"), blocklistConfig.severity, strings.Join(severities, ", "))
+	}
+	if blocklistConfig.dir != "" && c.String("rules") == "" {
+		return errors.New(tr("--blocklist 需要配合 --rules 使用", "--blocklist requires --rules"))
+	}
+	if blocklistConfig.push && c.String("rules") == "" {
+		return errors.New(tr("--push-blacklist 需要配合 --rules 使用", "--push-blacklist requires --rules"))
+	}
+	return nil
+}
+
+// 从规则告警中提取达到级别的 client_ip，按地址排序
+func offendingIPs(findings []result.Finding, minSeverity string, cidrMin int) []blockEntry {
+	minLevel := slices.Index(severities, minSeverity)
+	byAddr := make(map[netip.Addr][]string)
+	for _, f := range findings {
+		if slices.Index(severities, f.Severity) < minLevel {
+			continue
+		}
+		addr, err := netip.ParseAddr(f.Group["client_ip"])
+		if err != nil {
+			continue
+		}
+		addr = addr.Unmap()
+		if !slices.Contains(byAddr[addr], f.Rule) {
+			byAddr[addr] = append(byAddr[addr], f.Rule)
+		}
+	}
+
+	// 按网段合并
+	entries := make(map[netip.Prefix]*blockEntry)
+	if cidrMin > 0 {
+		bySubnet := make(map[netip.Prefix][]netip.Addr)
+		for addr := range byAddr {
+			bySubnet[subnetOf(addr)] = append(bySubnet[subnetOf(addr)], addr)
+		}
+		for subnet, addrs := range bySubnet {
+			if len(addrs) < cidrMin {
+				continue
+			}
+			e := &blockEntry{prefix: subnet}
+			for _, addr := range addrs {
+				for _, r := range byAddr[addr] {
+					if !slices.Contains(e.rules, r) {
+						e.rules = append(e.rules, r)
+					}
+				}
+				delete(byAddr, addr)
+			}
+			entries[subnet] = e
+		}
+	}
+	for addr, rules := range byAddr {
+		p := netip.PrefixFrom(addr, addr.BitLen())
+		entries[p] = &blockEntry{prefix: p, rules: rules}
+	}
+
+	list := make([]blockEntry, 0, len(entries))
+	for _, e := range entries {
+		slices.Sort(e.rules)
+		list = append(list, *e)
+	}
+	slices.SortFunc(list, func(a, b blockEntry) int {
+		if c := a.prefix.Addr().Compare(b.prefix.Addr()); c != 0 {
+			return c
+		}
+		return a.prefix.Bits() - b.prefix.Bits()
+	})
+	return list
+}
+
+// IP所在的 /24（IPv6 为 /64）网段
+func subnetOf(addr netip.Addr) netip.Prefix {
+	bits := 24
+	if addr.Is6() {
+		bits = 64
+	}
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// 网段的文本形式，单个地址不带前缀长度
+func prefixString(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+// 生成封禁列表文件，返回写入的条目数
+func writeBlocklists(findings []result.Finding) (int, error) {
+	entries := offendingIPs(findings, blocklistConfig.severity, blocklistConfig.cidrMin)
+	dir := blocklistConfig.dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	header := fmt.Sprintf(tr("由 cdn-log-analyzer 生成于 %s，域名 %s，时间范围 %s 至 %s，最低级别 %s", "generated by cdn-log-analyzer at %s, domain %s, time range %s to %s, minimum severity %s"),
+		time.Now().Format(time.RFC3339), config.domainName, config.startTime, config.endTime, blocklistConfig.severity)
+
+	writers := []struct {
+		name  string
+		write func(w *bufio.Writer)
+	}{
+		{"blocklist.txt", func(w *bufio.Writer) {
+			fmt.Fprintf(w, "# %s\n", header)
+			for _, e := range entries {
+				fmt.Fprintln(w, prefixString(e.prefix))
+			}
+		}},
+		{"nginx-deny.conf", func(w *bufio.Writer) {
+			fmt.Fprintf(w, "# %s\n", header)
+			for _, e := range entries {
+				fmt.Fprintf(w, "deny %s; # %s\n", prefixString(e.prefix), strings.Join(e.rules, ","))
+			}
+		}},
+		{"ipset.sh", func(w *bufio.Writer) { writeIpsetScript(w, header, entries) }},
+	}
+	for _, out := range writers {
+		if err := writeFileWith(filepath.Join(dir, out.name), out.write); err != nil {
+			return 0, err
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "ipset.sh"), 0755); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// ipset/iptables 脚本：创建集合、加入地址，并在 INPUT 链中丢弃来自集合的流量（可重复执行）
+func writeIpsetScript(w *bufio.Writer, header string, entries []blockEntry) {
+	fmt.Fprintf(w, "#!/bin/sh\n# %s\nset -e\n\n", header)
+	has6 := slices.ContainsFunc(entries, func(e blockEntry) bool { return e.prefix.Addr().Is6() })
+
+	fmt.Fprintf(w, "ipset create %s hash:net family inet -exist\n", ipsetName)
+	if has6 {
+		fmt.Fprintf(w, "ipset create %s hash:net family inet6 -exist\n", ipset6Name)
+	}
+	for _, e := range entries {
+		set := ipsetName
+		if e.prefix.Addr().Is6() {
+			set = ipset6Name
+		}
+		fmt.Fprintf(w, "ipset add %s %s -exist\n", set, prefixString(e.prefix))
+	}
+	fmt.Fprintf(w, "\niptables -C INPUT -m set --match-set %[1]s src -j DROP 2>/dev/null || iptables -I INPUT -m set --match-set %[1]s src -j DROP\n", ipsetName)
+	if has6 {
+		fmt.Fprintf(w, "ip6tables -C INPUT -m set --match-set %[1]s src -j DROP 2>/dev/null || ip6tables -I INPUT -m set --match-set %[1]s src -j DROP\n", ipset6Name)
+	}
+}
+
+// 创建文件并通过 write 写入内容
+func writeFileWith(path string, write func(w *bufio.Writer)) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	write(w)
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
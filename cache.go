@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 本地日志缓存的参数
+var cacheFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "cache-max-size",
+		Usage: tr("本地日志缓存（onlice-log 目录）的大小上限，如 50GB；超过时按最近使用时间删除最久未用的文件，默认不限制", "size limit of the local log cache (the onlice-log directory), e.g. 50GB; when exceeded, the least recently used files are deleted. Unlimited by default"),
+	},
+}
+
+// 缓存大小上限，0 表示不限制
+var cacheMaxSize int64
+
+func loadCacheConfig(c *cli.Context) error {
+	cacheMaxSize = 0
+	if s := c.String("cache-max-size"); s != "" {
+		size, err := parseSize(s)
+		if err != nil {
+			return fmt.Errorf(tr("--cache-max-size 格式错误: %w", "invalid --cache-max-size: %w"), err)
+		}
+		cacheMaxSize = size
+	}
+	return nil
+}
+
+// 记录缓存文件被使用：写入目录库，同时把修改时间更新为当前时间，供目录库不可用时使用（不依赖常被禁用的 atime）
+func touchLogFile(file string) {
+	now := time.Now()
+	os.Chtimes(file, now, now)
+	catalogUsed(file)
+}
+
+// 缓存超过 --cache-max-size 时删除最久未使用的文件；本次运行用到的文件 inUse 不会被删除
+func evictLogCache(inUse []string) error {
+	if cacheMaxSize <= 0 {
+		return nil
+	}
+	files := cachedLogs()
+	var total int64
+	for _, f := range files {
+		total += f.localSize
+	}
+	if total <= cacheMaxSize {
+		return nil
+	}
+
+	slices.SortFunc(files, func(a, b catalogEntry) int { return a.lastUsed.Compare(b.lastUsed) })
+	removed, freed := 0, int64(0)
+	for _, f := range files {
+		if total <= cacheMaxSize {
+			break
+		}
+		if slices.Contains(inUse, f.file) {
+			continue
+		}
+		if err := removeLogFile(f.file); err != nil {
+			return err
+		}
+		total -= f.localSize
+		removed++
+		freed += f.localSize
+	}
+	if removed > 0 {
+		fmt.Printf(tr("缓存清理: 删除 %d 个最久未使用的文件，释放 %s\n", "Cache eviction: removed %d least recently used files, freed %s\n"), removed, formatBytes(freed))
+	}
+	if total > cacheMaxSize {
+		fmt.Fprintf(os.Stderr, tr("警告: 本次用到的日志共 %s，超过 --cache-max-size %s\n", "Warning: the logs used by this run total %s, more than --cache-max-size %s\n"),
+			formatBytes(total), formatBytes(cacheMaxSize))
+	}
+	return nil
+}
+
+// 删除缓存的日志文件和它的目录库记录，并删除因此变空的日期分区目录
+func removeLogFile(file string) error {
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	catalogForget(file)
+	for dir := filepath.Dir(file); strings.HasPrefix(dir, logDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// 日志在缓存中的路径：按 <域名>/<年>/<月>/<日>/<文件名> 分区存放，文件名无法解析域名和日期时直接放在日志目录下
+func partitionedLogPath(name string) string {
+	domain, start, ok := parseLogFileName(name)
+	if !ok {
+		return filepath.Join(logDir, name)
+	}
+	return filepath.Join(logDir, domain, start.Format("2006"), start.Format("01"), start.Format("02"), name)
+}
+
+// 目录（含分区子目录）中的日志文件，跳过未下载完成的临时文件和目录库
+func walkLogFiles(dir string) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if filepath.Ext(name) == ".part" || name == catalogFile || filepath.Ext(name) == ".db-journal" || !d.Type().IsRegular() {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files
+}
+
+// 把旧版本平铺在日志目录下的文件移动到日期分区中，并更新目录库；每次运行只检查一次
+var migrateLogLayout = sync.OnceFunc(func() {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return
+	}
+	moved := make(map[string]string)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		old := filepath.Join(logDir, e.Name())
+		path := partitionedLogPath(e.Name())
+		if path == old {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 移动 %s 到日期分区失败: %v\n", "Warning: move %s into its date partition: %v\n"), old, err)
+			return
+		}
+		if err := os.Rename(old, path); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 移动 %s 到日期分区失败: %v\n", "Warning: move %s into its date partition: %v\n"), old, err)
+			continue
+		}
+		moved[old] = path
+	}
+	if len(moved) == 0 {
+		return
+	}
+	// 目录库不能在移动前打开：新建目录库时会导入目录中的文件
+	for old, path := range moved {
+		catalogExec(`UPDATE OR REPLACE logs SET file = ? WHERE file = ?`, path, old)
+	}
+	fmt.Printf(tr("已把 %d 个日志文件移动到 %s 的日期分区目录中\n", "Moved %d log files into date partitions under %s\n"), len(moved), logDir)
+})
+
+// CDN离线日志的文件名，如 example.com_2025_05_15_000000_010000.gz
+var logFileNameRe = regexp.MustCompile(`^(.+)_(\d{4}_\d{2}_\d{2})_(\d{4}(?:\d{2})?)_`)
+
+// 从日志文件名解析域名和开始时间，格式不符时返回 false
+func parseLogFileName(name string) (domain string, start time.Time, ok bool) {
+	m := logFileNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+	layout := "2006_01_02_1504"
+	if len(m[3]) == 6 {
+		layout = "2006_01_02_150405"
+	}
+	t, err := time.Parse(layout, m[2]+"_"+m[3])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return m[1], t, true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze cache：按URL统计回源流量和未命中率，找出命中率低的可缓存对象
+var cacheReportCommand = &cli.Command{
+	Name:  "cache",
+	Usage: tr("按URL统计未命中缓存的回源流量和未命中率，并列出命中率低的静态资源（如查询字符串不同导致无法命中）", "rank URLs by origin (cache miss) bytes and miss ratio, and list cacheable-looking objects with poor hit ratios (e.g. due to varying query strings)"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+		&cli.IntFlag{
+			Name:  "min-requests",
+			Value: 10,
+			Usage: tr("请求数至少为该值的对象才列为命中率低", "only report objects with at least this many requests as poorly cached"),
+		},
+		&cli.Float64Flag{
+			Name:  "min-miss-ratio",
+			Value: 50,
+			Usage: tr("未命中率（百分比）至少为该值的对象才列为命中率低", "only report objects whose miss ratio (percent) is at least this value as poorly cached"),
+		},
+	},
+	Action: runCacheReport,
+}
+
+// 通常可以长期缓存的静态资源扩展名
+var cacheableExts = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".map": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".avif": true, ".svg": true, ".ico": true, ".bmp": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	".mp4": true, ".webm": true, ".mov": true, ".flv": true, ".mp3": true, ".m4a": true, ".ogg": true, ".wav": true, ".ts": true, ".m4s": true,
+	".zip": true, ".gz": true, ".tgz": true, ".rar": true, ".7z": true, ".apk": true, ".ipa": true, ".exe": true, ".dmg": true, ".msi": true, ".bin": true,
+	".pdf": true, ".txt": true, ".wasm": true,
+}
+
+// 缓存报表的指标，命中率低的对象按 miss_bytes 排序
+const cacheMetrics = "miss_bytes,miss_ratio,count,bytes,distinct(query)"
+
+// 命中缓存的请求：hit_info 为 HIT，其余（MISS 等）都视为回源
+func cacheHit(rec *logRecord) bool {
+	return strings.EqualFold(rec.HitInfo, "HIT")
+}
+
+// 按扩展名判断路径是否像可缓存的静态资源
+func cacheableLooking(p string) bool {
+	return cacheableExts[strings.ToLower(path.Ext(p))]
+}
+
+func runCacheReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	urls, err := newGroupBy("cache", "host,path", cacheMetrics, c.String("filter"))
+	if err != nil {
+		return err
+	}
+	minRequests, minMissRatio := int64(c.Int("min-requests")), c.Float64("min-miss-ratio")
+	return runAggregates(c, []*groupBy{urls}, func(ctx context.Context) {
+		fixes, saved, total := cacheFixes(urls, minRequests, minMissRatio)
+		printCacheFixes(fixes, saved, total)
+		postAggregates = append(postAggregates, *fixes)
+	})
+}
+
+// 命中率低的可缓存对象，按回源流量从多到少；同时返回这些对象和全部对象的回源流量
+func cacheFixes(urls *groupBy, minRequests int64, minMissRatio float64) (fixes *result.Aggregate, saved, total int64) {
+	urls.mu.Lock()
+	defer urls.mu.Unlock()
+	fixes = &result.Aggregate{
+		Name:    "cache-fixes",
+		By:      []string{"host", "path", "cause"},
+		Metrics: []string{"miss_bytes", "miss_ratio", "count", "distinct(query)"},
+		Rows:    []result.AggregateRow{},
+	}
+	for _, v := range urls.groups {
+		// 与 cacheMetrics 的顺序一致
+		values := urls.values(v)
+		missBytes, missRatio, queries := values[0], values[1], values[4]
+		total += int64(missBytes)
+		if !cacheableLooking(v.keys[1]) || v.count < minRequests || missRatio < minMissRatio || hiddenGroup(v.count) {
+			continue
+		}
+		// 同一对象有多种查询字符串时，未命中多半是因为查询字符串不同（缓存键含查询字符串）
+		cause := "low-hit-ratio"
+		if queries > 1 {
+			cause = "query-string"
+		}
+		fixes.Rows = append(fixes.Rows, result.AggregateRow{Keys: []string{v.keys[0], v.keys[1], cause}, Values: []float64{missBytes, missRatio, float64(v.count), queries}})
+		fixes.Approximate = fixes.Approximate || v.distinct[4].approximate()
+		saved += int64(missBytes)
+	}
+	fixes.Groups = len(fixes.Rows)
+	if urls.pruned > 0 {
+		fixes.Approximate, fixes.ErrorBound = true, urls.pruned
+	}
+	sortAggregate(fixes)
+	limitAggregate(fixes)
+	return fixes, saved, total
+}
+
+// 在终端输出命中率低的可缓存对象及修复后最多可减少的回源流量
+func printCacheFixes(fixes *result.Aggregate, saved, total int64) {
+	if len(fixes.Rows) == 0 {
+		fmt.Print(tr("\n没有发现命中率低的可缓存对象\n", "\nNo cacheable-looking objects with poor hit ratios found\n"))
+		return
+	}
+	printAggregate(fixes)
+	fmt.Printf(tr("  改善这些对象的缓存最多可减少回源流量 %s（占全部回源流量的 %.1f%%）\n", "  Caching these objects better could save up to %s of origin traffic (%.1f%% of all cache misses)\n"),
+		formatBytes(saved), percentOf(saved, total))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// cache：管理本地日志缓存
+var cacheCommand = &cli.Command{
+	Name:  "cache",
+	Usage: tr("查看本地日志缓存（onlice-log 目录）", "inspect the local log cache (the onlice-log directory)"),
+	Subcommands: []*cli.Command{
+		{
+			Name:   "stats",
+			Usage:  tr("按域名和日期统计缓存的文件数、压缩和估算的解压后大小，以及缺少日志的小时", "per-domain, per-day file counts, compressed and estimated uncompressed sizes, and hours with no logs"),
+			Action: runCacheStats,
+		},
+	},
+}
+
+// 一个域名一天的缓存统计
+type cacheDayStats struct {
+	domain       string
+	day          time.Time
+	files        int
+	size         int64
+	uncompressed int64
+	hours        [24]bool
+	unscanned    int // 从未扫描过的文件
+	failed       int // 上次扫描出错或文件损坏
+}
+
+func runCacheStats(c *cli.Context) error {
+	if _, err := os.Stat(logDir); os.IsNotExist(err) {
+		fmt.Printf(tr("%s 目录不存在，没有缓存的日志\n", "%s does not exist, no cached logs\n"), logDir)
+		return nil
+	}
+
+	days := make(map[string]*cacheDayStats)
+	other, otherSize := 0, int64(0)
+	for _, e := range cachedLogs() {
+		if e.domain == "" || e.start.IsZero() {
+			other++
+			otherSize += e.localSize
+			continue
+		}
+		start := e.start.UTC()
+		day := start.Truncate(24 * time.Hour)
+		key := e.domain + "/" + day.Format(time.DateOnly)
+		s := days[key]
+		if s == nil {
+			s = &cacheDayStats{domain: e.domain, day: day}
+			days[key] = s
+		}
+		s.files++
+		s.size += e.localSize
+		s.uncompressed += gzipSize(e.file, e.localSize)
+		s.hours[start.Hour()] = true
+		switch e.scanStatus {
+		case scanError, scanCorrupt:
+			s.failed++
+		case "":
+			s.unscanned++
+		}
+	}
+
+	list := make([]*cacheDayStats, 0, len(days))
+	for _, s := range days {
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b *cacheDayStats) int {
+		return cmp.Or(strings.Compare(a.domain, b.domain), a.day.Compare(b.day))
+	})
+
+	var rows [][]string
+	var files int
+	var size, uncompressed int64
+	for _, s := range list {
+		rows = append(rows, []string{s.domain, s.day.Format(time.DateOnly), fmt.Sprint(s.files), formatBytes(s.size), formatBytes(s.uncompressed), fmt.Sprint(s.unscanned), fmt.Sprint(s.failed), formatHourGaps(s.hours)})
+		files += s.files
+		size += s.size
+		uncompressed += s.uncompressed
+	}
+	if len(rows) > 0 {
+		writeTable(os.Stdout, "", []string{"domain", "day", "files", "size", "uncompressed", "unscanned", "scan failed", "missing hours (UTC)"}, rows, []bool{false, false, true, true, true, true, true, false})
+	}
+	for _, gap := range missingDays(list) {
+		fmt.Printf(tr("%s 缺少日期: %s\n", "%s has no logs on: %s\n"), gap.domain, strings.Join(gap.days, ", "))
+	}
+	fmt.Printf(tr("共 %d 个日志文件，%s（解压后约 %s）\n", "%d log files, %s (about %s uncompressed)\n"), files, formatBytes(size), formatBytes(uncompressed))
+	if other > 0 {
+		fmt.Printf(tr("另有 %d 个无法识别域名和日期的文件，%s\n", "%d more files with unrecognized names, %s\n"), other, formatBytes(otherSize))
+	}
+	return nil
+}
+
+// 一个域名在最早和最晚缓存日期之间缺少的日期
+type dayGap struct {
+	domain string
+	days   []string
+}
+
+// 找出每个域名缓存日期之间缺少的日期，list 需已按域名和日期排序
+func missingDays(list []*cacheDayStats) []dayGap {
+	var gaps []dayGap
+	for i := 0; i < len(list); {
+		j := i
+		var days []string
+		for ; j+1 < len(list) && list[j+1].domain == list[i].domain; j++ {
+			for d := list[j].day.Add(24 * time.Hour); d.Before(list[j+1].day); d = d.Add(24 * time.Hour) {
+				days = append(days, d.Format(time.DateOnly))
+			}
+		}
+		if len(days) > 0 {
+			gaps = append(gaps, dayGap{domain: list[i].domain, days: days})
+		}
+		i = j + 1
+	}
+	return gaps
+}
+
+// 估算 gzip 文件解压后的大小：读取末尾记录的原始长度（对最后一个 member 有效，按 4GB 取模）；读取失败时返回压缩大小
+func gzipSize(path string, size int64) int64 {
+	if size < 18 {
+		return size
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return size
+	}
+	defer f.Close()
+	var trailer [4]byte
+	if _, err := f.ReadAt(trailer[:], size-4); err != nil && err != io.EOF {
+		return size
+	}
+	return int64(binary.LittleEndian.Uint32(trailer[:]))
+}
+
+// 一天中没有日志的小时，连续的小时合并为区间，如 03-05, 22；全部都有时为空
+func formatHourGaps(hours [24]bool) string {
+	var parts []string
+	for h := 0; h < 24; h++ {
+		if hours[h] {
+			continue
+		}
+		end := h
+		for end+1 < 24 && !hours[end+1] {
+			end++
+		}
+		if end == h {
+			parts = append(parts, fmt.Sprintf("%02d", h))
+		} else {
+			parts = append(parts, fmt.Sprintf("%02d-%02d", h, end))
+		}
+		h = end
+	}
+	return strings.Join(parts, ", ")
+}
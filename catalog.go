@@ -0,0 +1,211 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 日志目录中的 SQLite 目录库，记录每个日志文件的来源、大小、校验和、下载和扫描情况
+const catalogFile = "catalog.db"
+
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS logs (
+	file          TEXT PRIMARY KEY,
+	domain        TEXT NOT NULL DEFAULT '',
+	account       TEXT NOT NULL DEFAULT '',
+	url           TEXT NOT NULL DEFAULT '',
+	start_time    TEXT NOT NULL DEFAULT '',
+	end_time      TEXT NOT NULL DEFAULT '',
+	size          INTEGER NOT NULL DEFAULT 0,
+	local_size    INTEGER NOT NULL DEFAULT 0,
+	checksum      TEXT NOT NULL DEFAULT '',
+	downloaded_at TEXT NOT NULL DEFAULT '',
+	last_used     TEXT NOT NULL DEFAULT '',
+	scanned_at    TEXT NOT NULL DEFAULT '',
+	scan_status   TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS logs_domain_start ON logs (domain, start_time);
+`
+
+// 目录库中的一个日志文件；时间为零值、大小为0表示未知
+type catalogEntry struct {
+	file         string
+	domain       string
+	account      string
+	url          string
+	start        time.Time
+	end          time.Time
+	size         int64
+	localSize    int64
+	checksum     string
+	downloadedAt time.Time
+	lastUsed     time.Time
+	scannedAt    time.Time
+	scanStatus   string
+}
+
+// 扫描状态
+const (
+	scanOK      = "ok"
+	scanError   = "error"
+	scanCorrupt = "corrupt"
+)
+
+// 打开目录库，首次创建时导入日志目录中已有的文件；打开失败（如未启用 cgo 编译）时为 nil，各功能退回到扫描目录
+var catalog = sync.OnceValue(func() *sql.DB {
+	db, err := openCatalog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 无法打开日志目录库，改为扫描目录: %v\n", "Warning: cannot open the log catalog, falling back to directory scans: %v\n"), err)
+		return nil
+	}
+	return db
+})
+
+func openCatalog() (*sql.DB, error) {
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(logDir, catalogFile)
+	_, statErr := os.Stat(path)
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 同一时间只允许一个写入者，下载协程共用一个连接
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(catalogSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if errors.Is(statErr, os.ErrNotExist) {
+		importCachedLogs(db)
+	}
+	return db, nil
+}
+
+// 把日志目录中已有的文件导入新建的目录库，域名和时间从文件名解析
+func importCachedLogs(db *sql.DB) {
+	for _, e := range scanLogDir() {
+		// 下载时间未知，用文件的修改时间代替
+		db.Exec(`INSERT OR IGNORE INTO logs (file, domain, start_time, local_size, downloaded_at, last_used) VALUES (?, ?, ?, ?, ?, ?)`,
+			e.file, e.domain, formatCatalogTime(e.start), e.localSize, formatCatalogTime(e.lastUsed), formatCatalogTime(e.lastUsed))
+	}
+}
+
+// 扫描日志目录（含日期分区）得到缓存的文件，目录库不可用时使用
+func scanLogDir() []catalogEntry {
+	var list []catalogEntry
+	for _, file := range walkLogFiles(logDir) {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		entry := catalogEntry{file: file, localSize: info.Size(), downloadedAt: info.ModTime(), lastUsed: info.ModTime()}
+		entry.domain, entry.start, _ = parseLogFileName(filepath.Base(file))
+		list = append(list, entry)
+	}
+	return list
+}
+
+// 本地缓存中的日志文件：来自目录库（去掉已被手动删除的文件），目录库不可用时扫描目录
+func cachedLogs() []catalogEntry {
+	migrateLogLayout()
+	db := catalog()
+	if db == nil {
+		return scanLogDir()
+	}
+	rows, err := db.Query(`SELECT file, domain, account, url, start_time, end_time, size, local_size, checksum, downloaded_at, last_used, scanned_at, scan_status FROM logs WHERE downloaded_at != ''`)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 读取日志目录库失败，改为扫描目录: %v\n", "Warning: read log catalog failed, falling back to a directory scan: %v\n"), err)
+		return scanLogDir()
+	}
+	defer rows.Close()
+	var list []catalogEntry
+	var gone []string
+	for rows.Next() {
+		var e catalogEntry
+		var start, end, downloaded, used, scanned string
+		if err := rows.Scan(&e.file, &e.domain, &e.account, &e.url, &start, &end, &e.size, &e.localSize, &e.checksum, &downloaded, &used, &scanned, &e.scanStatus); err != nil {
+			continue
+		}
+		if _, err := os.Stat(e.file); err != nil {
+			gone = append(gone, e.file)
+			continue
+		}
+		e.start, e.end = parseCatalogTime(start), parseCatalogTime(end)
+		e.downloadedAt, e.lastUsed, e.scannedAt = parseCatalogTime(downloaded), parseCatalogTime(used), parseCatalogTime(scanned)
+		list = append(list, e)
+	}
+	rows.Close()
+	for _, file := range gone {
+		catalogForget(file)
+	}
+	return list
+}
+
+// 记录API返回的日志文件（下载前），已有的记录只更新来源信息
+func catalogListing(account, domain string, files []logFile) {
+	db := catalog()
+	if db == nil {
+		return
+	}
+	for _, f := range files {
+		db.Exec(`INSERT INTO logs (file, domain, account, url, start_time, end_time, size) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (file) DO UPDATE SET domain = excluded.domain, account = excluded.account, url = excluded.url,
+				start_time = excluded.start_time, end_time = excluded.end_time, size = excluded.size`,
+			localLogPath(f.URL), domain, account, f.URL, formatCatalogTime(f.Start), formatCatalogTime(f.End), f.Size)
+	}
+}
+
+// 记录一次完成的下载
+func catalogDownloaded(file, url string, size int64, checksum string) {
+	now := formatCatalogTime(time.Now())
+	catalogExec(`INSERT INTO logs (file, url, local_size, checksum, downloaded_at, last_used, scan_status) VALUES (?, ?, ?, ?, ?, ?, '')
+		ON CONFLICT (file) DO UPDATE SET url = excluded.url, local_size = excluded.local_size, checksum = excluded.checksum,
+			downloaded_at = excluded.downloaded_at, last_used = excluded.last_used, scan_status = ''`,
+		file, url, size, checksum, now, now)
+}
+
+// 记录缓存文件被使用，作为 LRU 淘汰的依据
+func catalogUsed(file string) {
+	catalogExec(`UPDATE logs SET last_used = ? WHERE file = ?`, formatCatalogTime(time.Now()), file)
+}
+
+// 记录文件的扫描结果
+func catalogScanned(file, status string) {
+	catalogExec(`UPDATE logs SET scanned_at = ?, scan_status = ? WHERE file = ?`, formatCatalogTime(time.Now()), status, file)
+}
+
+// 文件被删除后移除记录
+func catalogForget(file string) {
+	catalogExec(`DELETE FROM logs WHERE file = ?`, file)
+}
+
+func catalogExec(query string, args ...any) {
+	db := catalog()
+	if db == nil {
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 更新日志目录库失败: %v\n", "Warning: update log catalog failed: %v\n"), err)
+	}
+}
+
+func formatCatalogTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseCatalogTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
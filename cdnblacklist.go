@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"example.com/mod/result"
+	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CDN域名配置中IP黑名单的功能名和参数名
+const (
+	blackListFunction = "ip_black_list_set"
+	blackListArg      = "ip_list"
+)
+
+// 域名当前的IP黑名单配置
+type cdnBlackList struct {
+	configID string
+	entries  []string
+}
+
+// 将规则告警中的IP追加到域名的IP黑名单：先输出配置变更，confirm 为 true 时才调用API修改
+func pushBlackList(ctx context.Context, findings []result.Finding, confirm bool) (err error) {
+	_, span := startSpan(ctx, "push-blacklist", attribute.String("cdn.domain", config.domainName))
+	defer func() { endSpan(span, err) }()
+
+	client, err := createClient()
+	if err != nil {
+		return err
+	}
+	current, err := describeBlackList(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	// 已在黑名单中的地址（包括被已有网段覆盖的）不再追加
+	var added []blockEntry
+	for _, e := range offendingIPs(findings, blocklistConfig.severity, blocklistConfig.cidrMin) {
+		if !blackListCovers(current.entries, e.prefix) {
+			added = append(added, e)
+		}
+	}
+	span.SetAttributes(attribute.Int("blacklist.current", len(current.entries)), attribute.Int("blacklist.added", len(added)))
+
+	fmt.Printf(tr("\n域名 %s 的IP黑名单 (%s):\n", "\nIP blacklist of domain %s (%s):\n"), config.domainName, blackListFunction)
+	fmt.Printf(tr("  当前: %d 项\n", "  current: %d entries\n"), len(current.entries))
+	for _, e := range added {
+		fmt.Printf("  + %-40s # %s\n", prefixString(e.prefix), strings.Join(e.rules, ","))
+	}
+	fmt.Printf(tr("  变更后: %d 项 (新增 %d)\n", "  after: %d entries (%d added)\n"), len(current.entries)+len(added), len(added))
+
+	if len(added) == 0 {
+		fmt.Print(tr("黑名单无需修改\n", "Blacklist is already up to date\n"))
+		return nil
+	}
+	if !confirm {
+		fmt.Print(tr("未指定 --confirm，以上为预览，未修改域名配置\n", "--confirm not given: dry run only, domain config not changed\n"))
+		return nil
+	}
+
+	list := slices.Clone(current.entries)
+	for _, e := range added {
+		list = append(list, prefixString(e.prefix))
+	}
+	if err := setBlackList(ctx, client, current.configID, list); err != nil {
+		return err
+	}
+	fmt.Printf(tr("已更新域名 %s 的IP黑名单\n", "Updated the IP blacklist of domain %s\n"), config.domainName)
+	return nil
+}
+
+// 查询域名当前的IP黑名单
+func describeBlackList(ctx context.Context, client *cdn20180510.Client) (*cdnBlackList, error) {
+	var resp *cdn20180510.DescribeCdnDomainConfigsResponse
+	err := withAPIRetry(ctx, "DescribeCdnDomainConfigs", func() (err error) {
+		resp, err = client.DescribeCdnDomainConfigsWithOptions(&cdn20180510.DescribeCdnDomainConfigsRequest{
+			DomainName:    tea.String(config.domainName),
+			FunctionNames: tea.String(blackListFunction),
+		}, &util.RuntimeOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf(tr("查询域名配置失败: %w", "describe domain config: %w"), err)
+	}
+
+	current := &cdnBlackList{}
+	if resp.Body == nil || resp.Body.DomainConfigs == nil {
+		return current, nil
+	}
+	for _, cfg := range resp.Body.DomainConfigs.DomainConfig {
+		if tea.StringValue(cfg.FunctionName) != blackListFunction || cfg.FunctionArgs == nil {
+			continue
+		}
+		current.configID = tea.StringValue(cfg.ConfigId)
+		for _, arg := range cfg.FunctionArgs.FunctionArg {
+			if tea.StringValue(arg.ArgName) != blackListArg {
+				continue
+			}
+			for _, ip := range strings.Split(tea.StringValue(arg.ArgValue), ",") {
+				if ip = strings.TrimSpace(ip); ip != "" {
+					current.entries = append(current.entries, ip)
+				}
+			}
+		}
+	}
+	return current, nil
+}
+
+// 黑名单中是否已有覆盖 p 的地址或网段
+func blackListCovers(entries []string, p netip.Prefix) bool {
+	for _, s := range entries {
+		existing, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				continue
+			}
+			existing = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if existing.Bits() <= p.Bits() && existing.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// 设置域名的IP黑名单，configID 不为空时修改已有配置
+func setBlackList(ctx context.Context, client *cdn20180510.Client, configID string, list []string) error {
+	function := map[string]any{
+		"functionName": blackListFunction,
+		"functionArgs": []map[string]string{{"argName": blackListArg, "argValue": strings.Join(list, ",")}},
+	}
+	if configID != "" {
+		id, err := strconv.ParseInt(configID, 10, 64)
+		if err != nil {
+			return fmt.Errorf(tr("无效的配置ID %q", "invalid config ID %q"), configID)
+		}
+		function["configId"] = id
+	}
+	functions, err := json.Marshal([]any{function})
+	if err != nil {
+		return err
+	}
+
+	err = withAPIRetry(ctx, "BatchSetCdnDomainConfig", func() error {
+		_, err := client.BatchSetCdnDomainConfigWithOptions(&cdn20180510.BatchSetCdnDomainConfigRequest{
+			DomainNames: tea.String(config.domainName),
+			Functions:   tea.String(string(functions)),
+		}, &util.RuntimeOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf(tr("修改域名配置失败: %w", "update domain config: %w"), err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 终端图表的参数
+var chartFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "chart",
+		Usage: tr("在终端输出请求数分布和排行的条形图: unicode 或 ascii", "print bar charts of requests over time and top groups in the terminal: unicode or ascii"),
+	},
+	&cli.DurationFlag{
+		Name:  "chart-interval",
+		Value: time.Hour,
+		Usage: tr("请求数分布图每一行的时间段", "time span of each row in the requests-over-time chart"),
+	},
+}
+
+// 图表配置，style 为空表示不输出图表
+var chartConfig struct {
+	style    string
+	interval time.Duration
+}
+
+// 条形的最大宽度（字符数）
+const chartWidth = 50
+
+// unicode 条形末尾的 1/8 到 7/8 宽度的方块
+var chartEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// 读取图表参数，需要在 loadCrossCheckConfig 之后调用以复用其流量统计
+func loadChartConfig(c *cli.Context) error {
+	chartConfig.style = c.String("chart")
+	chartConfig.interval = c.Duration("chart-interval")
+	switch chartConfig.style {
+	case "":
+		return nil
+	case "unicode", "ascii":
+	default:
+		return fmt.Errorf(tr("不支持的图表样式 %q，可选 unicode 或 ascii", "unsupported chart style %q, use unicode or ascii"), chartConfig.style)
+	}
+	if chartConfig.interval <= 0 {
+		return fmt.Errorf(tr("无效的图表时间段 %s", "invalid chart interval %s"), chartConfig.interval)
+	}
+	if trafficCounter == nil {
+		trafficCounter = newTraffic(chartConfig.interval)
+	} else if chartConfig.interval%trafficCounter.interval != 0 {
+		return errors.New(tr("--chart-interval 必须是 --cross-check-interval 的整数倍", "--chart-interval must be a multiple of --cross-check-interval"))
+	}
+	return nil
+}
+
+// 输出时间范围内每个时间段的请求数分布图
+func printRequestChart() {
+	if chartConfig.style == "" {
+		return
+	}
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return
+	}
+	var labels []string
+	var values []float64
+	scale := lineSampler.scale()
+	for t := start.Truncate(chartConfig.interval); t.Before(end); t = t.Add(chartConfig.interval) {
+		labels = append(labels, t.Local().Format("01-02 15:04"))
+		values = append(values, float64(trafficCounter.sum(t, chartConfig.interval).requests)*scale)
+	}
+	fmt.Printf(tr("\n请求数分布 (每 %s):\n", "\nRequests over time (per %s):\n"), chartConfig.interval)
+	printBarChart(labels, values, formatNumber)
+}
+
+// 输出条形图：每行为标签、条形和数值，条形长度按最大值缩放
+func printBarChart(labels []string, values []float64, format func(float64) string) {
+	labelWidth, peak := 0, 0.0
+	for i, l := range labels {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(l))
+		peak = max(peak, values[i])
+	}
+	axis := "│"
+	if chartConfig.style == "ascii" {
+		axis = "|"
+	}
+	for i, l := range labels {
+		pad := strings.Repeat(" ", labelWidth-utf8.RuneCountInString(l))
+		fmt.Printf("  %s%s %s%s %s\n", l, pad, axis, chartBar(values[i], peak), format(values[i]))
+	}
+}
+
+// 长度与 v/peak 成比例的条形
+func chartBar(v, peak float64) string {
+	if peak <= 0 || v <= 0 {
+		return ""
+	}
+	if chartConfig.style == "ascii" {
+		return strings.Repeat("#", int(math.Round(v/peak*chartWidth)))
+	}
+	eighths := int(math.Round(v / peak * chartWidth * 8))
+	return strings.Repeat("█", eighths/8) + chartEighths[eighths%8]
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 单个分块的目标大小，实际分块会延伸到下一个换行符
+const chunkSize = 4 * 1024 * 1024
+
+// 待搜索的分块
+type chunk struct {
+	index int
+	data  []byte
+}
+
+// 分块的搜索结果
+type chunkResult struct {
+	index   int
+	matches []string
+	count   int
+	scan    *scanState
+}
+
+// 将单个文件切分为按行对齐的分块，由多个协程并行搜索
+// 命中行按原始行顺序返回，countOnly 时只统计命中数，limit 为单文件命中数上限；
+// 各分块的统计按分块顺序返回，由调用方在整个文件扫描成功后合并
+func searchInChunks(ctx context.Context, reader io.Reader, workers int, countOnly bool, limit int) (*fileResult, []*scanState, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan chunk, workers)
+	results := make(chan chunkResult, workers)
+
+	// 已找到的命中数超过上限后不再读取新的分块
+	var found atomic.Int64
+	// 启用了全量统计（检测规则等）时需要读完全部数据
+	stop := func() bool {
+		return !analysisEnabled() && (limit > 0 && found.Load() > int64(limit) || globalBudget.exhausted())
+	}
+
+	// 读取协程：按行边界切分数据
+	var readErr error
+	go func() {
+		defer close(chunks)
+		readErr = readChunks(ctx, reader, chunks, stop)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				matches, count, scan := searchChunk(c.data, countOnly)
+				found.Add(int64(count))
+				results <- chunkResult{index: c.index, matches: matches, count: count, scan: scan}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var collected []chunkResult
+	for res := range results {
+		collected = append(collected, res)
+	}
+
+	// results 关闭时读取协程已经退出，readErr 可以安全读取
+	if readErr != nil {
+		return nil, nil, readErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// 按分块序号合并结果，超出上限的部分截断
+	sort.Slice(collected, func(i, j int) bool { return collected[i].index < collected[j].index })
+	scans := make([]*scanState, len(collected))
+	for i, res := range collected {
+		scans[i] = res.scan
+	}
+	result := &fileResult{}
+	for _, res := range collected {
+		if res.count == 0 {
+			continue
+		}
+		n := res.count
+		if limit > 0 && result.matches+n > limit {
+			n = limit - result.matches
+		}
+		if granted := globalBudget.takeN(n); granted < n {
+			n = granted
+		}
+		if n < res.count {
+			result.truncated = true
+		}
+		result.matches += n
+		if !countOnly {
+			for _, line := range res.matches[:n] {
+				result.addLine(line, true)
+			}
+		}
+		if result.truncated {
+			break
+		}
+	}
+	return result, scans, nil
+}
+
+// 从reader中读取按行对齐的分块
+// stop 返回 true 时提前结束读取
+func readChunks(ctx context.Context, reader io.Reader, chunks chan<- chunk, stop func() bool) error {
+	br := bufio.NewReaderSize(reader, chunkSize)
+	for index := 0; !stop(); index++ {
+		buf := make([]byte, chunkSize)
+		n, err := readFull(br, buf)
+		buf = buf[:n]
+		if err == nil {
+			// 补齐到下一个换行符，保证分块不截断行
+			rest, restErr := br.ReadBytes('\n')
+			buf = append(buf, rest...)
+			if restErr == io.EOF {
+				err = io.EOF
+			} else if restErr != nil {
+				return restErr
+			}
+		} else if err != io.EOF {
+			return err
+		}
+
+		if len(buf) > 0 {
+			select {
+			case chunks <- chunk{index: index, data: buf}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 读满buf或遇到错误为止，与io.ReadFull不同，底层的ErrUnexpectedEOF（如gzip截断）会原样返回
+func readFull(r io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// 在单个分块中逐行匹配，返回命中行（countOnly 时不保留）、命中数和该分块的统计
+func searchChunk(data []byte, countOnly bool) ([]string, int, *scanState) {
+	var matches []string
+	count := 0
+	sample := lineSampler.newState()
+	scan := newScanState()
+	for len(data) > 0 {
+		scan.lines++
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		if !sample.keep() {
+			continue
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		s := string(line)
+		matched := matchLine(s)
+		s = anonymizeLine(s)
+		scan.observe(s, matched)
+		if matched {
+			count++
+			if !countOnly {
+				matches = append(matches, s)
+			}
+		}
+	}
+	return matches, count, scan
+}
@@ -0,0 +1,98 @@
+package main
+
+// 上下文分组之间的分隔符，与grep一致
+const contextSeparator = "--"
+
+// 按grep -A/-B/-C的方式收集命中行及其前后的上下文行
+type contextCollector struct {
+	result *fileResult
+	before int
+	after  int
+	// 只统计命中数，不保留任何行
+	countOnly bool
+	// 单个文件的命中数上限，0 表示不限制
+	limit int
+
+	// 最近的before行，环形缓冲
+	prev     []string
+	prevNext int
+	prevLen  int
+
+	// 剩余需要输出的after行数
+	afterLeft int
+	// 当前行号与最后输出的行号，用于判断是否需要分隔符
+	lineNo  int
+	lastOut int
+}
+
+func newContextCollector(result *fileResult, before, after int, countOnly bool, limit int) *contextCollector {
+	if countOnly {
+		before, after = 0, 0
+	}
+	c := &contextCollector{result: result, before: before, after: after, countOnly: countOnly, limit: limit}
+	if before > 0 {
+		c.prev = make([]string, before)
+	}
+	return c
+}
+
+// 处理一行，matched 表示该行命中搜索条件
+// 超出单文件或全局命中数上限时标记截断并返回 false，调用方应停止扫描
+func (c *contextCollector) add(line string, matched bool) bool {
+	c.lineNo++
+
+	if matched {
+		if c.limit > 0 && c.result.matches >= c.limit || !globalBudget.take() {
+			c.result.truncated = true
+			return false
+		}
+
+		c.result.matches++
+		if c.countOnly {
+			return true
+		}
+		if c.before == 0 && c.after == 0 {
+			c.result.addLine(line, true)
+			return true
+		}
+
+		// 与上一组不连续时插入分隔符
+		first := c.lineNo - c.prevLen
+		if c.lastOut > 0 && first > c.lastOut+1 {
+			c.result.addLine(contextSeparator, false)
+		}
+		c.flushBefore()
+		c.emit(line, true)
+		c.afterLeft = c.after
+		return true
+	}
+
+	if c.afterLeft > 0 {
+		c.afterLeft--
+		c.emit(line, false)
+		return true
+	}
+
+	if c.before > 0 {
+		c.prev[c.prevNext] = line
+		c.prevNext = (c.prevNext + 1) % c.before
+		if c.prevLen < c.before {
+			c.prevLen++
+		}
+	}
+	return true
+}
+
+// 输出缓冲中的before行
+func (c *contextCollector) flushBefore() {
+	start := (c.prevNext - c.prevLen + c.before) % max(c.before, 1)
+	for i := 0; i < c.prevLen; i++ {
+		c.result.addLine(c.prev[(start+i)%c.before], false)
+	}
+	c.prevLen = 0
+}
+
+func (c *contextCollector) emit(line string, match bool) {
+	c.result.addLine(line, match)
+	c.lastOut = c.lineNo
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze crawl：已验证的搜索引擎爬虫的抓取预算花在了哪里
+var crawlCommand = &cli.Command{
+	Name:  "crawl",
+	Usage: tr("只统计通过反向DNS验证的搜索引擎爬虫：按目录的抓取量、返回的状态码，以及带参数和重复的URL", "for search engine crawlers verified by reverse DNS only: crawl volume per directory, status codes served, and parameterized and duplicate URLs"),
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "depth",
+			Value: 2,
+			Usage: tr("按目录统计时目录的级数", "number of leading directories when aggregating by directory"),
+		},
+		&cli.IntFlag{
+			Name:  "verify-limit",
+			Value: 1000,
+			Usage: tr("通过反向DNS验证的IP数上限（按请求数从多到少），未验证的IP不计入报表", "maximum number of IPs to verify with reverse DNS (most requests first); unverified IPs are left out of the reports"),
+		},
+	},
+	Action: runCrawlReport,
+}
+
+func runCrawlReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	depth, limit := c.Int("depth"), c.Int("verify-limit")
+	if depth < 1 {
+		return errors.New(tr("--depth 至少为1", "--depth must be at least 1"))
+	}
+	if limit < 1 {
+		return errors.New(tr("--verify-limit 至少为1", "--verify-limit must be at least 1"))
+	}
+
+	// 按爬虫和IP分别统计，验证IP后只汇总通过验证的IP；第三个分组字段为各报表的维度
+	dir := dirField(depth)
+	parameterized := fieldExpr{name: "parameterized", get: func(r *logRecord) exprValue {
+		if _, _, query := splitURL(r.URL); query != "" {
+			return stringValue("yes")
+		}
+		return stringValue("no")
+	}}
+	var reports []*groupBy
+	for _, r := range []struct {
+		name, by, metrics string
+		field             *fieldExpr
+	}{
+		{"crawler-ips", "crawler,client_ip", "count", nil},
+		{"crawl-sections", "crawler,client_ip,path", "count,bytes,distinct(url)", &dir},
+		{"crawl-status", "crawler,client_ip,status", "count,share", nil},
+		{"crawl-urls", "crawler,client_ip,query", "count,distinct(url),distinct(path)", &parameterized},
+	} {
+		g, err := newGroupBy(r.name, r.by, r.metrics, "")
+		if err != nil {
+			return err
+		}
+		g.filter = verifiableCrawlerExpr{}
+		g.hidden = true
+		if r.field != nil {
+			g.by[2] = *r.field
+		}
+		reports = append(reports, g)
+	}
+
+	return runAggregates(c, reports, func(ctx context.Context) {
+		verified := verifyCrawlerIPs(ctx, reports[0].aggregate(), limit)
+		printVerification(verified)
+		postAggregates = append(postAggregates, *verified)
+		ips := make(map[string]bool)
+		for _, row := range verified.Rows {
+			if row.Keys[3] == verifiedYes {
+				ips[row.Keys[1]] = true
+			}
+		}
+		if len(ips) == 0 {
+			fmt.Print(tr("\n没有通过验证的爬虫IP\n", "\nNo verified crawler IPs\n"))
+		}
+		for _, g := range reports[1:] {
+			agg := rollupVerified(g, ips)
+			if len(agg.Rows) > 0 {
+				printAggregate(agg)
+			}
+			postAggregates = append(postAggregates, *agg)
+		}
+	})
+}
+
+// 只保留 client_ip（第二个分组字段）在 ips 中的分组，并去掉 client_ip 后汇总
+func rollupVerified(g *groupBy, ips map[string]bool) *result.Aggregate {
+	out := &groupBy{name: g.name, by: slices.Delete(slices.Clone(g.by), 1, 2), metrics: g.metrics, groups: make(map[string]*groupValues)}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, v := range g.groups {
+		if !ips[v.keys[1]] {
+			continue
+		}
+		keys := slices.Delete(slices.Clone(v.keys), 1, 2)
+		key := strings.Join(keys, "\x00")
+		o := out.groups[key]
+		if o == nil {
+			o = out.newValues(keys)
+			out.groups[key] = o
+		}
+		out.mergeValues(o, v)
+		out.total += v.count
+	}
+	out.pruned = g.pruned
+	return out.aggregate()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 内置的爬虫特征库
+//
+//go:embed crawlers.yaml
+var defaultCrawlerSignatures []byte
+
+// 爬虫特征库的参数
+var crawlerFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "signatures",
+		Usage: tr("爬虫特征库文件或URL，格式同内置的 crawlers.yaml，默认使用内置列表", "crawler signature file or URL in the format of the built-in crawlers.yaml; the built-in list is used by default"),
+	},
+}
+
+// analyze bots：按爬虫统计流量，并通过反向解析验证声称为搜索引擎爬虫的IP
+var botsCommand = &cli.Command{
+	Name:  "bots",
+	Usage: tr("按已知爬虫和监控程序统计流量，并验证搜索引擎爬虫IP的真伪", "break down traffic by known crawlers and monitors, verifying the IPs of search engine crawlers"),
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "verify-limit",
+			Value: 100,
+			Usage: tr("通过反向DNS验证的IP数上限（按请求数从多到少），0 表示不验证", "maximum number of IPs to verify with reverse DNS (most requests first); 0 disables verification"),
+		},
+	},
+	Action: runBotReport,
+}
+
+// 一条爬虫特征
+type crawlerSignature struct {
+	Name          string   `yaml:"name"`
+	Category      string   `yaml:"category"`
+	Pattern       string   `yaml:"pattern"`
+	VerifyDomains []string `yaml:"verify_domains"`
+
+	re *regexp.Regexp
+}
+
+// 当前使用的特征库及按 User-Agent 的匹配缓存；list 为 nil 时首次匹配前加载内置列表
+var crawlerDB struct {
+	mu    sync.Mutex
+	list  []*crawlerSignature
+	cache map[string]*crawlerSignature
+}
+
+// 加载 --signatures 指定的特征库，spec 为空时使用内置列表
+func loadCrawlerSignatures(ctx context.Context, spec string) error {
+	data := defaultCrawlerSignatures
+	if spec != "" {
+		var err error
+		if data, err = readFileOrURL(ctx, spec); err != nil {
+			return fmt.Errorf(tr("读取爬虫特征库失败: %w", "read crawler signatures: %w"), err)
+		}
+	}
+	list, err := parseCrawlerSignatures(data)
+	if err != nil {
+		return fmt.Errorf(tr("解析爬虫特征库 %s 失败: %w", "parse crawler signatures %s: %w"), spec, err)
+	}
+	crawlerDB.mu.Lock()
+	crawlerDB.list, crawlerDB.cache = list, nil
+	crawlerDB.mu.Unlock()
+	return nil
+}
+
+// 从文件或 http(s) URL 读取特征库、情报源等数据
+func readFileOrURL(ctx context.Context, spec string) ([]byte, error) {
+	if !strings.HasPrefix(spec, "http://") && !strings.HasPrefix(spec, "https://") {
+		return os.ReadFile(spec)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(tr("HTTP错误: %s", "HTTP error: %s"), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func parseCrawlerSignatures(data []byte) ([]*crawlerSignature, error) {
+	var file struct {
+		Crawlers []*crawlerSignature `yaml:"crawlers"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Crawlers) == 0 {
+		return nil, errors.New(tr("没有爬虫特征", "no crawler signatures"))
+	}
+	for _, s := range file.Crawlers {
+		if s.Name == "" || s.Pattern == "" {
+			return nil, errors.New(tr("每条特征都需要 name 和 pattern", "every signature needs a name and a pattern"))
+		}
+		re, err := regexp.Compile("(?i)" + s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf(tr("%s 的正则表达式无效: %w", "invalid pattern for %s: %w"), s.Name, err)
+		}
+		s.re = re
+	}
+	return file.Crawlers, nil
+}
+
+// 匹配 User-Agent 对应的爬虫，不是已知爬虫时返回 nil
+func matchCrawler(ua string) *crawlerSignature {
+	crawlerDB.mu.Lock()
+	defer crawlerDB.mu.Unlock()
+	if crawlerDB.list == nil {
+		// 内置列表在编译时已确定，解析失败属于程序错误
+		list, err := parseCrawlerSignatures(defaultCrawlerSignatures)
+		if err != nil {
+			panic(err)
+		}
+		crawlerDB.list = list
+	}
+	if s, ok := crawlerDB.cache[ua]; ok {
+		return s
+	}
+	var match *crawlerSignature
+	for _, s := range crawlerDB.list {
+		if s.re.MatchString(ua) {
+			match = s
+			break
+		}
+	}
+	if crawlerDB.cache == nil || len(crawlerDB.cache) >= userAgentCacheSize {
+		crawlerDB.cache = make(map[string]*crawlerSignature)
+	}
+	crawlerDB.cache[ua] = match
+	return match
+}
+
+// crawler 和 crawler_category 字段使用的特征，不是已知爬虫时为空特征
+func crawlerField(ua string) crawlerSignature {
+	if s := matchCrawler(ua); s != nil {
+		return *s
+	}
+	return crawlerSignature{}
+}
+
+// 内部使用的过滤条件：User-Agent 为需要验证IP的爬虫
+type verifiableCrawlerExpr struct{}
+
+func (verifiableCrawlerExpr) eval(rec *logRecord) exprValue {
+	s := matchCrawler(rec.UserAgent)
+	return boolValue(s != nil && len(s.VerifyDomains) > 0)
+}
+
+func runBotReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	bots, err := newGroupBy("crawler", "crawler_category,crawler", "count,share,bytes,distinct(client_ip)", `crawler != ""`)
+	if err != nil {
+		return err
+	}
+	reports := []*groupBy{bots}
+
+	limit := c.Int("verify-limit")
+	if limit <= 0 {
+		return runAggregates(c, reports, nil)
+	}
+	ips, err := newGroupBy("crawler-ips", "crawler,client_ip", "count", "")
+	if err != nil {
+		return err
+	}
+	ips.filter = verifiableCrawlerExpr{}
+	ips.hidden = true
+	return runAggregates(c, append(reports, ips), func(ctx context.Context) {
+		verified := verifyCrawlerIPs(ctx, ips.aggregate(), limit)
+		printVerification(verified)
+		postAggregates = append(postAggregates, *verified)
+	})
+}
+
+// 对请求数最多的 limit 个爬虫IP做反向解析验证
+func verifyCrawlerIPs(ctx context.Context, ips *result.Aggregate, limit int) *result.Aggregate {
+	rows := ips.Rows
+	slices.SortStableFunc(rows, func(a, b result.AggregateRow) int { return compareFloat(b.Values[0], a.Values[0]) })
+	rows = rows[:min(len(rows), limit)]
+
+	domains := make(map[string][]string)
+	crawlerDB.mu.Lock()
+	for _, s := range crawlerDB.list {
+		domains[s.Name] = s.VerifyDomains
+	}
+	crawlerDB.mu.Unlock()
+
+	if len(rows) > 0 {
+		fmt.Printf(tr("\n正在通过反向DNS验证 %d 个爬虫IP...\n", "\nVerifying %d crawler IPs with reverse DNS...\n"), len(rows))
+	}
+	agg := &result.Aggregate{
+		Name:    "crawler-verify",
+		By:      []string{"crawler", "client_ip", "hostname", "verified"},
+		Metrics: []string{"count"},
+		Groups:  len(ips.Rows),
+		Rows:    make([]result.AggregateRow, len(rows)),
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, rdnsWorkers)
+	for i, row := range rows {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			crawler, ip := row.Keys[0], row.Keys[1]
+			host, status := verifyHost(ctx, ip, domains[crawler])
+			agg.Rows[i] = result.AggregateRow{Keys: []string{crawler, ip, host, status}, Values: row.Values}
+		}()
+	}
+	wg.Wait()
+	return agg
+}
+
+// 验证结果汇总和未通过验证的IP
+func printVerification(agg *result.Aggregate) {
+	type summary struct{ verified, fake, failed int }
+	byCrawler := make(map[string]*summary)
+	var names []string
+	for _, row := range agg.Rows {
+		s := byCrawler[row.Keys[0]]
+		if s == nil {
+			s = &summary{}
+			byCrawler[row.Keys[0]] = s
+			names = append(names, row.Keys[0])
+		}
+		switch row.Keys[3] {
+		case verifiedYes:
+			s.verified++
+		case verifiedNo:
+			s.fake++
+		default:
+			s.failed++
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		s := byCrawler[name]
+		fmt.Printf(tr("  %s: %d 个IP验证通过，%d 个为冒充，%d 个解析失败\n", "  %s: %d IPs verified, %d fake, %d lookups failed\n"), name, s.verified, s.fake, s.failed)
+	}
+
+	fake := &result.Aggregate{Name: agg.Name, By: agg.By, Metrics: agg.Metrics}
+	for _, row := range agg.Rows {
+		if row.Keys[3] != verifiedYes {
+			fake.Rows = append(fake.Rows, row)
+		}
+	}
+	fake.Groups = len(fake.Rows)
+	if len(fake.Rows) > 0 {
+		sortAggregate(fake)
+		printAggregate(fake)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/mod/result"
+	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// 与CDN监控数据对比的参数
+var crossCheckFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "cross-check",
+		Usage: tr("与CDN监控数据按时间段对比，发现日志缺失或延迟，逗号分隔: bps (DescribeDomainBpsData)、qps (DescribeDomainQpsData)", "compare with CDN monitoring data per interval to spot missing or late logs, comma separated: bps (DescribeDomainBpsData), qps (DescribeDomainQpsData)"),
+	},
+	&cli.DurationFlag{
+		Name:  "cross-check-interval",
+		Value: 5 * time.Minute,
+		Usage: tr("对比的时间粒度: 5m、1h 或 24h", "comparison interval: 5m, 1h or 24h"),
+	},
+	&cli.Float64Flag{
+		Name:  "cross-check-tolerance",
+		Value: 0.1,
+		Usage: tr("允许的相对偏差，超过时标记该时间段", "allowed relative difference; intervals beyond it are flagged"),
+	},
+}
+
+// 监控API支持的时间粒度及单次查询的最长时间范围
+var crossCheckIntervals = map[time.Duration]time.Duration{
+	5 * time.Minute: 3 * 24 * time.Hour,
+	time.Hour:       31 * 24 * time.Hour,
+	24 * time.Hour:  90 * 24 * time.Hour,
+}
+
+// 对比配置，metrics 为空表示不对比
+var crossCheckConfig struct {
+	metrics   []string
+	interval  time.Duration
+	tolerance float64
+}
+
+// 对比结果，在搜索完成后设置
+var crossCheckResult *result.CrossCheck
+
+func loadCrossCheckConfig(c *cli.Context) error {
+	crossCheckConfig.metrics = nil
+	for _, m := range strings.Split(c.String("cross-check"), ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if m != "bps" && m != "qps" {
+			return fmt.Errorf(tr("不支持的对比指标 %q，可选 bps、qps", "unsupported cross-check metric %q, use bps or qps"), m)
+		}
+		if !slices.Contains(crossCheckConfig.metrics, m) {
+			crossCheckConfig.metrics = append(crossCheckConfig.metrics, m)
+		}
+	}
+	crossCheckConfig.interval = c.Duration("cross-check-interval")
+	crossCheckConfig.tolerance = c.Float64("cross-check-tolerance")
+	if len(crossCheckConfig.metrics) == 0 {
+		return nil
+	}
+	if _, ok := crossCheckIntervals[crossCheckConfig.interval]; !ok {
+		return fmt.Errorf(tr("不支持的对比粒度 %s，可选 5m、1h 或 24h", "unsupported cross-check interval %s, use 5m, 1h or 24h"), crossCheckConfig.interval)
+	}
+	trafficCounter = newTraffic(crossCheckConfig.interval)
+	return nil
+}
+
+// 监控数据中的一个点
+type monitorPoint struct {
+	start time.Time
+	value float64
+}
+
+// 查询监控数据并与日志统计对比
+func runCrossCheck(ctx context.Context) (check *result.CrossCheck, err error) {
+	_, span := startSpan(ctx, "cross-check", attribute.String("cdn.domain", config.domainName))
+	defer func() { endSpan(span, err) }()
+
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return nil, err
+	}
+	client, err := createClient()
+	if err != nil {
+		return nil, err
+	}
+
+	check = &result.CrossCheck{
+		Interval:  crossCheckConfig.interval.String(),
+		Tolerance: crossCheckConfig.tolerance,
+	}
+	seconds := crossCheckConfig.interval.Seconds()
+	for _, metric := range crossCheckConfig.metrics {
+		switch metric {
+		case "bps":
+			points, err := fetchMonitorData(start, end, func(s, e time.Time) ([]monitorPoint, error) { return describeBps(ctx, client, s, e) })
+			if err != nil {
+				return nil, fmt.Errorf(tr("查询带宽数据失败: %w", "describe bandwidth data: %w"), err)
+			}
+			check.Bandwidth = compareWithLogs("DescribeDomainBpsData", points, func(b trafficBucket) float64 {
+				return float64(b.bytes) * 8 / seconds
+			})
+		case "qps":
+			points, err := fetchMonitorData(start, end, func(s, e time.Time) ([]monitorPoint, error) { return describeQps(ctx, client, s, e) })
+			if err != nil {
+				return nil, fmt.Errorf(tr("查询QPS数据失败: %w", "describe QPS data: %w"), err)
+			}
+			check.Requests = compareWithLogs("DescribeDomainQpsData", points, func(b trafficBucket) float64 {
+				return float64(b.requests) / seconds
+			})
+		}
+	}
+	return check, nil
+}
+
+// 按API单次查询的最长时间范围分段查询监控数据
+func fetchMonitorData(start, end time.Time, describe func(start, end time.Time) ([]monitorPoint, error)) ([]monitorPoint, error) {
+	maxSpan := crossCheckIntervals[crossCheckConfig.interval]
+	var points []monitorPoint
+	for s := start; s.Before(end); s = s.Add(maxSpan) {
+		e := s.Add(maxSpan)
+		if e.After(end) {
+			e = end
+		}
+		part, err := describe(s, e)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, part...)
+	}
+	return points, nil
+}
+
+// 查询带宽监控数据（bit/s）
+func describeBps(ctx context.Context, client *cdn20180510.Client, start, end time.Time) ([]monitorPoint, error) {
+	var resp *cdn20180510.DescribeDomainBpsDataResponse
+	err := withAPIRetry(ctx, "DescribeDomainBpsData", func() (err error) {
+		resp, err = client.DescribeDomainBpsDataWithOptions(&cdn20180510.DescribeDomainBpsDataRequest{
+			DomainName: tea.String(config.domainName),
+			StartTime:  tea.String(start.UTC().Format(time.RFC3339)),
+			EndTime:    tea.String(end.UTC().Format(time.RFC3339)),
+			Interval:   tea.String(strconv.Itoa(int(crossCheckConfig.interval.Seconds()))),
+		}, &util.RuntimeOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var points []monitorPoint
+	if resp.Body == nil || resp.Body.BpsDataPerInterval == nil {
+		return nil, nil
+	}
+	for _, d := range resp.Body.BpsDataPerInterval.DataModule {
+		if p, ok := parseMonitorPoint(d.TimeStamp, d.Value); ok {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+// 查询每秒请求数监控数据
+func describeQps(ctx context.Context, client *cdn20180510.Client, start, end time.Time) ([]monitorPoint, error) {
+	var resp *cdn20180510.DescribeDomainQpsDataResponse
+	err := withAPIRetry(ctx, "DescribeDomainQpsData", func() (err error) {
+		resp, err = client.DescribeDomainQpsDataWithOptions(&cdn20180510.DescribeDomainQpsDataRequest{
+			DomainName: tea.String(config.domainName),
+			StartTime:  tea.String(start.UTC().Format(time.RFC3339)),
+			EndTime:    tea.String(end.UTC().Format(time.RFC3339)),
+			Interval:   tea.String(strconv.Itoa(int(crossCheckConfig.interval.Seconds()))),
+		}, &util.RuntimeOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var points []monitorPoint
+	if resp.Body == nil || resp.Body.QpsDataInterval == nil {
+		return nil, nil
+	}
+	for _, d := range resp.Body.QpsDataInterval.DataModule {
+		if p, ok := parseMonitorPoint(d.TimeStamp, d.Value); ok {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+func parseMonitorPoint(timestamp, value *string) (monitorPoint, bool) {
+	t, err := time.Parse(time.RFC3339, tea.StringValue(timestamp))
+	if err != nil {
+		return monitorPoint{}, false
+	}
+	v, err := strconv.ParseFloat(tea.StringValue(value), 64)
+	if err != nil {
+		return monitorPoint{}, false
+	}
+	return monitorPoint{start: t, value: v}, true
+}
+
+// 逐时间段对比监控数据与日志统计，logValue 由时间段的日志统计计算对应指标
+func compareWithLogs(source string, points []monitorPoint, logValue func(b trafficBucket) float64) *result.Comparison {
+	slices.SortFunc(points, func(a, b monitorPoint) int { return a.start.Compare(b.start) })
+	cmp := &result.Comparison{Source: source, Intervals: []result.ComparisonInterval{}}
+	scale := lineSampler.scale()
+	for _, p := range points {
+		logged := logValue(trafficCounter.bucket(p.start)) * scale
+		if p.value == 0 && logged == 0 {
+			continue
+		}
+		iv := result.ComparisonInterval{
+			Start: p.start,
+			End:   p.start.Add(crossCheckConfig.interval),
+			API:   p.value,
+			Log:   logged,
+		}
+		if p.value > 0 {
+			ratio := logged / p.value
+			iv.Ratio = &ratio
+			iv.Flagged = math.Abs(ratio-1) > crossCheckConfig.tolerance
+		} else {
+			iv.Flagged = true
+		}
+		if iv.Flagged {
+			cmp.Flagged++
+		}
+		cmp.Intervals = append(cmp.Intervals, iv)
+	}
+	return cmp
+}
+
+// 一项指标的对比及其显示名称和数值格式
+type crossCheckMetric struct {
+	name   string
+	cmp    *result.Comparison
+	format func(float64) string
+}
+
+func crossCheckMetrics(check *result.CrossCheck) []crossCheckMetric {
+	var metrics []crossCheckMetric
+	if check.Bandwidth != nil {
+		metrics = append(metrics, crossCheckMetric{tr("带宽", "Bandwidth"), check.Bandwidth, formatBps})
+	}
+	if check.Requests != nil {
+		metrics = append(metrics, crossCheckMetric{"QPS", check.Requests, formatQps})
+	}
+	return metrics
+}
+
+// 在终端输出对比摘要和被标记的时间段
+func printCrossCheck(check *result.CrossCheck) {
+	for _, m := range crossCheckMetrics(check) {
+		fmt.Printf(tr("\n%s对比 (%s, %s): %d 个时间段，%d 个偏差超过 %.0f%%\n", "\n%s cross-check (%s, %s): %d intervals, %d differ by more than %.0f%%\n"),
+			m.name, m.cmp.Source, check.Interval, len(m.cmp.Intervals), m.cmp.Flagged, check.Tolerance*100)
+		printed := 0
+		for _, iv := range m.cmp.Intervals {
+			if !iv.Flagged {
+				continue
+			}
+			if printed == maxPrintedFindings {
+				fmt.Print(tr("  ... 其余见结果文件\n", "  ... more in the results file\n"))
+				break
+			}
+			fmt.Println("  " + formatComparison(iv, m.format))
+			printed++
+		}
+	}
+}
+
+// 在文本报告中写入全部时间段的对比
+func writeCrossCheckReport(writer *bufio.Writer, check *result.CrossCheck) {
+	for _, m := range crossCheckMetrics(check) {
+		fmt.Fprintf(writer, tr("## %s对比 (%s, %s): %d 个偏差超过 %.0f%% 的时间段（以 ! 标记）\n", "## %s cross-check (%s, %s): %d intervals differ by more than %.0f%% (marked !)\n"),
+			m.name, m.cmp.Source, check.Interval, m.cmp.Flagged, check.Tolerance*100)
+		for _, iv := range m.cmp.Intervals {
+			mark := " "
+			if iv.Flagged {
+				mark = "!"
+			}
+			fmt.Fprintf(writer, "%s %s\n", mark, formatComparison(iv, m.format))
+		}
+		writer.WriteString("\n")
+	}
+}
+
+// 单个时间段对比的文本形式
+func formatComparison(iv result.ComparisonInterval, format func(float64) string) string {
+	ratio := "-"
+	if iv.Ratio != nil {
+		ratio = fmt.Sprintf("%.1f%%", *iv.Ratio*100)
+	}
+	return fmt.Sprintf(tr("%s API %s 日志 %s (%s)", "%s API %s logs %s (%s)"),
+		iv.Start.Local().Format("2006-01-02 15:04"), format(iv.API), format(iv.Log), ratio)
+}
+
+// QPS的文本形式
+func formatQps(v float64) string {
+	return fmt.Sprintf("%.2f req/s", v)
+}
+
+// 带宽的文本形式
+func formatBps(v float64) string {
+	units := []string{"bps", "Kbps", "Mbps", "Gbps", "Tbps"}
+	i := 0
+	for v >= 1000 && i < len(units)-1 {
+		v /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", v, units[i])
+}
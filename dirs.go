@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// analyze dirs：按路径的前几级目录统计流量，把流量归到网站的产品或栏目
+var dirsCommand = &cli.Command{
+	Name:  "dirs",
+	Usage: tr("按路径的前几级目录（如 /video/live）统计流量、请求数、占比、不同URL数和未命中率", "aggregate bytes, requests, share, distinct URLs and miss ratio by the leading directories of the path (e.g. /video/live)"),
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "depth",
+			Value: 2,
+			Usage: tr("目录的级数", "number of leading directories"),
+		},
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+	},
+	Action: runDirsReport,
+}
+
+func runDirsReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	depth := c.Int("depth")
+	if depth < 1 {
+		return errors.New(tr("--depth 至少为1", "--depth must be at least 1"))
+	}
+	g, err := newGroupBy("dirs", "host,path", "bytes,count,share,distinct(path),miss_ratio", c.String("filter"))
+	if err != nil {
+		return err
+	}
+	g.by[1] = dirField(depth)
+	return runAggregates(c, []*groupBy{g}, nil)
+}
+
+// 分组字段 dir：路径的前 depth 级目录
+func dirField(depth int) fieldExpr {
+	return fieldExpr{name: "dir", get: func(r *logRecord) exprValue {
+		_, path, _ := splitURL(r.URL)
+		return stringValue(pathDir(path, depth))
+	}}
+}
+
+// 路径的前 depth 级目录，不含最后的文件名，如 pathDir("/a/b/c.js", 2) 为 /a/b、pathDir("/a/b.js", 2) 为 /a；
+// 根目录下的文件为 /
+func pathDir(p string, depth int) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	// 不以 / 结尾时最后一段为文件名
+	if !strings.HasSuffix(p, "/") {
+		segments = segments[:len(segments)-1]
+	}
+	var b strings.Builder
+	for _, s := range segments[:min(len(segments), depth)] {
+		if s != "" {
+			b.WriteString("/" + s)
+		}
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
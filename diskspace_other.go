@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+// 其他平台不支持查询可用空间，下载前的检查会被跳过
+func freeDiskSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// 目录所在磁盘中当前用户可用的空间（字节）
+func freeDiskSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
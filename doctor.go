@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/urfave/cli/v2"
+)
+
+// doctor：检查运行环境，逐项输出检查结果和处理建议
+var doctorCommand = &cli.Command{
+	Name:   "doctor",
+	Usage:  tr("检查凭证、RAM权限、到API和日志下载地址的网络、磁盘空间等运行环境，逐项输出检查结果和处理建议", "check credentials, RAM permissions, network access to the API and to log downloads, disk space and more, printing pass/fail results with advice"),
+	Action: runDoctor,
+}
+
+// 检查结果
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+	doctorSkip = "SKIP"
+)
+
+// 磁盘剩余空间低于该值时给出警告
+const doctorMinFreeSpace = 1 << 30
+
+// 一项检查，hint 为未通过时的处理建议
+type doctorCheck struct {
+	name   string
+	status string
+	detail string
+	hint   string
+}
+
+// 要检查的一个账号：单账号时 name 为空，使用默认凭证链和 --domain
+type doctorTarget struct {
+	name    string
+	cred    func() (credential.Credential, error)
+	domains []string
+	// CDN厂商，阿里云以外的厂商只检查凭证和日志列表；account 为单账号时为 nil
+	provider string
+	account  *account
+}
+
+func runDoctor(c *cli.Context) error {
+	if err := loadListingCommandConfig(c); err != nil {
+		return err
+	}
+	loadOSSConfig(c)
+	ctx := c.Context
+
+	var checks []doctorCheck
+	add := func(check doctorCheck) {
+		checks = append(checks, check)
+		fmt.Printf("[%s] %s: %s\n", check.status, check.name, check.detail)
+	}
+	targets := []doctorTarget{{cred: func() (credential.Credential, error) { return credential.NewCredential(nil) }, provider: providerName}}
+	// 未指定 --domain 时为占位的默认值，不检查
+	if c.IsSet("domain") {
+		targets[0].domains = []string{config.domainName}
+	}
+	if len(accounts) > 0 {
+		targets = nil
+		for i := range accounts {
+			a := &accounts[i]
+			targets = append(targets, doctorTarget{name: a.Name, cred: a.credential, domains: a.Domains, provider: a.provider(), account: a})
+		}
+	}
+	checked := make(map[string]bool)
+	for _, t := range targets {
+		if !checked[t.provider] {
+			checked[t.provider] = true
+			add(doctorEndpoint(ctx, providerEndpoints[t.provider]))
+		}
+	}
+	var sampleURL string
+	for _, t := range targets {
+		if t.provider != "aliyun" {
+			checks, url := doctorProviderLogs(ctx, t)
+			for _, check := range checks {
+				add(check)
+			}
+			if sampleURL == "" {
+				sampleURL = url
+			}
+			continue
+		}
+		client, check := doctorCredential(t)
+		add(check)
+		if client == nil {
+			continue
+		}
+		add(doctorUserDomains(ctx, t, client))
+		if len(t.domains) == 0 {
+			add(doctorCheck{name: "DescribeCdnDomainLogs", status: doctorSkip, detail: tr("未指定 --domain", "no --domain given")})
+		}
+		for _, domain := range t.domains {
+			check, url := doctorDomainLogs(ctx, t, client, domain)
+			add(check)
+			if sampleURL == "" {
+				sampleURL = url
+			}
+		}
+	}
+	add(doctorLogDownload(ctx, sampleURL))
+	if ossConfig.bucket != "" {
+		add(doctorOSSBucket())
+	}
+	add(doctorDiskSpace())
+
+	failed := 0
+	var hints []string
+	for _, check := range checks {
+		if check.status == doctorFail {
+			failed++
+		}
+		if check.hint != "" && (check.status == doctorFail || check.status == doctorWarn) {
+			hints = append(hints, fmt.Sprintf("  - %s: %s", check.name, check.hint))
+		}
+	}
+	if len(hints) > 0 {
+		fmt.Print(tr("\n处理建议:\n", "\nAdvice:\n"))
+		fmt.Println(strings.Join(hints, "\n"))
+	}
+	if failed > 0 {
+		return fmt.Errorf(tr("%d 项检查未通过", "%d checks failed"), failed)
+	}
+	fmt.Print(tr("\n全部检查通过\n", "\nAll checks passed\n"))
+	return nil
+}
+
+// 检查项名称，多账号时加上账号名
+func (t doctorTarget) checkName(name string) string {
+	if t.name == "" {
+		return name
+	}
+	return name + " (" + t.name + ")"
+}
+
+// 能否访问 CDN API 的地址；使用默认的 HTTP 客户端，HTTPS_PROXY 等代理设置同样生效
+func doctorEndpoint(ctx context.Context, host string) doctorCheck {
+	check := doctorCheck{name: tr("网络: ", "network: ") + host}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+"/", nil)
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return check
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		check.hint = fmt.Sprintf(tr("检查防火墙和代理设置，需要能通过 HTTPS 访问 %s；使用代理时设置 HTTPS_PROXY 环境变量", "check firewall and proxy settings; %s must be reachable over HTTPS. Set HTTPS_PROXY when a proxy is required"), host)
+		return check
+	}
+	resp.Body.Close()
+	// 不带签名的请求会被拒绝，能收到响应即说明网络可达
+	check.status = doctorPass
+	check.detail = fmt.Sprintf(tr("可以连接，耗时 %s", "reachable in %s"), time.Since(start).Round(time.Millisecond))
+	return check
+}
+
+// 能否获取凭证，成功时返回 CDN 客户端
+func doctorCredential(t doctorTarget) (*cdn20180510.Client, doctorCheck) {
+	check := doctorCheck{
+		name: t.checkName(tr("凭证", "credentials")),
+		hint: tr("通过环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID/ALIBABA_CLOUD_ACCESS_KEY_SECRET、~/.alibabacloud/credentials 或 --accounts 配置凭证", "configure credentials via ALIBABA_CLOUD_ACCESS_KEY_ID/ALIBABA_CLOUD_ACCESS_KEY_SECRET, ~/.alibabacloud/credentials or --accounts"),
+	}
+	cred, err := t.cred()
+	if err == nil {
+		var model *credential.CredentialModel
+		if model, err = cred.GetCredential(); err == nil {
+			check.status = doctorPass
+			check.detail = fmt.Sprintf("%s, AccessKey %s", tea.StringValue(model.Type), maskAccessKey(tea.StringValue(model.AccessKeyId)))
+		}
+	}
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return nil, check
+	}
+	client, err := newCDNClient(cred)
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return nil, check
+	}
+	return client, check
+}
+
+// AccessKey ID 只显示首尾几位
+func maskAccessKey(id string) string {
+	if len(id) <= 8 {
+		return strings.Repeat("*", len(id))
+	}
+	return id[:4] + strings.Repeat("*", len(id)-8) + id[len(id)-4:]
+}
+
+// DescribeUserDomains 的权限，以及 --domain 是否属于该账号
+func doctorUserDomains(ctx context.Context, t doctorTarget, client *cdn20180510.Client) doctorCheck {
+	check := doctorCheck{name: t.checkName("DescribeUserDomains")}
+	req := &cdn20180510.DescribeUserDomainsRequest{PageSize: tea.Int32(50)}
+	var resp *cdn20180510.DescribeUserDomainsResponse
+	err := withAPIRetry(ctx, "DescribeUserDomains", func() (err error) {
+		resp, err = client.DescribeUserDomainsWithOptions(req, &util.RuntimeOptions{})
+		return err
+	})
+	if err != nil {
+		check.status, check.detail, check.hint = doctorFail, err.Error(), apiErrorHint(err, "cdn:DescribeUserDomains")
+		return check
+	}
+	check.status = doctorPass
+	check.detail = fmt.Sprintf(tr("账号下共 %d 个加速域名", "%d CDN domains in the account"), tea.Int64Value(resp.Body.TotalCount))
+	// 只在第一页中查找；域名较多时找不到不代表不存在，由 DescribeCdnDomainLogs 的检查确认
+	if tea.Int64Value(resp.Body.TotalCount) <= 50 && resp.Body.Domains != nil {
+		found := make(map[string]bool)
+		for _, d := range resp.Body.Domains.PageData {
+			found[tea.StringValue(d.DomainName)] = true
+		}
+		var missing []string
+		for _, domain := range t.domains {
+			if !found[domain] {
+				missing = append(missing, domain)
+			}
+		}
+		if len(missing) > 0 {
+			check.status = doctorFail
+			check.detail += fmt.Sprintf(tr("，不包含 %s", "; %s not among them"), strings.Join(missing, ", "))
+			check.hint = tr("确认 --domain 拼写正确，且凭证属于该域名所在的账号", "make sure --domain is spelled correctly and the credentials belong to the account owning the domain")
+		}
+	}
+	return check
+}
+
+// DescribeCdnDomainLogs 的权限，以及昨天（UTC）是否有日志；返回一个日志下载链接供下载检查使用
+func doctorDomainLogs(ctx context.Context, t doctorTarget, client *cdn20180510.Client, domain string) (doctorCheck, string) {
+	check := doctorCheck{name: t.checkName("DescribeCdnDomainLogs " + domain)}
+	day := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	files, err := describeDayLogs(ctx, client, domain, day)
+	if err != nil {
+		check.status, check.detail, check.hint = doctorFail, err.Error(), apiErrorHint(err, "cdn:DescribeCdnDomainLogs")
+		return check, ""
+	}
+	if len(files) == 0 {
+		check.status = doctorWarn
+		check.detail = fmt.Sprintf(tr("%s 没有日志文件", "no log files on %s"), day.Format(time.DateOnly))
+		check.hint = tr("确认域名当天有访问；新添加的域名要等几个小时才会生成离线日志", "make sure the domain had traffic that day; offline logs of newly added domains appear after a few hours")
+		return check, ""
+	}
+	check.status = doctorPass
+	check.detail = fmt.Sprintf(tr("%s 有 %d 个日志文件", "%s: %d log files"), day.Format(time.DateOnly), len(files))
+	return check, files[0].URL
+}
+
+// 阿里云以外的厂商：能否获取凭证，以及每个域名昨天（UTC）是否有日志；返回一个日志下载链接供下载检查使用
+func doctorProviderLogs(ctx context.Context, t doctorTarget) ([]doctorCheck, string) {
+	check := doctorCheck{name: t.checkName(tr("凭证", "credentials") + " " + t.provider)}
+	p, err := logProviders[t.provider](t.account)
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return []doctorCheck{check}, ""
+	}
+	check.status, check.detail = doctorPass, tr("已读取", "loaded")
+	checks := []doctorCheck{check}
+	if len(t.domains) == 0 {
+		checks = append(checks, doctorCheck{name: t.checkName(tr("日志列表", "log listing")), status: doctorSkip, detail: tr("未指定 --domain", "no --domain given")})
+	}
+	sampleURL := ""
+	day := time.Now().UTC().Truncate(24 * time.Hour).Add(-24 * time.Hour)
+	for _, domain := range t.domains {
+		check := doctorCheck{name: t.checkName(tr("日志列表 ", "log listing ") + domain)}
+		files, err := p.listDayLogs(ctx, domain, day)
+		switch {
+		case err != nil:
+			check.status, check.detail = doctorFail, err.Error()
+			check.hint = tr("检查密钥是否有效、是否有查询CDN日志的权限，以及域名是否属于该账号", "check that the keys are valid, allowed to list CDN logs and belong to the account owning the domain")
+		case len(files) == 0:
+			check.status = doctorWarn
+			check.detail = fmt.Sprintf(tr("%s 没有日志文件", "no log files on %s"), day.Format(time.DateOnly))
+			check.hint = tr("确认域名当天有访问；新添加的域名要等几个小时才会生成离线日志", "make sure the domain had traffic that day; offline logs of newly added domains appear after a few hours")
+		default:
+			check.status = doctorPass
+			check.detail = fmt.Sprintf(tr("%s 有 %d 个日志文件", "%s: %d log files"), day.Format(time.DateOnly), len(files))
+			if sampleURL == "" {
+				sampleURL = files[0].URL
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks, sampleURL
+}
+
+// 权限不足时给出需要授予的权限，其他错误提示检查 AccessKey 和网络
+func apiErrorHint(err error, action string) string {
+	var sdkErr *tea.SDKError
+	if errors.As(err, &sdkErr) {
+		code := tea.StringValue(sdkErr.Code)
+		switch {
+		case strings.HasPrefix(code, "Forbidden") || strings.Contains(code, "NoPermission") || tea.IntValue(sdkErr.StatusCode) == 403:
+			return fmt.Sprintf(tr("为RAM用户授予 %s 权限，或直接授予系统策略 AliyunCDNReadOnlyAccess", "grant %s to the RAM user, or attach the AliyunCDNReadOnlyAccess system policy"), action)
+		case strings.HasPrefix(code, "InvalidAccessKeyId") || strings.HasPrefix(code, "SignatureDoesNotMatch"):
+			return tr("AccessKey 无效或 Secret 不匹配，检查凭证配置", "the AccessKey is invalid or the secret does not match; check the credentials")
+		}
+	}
+	return tr("检查 AccessKey 是否有效，以及能否访问 cdn.aliyuncs.com", "check that the AccessKey is valid and cdn.aliyuncs.com is reachable")
+}
+
+// 能否下载日志：只请求示例日志的第一个字节
+func doctorLogDownload(ctx context.Context, url string) doctorCheck {
+	check := doctorCheck{name: tr("日志下载", "log download")}
+	if url == "" {
+		check.status, check.detail = doctorSkip, tr("没有可用的日志下载链接", "no log download URL available")
+		return check
+	}
+	if !strings.HasPrefix(url, "http") {
+		url = "https://" + url
+	}
+	check.hint = tr("检查能否访问日志下载链接所在的 OSS 域名（出口防火墙、代理），链接过期时重新查询即可", "check that the OSS host of the download links is reachable (egress firewall, proxy); expired links are refreshed by querying again")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return check
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return check
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		check.status, check.detail = doctorFail, fmt.Sprintf(tr("HTTP错误: %s", "HTTP error: %s"), resp.Status)
+		return check
+	}
+	check.status, check.detail = doctorPass, fmt.Sprintf("%s (%s)", resp.Status, req.URL.Host)
+	return check
+}
+
+// --oss-bucket 能否列出对象
+func doctorOSSBucket() doctorCheck {
+	check := doctorCheck{name: "OSS " + ossConfig.bucket}
+	bucket, err := newOSSBucket(ossConfig.bucket)
+	if err == nil {
+		_, err = bucket.ListObjectsV2(oss.Prefix(ossConfig.prefix), oss.MaxKeys(1))
+	}
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		check.hint = tr("确认 Bucket 名称、--oss-region/--oss-endpoint 正确，并为RAM用户授予 oss:ListObjects 和 oss:GetObject 权限", "check the bucket name and --oss-region/--oss-endpoint, and grant oss:ListObjects and oss:GetObject to the RAM user")
+		return check
+	}
+	check.status, check.detail = doctorPass, tr("可以列出对象", "objects can be listed")
+	return check
+}
+
+// 日志保存目录所在文件系统的剩余空间
+func doctorDiskSpace() doctorCheck {
+	check := doctorCheck{name: tr("磁盘空间", "disk space")}
+	dir := logDir
+	if _, err := os.Stat(dir); err != nil {
+		dir = "."
+	}
+	free, err := freeDiskSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		check.status, check.detail = doctorSkip, tr("当前系统不支持查询剩余空间", "free space cannot be queried on this system")
+		return check
+	}
+	if err != nil {
+		check.status, check.detail = doctorFail, err.Error()
+		return check
+	}
+	check.detail = fmt.Sprintf(tr("%s 剩余 %s", "%s: %s free"), dir, formatBytes(int64(free)))
+	check.status = doctorPass
+	if free < doctorMinFreeSpace {
+		check.status = doctorWarn
+		check.hint = tr("用 prune 或 --cache-max-size 清理日志缓存，或在空间更大的目录中运行", "free the log cache with prune or --cache-max-size, or run from a directory with more space")
+	}
+	return check
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 下载前确认的参数
+var downloadFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   tr("下载量超过 --confirm-size 时不再询问，直接下载", "download without asking even when the total size exceeds --confirm-size"),
+	},
+	&cli.StringFlag{
+		Name:  "confirm-size",
+		Value: "10GB",
+		Usage: tr("待下载日志总大小超过该值时需要确认（交互输入或 --yes），如 500MB、10GB，0 表示不确认", "ask for confirmation (interactively or with --yes) when the logs to download exceed this size, e.g. 500MB or 10GB; 0 never asks"),
+	},
+	&cli.StringFlag{
+		Name:  "disk-check",
+		Value: diskCheckRefuse,
+		Usage: tr("下载前检查日志目录的剩余空间是否足够: refuse 不足时退出，warn 只警告，off 不检查", "check that the log directory has enough free space before downloading: refuse exits when short, warn only warns, off skips the check"),
+	},
+}
+
+// --disk-check 的取值
+const (
+	diskCheckRefuse = "refuse"
+	diskCheckWarn   = "warn"
+	diskCheckOff    = "off"
+)
+
+// 下载前确认的配置
+var downloadConfig struct {
+	yes         bool
+	confirmSize int64
+	diskCheck   string
+}
+
+func loadDownloadConfig(c *cli.Context) error {
+	downloadConfig.yes = c.Bool("yes")
+	size, err := parseSize(c.String("confirm-size"))
+	if err != nil {
+		return fmt.Errorf(tr("--confirm-size 格式错误: %w", "invalid --confirm-size: %w"), err)
+	}
+	downloadConfig.confirmSize = size
+	downloadConfig.diskCheck = c.String("disk-check")
+	switch downloadConfig.diskCheck {
+	case diskCheckRefuse, diskCheckWarn, diskCheckOff:
+	default:
+		return fmt.Errorf(tr("不支持的 --disk-check %q，可选 refuse、warn 或 off", "unsupported --disk-check %q, use refuse, warn or off"), downloadConfig.diskCheck)
+	}
+	logSizes.m = nil
+	return nil
+}
+
+// 解析带单位的大小，如 500MB、1.5GB、1024；单位按1024进制，与 formatBytes 一致
+func parseSize(s string) (int64, error) {
+	num := strings.ToUpper(strings.TrimSpace(s))
+	num = strings.TrimSuffix(strings.TrimSuffix(num, "B"), "I")
+	scale := 1.0
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGTPE", num[n-1]); i >= 0 {
+			num = num[:n-1]
+			for range i + 1 {
+				scale *= 1024
+			}
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf(tr("无效的大小 %q", "invalid size %q"), s)
+	}
+	return int64(v * scale), nil
+}
+
+// 由 DescribeCdnDomainLogs 得到的日志大小，键为本地文件路径；使用 --urls-file 时为空
+var logSizes struct {
+	mu sync.Mutex
+	m  map[string]int64
+}
+
+func setLogSize(url string, size int64) {
+	logSizes.mu.Lock()
+	defer logSizes.mu.Unlock()
+	if logSizes.m == nil {
+		logSizes.m = make(map[string]int64)
+	}
+	logSizes.m[localLogPath(url)] = size
+}
+
+// 本地缓存中是否已有完整的日志文件：文件存在，且已知API返回的大小时大小一致
+func isCachedLog(file string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	size, ok := logSize(file)
+	return !ok || size <= 0 || info.Size() == size
+}
+
+// API返回的日志大小，没有记录时 ok 为 false
+func logSize(file string) (size int64, ok bool) {
+	logSizes.mu.Lock()
+	defer logSizes.mu.Unlock()
+	size, ok = logSizes.m[file]
+	return size, ok
+}
+
+// 汇总待下载（本地没有缓存）的日志大小并提示；超过 --confirm-size 时需要确认
+func confirmDownload(urls []string) error {
+	var total int64
+	pending, unknown := 0, 0
+	for _, url := range urls {
+		file := localLogPath(url)
+		if isCachedLog(file) {
+			continue
+		}
+		pending++
+		if size, ok := logSize(file); ok {
+			total += size
+		} else {
+			unknown++
+		}
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	// 使用 --urls-file 时没有大小信息
+	if unknown == pending {
+		fmt.Printf(tr("即将下载 %d 个文件（大小未知）", "About to download %d files (size unknown)"), pending)
+	} else {
+		fmt.Printf(tr("即将下载 %s，共 %d 个文件", "About to download %s in %d files"), formatBytes(total), pending)
+	}
+	if cached := len(urls) - pending; cached > 0 {
+		fmt.Printf(tr("（另有 %d 个已在本地缓存）", " (%d more already cached)"), cached)
+	}
+	if unknown > 0 && unknown < pending {
+		fmt.Printf(tr("，其中 %d 个大小未知", ", size unknown for %d"), unknown)
+	}
+	fmt.Println()
+	if err := checkDiskSpace(total); err != nil {
+		return err
+	}
+
+	if downloadConfig.yes || downloadConfig.confirmSize <= 0 || total <= downloadConfig.confirmSize {
+		return nil
+	}
+	// 标准输入不是终端（如脚本或管道）或 --job 时不询问，要求显式 --yes
+	if info, err := os.Stdin.Stat(); jobMode || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf(tr("待下载 %s 超过 --confirm-size %s，请加 --yes 确认", "%s to download exceeds --confirm-size %s; pass --yes to confirm"),
+			formatBytes(total), formatBytes(downloadConfig.confirmSize))
+	}
+	fmt.Print(tr("继续下载? [y/N] ", "Continue? [y/N] "))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New(tr("已取消下载", "download cancelled"))
+}
+
+// 检查日志目录的剩余空间能否容纳待下载的日志，避免下载到一半因磁盘写满而失败
+func checkDiskSpace(need int64) error {
+	if downloadConfig.diskCheck == diskCheckOff || need == 0 {
+		return nil
+	}
+	free, err := freeDiskSpace(logDir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 无法获取 %s 的剩余空间: %v\n", "Warning: cannot get free space of %s: %v\n"), logDir, err)
+		return nil
+	}
+	if uint64(need) <= free {
+		return nil
+	}
+	msg := fmt.Sprintf(tr("%s 剩余空间 %s，不足以下载 %s 的日志", "%s has %s free, not enough for %s of logs"), logDir, formatBytes(int64(free)), formatBytes(need))
+	if downloadConfig.diskCheck == diskCheckWarn {
+		fmt.Fprintf(os.Stderr, tr("警告: %s\n", "Warning: %s\n"), msg)
+		return nil
+	}
+	return fmt.Errorf(tr("%s（加 --disk-check warn 可忽略并继续）", "%s (use --disk-check warn to continue anyway)"), msg)
+}
+
+// 下载失败的链接记录在该文件中，供 download --retry-failed 重试
+const retryQueueFile = "failed-downloads.json"
+
+// 重试队列中的一个下载失败的链接
+type failedDownload struct {
+	URL         string    `json:"url"`
+	Error       string    `json:"error"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// 读取重试队列，文件不存在时为空
+func loadRetryQueue() ([]failedDownload, error) {
+	data, err := os.ReadFile(retryQueueFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var queue []failedDownload
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, fmt.Errorf(tr("解析 %s 失败: %w", "parse %s: %w"), retryQueueFile, err)
+	}
+	return queue, nil
+}
+
+// 按本次下载结果更新重试队列：下载成功的链接移出队列，失败的累加尝试次数；队列为空时删除文件
+func updateRetryQueue(attempted []string, failed []failedDownload) error {
+	old, err := loadRetryQueue()
+	if err != nil {
+		return err
+	}
+	queue := slices.DeleteFunc(slices.Clone(old), func(q failedDownload) bool { return slices.Contains(attempted, q.URL) })
+	now := time.Now()
+	for _, f := range failed {
+		f.Attempts, f.LastAttempt = 1, now
+		if i := slices.IndexFunc(old, func(q failedDownload) bool { return q.URL == f.URL }); i >= 0 {
+			f.Attempts = old[i].Attempts + 1
+		}
+		queue = append(queue, f)
+	}
+	if len(queue) == 0 {
+		if err := os.Remove(retryQueueFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(retryQueueFile, data, 0o644); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, tr("%d 个下载失败的链接已记录到 %s，可用 download --retry-failed 重试\n", "%d failed downloads recorded in %s; retry them with download --retry-failed\n"), len(queue), retryQueueFile)
+	}
+	return nil
+}
+
+// download：只下载日志到本地缓存，不分析
+var downloadCommand = &cli.Command{
+	Name:  "download",
+	Usage: tr("只下载日志到本地缓存（onlice-log 目录），不分析", "download logs into the local cache (the onlice-log directory) without analyzing them"),
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "retry-failed",
+			Usage: tr("只重新下载 "+retryQueueFile+" 中记录的下载失败的链接", "only re-download the failed links recorded in "+retryQueueFile),
+		},
+	},
+	Action: runDownload,
+}
+
+func runDownload(c *cli.Context) error {
+	if c.Bool("retry-failed") {
+		return retryFailedDownloads(c)
+	}
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	if ossConfig.bucket != "" {
+		return errors.New(tr("OSS中的日志直接以流的方式读取，不需要下载", "logs in OSS are streamed directly and need no download"))
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf(tr("创建日志保存目录失败: %w", "create log directory: %w"), err)
+	}
+	_, _, err := fetchAndDownloadLogs(c.Context, c.String("urls-file"))
+	return err
+}
+
+// 重新下载重试队列中的链接，不需要 --start/--end
+func retryFailedDownloads(c *cli.Context) error {
+	if err := loadCacheConfig(c); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf(tr("创建日志保存目录失败: %w", "create log directory: %w"), err)
+	}
+	queue, err := loadRetryQueue()
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		fmt.Print(tr("没有下载失败的记录\n", "No failed downloads to retry\n"))
+		return nil
+	}
+	urls := make([]string, len(queue))
+	for i, q := range queue {
+		urls[i] = q.URL
+	}
+	fmt.Printf(tr("重试 %d 个下载失败的链接\n", "Retrying %d failed downloads\n"), len(urls))
+	downloaded, err := downloadLogs(c.Context, urls)
+	fmt.Printf(tr("成功下载 %d/%d 个日志文件\n", "Downloaded %d/%d log files\n"), len(downloaded), len(urls))
+	if err := evictLogCache(downloaded); err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 清理日志缓存失败: %v\n", "Warning: log cache eviction failed: %v\n"), err)
+	}
+	if err != nil {
+		return fmt.Errorf(tr("下载日志失败: %w", "download logs: %w"), err)
+	}
+	return nil
+}
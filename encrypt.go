@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/urfave/cli/v2"
+)
+
+// 加密结果文件，避免包含客户端IP和URL的结果以明文保存
+var encryptFlags = []cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "encrypt-to",
+		Usage: tr("把结果文件和 --export 文件加密给该接收者，可重复: age 公钥（age1...）、SSH 公钥，或 GPG 密钥ID/邮箱（需要本机安装 gpg 并导入公钥）", "encrypt the results file and the --export file to this recipient, repeatable: an age public key (age1...), an SSH public key, or a GPG key ID/email (needs gpg with the public key imported)"),
+	},
+}
+
+// 加密配置，ext 为空表示不加密
+var resultEncryption struct {
+	// 加密后文件名的后缀：.age 或 .gpg
+	ext string
+	age []age.Recipient
+	gpg []string
+}
+
+func loadEncryptConfig(c *cli.Context) error {
+	resultEncryption.ext, resultEncryption.age, resultEncryption.gpg = "", nil, nil
+	for _, r := range c.StringSlice("encrypt-to") {
+		r = strings.TrimSpace(r)
+		switch {
+		case r == "":
+			continue
+		case strings.HasPrefix(r, "age1"):
+			recipient, err := age.ParseX25519Recipient(r)
+			if err != nil {
+				return fmt.Errorf(tr("无效的 age 公钥 %q: %w", "invalid age public key %q: %w"), r, err)
+			}
+			resultEncryption.age = append(resultEncryption.age, recipient)
+		case strings.HasPrefix(r, "ssh-"):
+			recipient, err := agessh.ParseRecipient(r)
+			if err != nil {
+				return fmt.Errorf(tr("无效的 SSH 公钥: %w", "invalid SSH public key: %w"), err)
+			}
+			resultEncryption.age = append(resultEncryption.age, recipient)
+		default:
+			resultEncryption.gpg = append(resultEncryption.gpg, r)
+		}
+	}
+	switch {
+	case len(resultEncryption.age) > 0 && len(resultEncryption.gpg) > 0:
+		return errors.New(tr("--encrypt-to 不能同时指定 age 和 GPG 接收者", "--encrypt-to cannot mix age and GPG recipients"))
+	case len(resultEncryption.age) > 0:
+		resultEncryption.ext = ".age"
+	case len(resultEncryption.gpg) > 0:
+		resultEncryption.ext = ".gpg"
+		// 提前检查 gpg 和公钥，避免分析完成后才发现无法加密
+		for _, r := range resultEncryption.gpg {
+			var stderr bytes.Buffer
+			cmd := exec.Command("gpg", "--batch", "--list-keys", r)
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf(tr("找不到 GPG 公钥 %q: %v %s", "GPG public key %q not found: %v %s"), r, err, strings.TrimSpace(stderr.String()))
+			}
+		}
+	default:
+		return nil
+	}
+	if c.Bool("append") {
+		return errors.New(tr("--encrypt-to 不能与 --append 同时使用", "--encrypt-to cannot be combined with --append"))
+	}
+	return nil
+}
+
+// 启用加密时在文件名后加上 .age 或 .gpg
+func encryptedPath(path string) string {
+	if resultEncryption.ext == "" || strings.HasSuffix(path, resultEncryption.ext) {
+		return path
+	}
+	return path + resultEncryption.ext
+}
+
+// 返回写入 f 的加密流，Close 时结束加密但不关闭 f；未启用加密时直接写入 f
+func encryptWriter(f *os.File) (io.WriteCloser, error) {
+	switch resultEncryption.ext {
+	case ".age":
+		return age.Encrypt(f, resultEncryption.age...)
+	case ".gpg":
+		args := []string{"--batch", "--yes", "--trust-model", "always", "--encrypt", "--output", "-"}
+		for _, r := range resultEncryption.gpg {
+			args = append(args, "--recipient", r)
+		}
+		cmd := exec.Command("gpg", args...)
+		cmd.Stdout = f
+		w := &gpgWriter{cmd: cmd}
+		cmd.Stderr = &w.stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		w.stdin = stdin
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf(tr("启动 gpg 失败: %w", "start gpg: %w"), err)
+		}
+		return w, nil
+	}
+	return nopWriteCloser{f}, nil
+}
+
+// 通过 gpg 进程加密，写入其标准输入
+type gpgWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+func (w *gpgWriter) Write(p []byte) (int, error) { return w.stdin.Write(p) }
+
+func (w *gpgWriter) Close() error {
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf(tr("gpg 加密失败: %v %s", "gpg encryption failed: %v %s"), err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
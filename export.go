@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 把日志转换为其他工具能直接读取的格式
+var exportFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "export",
+		Usage: tr("把命中的日志行转换格式后写入该文件（格式见 --export-format）", "convert the matched log lines and write them to this file (see --export-format)"),
+	},
+	&cli.StringFlag{
+		Name:  "export-format",
+		Value: "combined",
+		Usage: tr("--export 的格式: combined（Apache combined，可用于 goaccess、awstats、webalizer）、w3c（W3C 扩展日志格式，带 #Fields 头）、cef 或 leef（用于 ArcSight、QRadar 等 SIEM，同时导出规则告警）", "format of --export: combined (Apache combined, for goaccess, awstats and webalizer), w3c (W3C extended log format with a #Fields header), cef or leef (for SIEMs such as ArcSight and QRadar; rule findings are exported too)"),
+	},
+	&cli.BoolFlag{
+		Name:  "export-all",
+		Usage: tr("--export 导出全部日志行而不只是命中行（可不指定 --ip）", "make --export write every log line, not only the matches (--ip becomes optional)"),
+	},
+}
+
+// 一种导出格式：header 为文件开头的内容（可为 nil），line 把一条日志转换为一行（不含换行符），
+// finding 把一条规则告警转换为一行（可为 nil，表示不导出告警）
+type exportFormat struct {
+	header  func() string
+	line    func(rec *logRecord) string
+	finding func(f *result.Finding) string
+}
+
+var exportFormats = map[string]exportFormat{
+	"combined": {line: combinedLogLine},
+	"w3c":      {header: w3cHeader, line: w3cLogLine},
+	"cef":      {line: cefLogLine, finding: cefFinding},
+	"leef":     {line: leefLogLine, finding: leefFinding},
+}
+
+// --export 的导出文件；nil 表示未启用
+var logExport *exporter
+
+type exporter struct {
+	path   string
+	format exportFormat
+	// 导出全部日志行：在扫描时写入；否则在生成结果时写入命中行
+	all bool
+
+	mu   sync.Mutex
+	file *os.File
+	// --encrypt-to 时为加密流，否则直接写入 file
+	enc      io.WriteCloser
+	w        *bufio.Writer
+	lines    int64
+	skipped  int64
+	findings int
+}
+
+func loadExportConfig(c *cli.Context) error {
+	logExport = nil
+	path := c.String("export")
+	if path == "" {
+		if c.Bool("export-all") {
+			return errors.New(tr("--export-all 需要同时指定 --export", "--export-all requires --export"))
+		}
+		return nil
+	}
+	name := c.String("export-format")
+	format, ok := exportFormats[name]
+	if !ok {
+		return fmt.Errorf(tr("不支持的 --export-format %q", "unsupported --export-format %q"), name)
+	}
+	all := c.Bool("export-all")
+	if !all && (config.countOnly || config.summaryOnly) {
+		return errors.New(tr("--count 和 --summary-only 不保留命中行，只能与 --export-all 一起使用 --export", "--count and --summary-only keep no matched lines; use --export together with --export-all"))
+	}
+	path = encryptedPath(path)
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf(tr("创建导出文件失败: %w", "create export file: %w"), err)
+	}
+	enc, err := encryptWriter(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	e := &exporter{path: path, format: format, all: all, file: f, enc: enc, w: bufio.NewWriterSize(enc, 256*1024)}
+	if format.header != nil {
+		e.w.WriteString(format.header())
+	}
+	logExport = e
+	return nil
+}
+
+// 为一次扫描创建独立的缓冲；只导出命中行时不需要在扫描中处理
+func (e *exporter) newState() *exportState {
+	if e == nil || !e.all {
+		return nil
+	}
+	return &exportState{}
+}
+
+// 单次扫描的导出缓冲，攒够一批后再加锁写入文件
+type exportState struct {
+	buf   bytes.Buffer
+	lines int64
+}
+
+func (st *exportState) observe(rec *logRecord) {
+	if st == nil {
+		return
+	}
+	st.buf.WriteString(logExport.format.line(rec))
+	st.buf.WriteByte('\n')
+	st.lines++
+	if st.buf.Len() >= 64*1024 {
+		logExport.merge(st)
+	}
+}
+
+// 把一次扫描缓冲的内容写入导出文件
+func (e *exporter) merge(st *exportState) {
+	if e == nil || st == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(st.buf.Bytes())
+	e.lines += st.lines
+	st.buf.Reset()
+	st.lines = 0
+}
+
+// 写入命中行（只导出命中行时）并关闭导出文件
+func (e *exporter) finish(results map[string]*fileResult) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	if !e.all {
+		var rec logRecord
+		write := func(line string) {
+			if parseLogLine(line, &rec) != nil {
+				e.skipped++
+				return
+			}
+			e.w.WriteString(e.format.line(&rec))
+			e.w.WriteByte('\n')
+			e.lines++
+		}
+		if config.mergeByTime {
+			mergedMatches(results, func(_, line string, _ time.Time) error {
+				write(line)
+				return nil
+			})
+		} else {
+			for _, file := range sortedFiles(results) {
+				results[file].eachMatch(func(line string) error {
+					write(line)
+					return nil
+				})
+			}
+		}
+	}
+	if e.format.finding != nil && results != nil {
+		for _, f := range ruleSet.findings() {
+			e.w.WriteString(e.format.finding(&f))
+			e.w.WriteByte('\n')
+			e.findings++
+		}
+	}
+	err := e.w.Flush()
+	if cerr := e.enc.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+	e.file = nil
+	if err != nil {
+		return fmt.Errorf(tr("写入导出文件 %s 失败: %w", "write export file %s: %w"), e.path, err)
+	}
+	fmt.Printf(tr("已导出 %d 行日志到 %s\n", "Exported %d log lines to %s\n"), e.lines, e.path)
+	if e.findings > 0 {
+		fmt.Printf(tr("已导出 %d 条规则告警到 %s\n", "Exported %d rule findings to %s\n"), e.findings, e.path)
+	}
+	if e.skipped > 0 {
+		fmt.Fprintf(os.Stderr, tr("警告: %d 行命中的日志格式无法识别，未导出\n", "Warning: %d matched lines have an unrecognized format and were not exported\n"), e.skipped)
+	}
+	return nil
+}
+
+// Apache combined 格式：%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func combinedLogLine(rec *logRecord) string {
+	size := "-"
+	if rec.ResponseSize > 0 {
+		size = strconv.FormatInt(rec.ResponseSize, 10)
+	}
+	return fmt.Sprintf(`%s - - [%s] "%s %s HTTP/1.1" %d %s "%s" "%s"`,
+		rec.ClientIP, normalizeTime(rec.Time).Format("02/Jan/2006:15:04:05 -0700"),
+		rec.Method, requestURI(rec.URL), rec.Status, size,
+		quoteLogField(rec.Referer), quoteLogField(rec.UserAgent))
+}
+
+// W3C 扩展日志格式的字段，顺序与 w3cLogLine 一致
+const w3cFields = "date time c-ip cs-method cs-uri-stem cs-uri-query sc-status sc-bytes cs-bytes time-taken cs(Referer) cs(User-Agent) sc(Content-Type) x-hit-info"
+
+func w3cHeader() string {
+	return "#Software: cdn-log-analyzer\n#Version: 1.0\n#Date: " + time.Now().UTC().Format(time.DateTime) +
+		"\n#Fields: " + w3cFields + "\n"
+}
+
+// W3C 扩展日志格式：时间按规范使用 UTC，time-taken 单位为秒；字段以空格分隔，字段中的空格按 IIS 的习惯替换为 +
+func w3cLogLine(rec *logRecord) string {
+	path, query := rec.URL, ""
+	if u, err := url.Parse(rec.URL); err == nil {
+		path, query = u.EscapedPath(), u.RawQuery
+	}
+	t := rec.Time.UTC()
+	return strings.Join([]string{
+		t.Format(time.DateOnly), t.Format(time.TimeOnly), w3cField(rec.ClientIP), w3cField(rec.Method),
+		w3cField(path), w3cField(query), strconv.Itoa(rec.Status),
+		strconv.FormatInt(rec.ResponseSize, 10), strconv.FormatInt(rec.RequestSize, 10),
+		strconv.FormatFloat(float64(rec.ResponseTime)/1000, 'f', 3, 64),
+		w3cField(rec.Referer), w3cField(rec.UserAgent), w3cField(rec.ContentType), w3cField(rec.HitInfo),
+	}, " ")
+}
+
+// 空值写为 -，空白字符替换为 +
+func w3cField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return '+'
+		}
+		return r
+	}, s)
+}
+
+// CDN日志中的URL带协议和域名，访问日志的请求行只需要路径和查询参数
+func requestURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	return u.RequestURI()
+}
+
+// 双引号内字段中的引号和反斜杠需要转义，空值写为 -
+func quoteLogField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 规则过滤表达式，例如：
+//
+//	path startswith "/login" && method == "POST" && status >= 400
+//
+// 支持 == != > >= < <= =~ !~ contains startswith endswith in，&& || ! 以及括号。
+// 字段名见 exprFields，函数见 exprFuncs，字符串用双引号，in 的右侧为 ["a", "b"] 形式的列表。
+type expr interface {
+	eval(rec *logRecord) exprValue
+}
+
+// 表达式的值：字符串、数字或布尔
+type exprValue struct {
+	kind exprKind
+	str  string
+	num  float64
+	b    bool
+}
+
+type exprKind int
+
+const (
+	kindString exprKind = iota
+	kindNumber
+	kindBool
+)
+
+func (v exprValue) String() string {
+	switch v.kind {
+	case kindNumber:
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	case kindBool:
+		return strconv.FormatBool(v.b)
+	}
+	return v.str
+}
+
+func stringValue(s string) exprValue  { return exprValue{kind: kindString, str: s} }
+func numberValue(n float64) exprValue { return exprValue{kind: kindNumber, num: n} }
+func boolValue(b bool) exprValue      { return exprValue{kind: kindBool, b: b} }
+
+// 表达式和分组中可以使用的日志字段
+var exprFields = map[string]func(rec *logRecord) exprValue{
+	"client_ip":     func(r *logRecord) exprValue { return stringValue(r.ClientIP) },
+	"proxy_ip":      func(r *logRecord) exprValue { return stringValue(r.ProxyIP) },
+	"response_time": func(r *logRecord) exprValue { return numberValue(float64(r.ResponseTime)) },
+	"referer":       func(r *logRecord) exprValue { return stringValue(r.Referer) },
+	"method":        func(r *logRecord) exprValue { return stringValue(r.Method) },
+	"url":           func(r *logRecord) exprValue { return stringValue(r.URL) },
+	"host":          func(r *logRecord) exprValue { host, _, _ := splitURL(r.URL); return stringValue(host) },
+	"path":          func(r *logRecord) exprValue { _, path, _ := splitURL(r.URL); return stringValue(path) },
+	"query":         func(r *logRecord) exprValue { _, _, query := splitURL(r.URL); return stringValue(query) },
+	"status":        func(r *logRecord) exprValue { return numberValue(float64(r.Status)) },
+	"request_size":  func(r *logRecord) exprValue { return numberValue(float64(r.RequestSize)) },
+	"response_size": func(r *logRecord) exprValue { return numberValue(float64(r.ResponseSize)) },
+	"hit_info":      func(r *logRecord) exprValue { return stringValue(r.HitInfo) },
+	"user_agent":    func(r *logRecord) exprValue { return stringValue(r.UserAgent) },
+	"content_type":  func(r *logRecord) exprValue { return stringValue(r.ContentType) },
+	// 由 User-Agent 解析得到
+	"browser": func(r *logRecord) exprValue { return stringValue(parseUserAgent(r.UserAgent).browser) },
+	"os":      func(r *logRecord) exprValue { return stringValue(parseUserAgent(r.UserAgent).os) },
+	"device":  func(r *logRecord) exprValue { return stringValue(parseUserAgent(r.UserAgent).device) },
+	// 按爬虫特征库匹配，不是已知爬虫时为空
+	"crawler":          func(r *logRecord) exprValue { return stringValue(crawlerField(r.UserAgent).Name) },
+	"crawler_category": func(r *logRecord) exprValue { return stringValue(crawlerField(r.UserAgent).Category) },
+	// 路径的扩展名（小写，不含点）、去掉参数的 Content-Type，以及由两者判断的资源类型（见 fileType）
+	"extension": func(r *logRecord) exprValue { _, path, _ := splitURL(r.URL); return stringValue(fileExtension(path)) },
+	"mime_type": func(r *logRecord) exprValue { return stringValue(mimeType(r.ContentType)) },
+	"file_type": func(r *logRecord) exprValue {
+		_, path, _ := splitURL(r.URL)
+		return stringValue(fileType(path, r.ContentType))
+	},
+	// 包含 client_ip 的第一个威胁情报源（--intel-feed），不在情报源中时为空
+	"intel_feed": func(r *logRecord) exprValue { return stringValue(intelFeedOf(r.ClientIP)) },
+	// 包含客户端IP或代理IP的 --ip-file 条目
+	"suspect": func(r *logRecord) exprValue { return stringValue(suspectOf(r)) },
+}
+
+// 将日志中的完整URL拆分为域名、路径和查询字符串
+func splitURL(u string) (host, path, query string) {
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+		if j := strings.IndexByte(u, '/'); j >= 0 {
+			host, u = u[:j], u[j:]
+		} else {
+			host, u = u, "/"
+		}
+	}
+	path, query, _ = strings.Cut(u, "?")
+	return host, path, query
+}
+
+// 解析表达式
+func parseExpr(src string) (expr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf(tr("表达式中有多余的内容: %q", "unexpected %q in expression"), p.peek().text)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// 表达式中的运算符，较长的写在前面
+var exprOps = []string{"&&", "||", "==", "!=", ">=", "<=", "=~", "!~", ">", "<", "!", "(", ")", "[", "]", ","}
+
+func tokenizeExpr(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			// 双引号字符串，支持 Go 的转义规则
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, errors.New(tr("表达式中的字符串缺少结束引号", "unterminated string in expression"))
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf(tr("表达式中的字符串无效 %s: %w", "invalid string %s in expression: %w"), src[i:j+1], err)
+			}
+			tokens = append(tokens, token{tokString, s})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, src[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, src[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf(tr("表达式中有无法识别的字符 %q", "unexpected character %q in expression"), c)
+			}
+			tokens = append(tokens, token{tokOp, op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// 递归下降解析器，优先级从低到高：|| && ! 比较
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token { return p.tokens[p.pos] }
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// 当前记号是否为指定的运算符或关键字，是则跳过
+func (p *exprParser) accept(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf(tr("表达式中缺少 %q", "expected %q in expression"), text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (expr, error) {
+	if p.accept("!", "not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == ">" || t.text == ">=" || t.text == "<" || t.text == "<="):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{op: t.text, left: left, right: right}, nil
+	case t.kind == tokOp && (t.text == "=~" || t.text == "!~"):
+		p.next()
+		pattern := p.next()
+		if pattern.kind != tokString {
+			return nil, fmt.Errorf(tr("%s 右侧必须是字符串形式的正则表达式", "right side of %s must be a regular expression string"), t.text)
+		}
+		re, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, fmt.Errorf(tr("无效的正则表达式 %q: %w", "invalid regular expression %q: %w"), pattern.text, err)
+		}
+		return regexpExpr{e: left, re: re, negate: t.text == "!~"}, nil
+	case t.kind == tokIdent && (t.text == "contains" || t.text == "startswith" || t.text == "endswith"):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return stringOpExpr{op: t.text, left: left, right: right}, nil
+	case t.kind == tokIdent && t.text == "in":
+		p.next()
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inExpr{e: left, list: list}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseList() ([]exprValue, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var list []exprValue
+	for !p.accept("]") {
+		if len(list) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		e, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := e.(literalExpr)
+		if !ok {
+			return nil, errors.New(tr("in 的列表中只能包含字符串或数字", "in list may only contain strings and numbers"))
+		}
+		list = append(list, exprValue(lit))
+	}
+	return list, nil
+}
+
+func (p *exprParser) parseOperand() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literalExpr(stringValue(t.text)), nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf(tr("无效的数字 %q", "invalid number %q"), t.text)
+		}
+		return literalExpr(numberValue(n)), nil
+	case tokIdent:
+		if t.text == "true" || t.text == "false" {
+			return literalExpr(boolValue(t.text == "true")), nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t.text)
+		}
+		field, ok := exprFields[t.text]
+		if !ok {
+			return nil, fmt.Errorf(tr("未知字段 %q", "unknown field %q"), t.text)
+		}
+		return fieldExpr{name: t.text, get: field}, nil
+	case tokOp:
+		if t.text == "(" {
+			e, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+	case tokEOF:
+		return nil, errors.New(tr("表达式不完整", "incomplete expression"))
+	}
+	return nil, fmt.Errorf(tr("表达式中有意外的 %q", "unexpected %q in expression"), t.text)
+}
+
+// 解析函数调用的参数，函数名后的左括号已读取
+func (p *exprParser) parseCall(name string) (expr, error) {
+	fn, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf(tr("未知函数 %q", "unknown function %q"), name)
+	}
+	var args []expr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) != fn.args {
+		return nil, fmt.Errorf(tr("函数 %s 需要 %d 个参数", "function %s takes %d arguments"), name, fn.args)
+	}
+	call, err := fn.build(args)
+	if err != nil {
+		return nil, fmt.Errorf(tr("函数 %s: %w", "function %s: %w"), name, err)
+	}
+	return callExpr{args: args, call: call}, nil
+}
+
+// 表达式中可以使用的函数：args 为参数个数，build 在解析时检查参数并返回求值函数
+var exprFuncs = map[string]struct {
+	args  int
+	build func(args []expr) (func(vals []exprValue) exprValue, error)
+}{
+	// 正则的第一个捕获组，没有捕获组时为整个匹配，不匹配时为空字符串
+	"regex": {2, func(args []expr) (func([]exprValue) exprValue, error) {
+		lit, ok := args[1].(literalExpr)
+		if !ok || lit.kind != kindString {
+			return nil, errors.New(tr("第二个参数必须是字符串形式的正则表达式", "second argument must be a regular expression string"))
+		}
+		re, err := regexp.Compile(lit.str)
+		if err != nil {
+			return nil, fmt.Errorf(tr("无效的正则表达式 %q: %w", "invalid regular expression %q: %w"), lit.str, err)
+		}
+		return func(vals []exprValue) exprValue {
+			m := re.FindStringSubmatch(vals[0].String())
+			switch {
+			case m == nil:
+				return stringValue("")
+			case len(m) > 1:
+				return stringValue(m[1])
+			}
+			return stringValue(m[0])
+		}, nil
+	}},
+	"prefix": {2, stringFunc(func(s []string) exprValue { return boolValue(strings.HasPrefix(s[0], s[1])) })},
+	"suffix": {2, stringFunc(func(s []string) exprValue { return boolValue(strings.HasSuffix(s[0], s[1])) })},
+	"lower":  {1, stringFunc(func(s []string) exprValue { return stringValue(strings.ToLower(s[0])) })},
+	"upper":  {1, stringFunc(func(s []string) exprValue { return stringValue(strings.ToUpper(s[0])) })},
+	"len":    {1, stringFunc(func(s []string) exprValue { return numberValue(float64(len(s[0]))) })},
+	// 按分隔符拆分后的第 n 段（从 0 开始），不存在时为空字符串
+	"split": {3, stringFunc(func(s []string) exprValue {
+		n, err := strconv.Atoi(s[2])
+		parts := strings.Split(s[0], s[1])
+		if err != nil || n < 0 || n >= len(parts) {
+			return stringValue("")
+		}
+		return stringValue(parts[n])
+	})},
+	// 路径的前 n 级目录，不含文件名，如 dir("/a/b/c.js", 1) 为 /a
+	"dir": {2, stringFunc(func(s []string) exprValue {
+		n, err := strconv.Atoi(s[1])
+		if err != nil || n < 1 {
+			return stringValue("")
+		}
+		return stringValue(pathDir(s[0], n))
+	})},
+	// 转换为数字，无法转换时为 0
+	"num": {1, stringFunc(func(s []string) exprValue {
+		n, _ := strconv.ParseFloat(s[0], 64)
+		return numberValue(n)
+	})},
+	// 条件为真时取第二个参数，否则取第三个
+	"if": {3, func([]expr) (func([]exprValue) exprValue, error) {
+		return func(vals []exprValue) exprValue {
+			if vals[0].truthy() {
+				return vals[1]
+			}
+			return vals[2]
+		}, nil
+	}},
+}
+
+// 参数都按字符串处理的函数
+func stringFunc(f func(s []string) exprValue) func([]expr) (func([]exprValue) exprValue, error) {
+	return func([]expr) (func([]exprValue) exprValue, error) {
+		return func(vals []exprValue) exprValue {
+			s := make([]string, len(vals))
+			for i, v := range vals {
+				s[i] = v.String()
+			}
+			return f(s)
+		}, nil
+	}
+}
+
+type callExpr struct {
+	args []expr
+	call func(vals []exprValue) exprValue
+}
+
+func (e callExpr) eval(rec *logRecord) exprValue {
+	vals := make([]exprValue, len(e.args))
+	for i, arg := range e.args {
+		vals[i] = arg.eval(rec)
+	}
+	return e.call(vals)
+}
+
+type literalExpr exprValue
+
+func (e literalExpr) eval(*logRecord) exprValue { return exprValue(e) }
+
+type fieldExpr struct {
+	name string
+	get  func(rec *logRecord) exprValue
+}
+
+func (e fieldExpr) eval(rec *logRecord) exprValue { return e.get(rec) }
+
+// 值的真假：布尔值本身、非零数字、非空字符串
+func (v exprValue) truthy() bool {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.num != 0
+	}
+	return v.str != ""
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) eval(rec *logRecord) exprValue {
+	return boolValue(e.left.eval(rec).truthy() && e.right.eval(rec).truthy())
+}
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) eval(rec *logRecord) exprValue {
+	return boolValue(e.left.eval(rec).truthy() || e.right.eval(rec).truthy())
+}
+
+type notExpr struct{ e expr }
+
+func (e notExpr) eval(rec *logRecord) exprValue { return boolValue(!e.e.eval(rec).truthy()) }
+
+// 比较两个值：两侧都是数字时按数值比较，否则按字符串比较
+func compareValues(a, b exprValue) int {
+	if a.kind == kindNumber && b.kind == kindNumber {
+		switch {
+		case a.num < b.num:
+			return -1
+		case a.num > b.num:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
+type compareExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e compareExpr) eval(rec *logRecord) exprValue {
+	c := compareValues(e.left.eval(rec), e.right.eval(rec))
+	switch e.op {
+	case "==":
+		return boolValue(c == 0)
+	case "!=":
+		return boolValue(c != 0)
+	case ">":
+		return boolValue(c > 0)
+	case ">=":
+		return boolValue(c >= 0)
+	case "<":
+		return boolValue(c < 0)
+	}
+	return boolValue(c <= 0)
+}
+
+type regexpExpr struct {
+	e      expr
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (e regexpExpr) eval(rec *logRecord) exprValue {
+	return boolValue(e.re.MatchString(e.e.eval(rec).String()) != e.negate)
+}
+
+type stringOpExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e stringOpExpr) eval(rec *logRecord) exprValue {
+	s, sub := e.left.eval(rec).String(), e.right.eval(rec).String()
+	switch e.op {
+	case "contains":
+		return boolValue(strings.Contains(s, sub))
+	case "startswith":
+		return boolValue(strings.HasPrefix(s, sub))
+	}
+	return boolValue(strings.HasSuffix(s, sub))
+}
+
+type inExpr struct {
+	e    expr
+	list []exprValue
+}
+
+func (e inExpr) eval(rec *logRecord) exprValue {
+	v := e.e.eval(rec)
+	for _, item := range e.list {
+		if compareValues(v, item) == 0 {
+			return boolValue(true)
+		}
+	}
+	return boolValue(false)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 派生字段的参数
+var fieldFlags = []cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "field",
+		Usage: tr("定义派生字段，形式为 名称 = 表达式，如 'is_api = prefix(path, \"/api/\")'，可在过滤条件、分组和结果中使用，可多次指定", "define a derived field as name = expression, e.g. 'is_api = prefix(path, \"/api/\")', usable in filters, group-bys and results; repeatable"),
+	},
+}
+
+// 用户定义的派生字段，按定义顺序排列，后定义的字段可以引用先定义的
+var derivedFields []derivedField
+
+type derivedField struct {
+	name string
+	e    expr
+}
+
+// 清除已定义的派生字段
+func resetDerivedFields() {
+	for _, f := range derivedFields {
+		delete(exprFields, f.name)
+	}
+	derivedFields = nil
+}
+
+// 定义派生字段，def 的形式为 "名称 = 表达式"
+func defineField(def string) error {
+	name, src, ok := strings.Cut(def, "=")
+	name, src = strings.TrimSpace(name), strings.TrimSpace(src)
+	if !ok || !isFieldName(name) || src == "" {
+		return fmt.Errorf(tr("无效的派生字段定义 %q，应为 名称 = 表达式", "invalid field definition %q, use name = expression"), def)
+	}
+	if _, exists := exprFields[name]; exists || name == "true" || name == "false" {
+		return fmt.Errorf(tr("字段 %q 已存在", "field %q already exists"), name)
+	}
+	e, err := parseExpr(src)
+	if err != nil {
+		return fmt.Errorf(tr("派生字段 %s: %w", "field %s: %w"), name, err)
+	}
+	derivedFields = append(derivedFields, derivedField{name: name, e: e})
+	exprFields[name] = e.eval
+	return nil
+}
+
+// 字段名只能由字母、数字和下划线组成，且不以数字开头
+func isFieldName(s string) bool {
+	tokens, err := tokenizeExpr(s)
+	return err == nil && len(tokens) == 2 && tokens[0].kind == tokIdent
+}
+
+// 日志记录的派生字段取值，没有定义派生字段时为 nil
+func (r *logRecord) derivedValues() map[string]string {
+	if len(derivedFields) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(derivedFields))
+	for _, f := range derivedFields {
+		values[f.name] = f.e.eval(r).String()
+	}
+	return values
+}
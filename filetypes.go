@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// analyze types：按扩展名、Content-Type 和资源类型统计请求数和流量
+var typesCommand = &cli.Command{
+	Name:  "types",
+	Usage: tr("按文件扩展名、Content-Type 和资源类型（图片、视频、脚本/样式、接口等）统计请求数、占比和流量", "break down requests, share and bytes by file extension, content type and resource type (images, video, scripts/styles, API and so on)"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+	},
+	Action: runTypesReport,
+}
+
+func runTypesReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	var reports []*groupBy
+	for _, field := range []string{"file_type", "extension", "mime_type"} {
+		g, err := newGroupBy(field, field, "count,share,bytes,distinct(path)", c.String("filter"))
+		if err != nil {
+			return err
+		}
+		reports = append(reports, g)
+	}
+	return runAggregates(c, reports, nil)
+}
+
+// 扩展名（小写，不含点）→ 资源类型
+var extFileTypes = extensionIndex(map[string][]string{
+	"image":    {"png", "jpg", "jpeg", "gif", "webp", "avif", "bmp", "tif", "tiff", "heic", "svg", "ico"},
+	"video":    {"mp4", "webm", "mov", "flv", "mkv", "avi", "m3u8", "mpd", "ts", "m4s"},
+	"audio":    {"mp3", "m4a", "aac", "ogg", "wav", "flac"},
+	"script":   {"js", "mjs", "css", "map", "wasm"},
+	"font":     {"woff", "woff2", "ttf", "otf", "eot"},
+	"document": {"html", "htm", "pdf", "txt", "doc", "docx", "xls", "xlsx", "ppt", "pptx"},
+	"api":      {"json", "xml", "php", "asp", "aspx", "jsp", "do"},
+	"download": {"zip", "gz", "tgz", "rar", "7z", "apk", "ipa", "exe", "dmg", "msi", "bin", "iso", "deb", "rpm"},
+})
+
+// 把 类型 → 扩展名列表 转为 扩展名 → 类型
+func extensionIndex(types map[string][]string) map[string]string {
+	index := make(map[string]string)
+	for t, exts := range types {
+		for _, ext := range exts {
+			index[ext] = t
+		}
+	}
+	return index
+}
+
+// 路径的扩展名（小写，不含点），没有扩展名时为空
+func fileExtension(p string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(p), "."))
+}
+
+// Content-Type 去掉参数（如 charset）后的小写形式，日志中没有时为空
+func mimeType(contentType string) string {
+	t, _, _ := strings.Cut(contentType, ";")
+	t = strings.ToLower(strings.TrimSpace(t))
+	if t == "-" {
+		return ""
+	}
+	return t
+}
+
+// 资源类型：image、video、audio、script、font、document、api、download 或 other；
+// 优先按扩展名判断，没有已知的扩展名时按路径中的 /api/ 和 Content-Type
+func fileType(p, contentType string) string {
+	ext := fileExtension(p)
+	if t, ok := extFileTypes[ext]; ok {
+		return t
+	}
+	if ext == "" && strings.Contains(p, "/api/") {
+		return "api"
+	}
+	mime := mimeType(contentType)
+	major, minor, _ := strings.Cut(mime, "/")
+	switch {
+	case major == "image" || major == "video" || major == "audio" || major == "font":
+		return major
+	case strings.Contains(minor, "javascript") || mime == "text/css":
+		return "script"
+	case strings.Contains(minor, "json") || strings.Contains(minor, "xml") || strings.Contains(minor, "protobuf"):
+		return "api"
+	case mime == "text/html" || mime == "text/plain" || mime == "application/pdf":
+		return "document"
+	case minor == "zip" || minor == "gzip" || minor == "octet-stream" || strings.Contains(minor, "android.package"):
+		return "download"
+	}
+	return "other"
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 以 Fluentd forward 协议发送命中行和告警，可直接接入 Fluent Bit/Fluentd 的 forward 输入
+var fluentFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "fluent",
+		Usage: tr("把命中行和告警以 forward 协议发送到 Fluent Bit/Fluentd，如 127.0.0.1:24224、unix:///var/run/fluent.sock", "send matched lines and alerts to Fluent Bit/Fluentd over the forward protocol, e.g. 127.0.0.1:24224 or unix:///var/run/fluent.sock"),
+	},
+	&cli.StringFlag{
+		Name:  "fluent-tag",
+		Value: "cdn",
+		Usage: tr("forward 记录的标签前缀，实际标签为 <前缀>.match、<前缀>.finding 或 <前缀>.alert", "tag prefix of the forward records; the tags are <prefix>.match, <prefix>.finding and <prefix>.alert"),
+	},
+}
+
+// 每批发送的记录数
+const fluentBatchSize = 500
+
+type fluentSink struct {
+	target  string
+	network string
+	addr    string
+	tag     string
+
+	conn net.Conn
+	w    *bufio.Writer
+	// 按标签缓冲的记录，攒够一批后以 Forward 模式发送
+	pending map[string][]*sinkEvent
+}
+
+func loadFluentSink(c *cli.Context) (outputSink, error) {
+	target := c.String("fluent")
+	if target == "" {
+		return nil, nil
+	}
+	s := &fluentSink{target: target, network: "tcp", addr: target, tag: c.String("fluent-tag"), pending: make(map[string][]*sinkEvent)}
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf(tr("--fluent 地址无效 %q", "invalid --fluent address %q"), target)
+		}
+		switch u.Scheme {
+		case "tcp":
+			s.addr = u.Host
+		case "unix":
+			s.network, s.addr = "unix", u.Path
+		default:
+			return nil, fmt.Errorf(tr("--fluent 不支持的协议 %q，可选 tcp 或 unix", "unsupported --fluent scheme %q, use tcp or unix"), u.Scheme)
+		}
+	}
+	if s.network == "tcp" {
+		if _, _, err := net.SplitHostPort(s.addr); err != nil {
+			s.addr = net.JoinHostPort(s.addr, "24224")
+		}
+	}
+	if s.tag == "" {
+		return nil, errors.New(tr("--fluent-tag 不能为空", "--fluent-tag must not be empty"))
+	}
+	return s, nil
+}
+
+func (s *fluentSink) String() string { return "fluent " + s.target }
+
+func (s *fluentSink) send(ev *sinkEvent) error {
+	tag := s.tag + "." + ev.kind
+	s.pending[tag] = append(s.pending[tag], ev)
+	if len(s.pending[tag]) >= fluentBatchSize {
+		return s.flush(tag)
+	}
+	return nil
+}
+
+// Forward 模式：[tag, [[time, record], ...], {"size": n}]
+func (s *fluentSink) flush(tag string) error {
+	events := s.pending[tag]
+	if len(events) == 0 {
+		return nil
+	}
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn, s.w = conn, bufio.NewWriter(conn)
+	}
+	var b msgpackBuffer
+	b.arrayHeader(3)
+	b.value(tag)
+	b.arrayHeader(len(events))
+	for _, ev := range events {
+		b.arrayHeader(2)
+		b.eventTime(ev.time)
+		b.value(ev.fields())
+	}
+	b.value(map[string]any{"size": len(events)})
+	delete(s.pending, tag)
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *fluentSink) close() error {
+	var err error
+	tags := make([]string, 0, len(s.pending))
+	for tag := range s.pending {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	for _, tag := range tags {
+		if err = s.flush(tag); err != nil {
+			break
+		}
+	}
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+		s.conn = nil
+	}
+	return err
+}
+
+// 只支持 forward 记录中用到的类型的 MessagePack 编码
+type msgpackBuffer []byte
+
+func (b *msgpackBuffer) arrayHeader(n int) {
+	switch {
+	case n < 16:
+		*b = append(*b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		*b = binary.BigEndian.AppendUint16(append(*b, 0xdc), uint16(n))
+	default:
+		*b = binary.BigEndian.AppendUint32(append(*b, 0xdd), uint32(n))
+	}
+}
+
+func (b *msgpackBuffer) mapHeader(n int) {
+	switch {
+	case n < 16:
+		*b = append(*b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		*b = binary.BigEndian.AppendUint16(append(*b, 0xde), uint16(n))
+	default:
+		*b = binary.BigEndian.AppendUint32(append(*b, 0xdf), uint32(n))
+	}
+}
+
+func (b *msgpackBuffer) str(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		*b = append(*b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		*b = append(*b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		*b = binary.BigEndian.AppendUint16(append(*b, 0xda), uint16(n))
+	default:
+		*b = binary.BigEndian.AppendUint32(append(*b, 0xdb), uint32(n))
+	}
+	*b = append(*b, s...)
+}
+
+func (b *msgpackBuffer) int(v int64) {
+	switch {
+	case v >= 0 && v < 128:
+		*b = append(*b, byte(v))
+	case v < 0 && v >= -32:
+		*b = append(*b, byte(v))
+	default:
+		*b = binary.BigEndian.AppendUint64(append(*b, 0xd3), uint64(v))
+	}
+}
+
+// Fluentd 的 EventTime 扩展类型（类型 0）：秒和纳秒各 4 字节
+func (b *msgpackBuffer) eventTime(t time.Time) {
+	*b = append(*b, 0xd7, 0x00)
+	*b = binary.BigEndian.AppendUint32(*b, uint32(t.Unix()))
+	*b = binary.BigEndian.AppendUint32(*b, uint32(t.Nanosecond()))
+}
+
+func (b *msgpackBuffer) value(v any) {
+	switch v := v.(type) {
+	case nil:
+		*b = append(*b, 0xc0)
+	case bool:
+		if v {
+			*b = append(*b, 0xc3)
+		} else {
+			*b = append(*b, 0xc2)
+		}
+	case int:
+		b.int(int64(v))
+	case int64:
+		b.int(v)
+	case float64:
+		*b = binary.BigEndian.AppendUint64(append(*b, 0xcb), math.Float64bits(v))
+	case string:
+		b.str(v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		b.mapHeader(len(keys))
+		for _, k := range keys {
+			b.str(k)
+			b.value(v[k])
+		}
+	default:
+		b.str(fmt.Sprint(v))
+	}
+}
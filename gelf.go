@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 以 GELF 格式发送命中行和告警到 Graylog
+var gelfFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "gelf",
+		Usage: tr("把命中行和告警以 GELF 格式发送到 Graylog，如 udp://graylog:12201、tcp://graylog:12201", "send matched lines and alerts as GELF to Graylog, e.g. udp://graylog:12201 or tcp://graylog:12201"),
+	},
+	&cli.IntFlag{
+		Name:  "gelf-chunk-size",
+		Value: 1420,
+		Usage: tr("UDP 数据报的最大字节数，超过时按 GELF 分块发送", "maximum UDP datagram size; larger messages are sent as GELF chunks"),
+	},
+}
+
+// GELF 分块的块头长度和最多块数
+const (
+	gelfChunkHeader = 12
+	gelfMaxChunks   = 128
+)
+
+type gelfSink struct {
+	target    string
+	network   string
+	addr      string
+	chunkSize int
+
+	conn net.Conn
+}
+
+func loadGELFSink(c *cli.Context) (outputSink, error) {
+	target := c.String("gelf")
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf(tr("--gelf 地址无效 %q，格式如 udp://graylog:12201", "invalid --gelf address %q, use e.g. udp://graylog:12201"), target)
+	}
+	s := &gelfSink{target: target, network: u.Scheme, addr: u.Host, chunkSize: c.Int("gelf-chunk-size")}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "12201")
+	}
+	if s.chunkSize <= gelfChunkHeader {
+		return nil, fmt.Errorf(tr("--gelf-chunk-size 必须大于 %d", "--gelf-chunk-size must be greater than %d"), gelfChunkHeader)
+	}
+	return s, nil
+}
+
+func (s *gelfSink) String() string { return "gelf " + s.target }
+
+// GELF 1.1 消息，附加字段以 _ 开头
+func (s *gelfSink) message(ev *sinkEvent) map[string]any {
+	msg := map[string]any{
+		"version":       "1.1",
+		"host":          ev.domain(),
+		"short_message": ev.message(),
+		"timestamp":     float64(ev.time.UnixMilli()) / 1000,
+		"level":         syslogSeverities[ev.severity],
+	}
+	for k, v := range ev.fields() {
+		if k != "message" {
+			msg["_"+k] = v
+		}
+	}
+	return msg
+}
+
+func (s *gelfSink) send(ev *sinkEvent) error {
+	msg := s.message(ev)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// UDP 消息超过分块上限时截断，仍然过大时只跳过这一条，不影响之后的消息
+	if limit := (s.chunkSize - gelfChunkHeader) * gelfMaxChunks; s.network == "udp" && len(data) > limit {
+		if data = truncateGELF(msg, data, limit); data == nil {
+			fmt.Fprintf(os.Stderr, tr("警告: GELF 消息过大，超过 %d 个分块，已跳过\n", "Warning: GELF message larger than %d chunks, skipped\n"), gelfMaxChunks)
+			return nil
+		}
+	}
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	// TCP 中每条消息以空字节结尾
+	if s.network == "tcp" {
+		_, err := s.conn.Write(append(data, 0))
+		return err
+	}
+	if len(data) <= s.chunkSize {
+		_, err := s.conn.Write(data)
+		return err
+	}
+	return s.writeChunks(data)
+}
+
+// 分块：每块以 0x1e 0x0f、8 字节消息ID、块序号和块数开头
+func (s *gelfSink) writeChunks(data []byte) error {
+	size := s.chunkSize - gelfChunkHeader
+	count := (len(data) + size - 1) / size
+	var id [8]byte
+	rand.Read(id[:])
+	chunk := make([]byte, 0, s.chunkSize)
+	for i := range count {
+		part := data[i*size : min((i+1)*size, len(data))]
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, part...)
+		if _, err := s.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 截断后字符串字段的结尾
+const gelfTruncated = "...(truncated)"
+
+// 逐次截断最长的字符串字段（通常是 short_message 或 _line），直到消息不超过 limit 字节；
+// 无法再截断时返回 nil
+func truncateGELF(msg map[string]any, data []byte, limit int) []byte {
+	for len(data) > limit {
+		key, longest := "", 0
+		for k, v := range msg {
+			if v, ok := v.(string); ok && k != "version" && k != "host" && len(v) > longest {
+				key, longest = k, len(v)
+			}
+		}
+		if longest == 0 {
+			return nil
+		}
+		v := msg[key].(string)
+		n := len(v) - (len(data) - limit) - len(gelfTruncated)
+		if n <= 0 {
+			msg[key] = ""
+		} else {
+			// 不在 UTF-8 字符中间截断
+			for n > 0 && !utf8.RuneStart(v[n]) {
+				n--
+			}
+			msg[key] = v[:n] + gelfTruncated
+		}
+		var err error
+		if data, err = json.Marshal(msg); err != nil {
+			return nil
+		}
+	}
+	return data
+}
+
+func (s *gelfSink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// analyze 子命令：在全部日志上做聚合统计，不需要指定搜索IP
+var analyzeCommand = &cli.Command{
+	Name:  "analyze",
+	Usage: tr("在全部日志上做聚合统计（域名、时间范围等参数写在 analyze 之前）", "aggregate statistics over all log lines (put --domain, --start and other options before analyze)"),
+	Subcommands: []*cli.Command{
+		{
+			Name:  "groupby",
+			Usage: tr("按任意字段（包括派生字段）分组统计", "aggregate by any combination of fields, including derived fields"),
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "by",
+					Required: true,
+					Usage:    tr("分组字段，逗号分隔，如 status,ext", "comma-separated fields to group by, e.g. status,ext"),
+				},
+				&cli.StringFlag{
+					Name:  "metrics",
+					Value: "count",
+					Usage: tr("统计指标，逗号分隔: count、share（占总行数的百分比）、bytes、sum(字段)、avg(字段)、max(字段)、distinct(字段)、first_seen、last_seen（第一条和最后一条请求的时间）、active（两者之间的时长）、miss_bytes（未命中缓存的回源流量）、miss_ratio（未命中缓存的请求百分比）、p50/p90/p95/p99(字段)（百分位数）", "comma-separated metrics: count, share (percent of all lines), bytes, sum(field), avg(field), max(field), distinct(field), p50/p90/p95/p99(field) (percentiles), first_seen, last_seen (time of the first and last request), active (time between them), miss_bytes (bytes of cache misses served from origin), miss_ratio (percent of requests missing the cache)"),
+				},
+				&cli.StringFlag{
+					Name:  "filter",
+					Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+				},
+			},
+			Action: runGroupBy,
+		},
+		uaCommand,
+		botsCommand,
+		cacheReportCommand,
+		notFoundCommand,
+		slowCommand,
+		largeCommand,
+		typesCommand,
+		dirsCommand,
+		queryCommand,
+		crawlCommand,
+		streamsCommand,
+	},
+}
+
+// 本次分析的聚合报表，为空表示未启用
+var aggregateReports []*groupBy
+
+// 分析结束后由其他步骤生成的报表（如爬虫IP验证），写入结果时排在 aggregateReports 之后
+var postAggregates []result.Aggregate
+
+// 聚合报表的标题，键为报表名
+var aggregateTitles = map[string]string{
+	"groupby": tr("分组统计", "Group-by"),
+	"browser": tr("浏览器", "Browsers"),
+	"os":      tr("操作系统", "Operating systems"),
+	"device":  tr("设备类型", "Device classes"),
+
+	"crawler":        tr("已知爬虫", "Known crawlers"),
+	"crawler-verify": tr("爬虫IP验证", "Crawler IP verification"),
+	"known-bad":      tr("已知恶意IP流量", "Known-bad traffic"),
+	"suspects":       tr("IP列表命中", "IP file hits"),
+	"matched-ips":    tr("命中IP", "Matched IPs"),
+	"cache":          tr("回源流量最多的URL", "URLs by origin traffic"),
+	"cache-fixes":    tr("命中率低的可缓存对象", "Poorly cached objects"),
+
+	"notfound":              tr("404 缺失资源", "Missing resources (404)"),
+	"notfound-referers":     tr("404 来源页面", "Referers of 404s"),
+	"notfound-ips":          tr("404 客户端IP", "Clients with 404s"),
+	"notfound-top-referers": tr("缺失资源的主要来源页面", "Top referers per missing resource"),
+
+	"slow":          tr("最慢的URL", "Slowest URLs"),
+	"slow-hit-info": tr("按缓存状态的响应时间", "Response time by cache status"),
+
+	"large":         tr("单个响应最大的对象", "Largest single responses"),
+	"large-traffic": tr("总流量最多的对象", "Objects by total bytes"),
+	"large-flagged": tr("异常大的图片和脚本/样式文件", "Unexpectedly large images and bundles"),
+
+	"file_type": tr("资源类型", "Resource types"),
+	"extension": tr("文件扩展名", "File extensions"),
+	"mime_type": tr("Content-Type", "Content types"),
+	"dirs":      tr("目录", "Directories"),
+
+	"query-urls":   tr("查询字符串组合最多的URL", "URLs by query string combinations"),
+	"query-params": tr("查询参数", "Query parameters"),
+
+	"crawl-sections": tr("已验证爬虫按目录的抓取量", "Verified crawler requests by directory"),
+	"crawl-status":   tr("已验证爬虫的状态码", "Status codes served to verified crawlers"),
+	"crawl-urls":     tr("已验证爬虫抓取的带参数URL", "Parameterized URLs crawled by verified crawlers"),
+	"streams":        tr("HLS/DASH 流", "HLS/DASH streams"),
+	"stream-viewers": tr("并发观看人数", "concurrent viewers"),
+}
+
+// 一个聚合报表：按字段分组统计各项指标
+type groupBy struct {
+	name    string
+	by      []fieldExpr
+	metrics []groupMetric
+	filter  expr
+	// 只在分析过程中使用，不输出到终端和结果文件
+	hidden bool
+
+	mu     sync.Mutex
+	groups map[string]*groupValues
+	// 满足过滤条件的总行数，用于计算 share
+	total int64
+	// 分组数超过 --max-groups 后被剪掉的分组的计数上限之和，即保留的分组最多少计的行数；0 表示结果精确
+	pruned int64
+}
+
+// 一项统计指标：fn 为 count、share、bytes、sum、avg、max、distinct、p50/p90/p95/p99、first_seen、last_seen、active、miss_bytes 或 miss_ratio
+type groupMetric struct {
+	name  string
+	fn    string
+	field *fieldExpr
+}
+
+// 一个分组的字段取值及各项指标的累计值
+type groupValues struct {
+	keys  []string
+	count int64
+	// 与 metrics 一一对应：sum/avg 为累加值，max 为最大值，distinct 为不同取值，miss_bytes/miss_ratio 为未命中的流量/请求数
+	sums      []float64
+	distinct  []distinctSet
+	quantiles []quantileSketch
+	// 第一条和最后一条请求的时间（Unix 秒），用于 first_seen、last_seen 和 active
+	first, last int64
+}
+
+// 单次扫描中的分组统计，扫描结束后合并
+type groupByState struct {
+	g      *groupBy
+	groups map[string]*groupValues
+	total  int64
+	pruned int64
+}
+
+// 创建名为 name 的聚合报表，by、metrics 和 filter 的形式同 analyze groupby 的参数
+func newGroupBy(name, by, metrics, filter string) (*groupBy, error) {
+	g := &groupBy{name: name, groups: make(map[string]*groupValues)}
+	for _, name := range strings.Split(by, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		get, ok := exprFields[name]
+		if !ok {
+			return nil, fmt.Errorf(tr("未知的分组字段 %q", "unknown group_by field %q"), name)
+		}
+		g.by = append(g.by, fieldExpr{name: name, get: get})
+	}
+	if len(g.by) == 0 {
+		return nil, errors.New(tr("--by 不能为空", "--by must not be empty"))
+	}
+
+	for _, spec := range splitMetrics(metrics) {
+		m := groupMetric{name: spec, fn: spec}
+		if fn, arg, ok := strings.Cut(spec, "("); ok && strings.HasSuffix(arg, ")") {
+			m.fn = strings.TrimSpace(fn)
+			arg = strings.TrimSpace(strings.TrimSuffix(arg, ")"))
+			get, found := exprFields[arg]
+			if !found {
+				return nil, fmt.Errorf(tr("未知的统计字段 %q", "unknown metric field %q"), arg)
+			}
+			m.field = &fieldExpr{name: arg, get: get}
+		}
+		switch {
+		case slices.Contains([]string{"count", "share", "bytes", "first_seen", "last_seen", "active", "miss_bytes", "miss_ratio"}, m.fn) && m.field == nil:
+		case (m.fn == "sum" || m.fn == "avg" || m.fn == "max" || m.fn == "distinct" || percentiles[m.fn] > 0) && m.field != nil:
+		default:
+			return nil, fmt.Errorf(tr("无效的统计指标 %q，可选 count、share、bytes、sum(字段)、avg(字段)、max(字段)、distinct(字段)、p50/p90/p95/p99(字段)、first_seen、last_seen、active、miss_bytes、miss_ratio", "invalid metric %q, use count, share, bytes, sum(field), avg(field), max(field), distinct(field), p50/p90/p95/p99(field), first_seen, last_seen, active, miss_bytes or miss_ratio"), spec)
+		}
+		g.metrics = append(g.metrics, m)
+	}
+	if len(g.metrics) == 0 {
+		return nil, errors.New(tr("--metrics 不能为空", "--metrics must not be empty"))
+	}
+
+	if filter != "" {
+		e, err := parseExpr(filter)
+		if err != nil {
+			return nil, fmt.Errorf(tr("过滤条件: %w", "filter: %w"), err)
+		}
+		g.filter = e
+	}
+	return g, nil
+}
+
+// 百分位数指标及其位置
+var percentiles = map[string]float64{"p50": 0.5, "p90": 0.9, "p95": 0.95, "p99": 0.99}
+
+// 按逗号拆分指标列表，括号内的逗号不拆分
+func splitMetrics(s string) []string {
+	var list []string
+	depth, start := 0, 0
+	for i, c := range s + "," {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			if m := strings.TrimSpace(s[start:i]); m != "" {
+				list = append(list, m)
+			}
+			start = i + 1
+		}
+	}
+	return list
+}
+
+func (g *groupBy) newState() *groupByState {
+	if g == nil {
+		return nil
+	}
+	return &groupByState{g: g, groups: make(map[string]*groupValues)}
+}
+
+func (st *groupByState) observe(rec *logRecord) {
+	g := st.g
+	if g.filter != nil && !g.filter.eval(rec).truthy() {
+		return
+	}
+	st.total++
+	keys := make([]string, len(g.by))
+	for i, f := range g.by {
+		keys[i] = f.eval(rec).String()
+	}
+	key := strings.Join(keys, "\x00")
+	v, ok := st.groups[key]
+	if !ok {
+		v = g.newValues(keys)
+		st.groups[key] = v
+		st.pruned += pruneGroups(st.groups, reportConfig.maxGroups)
+	}
+	v.count++
+	if t := rec.Time.Unix(); v.count == 1 {
+		v.first, v.last = t, t
+	} else {
+		v.first, v.last = min(v.first, t), max(v.last, t)
+	}
+	for i, m := range g.metrics {
+		switch m.fn {
+		case "bytes":
+			v.sums[i] += float64(rec.ResponseSize)
+		case "sum", "avg":
+			v.sums[i] += m.field.eval(rec).num
+		case "max":
+			v.sums[i] = max(v.sums[i], m.field.eval(rec).num)
+		case "distinct":
+			v.distinct[i].add(m.field.eval(rec).String())
+		case "p50", "p90", "p95", "p99":
+			v.quantiles[i].add(m.field.eval(rec).num)
+		case "miss_bytes":
+			if !cacheHit(rec) {
+				v.sums[i] += float64(rec.ResponseSize)
+			}
+		case "miss_ratio":
+			if !cacheHit(rec) {
+				v.sums[i]++
+			}
+		}
+	}
+}
+
+func (g *groupBy) newValues(keys []string) *groupValues {
+	return &groupValues{keys: keys, sums: make([]float64, len(g.metrics)), distinct: make([]distinctSet, len(g.metrics)), quantiles: make([]quantileSketch, len(g.metrics))}
+}
+
+// 分组数超过 2*limit 时只保留计数最多的 limit 个分组（heavy hitters），返回被剪掉的分组中最大的计数，
+// 此后重新出现的分组最多少计这么多行；limit 为 0 或未超出时不做任何事。
+// 超出一倍才剪枝，使排序的开销分摊到每次新增分组上
+func pruneGroups(groups map[string]*groupValues, limit int) int64 {
+	if limit <= 0 || len(groups) <= 2*limit {
+		return 0
+	}
+	counts := make([]int64, 0, len(groups))
+	for _, v := range groups {
+		counts = append(counts, v.count)
+	}
+	slices.SortFunc(counts, func(a, b int64) int { return cmp.Compare(b, a) })
+	threshold := counts[limit]
+	// 计数等于阈值的分组按需保留，使剩下的分组正好为 limit 个
+	keep := limit - slices.Index(counts, threshold)
+	for key, v := range groups {
+		switch {
+		case v.count > threshold:
+		case v.count == threshold && keep > 0:
+			keep--
+		default:
+			delete(groups, key)
+		}
+	}
+	return threshold
+}
+
+func (g *groupBy) merge(st *groupByState) {
+	if g == nil || st == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.total += st.total
+	g.pruned += st.pruned
+	for key, sv := range st.groups {
+		v, ok := g.groups[key]
+		if !ok {
+			g.groups[key] = sv
+			g.pruned += pruneGroups(g.groups, reportConfig.maxGroups)
+			continue
+		}
+		g.mergeValues(v, sv)
+	}
+}
+
+// 把分组 sv 的累计值合并到 v
+func (g *groupBy) mergeValues(v, sv *groupValues) {
+	if v.count == 0 {
+		v.first, v.last = sv.first, sv.last
+	}
+	v.count += sv.count
+	v.first, v.last = min(v.first, sv.first), max(v.last, sv.last)
+	for i, m := range g.metrics {
+		switch m.fn {
+		case "max":
+			v.sums[i] = max(v.sums[i], sv.sums[i])
+		case "distinct":
+			v.distinct[i].merge(&sv.distinct[i])
+		case "p50", "p90", "p95", "p99":
+			v.quantiles[i].merge(&sv.quantiles[i])
+		default:
+			v.sums[i] += sv.sums[i]
+		}
+	}
+}
+
+// 各项指标的最终值
+func (g *groupBy) values(v *groupValues) []float64 {
+	values := make([]float64, len(g.metrics))
+	for i, m := range g.metrics {
+		switch m.fn {
+		case "count":
+			values[i] = float64(v.count)
+		case "share":
+			values[i] = float64(v.count) / float64(g.total) * 100
+		case "avg":
+			values[i] = v.sums[i] / float64(v.count)
+		case "miss_ratio":
+			values[i] = v.sums[i] / float64(v.count) * 100
+		case "distinct":
+			values[i] = v.distinct[i].count()
+		case "p50", "p90", "p95", "p99":
+			values[i] = v.quantiles[i].quantile(percentiles[m.fn])
+		case "first_seen":
+			values[i] = float64(v.first)
+		case "last_seen":
+			values[i] = float64(v.last)
+		case "active":
+			values[i] = float64(v.last - v.first)
+		default:
+			values[i] = v.sums[i]
+		}
+	}
+	return values
+}
+
+// 分组统计结果，按 --sort-by/--desc 排序，按 --min-count 和 --top 筛选
+func (g *groupBy) aggregate() *result.Aggregate {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	agg := &result.Aggregate{Name: g.name, Rows: []result.AggregateRow{}}
+	for _, f := range g.by {
+		agg.By = append(agg.By, f.name)
+	}
+	for _, m := range g.metrics {
+		agg.Metrics = append(agg.Metrics, m.name)
+	}
+	for _, v := range g.groups {
+		if !hiddenGroup(v.count) {
+			agg.Rows = append(agg.Rows, result.AggregateRow{Keys: v.keys, Values: g.values(v)})
+		}
+		for i := range v.distinct {
+			agg.Approximate = agg.Approximate || v.distinct[i].approximate() || v.quantiles[i].approximate()
+		}
+	}
+	agg.Groups = len(g.groups)
+	if g.pruned > 0 {
+		agg.Approximate, agg.ErrorBound = true, g.pruned
+	}
+	sortAggregate(agg)
+	limitAggregate(agg)
+	return agg
+}
+
+// 结果中的聚合报表
+func aggregates() []result.Aggregate {
+	var list []result.Aggregate
+	for _, g := range aggregateReports {
+		if !g.hidden {
+			list = append(list, *g.aggregate())
+		}
+	}
+	// 没有命中行时不输出 matched-ips
+	if agg := matchedIPs.aggregate(); agg != nil && agg.Groups > 0 {
+		list = append(list, *agg)
+	}
+	return append(list, postAggregates...)
+}
+
+func runGroupBy(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	g, err := newGroupBy("groupby", c.String("by"), c.String("metrics"), c.String("filter"))
+	if err != nil {
+		return err
+	}
+	return runAggregates(c, []*groupBy{g}, nil)
+}
+
+// 在全部日志上计算聚合报表，并在终端和结果文件中输出；after 不为 nil 时在输出报表后、保存结果前调用
+func runAggregates(c *cli.Context, reports []*groupBy, after func(ctx context.Context)) error {
+	var columns []string
+	for _, g := range reports {
+		columns = append(columns, g.columns()...)
+	}
+	if err := checkSortColumn(columns); err != nil {
+		return err
+	}
+	aggregateReports = append(aggregateReports, reports...)
+
+	runStats.reset()
+	ctx, span := startSpan(c.Context, "analyze-"+c.Command.Name,
+		attribute.String("cdn.domain", config.domainName))
+	defer span.End()
+
+	fmt.Printf(tr("开始CDN日志聚合统计: %s\n", "Starting CDN log aggregation: %s\n"), c.Command.Name)
+	fmt.Printf(tr("域名: %s\n", "Domain: %s\n"), config.domainName)
+	fmt.Printf(tr("时间范围: %s 至 %s\n", "Time range: %s to %s\n"), config.startTime, config.endTime)
+
+	if err := openPartialResults(); err != nil {
+		return err
+	}
+	results, err := analyze(ctx, c.String("urls-file"))
+	if err != nil {
+		return err
+	}
+	printRequestChart()
+	resolveReportIPs(ctx, nil, aggregates())
+	for _, g := range reports {
+		if !g.hidden {
+			printAggregate(g.aggregate())
+		}
+	}
+	printSuspectsReport()
+	printIntelReport()
+	if err := printHeatmap(); err != nil {
+		return err
+	}
+	if err := printTypeTimeline(); err != nil {
+		return err
+	}
+	compareWithPreviousWeek(ctx)
+	if after != nil {
+		after(ctx)
+	}
+
+	if err := saveResults(ctx, results); err != nil {
+		return fmt.Errorf(tr("保存结果失败: %w", "save results: %w"), err)
+	}
+	fmt.Printf(tr("\n处理统计:\n%s", "\nProcessing statistics:\n%s"), runStats.summary("  ", totalMatches(results)))
+	printResultsSaved()
+	return nil
+}
+
+// 报表的全部列名：分组字段和指标
+func (g *groupBy) columns() []string {
+	var columns []string
+	for _, f := range g.by {
+		columns = append(columns, f.name)
+	}
+	for _, m := range g.metrics {
+		columns = append(columns, m.name)
+	}
+	return columns
+}
+
+// 近似统计时的说明，精确时为空
+func approximateNote(agg *result.Aggregate) string {
+	switch {
+	case agg.ErrorBound > 0:
+		return fmt.Sprintf(tr("（近似：分组数超过 --max-groups，只保留出现最多的分组，各分组的行数最多少计 %d）", " (approximate: more groups than --max-groups, only the most frequent are kept and counts may be up to %d low)"), agg.ErrorBound)
+	case agg.Approximate:
+		return tr("（distinct 和百分位数为估算值）", " (distinct values and percentiles are estimates)")
+	}
+	return ""
+}
+
+// 在终端以表格输出聚合报表
+func printAggregate(agg *result.Aggregate) {
+	fmt.Printf(tr("\n%s (%s): %d 组，显示 %d 组%s\n", "\n%s (%s): %d groups, %d shown%s\n"), aggregateTitles[agg.Name], strings.Join(agg.By, ","), agg.Groups, len(printedRows(agg)), approximateNote(agg))
+	rows := printedRows(agg)
+	writeAggregateTable(os.Stdout, "  ", agg, rows)
+	if len(rows) < len(agg.Rows) {
+		fmt.Print(tr("  ... 其余见结果文件\n", "  ... more in the results file\n"))
+	}
+
+	// 条形图使用排序的指标列，按分组字段排序时使用第一项指标
+	if chartConfig.style != "" && len(rows) > 0 {
+		col, metric := sortColumn(agg)
+		if !metric {
+			col = 0
+		}
+		labels := make([]string, len(rows))
+		values := make([]float64, len(rows))
+		for i, row := range rows {
+			labels[i] = strings.Join(row.Keys, ",")
+			values[i] = row.Values[col]
+		}
+		fmt.Printf(tr("\n前 %d 组 (%s):\n", "\nTop %d groups (%s):\n"), len(rows), agg.Metrics[col])
+		printBarChart(labels, values, func(v float64) string { return formatMetric(agg.Metrics[col], v) })
+	}
+}
+
+// 在文本报告中以表格写入聚合报表的全部行
+func writeAggregateReport(writer *bufio.Writer, agg result.Aggregate) {
+	fmt.Fprintf(writer, tr("## %s (%s): %d 组，列出 %d 组%s\n", "## %s (%s): %d groups, %d listed%s\n"), aggregateTitles[agg.Name], strings.Join(agg.By, ","), agg.Groups, len(agg.Rows), approximateNote(&agg))
+	writeAggregateTable(writer, "", &agg, agg.Rows)
+	writer.WriteString("\n")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"example.com/mod/jobpb"
+	"example.com/mod/result"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WatchJob 检查任务进度的间隔
+var watchJobInterval = time.Second
+
+// serve 的 gRPC 接口（jobpb/jobs.proto）
+type grpcJobService struct {
+	jobpb.UnimplementedJobServiceServer
+	s *server
+}
+
+// 创建 gRPC 服务，设置了令牌时每个调用都需要带 authorization: Bearer <令牌> 元数据
+func newGRPCServer(s *server, token string) *grpc.Server {
+	var opts []grpc.ServerOption
+	if token != "" {
+		check := func(ctx context.Context) error {
+			md, _ := metadata.FromIncomingContext(ctx)
+			for _, v := range md.Get("authorization") {
+				if subtle.ConstantTimeCompare([]byte(v), []byte("Bearer "+token)) == 1 {
+					return nil
+				}
+			}
+			return status.Error(codes.Unauthenticated, tr("需要访问令牌", "access token required"))
+		}
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := check(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := check(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}))
+	}
+	g := grpc.NewServer(opts...)
+	jobpb.RegisterJobServiceServer(g, &grpcJobService{s: s})
+	return g
+}
+
+func (g *grpcJobService) SubmitJob(ctx context.Context, in *jobpb.JobRequest) (*jobpb.Job, error) {
+	req, err := jobRequestFromProto(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	j, err := g.s.submit(req)
+	if errors.Is(err, errQueueFull) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return jobProto(j), nil
+}
+
+func (g *grpcJobService) GetJob(ctx context.Context, in *jobpb.GetJobRequest) (*jobpb.Job, error) {
+	j, ok := g.s.get(in.GetId())
+	if !ok {
+		return nil, status.Error(codes.NotFound, errJobNotFound.Error())
+	}
+	return jobProto(j), nil
+}
+
+func (g *grpcJobService) ListJobs(ctx context.Context, in *jobpb.ListJobsRequest) (*jobpb.ListJobsResponse, error) {
+	resp := &jobpb.ListJobsResponse{}
+	for _, j := range g.s.list() {
+		resp.Jobs = append(resp.Jobs, jobProto(j))
+	}
+	return resp, nil
+}
+
+// 先推送一次当前状态，之后状态或进度变化时推送，任务结束后返回
+func (g *grpcJobService) WatchJob(in *jobpb.GetJobRequest, stream grpc.ServerStreamingServer[jobpb.Job]) error {
+	ticker := time.NewTicker(watchJobInterval)
+	defer ticker.Stop()
+	var last *jobpb.Job
+	for {
+		j, ok := g.s.get(in.GetId())
+		if !ok {
+			return status.Error(codes.NotFound, errJobNotFound.Error())
+		}
+		cur := jobProto(j)
+		if last == nil || cur.Status != last.Status || cur.FilesTotal != last.FilesTotal || cur.FilesScanned != last.FilesScanned || cur.Matches != last.Matches {
+			if err := stream.Send(cur); err != nil {
+				return err
+			}
+			last = cur
+		}
+		if j.FinishedAt != nil {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *grpcJobService) GetResult(ctx context.Context, in *jobpb.GetJobRequest) (*jobpb.JobResult, error) {
+	j, ok := g.s.get(in.GetId())
+	if !ok {
+		return nil, status.Error(codes.NotFound, errJobNotFound.Error())
+	}
+	res := g.s.result(j.ID)
+	if res == nil {
+		if j.FinishedAt == nil {
+			return nil, status.Error(codes.FailedPrecondition, tr("任务尚未完成", "job not finished"))
+		}
+		return nil, status.Error(codes.FailedPrecondition, j.Error)
+	}
+	var data bytes.Buffer
+	if err := res.writeJSON(&data); err != nil {
+		return nil, err
+	}
+	return &jobpb.JobResult{SchemaVersion: result.SchemaVersion, ReportJson: data.Bytes(), TotalMatches: int64(res.header.Summary.TotalMatches)}, nil
+}
+
+// 任务状态对应的 proto 枚举
+var jobStatusProto = map[string]jobpb.JobStatus{
+	jobQueued:  jobpb.JobStatus_JOB_STATUS_QUEUED,
+	jobRunning: jobpb.JobStatus_JOB_STATUS_RUNNING,
+	jobDone:    jobpb.JobStatus_JOB_STATUS_DONE,
+	jobFailed:  jobpb.JobStatus_JOB_STATUS_FAILED,
+}
+
+// proto 的分析参数，数量上限超出 int 范围时报错而不是截断
+func jobRequestFromProto(in *jobpb.JobRequest) (jobRequest, error) {
+	req := jobRequest{
+		Domain:          in.GetDomain(),
+		Start:           in.GetStart(),
+		End:             in.GetEnd(),
+		IP:              in.GetIp(),
+		IgnoreCase:      in.GetIgnoreCase(),
+		MaxMatches:      int(in.GetMaxMatches()),
+		MaxTotalMatches: int(in.GetMaxTotalMatches()),
+		Sample:          in.GetSample(),
+		Heatmap:         in.GetHeatmap(),
+		TypeTimeline:    in.GetTypeTimeline(),
+	}
+	if int64(req.MaxMatches) != in.GetMaxMatches() || int64(req.MaxTotalMatches) != in.GetMaxTotalMatches() {
+		return jobRequest{}, errors.New(tr("命中数上限超出范围", "match limit out of range"))
+	}
+	return req, nil
+}
+
+func jobProto(j job) *jobpb.Job {
+	r := j.Request
+	p := &jobpb.Job{
+		Id: j.ID,
+		Request: &jobpb.JobRequest{
+			Domain:          r.Domain,
+			Start:           r.Start,
+			End:             r.End,
+			Ip:              r.IP,
+			IgnoreCase:      r.IgnoreCase,
+			MaxMatches:      int64(r.MaxMatches),
+			MaxTotalMatches: int64(r.MaxTotalMatches),
+			Sample:          r.Sample,
+			Heatmap:         r.Heatmap,
+			TypeTimeline:    r.TypeTimeline,
+		},
+		Status:       jobStatusProto[j.Status],
+		Error:        j.Error,
+		CreatedAt:    timestamppb.New(j.CreatedAt),
+		FilesTotal:   j.FilesTotal,
+		FilesScanned: j.FilesScanned,
+		Matches:      int64(j.Matches),
+	}
+	if j.FinishedAt != nil {
+		p.FinishedAt = timestamppb.New(*j.FinishedAt)
+	}
+	return p
+}
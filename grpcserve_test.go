@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"example.com/mod/jobpb"
+	"example.com/mod/result"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 在内存连接上启动 gRPC 服务，不启动执行任务的 worker，由测试直接修改任务状态
+func newTestJobClient(t *testing.T, s *server, token string) jobpb.JobServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	g := newGRPCServer(s, token)
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return jobpb.NewJobServiceClient(conn)
+}
+
+// 模拟 worker 完成任务
+func finishTestJob(s *server, id string, report *result.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.find(id)
+	now := time.Now()
+	j.Status, j.FinishedAt, j.result = jobDone, &now, &jobResult{header: *report}
+	j.Matches = report.Summary.TotalMatches
+}
+
+func TestGRPCJobService(t *testing.T) {
+	watchJobInterval = 10 * time.Millisecond
+	s := &server{keepJobs: 5, queue: make(chan *job, 1)}
+	client := newTestJobClient(t, s, "")
+	ctx := context.Background()
+
+	job, err := client.SubmitJob(ctx, &jobpb.JobRequest{Start: "2025-05-15T00:00:00Z", End: "2025-05-15T01:00:00Z", Ip: "1.2.3.4", MaxMatches: 10})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	if job.GetId() != "1" || job.GetStatus() != jobpb.JobStatus_JOB_STATUS_QUEUED || job.GetRequest().GetMaxMatches() != 10 {
+		t.Errorf("SubmitJob = %v", job)
+	}
+
+	errorTests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"缺少结束时间", func() error {
+			_, err := client.SubmitJob(ctx, &jobpb.JobRequest{Start: "2025-05-15T00:00:00Z", Ip: "1.2.3.4"})
+			return err
+		}, codes.InvalidArgument},
+		{"队列已满", func() error {
+			_, err := client.SubmitJob(ctx, &jobpb.JobRequest{Start: "2025-05-15T00:00:00Z", End: "2025-05-15T01:00:00Z", Ip: "1.2.3.4"})
+			return err
+		}, codes.ResourceExhausted},
+		{"任务不存在", func() error {
+			_, err := client.GetJob(ctx, &jobpb.GetJobRequest{Id: "404"})
+			return err
+		}, codes.NotFound},
+		{"任务未完成", func() error {
+			_, err := client.GetResult(ctx, &jobpb.GetJobRequest{Id: "1"})
+			return err
+		}, codes.FailedPrecondition},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call()); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	got, err := client.GetJob(ctx, &jobpb.GetJobRequest{Id: "1"})
+	if err != nil || got.GetId() != "1" || got.GetCreatedAt() == nil {
+		t.Fatalf("GetJob = %v, %v", got, err)
+	}
+
+	stream, err := client.WatchJob(ctx, &jobpb.GetJobRequest{Id: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := stream.Recv()
+	if err != nil || first.GetStatus() != jobpb.JobStatus_JOB_STATUS_QUEUED {
+		t.Fatalf("WatchJob first = %v, %v", first, err)
+	}
+	report := &result.Report{SchemaVersion: result.SchemaVersion}
+	report.Summary.TotalMatches = 3
+	finishTestJob(s, "1", report)
+	last, err := stream.Recv()
+	if err != nil || last.GetStatus() != jobpb.JobStatus_JOB_STATUS_DONE || last.GetFinishedAt() == nil || last.GetMatches() != 3 {
+		t.Fatalf("WatchJob last = %v, %v", last, err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Error("WatchJob: stream not closed after the job finished")
+	}
+
+	res, err := client.GetResult(ctx, &jobpb.GetJobRequest{Id: "1"})
+	if err != nil {
+		t.Fatalf("GetResult: %v", err)
+	}
+	var decoded result.Report
+	if err := json.Unmarshal(res.GetReportJson(), &decoded); err != nil {
+		t.Fatalf("report_json: %v", err)
+	}
+	if res.GetSchemaVersion() != result.SchemaVersion || res.GetTotalMatches() != 3 || decoded.Summary.TotalMatches != 3 {
+		t.Errorf("GetResult = %v", res)
+	}
+}
+
+func TestGRPCToken(t *testing.T) {
+	client := newTestJobClient(t, &server{keepJobs: 5, queue: make(chan *job, 1)}, "secret")
+	tests := []struct {
+		name string
+		md   []string
+		want codes.Code
+	}{
+		{"没有令牌", nil, codes.Unauthenticated},
+		{"令牌错误", []string{"authorization", "Bearer wrong"}, codes.Unauthenticated},
+		{"令牌正确", []string{"authorization", "Bearer secret"}, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.md...)
+			_, err := client.ListJobs(ctx, &jobpb.ListJobsRequest{})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("ListJobs code = %v, want %v", got, tt.want)
+			}
+			// 流式调用同样检查令牌
+			stream, err := client.WatchJob(ctx, &jobpb.GetJobRequest{Id: "1"})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if got := status.Code(err); tt.want == codes.Unauthenticated && got != tt.want {
+				t.Errorf("WatchJob code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
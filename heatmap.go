@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 星期 × 小时热力图的参数
+var heatmapFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "heatmap",
+		Usage: tr("按星期和小时统计全部日志的请求数和流量，在终端和文本报告中以热力图显示，并写入JSON结果的 heatmap；时区同 --time-zone，默认为日志的 +0800", "aggregate requests and bytes of all log lines by day of week and hour of day, shown as a heatmap in the terminal and text report and written to heatmap in JSON results; uses --time-zone, the log's +0800 by default"),
+	},
+	&cli.StringFlag{
+		Name:  "heatmap-csv",
+		Usage: tr("把热力图写入CSV文件，每行为星期、小时、请求数和流量（隐含 --heatmap）", "write the heatmap to a CSV file with weekday, hour, requests and bytes per row (implies --heatmap)"),
+	},
+}
+
+// 热力图配置，enabled 为 false 表示不统计
+var heatmapConfig struct {
+	enabled bool
+	csv     string
+}
+
+// 星期的显示名称，从周一开始
+var weekdayNames = []string{
+	tr("周一", "Mon"), tr("周二", "Tue"), tr("周三", "Wed"), tr("周四", "Thu"), tr("周五", "Fri"), tr("周六", "Sat"), tr("周日", "Sun"),
+}
+
+// 热力图从低到高的字符，没有请求的格子为空格
+var (
+	heatUnicode = []string{"░░", "▒▒", "▓▓", "██"}
+	heatASCII   = []string{"..", "::", "**", "##"}
+)
+
+// 读取热力图参数，复用按时间段的流量统计（需要在 loadCrossCheckConfig、loadChartConfig 和 loadInfluxConfig 之后调用）
+func loadHeatmapConfig(c *cli.Context) error {
+	heatmapConfig.csv = c.String("heatmap-csv")
+	heatmapConfig.enabled = c.Bool("heatmap") || heatmapConfig.csv != ""
+	if !heatmapConfig.enabled {
+		return nil
+	}
+	if trafficCounter == nil {
+		trafficCounter = newTraffic(time.Hour)
+	} else if time.Hour%trafficCounter.interval != 0 {
+		return errors.New(tr("--heatmap 需要 --cross-check-interval、--chart-interval 或 --influx-interval 能整除1小时", "--heatmap requires --cross-check-interval, --chart-interval or --influx-interval to divide one hour"))
+	}
+	return nil
+}
+
+// 热力图使用的时区：--time-zone，默认为日志中的 +0800
+func heatmapLocation() *time.Location {
+	if outputTime.loc != nil {
+		return outputTime.loc
+	}
+	return time.FixedZone("+0800", 8*60*60)
+}
+
+// 结果中的热力图，未启用时为 nil
+func heatmapResult() *result.Heatmap {
+	if !heatmapConfig.enabled || trafficCounter == nil {
+		return nil
+	}
+	loc := heatmapLocation()
+	h := &result.Heatmap{TimeZone: loc.String(), Requests: make([][]int64, 7), Bytes: make([][]int64, 7)}
+	for d := range h.Requests {
+		h.Requests[d], h.Bytes[d] = make([]int64, 24), make([]int64, 24)
+	}
+	trafficCounter.mu.Lock()
+	defer trafficCounter.mu.Unlock()
+	for key, b := range trafficCounter.buckets {
+		t := time.Unix(key, 0).In(loc)
+		// time.Weekday 从周日开始
+		d := (int(t.Weekday()) + 6) % 7
+		h.Requests[d][t.Hour()] += b.requests
+		h.Bytes[d][t.Hour()] += b.bytes
+	}
+	return h
+}
+
+// 写入热力图：每行一个星期，每格一个小时，颜色深浅按请求数相对于最多的格子；返回是否有数据
+func writeHeatmap(w io.Writer, prefix string, h *result.Heatmap) bool {
+	var peak int64
+	peakDay, peakHour := 0, 0
+	for d, hours := range h.Requests {
+		for hour, n := range hours {
+			if n > peak {
+				peak, peakDay, peakHour = n, d, hour
+			}
+		}
+	}
+	if peak == 0 {
+		return false
+	}
+	chars := heatUnicode
+	if chartConfig.style == "ascii" {
+		chars = heatASCII
+	}
+	// 星期名称的显示宽度相同：中文两个全角字符，英文三个字母
+	header := []string{tr("    ", "   ")}
+	for hour := range 24 {
+		header = append(header, fmt.Sprintf("%02d", hour))
+	}
+	fmt.Fprintln(w, prefix+strings.Join(header, " "))
+	for d, hours := range h.Requests {
+		row := []string{weekdayNames[d]}
+		for _, n := range hours {
+			cell := "  "
+			if n > 0 {
+				level := int(math.Ceil(float64(n)/float64(peak)*float64(len(chars)))) - 1
+				cell = chars[max(level, 0)]
+			}
+			row = append(row, cell)
+		}
+		fmt.Fprintln(w, prefix+strings.TrimRight(strings.Join(row, " "), " "))
+	}
+	fmt.Fprintf(w, tr("%s最多: %s %02d:00，%s 次请求，%s\n", "%sPeak: %s %02d:00, %s requests, %s\n"), prefix,
+		weekdayNames[peakDay], peakHour, formatNumber(float64(peak)), formatBytes(h.Bytes[peakDay][peakHour]))
+	return true
+}
+
+// 在终端输出热力图，指定 --heatmap-csv 时同时写入CSV
+func printHeatmap() error {
+	h := heatmapResult()
+	if h == nil {
+		return nil
+	}
+	var b strings.Builder
+	if writeHeatmap(&b, "  ", h) {
+		fmt.Printf(tr("\n请求热力图 (星期 × 小时, %s):\n%s", "\nRequest heatmap (weekday × hour, %s):\n%s"), h.TimeZone, b.String())
+	}
+	if heatmapConfig.csv == "" {
+		return nil
+	}
+	if err := writeHeatmapCSV(h); err != nil {
+		return fmt.Errorf(tr("写入热力图失败: %w", "write heatmap: %w"), err)
+	}
+	fmt.Printf(tr("热力图已写入 %s\n", "Heatmap written to %s\n"), heatmapConfig.csv)
+	return nil
+}
+
+// 在文本报告中写入热力图
+func writeHeatmapReport(writer *bufio.Writer) {
+	h := heatmapResult()
+	if h == nil {
+		return
+	}
+	var b strings.Builder
+	if writeHeatmap(&b, "", h) {
+		fmt.Fprintf(writer, tr("## 请求热力图 (星期 × 小时, %s)\n%s\n", "## Request heatmap (weekday × hour, %s)\n%s\n"), h.TimeZone, b.String())
+	}
+}
+
+// 把热力图写入 --heatmap-csv：列为 weekday（1 为周一，7 为周日）、hour、requests、bytes，共 168 行
+func writeHeatmapCSV(h *result.Heatmap) error {
+	return writeFileWith(heatmapConfig.csv, func(w *bufio.Writer) {
+		w.WriteString("weekday,hour,requests,bytes\n")
+		for d, hours := range h.Requests {
+			for hour, n := range hours {
+				fmt.Fprintf(w, "%d,%d,%d,%d\n", d+1, hour, n, h.Bytes[d][hour])
+			}
+		}
+	})
+}
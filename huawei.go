@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 华为云CDN的API地址
+const huaweiCDNEndpoint = "cdn.myhuaweicloud.com"
+
+// ShowLogs 单页返回的日志数（接口上限为10000）
+const huaweiListingPageSize = 1000
+
+// 华为云CDN，通过 ShowLogs（cdn.myhuaweicloud.com）查询
+type huaweiProvider struct {
+	cred   apiKey
+	client *http.Client
+}
+
+// 华为云凭证的来源：环境变量 HUAWEICLOUD_SDK_AK/HUAWEICLOUD_SDK_SK 或 ~/.huaweicloud/credentials
+var huaweiKeySource = apiKeySource{
+	vendor:   "huawei",
+	idEnv:    "HUAWEICLOUD_SDK_AK",
+	keyEnv:   "HUAWEICLOUD_SDK_SK",
+	tokenEnv: "HUAWEICLOUD_SDK_SECURITY_TOKEN",
+	file:     filepath.Join(".huaweicloud", "credentials"),
+	idKey:    "ak",
+	keyKey:   "sk",
+	tokenKey: "security_token",
+}
+
+// 使用账号（为 nil 时为默认凭证）创建华为云的日志来源
+func newHuaweiProvider(a *account) (logProvider, error) {
+	cred, err := huaweiKeySource.load(a)
+	if err != nil {
+		return nil, err
+	}
+	return &huaweiProvider{cred: cred, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (p *huaweiProvider) name() string { return "huawei" }
+
+// 查询一天（UTC）的全部日志文件。接口按北京时间的日期查询，UTC的一天跨两个北京日期，两天都查询后按开始时间筛选
+func (p *huaweiProvider) listDayLogs(ctx context.Context, domain string, day time.Time) ([]logFile, error) {
+	var files []logFile
+	local := day.In(beijingTime)
+	first := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, beijingTime)
+	for _, date := range []time.Time{first, first.AddDate(0, 0, 1)} {
+		logs, err := p.listDateLogs(ctx, domain, date)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range logs {
+			if !f.Start.Before(day) && f.Start.Before(day.Add(24*time.Hour)) {
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// 分页查询一个北京日期的日志文件
+func (p *huaweiProvider) listDateLogs(ctx context.Context, domain string, date time.Time) ([]logFile, error) {
+	var files []logFile
+	for page := 1; ; page++ {
+		query := url.Values{
+			"domain_name":           {domain},
+			"query_date":            {strconv.FormatInt(date.UnixMilli(), 10)},
+			"page_size":             {strconv.Itoa(huaweiListingPageSize)},
+			"page_number":           {strconv.Itoa(page)},
+			"enterprise_project_id": {"ALL"},
+		}
+		var resp struct {
+			Total int `json:"total"`
+			Logs  []struct {
+				Name      string `json:"name"`
+				Size      int64  `json:"size"`
+				Link      string `json:"link"`
+				StartTime int64  `json:"start_time"`
+				EndTime   int64  `json:"end_time"`
+			} `json:"logs"`
+		}
+		err := withAPIRetry(ctx, "ShowLogs", func() error {
+			return p.call(ctx, "/v1.0/cdn/logs", query, &resp)
+		})
+		if err != nil {
+			return nil, fmt.Errorf(tr("API调用失败: %w", "API call failed: %w"), err)
+		}
+		for _, l := range resp.Logs {
+			if l.Link == "" {
+				continue
+			}
+			files = append(files, logFile{Name: l.Name, URL: l.Link, Size: l.Size, Start: time.UnixMilli(l.StartTime), End: time.UnixMilli(l.EndTime)})
+		}
+		if len(resp.Logs) < huaweiListingPageSize || page*huaweiListingPageSize >= resp.Total {
+			return files, nil
+		}
+	}
+}
+
+// 调用华为云API（SDK-HMAC-SHA256 签名）的 GET 接口，把响应解析到 out
+func (p *huaweiProvider) call(ctx context.Context, path string, query url.Values, out any) error {
+	rawQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+huaweiCDNEndpoint+path+"?"+rawQuery, nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Sdk-Date", now)
+	if p.cred.token != "" {
+		req.Header.Set("X-Security-Token", p.cred.token)
+	}
+	req.Header.Set("Authorization", huaweiAuthorization(p.cred, huaweiCDNEndpoint, path, rawQuery, now))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	// CDN接口的错误在 error 中，API网关（如签名错误、限流）的错误在最外层
+	var body struct {
+		Error struct {
+			Code    string `json:"error_code"`
+			Message string `json:"error_msg"`
+		} `json:"error"`
+		Code    string `json:"error_code"`
+		Message string `json:"error_msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("HTTP %d: %w", resp.StatusCode, err)
+	}
+	apiErr := &cloudAPIError{status: resp.StatusCode, code: body.Error.Code, message: body.Error.Message, requestID: resp.Header.Get("X-Request-Id")}
+	if apiErr.code == "" {
+		apiErr.code, apiErr.message = body.Code, body.Message
+	}
+	if apiErr.code == "" {
+		apiErr.code = "HTTP " + strconv.Itoa(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// SDK-HMAC-SHA256 签名的 Authorization 头，签名 host 和 x-sdk-date 两个头；
+// 请求体为空，路径按华为云的规范以 / 结尾参与签名
+func huaweiAuthorization(c apiKey, host, path, rawQuery, date string) string {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	canonical := "GET\n" + path + "\n" + rawQuery + "\nhost:" + host + "\nx-sdk-date:" + date + "\n\nhost;x-sdk-date\n" + sha256Hex(nil)
+	stringToSign := "SDK-HMAC-SHA256\n" + date + "\n" + sha256Hex([]byte(canonical))
+	mac := hmac.New(sha256.New, []byte(c.secret))
+	mac.Write([]byte(stringToSign))
+	return "SDK-HMAC-SHA256 Access=" + c.id + ", SignedHeaders=host;x-sdk-date, Signature=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 是否为华为云CDN的日志行：与阿里云一样以 [时间] 开头，但第5个字段是 "HTTP/..." 协议而不是 Referer 之后的请求行
+func isHuaweiLine(line string) bool {
+	if !strings.HasPrefix(line, "[") {
+		return false
+	}
+	rest := line
+	for range 4 {
+		var ok bool
+		if _, rest, ok = nextField(rest); !ok || rest == "" {
+			return false
+		}
+	}
+	return strings.HasPrefix(rest, `"HTTP/`)
+}
+
+// 解析一行华为云CDN访问日志
+// 格式: [访问时间] 客户端IP 响应时间 "Referer" "协议" "方法" "域名" "URI" 状态码 响应大小 命中信息 "User-Agent" "Range" 服务端IP
+// 例如: [05/Feb/2018:07:54:52 +0800] 192.168.1.1 1 "-" "HTTP/1.1" "GET" "www.test.com" "/test/1.gif" 206 720 HIT "Mozilla/5.0" "bytes=-256" 10.0.0.1
+func parseHuaweiLine(line string, rec *logRecord) error {
+	var fields [14]string
+	n := 0
+	for rest := line; rest != "" && n < len(fields); n++ {
+		var field string
+		var ok bool
+		field, rest, ok = nextField(rest)
+		if !ok {
+			return errMalformedLine
+		}
+		fields[n] = field
+	}
+	if n < 11 {
+		return errMalformedLine
+	}
+	t, err := time.Parse(logTimeLayout, fields[0])
+	if err != nil {
+		return errMalformedLine
+	}
+	rec.Time = t
+	rec.ClientIP = normalizeIP(fields[1])
+	rec.ProxyIP = "-"
+	rec.ResponseTime, _ = strconv.Atoi(fields[2])
+	rec.Referer = fields[3]
+	rec.Method = fields[5]
+	rec.URL = "http://" + fields[6] + fields[7]
+	if rec.Status, err = strconv.Atoi(fields[8]); err != nil {
+		return errMalformedLine
+	}
+	rec.ResponseSize, _ = strconv.ParseInt(fields[9], 10, 64)
+	rec.HitInfo = strings.ToUpper(fields[10])
+	rec.UserAgent = fields[11]
+	return nil
+}
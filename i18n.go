@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// 当前输出语言：zh 或 en
+// 命令行参数需要在构建 cli.App 之前翻译，因此在包初始化时直接从 os.Args 和环境变量中确定
+var lang = detectLang(os.Args[1:])
+
+// 根据当前语言选择文本
+func tr(zh, en string) string {
+	if lang == "en" {
+		return en
+	}
+	return zh
+}
+
+// 确定输出语言：--lang 参数优先，其次是 LC_ALL/LC_MESSAGES/LANG，默认中文
+func detectLang(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "lang" || !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		return normalizeLang(value)
+	}
+
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		// C/POSIX 不代表语言偏好，保持默认
+		if value == "C" || value == "POSIX" || strings.HasPrefix(value, "C.") {
+			return "zh"
+		}
+		return normalizeLang(value)
+	}
+	return "zh"
+}
+
+// 将 zh_CN.UTF-8、en-US 等形式规范为 zh/en，非中文环境一律使用英文
+func normalizeLang(value string) string {
+	if strings.HasPrefix(strings.ToLower(value), "zh") {
+		return "zh"
+	}
+	return "en"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// 每个日志文件搜索完成后，其在结果中的部分（文本报告中的文件分组、JSON 的 files 元素或模板的输出）
+// 立即写入 <结果文件>.partial；保存结果时按文件名顺序从中复制，再补上头部和汇总。
+// 运行中途退出时已完成的文件的命中行保留在该文件中
+var partialResults struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	w    *bufio.Writer
+	// 日志文件 → 在 .partial 中的位置
+	sections map[string]partialSection
+	size     int64
+	err      error
+}
+
+type partialSection struct {
+	offset, length int64
+}
+
+// 中间文件的后缀
+const partialSuffix = ".partial"
+
+// 是否逐个文件写入中间文件：按时间合并需要全部文件搜索完成后才能输出；
+// 加密结果时不写未加密的中间文件；不写本地结果时也不需要
+func incrementalResults() bool {
+	return !config.noLocalResults && !config.mergeByTime && resultEncryption.ext == ""
+}
+
+// 创建中间文件，搜索开始前调用；未启用时不做任何事
+func openPartialResults() error {
+	closePartialResults(true)
+	if !incrementalResults() {
+		return nil
+	}
+	path := resultsPath() + partialSuffix
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf(tr("创建中间结果文件失败: %w", "create partial results file: %w"), err)
+	}
+	partialResults.mu.Lock()
+	defer partialResults.mu.Unlock()
+	partialResults.path, partialResults.f, partialResults.w = path, f, bufio.NewWriterSize(f, 256*1024)
+	partialResults.sections = make(map[string]partialSection)
+	partialResults.size, partialResults.err = 0, nil
+	return nil
+}
+
+// 结果中每个文件的部分的写入方式，与最终结果的格式一致
+func fileSectionWriter() func(w *bufio.Writer, file string, r *fileResult) error {
+	switch {
+	case outputTemplate != nil:
+		return writeTemplateFileSection
+	case config.format == formatJSON:
+		return writeJSONFile
+	default:
+		return writeTextFileSection
+	}
+}
+
+// 写入一个搜索完成的文件；写入失败只给出一次警告，保存结果时改为直接生成
+func addPartialResult(file string, r *fileResult) {
+	partialResults.mu.Lock()
+	defer partialResults.mu.Unlock()
+	if partialResults.f == nil || partialResults.err != nil {
+		return
+	}
+	cw := &countingWriter{w: partialResults.w}
+	bw := bufio.NewWriterSize(cw, 64*1024)
+	err := fileSectionWriter()(bw, file, r)
+	if err == nil {
+		err = bw.Flush()
+	}
+	// 每个文件写完后写入磁盘，进程中途退出时不丢失
+	if err == nil {
+		err = partialResults.w.Flush()
+	}
+	if err != nil {
+		partialResults.err = err
+		fmt.Fprintf(os.Stderr, tr("警告: 写入中间结果文件失败: %v\n", "Warning: writing partial results file failed: %v\n"), err)
+		return
+	}
+	partialResults.sections[file] = partialSection{offset: partialResults.size, length: cw.n}
+	partialResults.size += cw.n
+}
+
+// 若文件已写入中间文件，把其内容复制到 w 并返回 true
+func copyPartialResult(w io.Writer, file string) (bool, error) {
+	partialResults.mu.Lock()
+	defer partialResults.mu.Unlock()
+	s, ok := partialResults.sections[file]
+	if !ok || partialResults.err != nil {
+		return false, nil
+	}
+	_, err := io.Copy(w, io.NewSectionReader(partialResults.f, s.offset, s.length))
+	return true, err
+}
+
+// 写入结果中一个文件的部分：已写入中间文件时直接复制，否则现在生成
+func writeFileSection(w *bufio.Writer, file string, r *fileResult) error {
+	if ok, err := copyPartialResult(w, file); ok || err != nil {
+		return err
+	}
+	return fileSectionWriter()(w, file, r)
+}
+
+// 关闭中间文件；remove 为 true 时（结果已保存）删除，否则保留并提示文件位置
+func closePartialResults(remove bool) {
+	partialResults.mu.Lock()
+	defer partialResults.mu.Unlock()
+	if partialResults.f == nil {
+		return
+	}
+	partialResults.w.Flush()
+	partialResults.f.Close()
+	if remove || len(partialResults.sections) == 0 {
+		os.Remove(partialResults.path)
+	} else {
+		fmt.Fprintf(os.Stderr, tr("已完成的 %d 个文件的结果保存在 %s\n", "Results of the %d completed files are kept in %s\n"), len(partialResults.sections), partialResults.path)
+	}
+	partialResults.f, partialResults.w, partialResults.sections = nil, nil, nil
+}
+
+// 统计写入字节数的 writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
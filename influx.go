@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 把按时间段统计的请求数、流量和错误数以 line protocol 写入 InfluxDB v2
+var influxFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "influx-url",
+		Usage: tr("把每个时间段的请求数、流量和错误数写入该 InfluxDB v2 地址，如 http://localhost:8086", "write requests, bytes and error counts per interval to this InfluxDB v2, e.g. http://localhost:8086"),
+	},
+	&cli.StringFlag{
+		Name:  "influx-org",
+		Usage: tr("InfluxDB 组织", "InfluxDB organization"),
+	},
+	&cli.StringFlag{
+		Name:  "influx-bucket",
+		Usage: tr("InfluxDB Bucket", "InfluxDB bucket"),
+	},
+	&cli.StringFlag{
+		Name:    "influx-token",
+		Usage:   tr("InfluxDB API 令牌", "InfluxDB API token"),
+		EnvVars: []string{"INFLUX_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:  "influx-measurement",
+		Value: "cdn_traffic",
+		Usage: tr("写入的 measurement 名称", "measurement to write"),
+	},
+	&cli.DurationFlag{
+		Name:  "influx-interval",
+		Value: 5 * time.Minute,
+		Usage: tr("每个数据点的时间段", "time span of each point"),
+	},
+}
+
+// InfluxDB 写入配置，endpoint 为空表示未启用
+var influxConfig struct {
+	endpoint    string
+	token       string
+	measurement string
+	interval    time.Duration
+}
+
+// 每个请求写入的最多行数
+const influxBatchSize = 5000
+
+// 读取 InfluxDB 参数，需要在 loadChartConfig 之后调用以复用其流量统计
+func loadInfluxConfig(c *cli.Context) error {
+	influxConfig.endpoint = ""
+	target := c.String("influx-url")
+	if target == "" {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf(tr("--influx-url 地址无效 %q，格式如 http://localhost:8086", "invalid --influx-url %q, use e.g. http://localhost:8086"), target)
+	}
+	org, bucket := c.String("influx-org"), c.String("influx-bucket")
+	if org == "" || bucket == "" {
+		return errors.New(tr("使用 --influx-url 时需要指定 --influx-org 和 --influx-bucket", "--influx-url requires --influx-org and --influx-bucket"))
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+	u.RawQuery = url.Values{"org": {org}, "bucket": {bucket}, "precision": {"s"}}.Encode()
+	influxConfig.endpoint = u.String()
+	influxConfig.token = c.String("influx-token")
+	influxConfig.measurement = c.String("influx-measurement")
+	influxConfig.interval = c.Duration("influx-interval")
+	if influxConfig.interval <= 0 {
+		return fmt.Errorf(tr("无效的 --influx-interval %s", "invalid --influx-interval %s"), influxConfig.interval)
+	}
+	if trafficCounter == nil {
+		trafficCounter = newTraffic(influxConfig.interval)
+	} else if influxConfig.interval%trafficCounter.interval != 0 {
+		return fmt.Errorf(tr("--influx-interval 必须是 %s 的整数倍（与 --cross-check-interval 或 --chart-interval 共用统计）", "--influx-interval must be a multiple of %s (statistics are shared with --cross-check-interval or --chart-interval)"), trafficCounter.interval)
+	}
+	return nil
+}
+
+// measurement 中的逗号和空格、标签中的逗号、等号和空格需要转义
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// 时间范围内每个时间段一行，没有日志的时间段写为 0；采样时按比例估算
+func influxLines() ([]string, error) {
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return nil, err
+	}
+	scale := lineSampler.scale()
+	estimate := func(n int64) int64 { return int64(math.Round(float64(n) * scale)) }
+	// 不带分析ID，重复分析同一时间范围时覆盖相同的数据点而不是产生新的序列
+	prefix := influxMeasurementEscaper.Replace(influxConfig.measurement) + ",domain=" + influxTagEscaper.Replace(config.domainName)
+	var lines []string
+	for t := start.Truncate(influxConfig.interval); t.Before(end); t = t.Add(influxConfig.interval) {
+		b := trafficCounter.sum(t, influxConfig.interval)
+		lines = append(lines, fmt.Sprintf("%s requests=%di,bytes=%di,errors_4xx=%di,errors_5xx=%di %d",
+			prefix, estimate(b.requests), estimate(b.bytes), estimate(b.clientErrors), estimate(b.serverErrors), t.Unix()))
+	}
+	return lines, nil
+}
+
+// 写入 InfluxDB，失败时只给出警告
+func writeInfluxPoints() {
+	if influxConfig.endpoint == "" {
+		return
+	}
+	lines, err := influxLines()
+	for i := 0; err == nil && i < len(lines); i += influxBatchSize {
+		body := strings.Join(lines[i:min(i+influxBatchSize, len(lines))], "\n") + "\n"
+		var req *http.Request
+		req, err = http.NewRequest("POST", influxConfig.endpoint, bytes.NewBufferString(body))
+		if err != nil {
+			break
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if influxConfig.token != "" {
+			req.Header.Set("Authorization", "Token "+influxConfig.token)
+		}
+		err = doSinkRequest(req)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 写入 InfluxDB 失败: %v\n", "Warning: writing to InfluxDB failed: %v\n"), err)
+		markPartialFailure()
+		return
+	}
+	fmt.Printf(tr("已写入 %d 个时间段的统计到 InfluxDB\n", "Wrote statistics of %d intervals to InfluxDB\n"), len(lines))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 威胁情报源的参数
+var intelFlags = []cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "intel-feed",
+		Usage: tr("威胁情报IP源（文件或URL）：每行一个IP或CIDR，或第一列为IP/CIDR的CSV；来自其中IP的请求单独列在已知恶意IP流量报表中，可多次指定", "threat-intel feed (file or URL): one IP or CIDR per line, or CSV whose first column is an IP/CIDR; traffic from listed IPs is reported in a known-bad traffic section; may be repeated"),
+	},
+}
+
+// 一个威胁情报源
+type intelFeed struct {
+	name string
+	set  *ipSet
+}
+
+// 已加载的威胁情报源，为空表示未启用
+var intelFeeds []*intelFeed
+
+// 已知恶意IP流量报表，未指定 --intel-feed 时为 nil
+var intelReport *groupBy
+
+// 加载 --intel-feed 并创建 known-bad 报表
+func loadIntelFeeds(c *cli.Context) error {
+	intelFeeds, intelReport = nil, nil
+	for _, spec := range c.StringSlice("intel-feed") {
+		data, err := readFileOrURL(c.Context, spec)
+		if err != nil {
+			return fmt.Errorf(tr("读取威胁情报源 %s 失败: %w", "read threat-intel feed %s: %w"), spec, err)
+		}
+		set, err := parseIPSet(data)
+		if err != nil {
+			return fmt.Errorf(tr("解析威胁情报源 %s 失败: %w", "parse threat-intel feed %s: %w"), spec, err)
+		}
+		intelFeeds = append(intelFeeds, &intelFeed{name: path.Base(spec), set: set})
+	}
+	if len(intelFeeds) == 0 {
+		return nil
+	}
+	g, err := newGroupBy("known-bad", "intel_feed,client_ip", "count,bytes,distinct(url),first_seen,last_seen,active", `intel_feed != ""`)
+	if err != nil {
+		return err
+	}
+	intelReport = g
+	aggregateReports = append(aggregateReports, g)
+	return nil
+}
+
+// intel_feed 字段：包含该IP的第一个情报源名称，不在任何情报源中时为空
+func intelFeedOf(ip string) string {
+	if len(intelFeeds) == 0 {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	for _, f := range intelFeeds {
+		if f.set.contains(addr) {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// 各情报源的条目数，用于启动时的提示
+func intelFeedSummary() string {
+	parts := make([]string, len(intelFeeds))
+	for i, f := range intelFeeds {
+		parts[i] = fmt.Sprintf("%s (%d)", f.name, f.set.len())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 在终端输出已知恶意IP流量报表
+func printIntelReport() {
+	if intelReport == nil {
+		return
+	}
+	agg := intelReport.aggregate()
+	if len(agg.Rows) == 0 {
+		fmt.Print(tr("\n已知恶意IP流量: 无\n", "\nKnown-bad traffic: none\n"))
+		return
+	}
+	printAggregate(agg)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// IP和网段的集合，用于威胁情报源和 --ip-file
+type ipSet struct {
+	addrs map[netip.Addr]struct{}
+	// 按前缀长度分组的网段，bits 为已有的前缀长度，从长到短排序
+	prefixes map[int]map[netip.Prefix]struct{}
+	bits     []int
+}
+
+// 解析IP列表：每行一个IP或CIDR，或第一列为IP/CIDR的CSV；
+// 跳过空行、注释（# 或 ;）和第一列不是IP/CIDR的行（如CSV表头）
+func parseIPSet(data []byte) (*ipSet, error) {
+	set := &ipSet{addrs: make(map[netip.Addr]struct{}), prefixes: make(map[int]map[netip.Prefix]struct{})}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		// 第一列：CSV 以逗号分隔，纯文本列表的行尾可能带注释
+		first, _, _ := strings.Cut(line, ",")
+		if fields := strings.Fields(first); len(fields) > 0 {
+			first = strings.Trim(fields[0], `"[]`)
+		}
+		if strings.Contains(first, "/") {
+			p, err := netip.ParsePrefix(first)
+			if err != nil {
+				continue
+			}
+			set.addPrefix(p.Masked())
+		} else if addr, err := netip.ParseAddr(first); err == nil {
+			set.addrs[addr.Unmap()] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if set.len() == 0 {
+		return nil, errors.New(tr("没有有效的IP或CIDR", "no valid IP or CIDR entries"))
+	}
+	return set, nil
+}
+
+func (s *ipSet) addPrefix(p netip.Prefix) {
+	if s.prefixes[p.Bits()] == nil {
+		s.prefixes[p.Bits()] = make(map[netip.Prefix]struct{})
+		s.bits = append(s.bits, p.Bits())
+		slices.SortFunc(s.bits, func(a, b int) int { return b - a })
+	}
+	s.prefixes[p.Bits()][p] = struct{}{}
+}
+
+// 条目数：IP和网段的总数
+func (s *ipSet) len() int {
+	n := len(s.addrs)
+	for _, set := range s.prefixes {
+		n += len(set)
+	}
+	return n
+}
+
+// 查找包含 addr 的条目，优先返回单个IP，其次为最长的网段
+func (s *ipSet) lookup(addr netip.Addr) (netip.Prefix, bool) {
+	addr = addr.Unmap()
+	if _, ok := s.addrs[addr]; ok {
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	for _, bits := range s.bits {
+		if bits > addr.BitLen() {
+			continue
+		}
+		p, _ := addr.Prefix(bits)
+		if _, ok := s.prefixes[bits][p]; ok {
+			return p, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+func (s *ipSet) contains(addr netip.Addr) bool {
+	_, ok := s.lookup(addr)
+	return ok
+}
+
+// 条目的文本形式：单个IP不带前缀长度
+func formatIPEntry(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 请求时间线的参数
+var ipTimelineFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "ip-timeline",
+		Usage: tr("按该时间段（如 1m、1s）统计每个搜索IP的命中请求数，在终端和文本报告中以迷你图显示突发的形状，并写入JSON结果的 request_timelines（需要 --ip）", "count each searched IP's matched requests per time span (e.g. 1m, 1s) and show the burst shape as a sparkline in the terminal and text report; also written to request_timelines in JSON results (requires --ip)"),
+	},
+	&cli.StringFlag{
+		Name:  "ip-timeline-csv",
+		Usage: tr("把请求时间线写入CSV文件：每行一个时间段，每列一个搜索IP（需要 --ip-timeline）", "write the request timeline to a CSV file: one row per time span, one column per searched IP (requires --ip-timeline)"),
+	},
+}
+
+// 迷你图的最大宽度（字符数），时间段更多时每个字符显示若干时间段中的最大值
+const sparklineWidth = 100
+
+// 迷你图从低到高的字符，没有请求的时间段为空格
+var (
+	sparkUnicode = []rune("▁▂▃▄▅▆▇█")
+	sparkASCII   = []rune(".:-=+*#@")
+)
+
+// 每个搜索IP的命中请求数按时间段的计数，未指定 --ip-timeline 时为 nil
+var ipTimeline *requestTimeline
+
+type requestTimeline struct {
+	interval time.Duration
+	csv      string
+	// 日志中的IP（压缩形式）→ 显示的搜索IP，ips 为显示顺序（与 --ip 一致）
+	keys map[string]string
+	ips  []string
+
+	mu     sync.Mutex
+	counts timelineCounts
+}
+
+// 搜索IP → 时间段开始的 Unix 时间 → 请求数
+type timelineCounts map[string]map[int64]int64
+
+func loadIPTimelineConfig(c *cli.Context) error {
+	ipTimeline = nil
+	interval := c.Duration("ip-timeline")
+	if interval == 0 {
+		if c.String("ip-timeline-csv") != "" {
+			return errors.New(tr("--ip-timeline-csv 需要同时指定 --ip-timeline", "--ip-timeline-csv requires --ip-timeline"))
+		}
+		return nil
+	}
+	if interval < time.Second {
+		return fmt.Errorf(tr("无效的时间线时间段 %s，最小为 1s", "invalid timeline interval %s, the minimum is 1s"), interval)
+	}
+	// 匿名化时命中行中的IP已经替换，按匿名化后的搜索IP统计
+	patterns := anonymizePatterns(splitPatterns(config.searchIP))
+	if len(patterns) == 0 {
+		return errors.New(tr("--ip-timeline 需要 --ip", "--ip-timeline requires --ip"))
+	}
+	t := &requestTimeline{interval: interval, csv: c.String("ip-timeline-csv"), keys: make(map[string]string), counts: make(timelineCounts)}
+	for _, p := range patterns {
+		key := p
+		if addr, err := netip.ParseAddr(strings.Trim(p, "[]")); err == nil {
+			key = addr.Unmap().String()
+		}
+		if _, ok := t.keys[key]; !ok {
+			t.keys[key] = p
+			t.ips = append(t.ips, p)
+		}
+	}
+	ipTimeline = t
+	return nil
+}
+
+// 统计一条命中行：客户端IP（其次为代理IP）是搜索IP之一时计入其所在的时间段
+func (t *requestTimeline) observe(st timelineCounts, rec *logRecord) {
+	if t == nil {
+		return
+	}
+	for _, ip := range []string{rec.ClientIP, rec.ProxyIP} {
+		if p, ok := t.keys[ip]; ok {
+			if st[p] == nil {
+				st[p] = make(map[int64]int64)
+			}
+			st[p][rec.Time.Truncate(t.interval).Unix()]++
+			return
+		}
+	}
+}
+
+func (t *requestTimeline) merge(st timelineCounts) {
+	if t == nil || st == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ip, buckets := range st {
+		total := t.counts[ip]
+		if total == nil {
+			t.counts[ip] = buckets
+			continue
+		}
+		for b, n := range buckets {
+			total[b] += n
+		}
+	}
+}
+
+// 时间范围内的全部时间段的开始时间
+func (t *requestTimeline) buckets() []time.Time {
+	return timeBuckets(t.interval)
+}
+
+// 时间范围内每个 interval 长的时间段的开始时间
+func timeBuckets(interval time.Duration) []time.Time {
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return nil
+	}
+	var list []time.Time
+	for b := start.Truncate(interval); b.Before(end); b = b.Add(interval) {
+		list = append(list, b)
+	}
+	return list
+}
+
+// 结果中的请求时间线，只列出有命中的搜索IP和有请求的时间段
+func (t *requestTimeline) result() []result.RequestTimeline {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var list []result.RequestTimeline
+	for _, ip := range t.ips {
+		buckets := t.counts[ip]
+		if len(buckets) == 0 {
+			continue
+		}
+		tl := result.RequestTimeline{IP: ip, IntervalSeconds: int64(t.interval / time.Second), Points: []result.TimelinePoint{}}
+		for _, b := range slices.Sorted(maps.Keys(buckets)) {
+			n := buckets[b]
+			tl.Points = append(tl.Points, result.TimelinePoint{Time: time.Unix(b, 0).UTC(), Requests: n})
+			tl.Requests += n
+			if n > tl.PeakRequests {
+				tl.PeakTime, tl.PeakRequests = time.Unix(b, 0).UTC(), n
+			}
+		}
+		list = append(list, tl)
+	}
+	return list
+}
+
+// 时间线中的时间：时间段小于1分钟时显示到秒
+func (t *requestTimeline) formatTime(tm time.Time) string {
+	if t.interval < time.Minute {
+		return tm.Local().Format("01-02 15:04:05")
+	}
+	return tm.Local().Format("01-02 15:04")
+}
+
+// 写入每个有命中的搜索IP的总数、峰值和迷你图，每行以 prefix 开头；返回是否写入了内容
+func (t *requestTimeline) write(w io.Writer, prefix string) bool {
+	timelines := t.result()
+	if len(timelines) == 0 {
+		return false
+	}
+	buckets := t.buckets()
+	per := max(1, (len(buckets)+sparklineWidth-1)/sparklineWidth)
+	if len(buckets) > 0 {
+		fmt.Fprintf(w, tr("%s%s ~ %s，每格 %s\n", "%s%s ~ %s, %s per column\n"), prefix,
+			t.formatTime(buckets[0]), t.formatTime(buckets[len(buckets)-1].Add(t.interval)), compactDuration(t.interval*time.Duration(per)))
+	}
+	for _, tl := range timelines {
+		fmt.Fprintf(w, tr("%s%s: 共 %d 次，峰值 %d 次/%s (%s)\n", "%s%s: %d requests, peak %d per %s (%s)\n"), prefix,
+			tl.IP, tl.Requests, tl.PeakRequests, compactDuration(t.interval), t.formatTime(tl.PeakTime))
+		values := make([]int64, len(buckets))
+		t.mu.Lock()
+		for i, b := range buckets {
+			values[i] = t.counts[tl.IP][b.Unix()]
+		}
+		t.mu.Unlock()
+		fmt.Fprintf(w, "%s  |%s|\n", prefix, sparkline(values, per))
+	}
+	return true
+}
+
+// 迷你图：每个字符为 per 个连续值中的最大值，高度按全部值中的最大值缩放
+func sparkline(values []int64, per int) string {
+	chars := sparkUnicode
+	if chartConfig.style == "ascii" {
+		chars = sparkASCII
+	}
+	peak := slices.Max(append([]int64{0}, values...))
+	var b strings.Builder
+	for i := 0; i < len(values); i += per {
+		v := slices.Max(values[i:min(i+per, len(values))])
+		if v == 0 {
+			b.WriteByte(' ')
+			continue
+		}
+		level := int(math.Ceil(float64(v)/float64(peak)*float64(len(chars)))) - 1
+		b.WriteRune(chars[max(level, 0)])
+	}
+	return b.String()
+}
+
+// 在终端输出请求时间线
+func printIPTimeline() {
+	if ipTimeline == nil {
+		return
+	}
+	var b strings.Builder
+	if ipTimeline.write(&b, "  ") {
+		fmt.Printf(tr("\n请求时间线 (每 %s):\n%s", "\nRequest timeline (per %s):\n%s"), compactDuration(ipTimeline.interval), b.String())
+	}
+}
+
+// 在文本报告中写入请求时间线
+func writeIPTimelineReport(writer *bufio.Writer) {
+	if ipTimeline == nil {
+		return
+	}
+	var b strings.Builder
+	if ipTimeline.write(&b, "") {
+		fmt.Fprintf(writer, tr("## 请求时间线 (每 %s)\n%s\n", "## Request timeline (per %s)\n%s\n"), compactDuration(ipTimeline.interval), b.String())
+	}
+}
+
+// 去掉时长末尾为零的单位，如 1m0s 显示为 1m、2h0m0s 显示为 2h
+func compactDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// 把请求时间线写入 --ip-timeline-csv：第一列为时间段的开始时间（RFC3339），其后每列为一个搜索IP的请求数
+func writeIPTimelineCSV() error {
+	if ipTimeline == nil || ipTimeline.csv == "" {
+		return nil
+	}
+	t := ipTimeline
+	return writeFileWith(t.csv, func(w *bufio.Writer) {
+		w.WriteString("time")
+		for _, ip := range t.ips {
+			w.WriteString("," + ip)
+		}
+		w.WriteString("\n")
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for _, b := range t.buckets() {
+			w.WriteString(b.UTC().Format(time.RFC3339))
+			for _, ip := range t.ips {
+				fmt.Fprintf(w, ",%d", t.counts[ip][b.Unix()])
+			}
+			w.WriteString("\n")
+		}
+	})
+}
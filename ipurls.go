@@ -0,0 +1,59 @@
+package main
+
+// 命中行按客户端IP统计请求数和不同URL数，区分“爬取整站”（URL很多）和“反复请求同一接口”（URL很少）；
+// 只在搜索时启用，未启用时为 nil
+var matchedIPs *groupBy
+
+// 搜索IP、关键字、正则表达式或 --ip-file 时创建 matched-ips 报表
+func loadMatchedIPs() error {
+	matchedIPs = nil
+	if len(splitPatterns(config.searchIP)) == 0 && len(config.keywords) == 0 && len(config.regexps) == 0 && suspects == nil {
+		return nil
+	}
+	g, err := newGroupBy("matched-ips", "client_ip", "count,distinct(url),first_seen,last_seen,active", "")
+	if err != nil {
+		return err
+	}
+	matchedIPs = g
+	return nil
+}
+
+// 单次扫描中命中行的统计
+type matchedIPState struct {
+	st       *groupByState
+	timeline timelineCounts
+	rec      logRecord
+}
+
+func newMatchedIPState() *matchedIPState {
+	if matchedIPs == nil {
+		return nil
+	}
+	return &matchedIPState{st: matchedIPs.newState(), timeline: make(timelineCounts)}
+}
+
+// 统计一条命中行（包括 --ip-timeline），无法解析的行跳过
+func (s *matchedIPState) observe(line string) {
+	if s == nil || parseLogLine(line, &s.rec) != nil {
+		return
+	}
+	s.st.observe(&s.rec)
+	ipTimeline.observe(s.timeline, &s.rec)
+}
+
+func (s *matchedIPState) merge() {
+	if s != nil {
+		matchedIPs.merge(s.st)
+		ipTimeline.merge(s.timeline)
+	}
+}
+
+// 在终端输出命中行的客户端IP统计
+func printMatchedIPs() {
+	if matchedIPs == nil {
+		return
+	}
+	if agg := matchedIPs.aggregate(); len(agg.Rows) > 0 {
+		printAggregate(agg)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 一次性运行模式，用于 Kubernetes CronJob、systemd timer 等定时任务
+var jobFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "job",
+		Usage: tr("定时任务模式：标准输出和标准错误改为每行一条的JSON日志，不交互确认，没有命中时退出码也为0；配置了输出（如 --loki、--db-dsn）且未指定 --output 时只发送到输出，不写本地结果文件", "scheduled job mode: stdout and stderr become JSON log lines, nothing is asked interactively and no matches also exit 0; with outputs configured (e.g. --loki, --db-dsn) and no --output, results only go to the outputs and no local result file is written"),
+	},
+	&cli.StringFlag{
+		Name:  "work-dir",
+		Usage: tr("工作目录：日志缓存、临时文件、结果文件和结果索引等相对路径都相对于该目录", "working directory; relative paths such as the log cache, temp files, result files and the result index are resolved against it"),
+	},
+}
+
+// 是否为 --job 模式
+var jobMode bool
+
+// 参数对应的环境变量前缀，如 --output 对应 CDN_LOG_OUTPUT，子命令的参数加上命令名，如 CDN_LOG_SERVE_LISTEN
+const flagEnvPrefix = "CDN_LOG_"
+
+// 确认下载和修改域名配置的参数只能在命令行上指定，以免 shell 或容器配置中遗留的环境变量跳过交互运行时的确认
+var noEnvFlags = []string{"confirm", "yes", "push-blacklist"}
+
+// 为全部参数（包括子命令的参数）加上对应的环境变量，容器中可以只用环境变量配置；已有的环境变量保留
+func bindFlagEnvVars(prefix string, flags []cli.Flag, commands []*cli.Command) {
+	for _, f := range flags {
+		if slices.Contains(noEnvFlags, f.Names()[0]) {
+			continue
+		}
+		v := reflect.ValueOf(f)
+		if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		field := v.Elem().FieldByName("EnvVars")
+		if !field.IsValid() || field.Type() != reflect.TypeFor[[]string]() {
+			continue
+		}
+		env := prefix + envName(f.Names()[0])
+		if !slices.Contains(field.Interface().([]string), env) {
+			field.Set(reflect.Append(field, reflect.ValueOf(env)))
+		}
+	}
+	for _, cmd := range commands {
+		bindFlagEnvVars(prefix+envName(cmd.Name)+"_", cmd.Flags, cmd.Subcommands)
+	}
+}
+
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// --job 时把标准输出和标准错误替换为同一个管道（保持输出顺序），每行转为一条JSON日志写到原来的标准输出
+var jsonLogs struct {
+	out    *os.File
+	stderr *os.File
+	pipe   *os.File
+	done   chan struct{}
+}
+
+// 一条JSON日志
+type jsonLogRecord struct {
+	Time       time.Time `json:"time"`
+	Level      string    `json:"level"`
+	Message    string    `json:"msg"`
+	AnalysisID string    `json:"analysis_id,omitempty"`
+}
+
+func startJSONLogs() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	jsonLogs.out, jsonLogs.stderr, jsonLogs.pipe = os.Stdout, os.Stderr, w
+	jsonLogs.done = make(chan struct{})
+	os.Stdout, os.Stderr = w, w
+	go func() {
+		defer close(jsonLogs.done)
+		defer r.Close()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			writeJSONLog(scanner.Text())
+		}
+	}()
+	return nil
+}
+
+// 写入一条JSON日志，级别按前缀判断：“错误”为 error，“警告”为 warn，其余为 info；空行跳过
+func writeJSONLog(msg string) {
+	msg = strings.TrimRight(msg, " \t\r")
+	if strings.TrimSpace(msg) == "" {
+		return
+	}
+	level := "info"
+	switch {
+	case strings.HasPrefix(msg, "错误") || strings.HasPrefix(msg, "Error"):
+		level = "error"
+	case strings.HasPrefix(msg, "警告") || strings.HasPrefix(msg, "Warning"):
+		level = "warn"
+	}
+	data, err := json.Marshal(jsonLogRecord{Time: time.Now(), Level: level, Message: msg, AnalysisID: analysisID})
+	if err != nil {
+		return
+	}
+	jsonLogs.out.Write(append(data, '\n'))
+}
+
+// 写完剩余的日志并恢复标准输出和标准错误；未启用时不做任何事
+func stopJSONLogs() {
+	if jsonLogs.pipe == nil {
+		return
+	}
+	jsonLogs.pipe.Close()
+	<-jsonLogs.done
+	os.Stdout, os.Stderr = jsonLogs.out, jsonLogs.stderr
+	jsonLogs.pipe = nil
+}
+
+// 结果已生成但部分输出失败：--job 时以 exitPartial 退出，便于定时任务发现
+func markPartialFailure() {
+	if jobMode {
+		exitCode = exitPartial
+	}
+}
+
+// 分析完成时提示结果保存的位置
+func printResultsSaved() {
+	if config.noLocalResults {
+		fmt.Print(tr("\n分析完成! 结果已发送到配置的输出\n", "\nDone! Results sent to the configured outputs\n"))
+		return
+	}
+	fmt.Printf(tr("\n分析完成! 结果已保存到 %s\n", "\nDone! Results saved to %s\n"), resultsPath())
+}
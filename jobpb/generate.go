@@ -0,0 +1,4 @@
+// Package jobpb 是 serve 子命令的 gRPC 接口，由 jobs.proto 生成
+package jobpb
+
+//go:generate go run github.com/bufbuild/buf/cmd/buf@v1.34.0 generate
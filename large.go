@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze large：按单个响应大小和总流量列出最大的对象，并标出异常大的图片和脚本/样式文件
+var largeCommand = &cli.Command{
+	Name:  "large",
+	Usage: tr("按单个响应的最大大小和总流量列出最大的对象，并标出超过上限的图片（如未压缩的原图）和脚本/样式文件（如未压缩的打包文件）", "list the largest objects by single-response size and by total bytes, flagging images (e.g. full-resolution originals) and scripts/stylesheets (e.g. uncompressed bundles) above the size limits"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+		&cli.StringFlag{
+			Name:  "image-size",
+			Value: "1MB",
+			Usage: tr("单个响应超过该大小的图片标为异常", "flag images whose largest response exceeds this size"),
+		},
+		&cli.StringFlag{
+			Name:  "bundle-size",
+			Value: "512KB",
+			Usage: tr("单个响应超过该大小的 JavaScript 和 CSS 文件标为异常", "flag JavaScript and CSS files whose largest response exceeds this size"),
+		},
+	},
+	Action: runLargeReport,
+}
+
+// 最大对象报表的指标，largeFlags 按下标读取
+const largeMetrics = "max(response_size),bytes,count,avg(response_size)"
+
+func runLargeReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	// 对象类型 → 最大响应的上限
+	limits := make(map[string]int64)
+	for kind, name := range map[string]string{"image": "image-size", "bundle": "bundle-size"} {
+		size, err := parseSize(c.String(name))
+		if err != nil {
+			return fmt.Errorf(tr("--%s 格式错误: %w", "invalid --%s: %w"), name, err)
+		}
+		limits[kind] = size
+	}
+	objects, err := newGroupBy("large", "host,path", largeMetrics, c.String("filter"))
+	if err != nil {
+		return err
+	}
+	traffic, err := newGroupBy("large-traffic", "host,path", "bytes,count,max(response_size),avg(response_size)", c.String("filter"))
+	if err != nil {
+		return err
+	}
+	return runAggregates(c, []*groupBy{objects, traffic}, func(ctx context.Context) {
+		flagged := largeFlags(objects, limits)
+		if len(flagged.Rows) > 0 {
+			printAggregate(flagged)
+		}
+		postAggregates = append(postAggregates, *flagged)
+	})
+}
+
+// 按扩展名判断对象的类型：image、bundle（脚本和样式）或空（不检查大小）
+func largeKind(p string) string {
+	switch extFileTypes[fileExtension(p)] {
+	case "image":
+		return "image"
+	case "script":
+		return "bundle"
+	}
+	return ""
+}
+
+// 最大响应超过其类型的上限的图片和脚本/样式文件，按总流量从多到少
+func largeFlags(objects *groupBy, limits map[string]int64) *result.Aggregate {
+	objects.mu.Lock()
+	defer objects.mu.Unlock()
+	flagged := &result.Aggregate{
+		Name:    "large-flagged",
+		By:      []string{"host", "path", "kind"},
+		Metrics: []string{"bytes", "max(response_size)", "count"},
+		Rows:    []result.AggregateRow{},
+	}
+	for _, v := range objects.groups {
+		kind := largeKind(v.keys[1])
+		if kind == "" || hiddenGroup(v.count) {
+			continue
+		}
+		// 与 largeMetrics 的顺序一致
+		values := objects.values(v)
+		if values[0] <= float64(limits[kind]) {
+			continue
+		}
+		flagged.Rows = append(flagged.Rows, result.AggregateRow{Keys: []string{v.keys[0], v.keys[1], kind}, Values: []float64{values[1], values[0], values[2]}})
+	}
+	flagged.Groups = len(flagged.Rows)
+	if objects.pruned > 0 {
+		flagged.Approximate, flagged.ErrorBound = true, objects.pruned
+	}
+	sortAggregate(flagged)
+	limitAggregate(flagged)
+	return flagged
+}
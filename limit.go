@@ -0,0 +1,63 @@
+package main
+
+import "sync/atomic"
+
+// 全局命中数上限，所有文件共享；nil 表示不限制
+var globalBudget *matchBudget
+
+// 命中数额度
+type matchBudget struct {
+	limit int64
+	used  atomic.Int64
+	// 是否有命中因额度用完而被丢弃
+	truncated atomic.Bool
+}
+
+func newMatchBudget(limit int) *matchBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &matchBudget{limit: int64(limit)}
+}
+
+// 申请一个命中额度，额度用完时返回 false
+func (b *matchBudget) take() bool {
+	return b.takeN(1) == 1
+}
+
+// 最多申请n个命中额度，返回实际获得的数量
+func (b *matchBudget) takeN(n int) int {
+	if b == nil {
+		return n
+	}
+	for {
+		used := b.used.Load()
+		grant := min(int64(n), b.limit-used)
+		if grant < int64(n) {
+			b.truncated.Store(true)
+		}
+		if grant <= 0 {
+			return 0
+		}
+		if b.used.CompareAndSwap(used, used+grant) {
+			return int(grant)
+		}
+	}
+}
+
+// 退回n个已申请的额度，扫描失败、命中被丢弃时调用
+func (b *matchBudget) release(n int) {
+	if b != nil {
+		b.used.Add(-int64(n))
+	}
+}
+
+// 额度是否已经用完
+func (b *matchBudget) exhausted() bool {
+	return b != nil && b.used.Load() >= b.limit
+}
+
+// 是否有命中因额度用完而被丢弃
+func (b *matchBudget) wasTruncated() bool {
+	return b != nil && b.truncated.Load()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// 日志列表缓存的参数
+var listingFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "listing-cache-ttl",
+		Usage: tr("DescribeCdnDomainLogs 结果按域名和日期缓存在本地的有效期，如 30m，0 表示不缓存；注意日志下载链接本身也会过期", "how long DescribeCdnDomainLogs results are cached on disk per domain and day, e.g. 30m; 0 disables the cache. Note that the download links themselves also expire"),
+	},
+}
+
+// 日志列表缓存的有效期，0 表示不缓存
+var listingCacheTTL time.Duration
+
+func loadListingConfig(c *cli.Context) error {
+	listingCacheTTL = c.Duration("listing-cache-ttl")
+	if listingCacheTTL < 0 {
+		return errors.New(tr("--listing-cache-ttl 不能为负数", "--listing-cache-ttl must not be negative"))
+	}
+	return nil
+}
+
+// 一个可下载的日志文件
+type logFile struct {
+	Name  string    `json:"name"`
+	URL   string    `json:"url"`
+	Size  int64     `json:"size"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// 一个域名一天的日志列表缓存
+type listingCacheEntry struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Files     []logFile `json:"files"`
+}
+
+// 单页最多返回的日志数（接口上限）
+const listingPageSize = 1000
+
+// 查询域名在时间范围内的日志文件：按UTC日期逐天查询（可使用缓存），再筛选与时间范围重叠的文件
+func listLogFiles(ctx context.Context, p logProvider, domain string, start, end time.Time) (files []logFile, err error) {
+	ctx, span := startSpan(ctx, "list-log-files", attribute.String("cdn.provider", p.name()), attribute.String("cdn.domain", domain))
+	defer func() { endSpan(span, err) }()
+
+	cached := 0
+	for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+		list, ok := loadListingCache(p.name(), domain, day)
+		if ok {
+			cached++
+		} else {
+			if list, err = p.listDayLogs(ctx, domain, day); err != nil {
+				return nil, err
+			}
+			// 当天的日志还会增加，只缓存已经结束的日期
+			if day.Add(24 * time.Hour).Before(time.Now()) {
+				saveListingCache(p.name(), domain, day, list)
+			}
+		}
+		if len(list) == 0 {
+			recordMissingLogDay(domain, day)
+		}
+		for _, f := range list {
+			if f.End.After(start) && f.Start.Before(end) {
+				files = append(files, f)
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("cdn.log_files", len(files)), attribute.Int("cdn.cached_days", cached))
+	return files, nil
+}
+
+// 通过 DescribeCdnDomainLogs 分页查询一天的全部日志文件
+func describeDayLogs(ctx context.Context, client *cdn20180510.Client, domain string, day time.Time) ([]logFile, error) {
+	var files []logFile
+	for page := int64(1); ; page++ {
+		req := &cdn20180510.DescribeCdnDomainLogsRequest{
+			DomainName: tea.String(domain),
+			StartTime:  tea.String(day.Format(time.RFC3339)),
+			EndTime:    tea.String(day.Add(24 * time.Hour).Format(time.RFC3339)),
+			PageNumber: tea.Int64(page),
+			PageSize:   tea.Int64(listingPageSize),
+		}
+		var resp *cdn20180510.DescribeCdnDomainLogsResponse
+		err := withAPIRetry(ctx, "DescribeCdnDomainLogs", func() (err error) {
+			resp, err = client.DescribeCdnDomainLogsWithOptions(req, &util.RuntimeOptions{})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf(tr("API调用失败: %w", "API call failed: %w"), err)
+		}
+
+		total, got := int64(0), 0
+		for _, log := range resp.Body.DomainLogDetails.DomainLogDetail {
+			if log.PageInfos != nil {
+				total = max(total, tea.Int64Value(log.PageInfos.Total))
+			}
+			if log.LogInfos == nil {
+				continue
+			}
+			for _, detail := range log.LogInfos.LogInfoDetail {
+				got++
+				if detail.LogPath == nil {
+					continue
+				}
+				f := logFile{
+					Name: tea.StringValue(detail.LogName),
+					URL:  tea.StringValue(detail.LogPath),
+					Size: tea.Int64Value(detail.LogSize),
+				}
+				f.Start, _ = time.Parse(time.RFC3339, tea.StringValue(detail.StartTime))
+				f.End, _ = time.Parse(time.RFC3339, tea.StringValue(detail.EndTime))
+				files = append(files, f)
+			}
+		}
+		if got < listingPageSize || page*listingPageSize >= total {
+			return files, nil
+		}
+	}
+}
+
+// 用户缓存目录中日志列表缓存的根目录
+func listingCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdn-log-analyzer", "listings"), nil
+}
+
+// 一个域名一天的日志列表缓存；阿里云沿用最初的目录结构，其他厂商在以厂商名命名的子目录中
+func listingCachePath(provider, domain string, day time.Time) (string, error) {
+	dir, err := listingCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if provider != "aliyun" {
+		dir = filepath.Join(dir, provider)
+	}
+	return filepath.Join(dir, domain, day.Format(time.DateOnly)+".json"), nil
+}
+
+// 读取未过期的日志列表缓存
+func loadListingCache(provider, domain string, day time.Time) ([]logFile, bool) {
+	if listingCacheTTL <= 0 {
+		return nil, false
+	}
+	path, err := listingCachePath(provider, domain, day)
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry listingCacheEntry
+	if json.Unmarshal(data, &entry) != nil || time.Since(entry.FetchedAt) > listingCacheTTL {
+		return nil, false
+	}
+	return entry.Files, true
+}
+
+// 保存日志列表缓存；失败只影响下次是否命中缓存，因此只打印警告
+func saveListingCache(provider, domain string, day time.Time, files []logFile) {
+	if listingCacheTTL <= 0 {
+		return
+	}
+	path, err := listingCachePath(provider, domain, day)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+	}
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(listingCacheEntry{FetchedAt: time.Now(), Files: files}); err == nil {
+			err = os.WriteFile(path, data, 0o600)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 保存日志列表缓存失败: %v\n", "Warning: save listing cache: %v\n"), err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// list-logs：只列出可下载的日志文件，不下载
+var listLogsCommand = &cli.Command{
+	Name:  "list-logs",
+	Usage: tr("列出域名在时间范围内可下载的日志文件（文件名、大小和时间段），不下载", "list the log files available for the domain and time range (name, size and time span) without downloading them"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: tr("输出格式: table 或 json", "output format: table or json"),
+		},
+		&cli.BoolFlag{
+			Name:  "urls",
+			Usage: tr("表格中显示下载链接", "show download URLs in the table"),
+		},
+	},
+	Action: runListLogs,
+}
+
+// list-logs 输出的一个日志文件
+type listedLog struct {
+	Account string `json:"account,omitempty"`
+	Domain  string `json:"domain"`
+	logFile
+}
+
+func runListLogs(c *cli.Context) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf(tr("不支持的输出格式 %q，可选 table 或 json", "unsupported output format %q, use table or json"), format)
+	}
+	if err := loadListingCommandConfig(c); err != nil {
+		return err
+	}
+	logs, err := listAllLogs(c.Context)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if logs == nil {
+			logs = []listedLog{}
+		}
+		return encoder.Encode(logs)
+	}
+	printLogList(logs, c.Bool("urls"))
+	return nil
+}
+
+// list-logs、verify 等只查询日志列表的子命令需要的配置，不加载搜索和分析相关的参数
+func loadListingCommandConfig(c *cli.Context) error {
+	config.domainName = c.String("domain")
+	config.startTime = c.String("start")
+	config.endTime = c.String("end")
+	if err := loadProviderConfig(c); err != nil {
+		return err
+	}
+	if err := loadAccounts(c); err != nil {
+		return err
+	}
+	if err := loadAPIRetryConfig(c); err != nil {
+		return err
+	}
+	return loadListingConfig(c)
+}
+
+// 查询时间范围内全部域名（多账号时为每个账号的每个域名）的日志文件
+func listAllLogs(ctx context.Context) ([]listedLog, error) {
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return nil, err
+	}
+	missingLogDays = nil
+	defer printMissingLogDays()
+	var logs []listedLog
+	if len(accounts) == 0 {
+		p, err := newLogProvider()
+		if err != nil {
+			return nil, err
+		}
+		files, err := listLogFiles(ctx, p, config.domainName, start, end)
+		if err != nil {
+			return nil, err
+		}
+		catalogListing("", config.domainName, files)
+		for _, f := range files {
+			logs = append(logs, listedLog{Domain: config.domainName, logFile: f})
+		}
+	}
+	for i := range accounts {
+		a := &accounts[i]
+		p, err := a.logProvider()
+		if err != nil {
+			return nil, err
+		}
+		for _, domain := range a.Domains {
+			files, err := listLogFiles(ctx, p, domain, start, end)
+			if err != nil {
+				return nil, fmt.Errorf(tr("账号 %s 域名 %s: %w", "account %s, domain %s: %w"), a.Name, domain, err)
+			}
+			catalogListing(a.Name, domain, files)
+			for _, f := range files {
+				logs = append(logs, listedLog{Account: a.Name, Domain: domain, logFile: f})
+			}
+		}
+	}
+	return logs, nil
+}
+
+// 以表格输出日志文件列表和总大小
+func printLogList(logs []listedLog, showURLs bool) {
+	header := []string{"domain", "name", "size", "start", "end"}
+	if len(accounts) > 0 {
+		header = append([]string{"account"}, header...)
+	}
+	if showURLs {
+		header = append(header, "url")
+	}
+	// 大小列右对齐
+	rightAlign := make([]bool, len(header))
+	rightAlign[slices.Index(header, "size")] = true
+	var rows [][]string
+	var total int64
+	for _, l := range logs {
+		row := []string{l.Domain, l.Name, formatBytes(l.Size), l.Start.Format(time.RFC3339), l.End.Format(time.RFC3339)}
+		if len(accounts) > 0 {
+			row = append([]string{l.Account}, row...)
+		}
+		if showURLs {
+			row = append(row, l.URL)
+		}
+		rows = append(rows, row)
+		total += l.Size
+	}
+	writeTable(os.Stdout, "", header, rows, rightAlign)
+	fmt.Printf(tr("共 %d 个日志文件，%s\n", "%d log files, %s in total\n"), len(logs), formatBytes(total))
+}
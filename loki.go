@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 通过 Loki push API 发送命中行和告警
+var lokiFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "loki",
+		Usage: tr("把命中行和告警推送到该 Loki 地址，如 http://localhost:3100；用户名和密码可写在地址中", "push matched lines and alerts to this Loki, e.g. http://localhost:3100; credentials may be given in the URL"),
+	},
+	&cli.StringFlag{
+		Name:  "loki-labels",
+		Value: "domain,kind,status_class,analysis_id",
+		Usage: tr("作为 Loki 标签的字段，逗号分隔，可选 domain、kind、status_class（如 4xx）、severity、rule、analysis_id", "comma-separated fields used as Loki labels: domain, kind, status_class (e.g. 4xx), severity, rule, analysis_id"),
+	},
+	&cli.StringSliceFlag{
+		Name:  "loki-label",
+		Usage: tr("附加的固定标签，格式 name=value，可重复", "extra static label as name=value, repeatable"),
+	},
+	&cli.StringFlag{
+		Name:  "loki-tenant",
+		Usage: tr("多租户 Loki 的租户ID（X-Scope-OrgID）", "tenant ID (X-Scope-OrgID) of a multi-tenant Loki"),
+	},
+}
+
+// 可作为 Loki 标签的字段
+var lokiLabelFields = map[string]func(ev *sinkEvent) string{
+	"domain":      (*sinkEvent).domain,
+	"kind":        func(ev *sinkEvent) string { return ev.kind },
+	"severity":    func(ev *sinkEvent) string { return ev.severity },
+	"rule":        (*sinkEvent).rule,
+	"analysis_id": func(*sinkEvent) string { return analysisID },
+	"status_class": func(ev *sinkEvent) string {
+		if ev.rec == nil || ev.rec.Status <= 0 {
+			return ""
+		}
+		return strconv.Itoa(ev.rec.Status/100) + "xx"
+	},
+}
+
+// 每次推送的最多行数
+const lokiBatchSize = 1000
+
+type lokiSink struct {
+	endpoint string
+	user     *url.Userinfo
+	tenant   string
+	labels   []string
+	static   map[string]string
+
+	// 按标签集合缓冲的行，键为标签的 JSON 文本
+	streams map[string]*lokiBuffer
+	pending int
+}
+
+// 一个标签集合下缓冲的行
+type lokiBuffer struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	t    int64
+	line string
+}
+
+// push API 中的一个流，values 的每一项为 [纳秒时间戳, 日志行]
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func loadLokiSink(c *cli.Context) (outputSink, error) {
+	target := c.String("loki")
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(tr("--loki 地址无效 %q，格式如 http://localhost:3100", "invalid --loki address %q, use e.g. http://localhost:3100"), target)
+	}
+	s := &lokiSink{user: u.User, tenant: c.String("loki-tenant"), static: make(map[string]string), streams: make(map[string]*lokiBuffer)}
+	u.User = nil
+	s.endpoint = strings.TrimSuffix(u.String(), "/") + "/loki/api/v1/push"
+	for _, name := range strings.Split(c.String("loki-labels"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if lokiLabelFields[name] == nil {
+			return nil, fmt.Errorf(tr("--loki-labels 中不支持的字段 %q", "unsupported field %q in --loki-labels"), name)
+		}
+		s.labels = append(s.labels, name)
+	}
+	for _, kv := range c.StringSlice("loki-label") {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf(tr("--loki-label 格式应为 name=value: %q", "--loki-label must be name=value: %q"), kv)
+		}
+		s.static[name] = value
+	}
+	if len(s.labels) == 0 && len(s.static) == 0 {
+		return nil, errors.New(tr("Loki 的记录至少需要一个标签，请设置 --loki-labels 或 --loki-label", "Loki entries need at least one label; set --loki-labels or --loki-label"))
+	}
+	return s, nil
+}
+
+func (s *lokiSink) String() string { return "loki " + s.endpoint }
+
+func (s *lokiSink) send(ev *sinkEvent) error {
+	labels := make(map[string]string, len(s.labels)+len(s.static))
+	for k, v := range s.static {
+		labels[k] = v
+	}
+	for _, name := range s.labels {
+		if v := lokiLabelFields[name](ev); v != "" {
+			labels[name] = v
+		}
+	}
+	key, _ := json.Marshal(labels)
+	buf := s.streams[string(key)]
+	if buf == nil {
+		buf = &lokiBuffer{labels: labels}
+		s.streams[string(key)] = buf
+	}
+	buf.entries = append(buf.entries, lokiEntry{ev.time.UnixNano(), ev.message()})
+	s.pending++
+	if s.pending >= lokiBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// 推送缓冲中的全部行，每个流内按时间排序
+func (s *lokiSink) flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+	var body struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+	for _, buf := range s.streams {
+		slices.SortStableFunc(buf.entries, func(a, b lokiEntry) int { return cmp.Compare(a.t, b.t) })
+		st := &lokiStream{Stream: buf.labels, Values: make([][2]string, len(buf.entries))}
+		for i, e := range buf.entries {
+			st.Values[i] = [2]string{strconv.FormatInt(e.t, 10), e.line}
+		}
+		body.Streams = append(body.Streams, st)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	s.streams, s.pending = make(map[string]*lokiBuffer), 0
+
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.tenant)
+	}
+	if s.user != nil {
+		password, _ := s.user.Password()
+		req.SetBasicAuth(s.user.Username(), password)
+	}
+	return doSinkRequest(req)
+}
+
+func (s *lokiSink) close() error { return s.flush() }
@@ -2,181 +2,725 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
-	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
-	util "github.com/alibabacloud-go/tea-utils/v2/service"
-	"github.com/alibabacloud-go/tea/tea"
 	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/klauspost/compress/flate"
+	gzip "github.com/klauspost/pgzip"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
 	tempDir     = "./cdn_logs_temp"
+	logDir      = "onlice-log"
 	resultsFile = "ip_search_results.txt"
 	maxWorkers  = 8
-	userAgent   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36"
+	// 并行解压参数：每块1MB，每个文件最多预读16块
+	gzipBlockSize = 1 << 20
+	gzipBlocks    = 16
+	userAgent     = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36"
 )
 
+// 进程退出码，与grep保持一致
+const (
+	exitMatched   = 0
+	exitNoMatches = 1
+	exitError     = 2
+	// --job 时结果已生成，但发送到部分输出失败
+	exitPartial = 3
+)
+
+// 搜索完成后设置的退出码，子命令保持默认的 0
+var exitCode = exitMatched
+
+// 当前搜索使用的行匹配器
+var lineMatcher matcher
+
 // 全局配置
 var config struct {
 	domainName string
 	startTime  string
 	endTime    string
 	searchIP   string
+	// --ip-file 的路径
+	ipFile string
+	// --keyword 和 --pattern
+	keywords   []string
+	regexps    []string
+	ignoreCase bool
+	// 命中行前后输出的上下文行数
+	beforeContext int
+	afterContext  int
+	// 只统计命中数，不输出命中行
+	countOnly bool
+	// 结果文件只包含汇总，不保留命中行
+	summaryOnly bool
+	// 命中行按请求时间合并输出
+	mergeByTime bool
+	// 按时间排序时每个搜索协程的排序缓冲大小，超出后写出已排序的段；0 表示不限制
+	sortBuffer int64
+	// 单个文件和全局的命中数上限，0 表示不限制
+	maxMatches      int
+	maxTotalMatches int
+	// 同时搜索的文件数
+	workers int
+	// 单个文件内部的并行搜索协程数，<=1 表示按行顺序搜索
+	splitWorkers int
+	// 结果文件格式，text 或 json
+	format string
+	// 结果文件路径：--output 渲染后的路径，或带时间戳的默认文件名；为空时使用固定的默认文件名
+	output string
+	// 追加到结果文件而不是覆盖
+	appendResults bool
+	// --job 且配置了输出时不写本地结果文件
+	noLocalResults bool
 }
 
 func main() {
 	app := &cli.App{
 		Name:  "cdn-log-analyzer",
-		Usage: "查询、下载和分析阿里云CDN日志",
-		Flags: []cli.Flag{
+		Usage: tr("查询、下载和分析阿里云CDN日志", "query, download and analyze Aliyun CDN logs"),
+		// --field 的表达式中可能有逗号，不按逗号拆分
+		DisableSliceFlagSeparator: true,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "lang",
+				Value: lang,
+				Usage: tr("输出语言: zh 或 en (默认根据 LANG 环境变量)", "output language: zh or en (defaults from LANG)"),
+			},
 			&cli.StringFlag{
 				Name:     "domain",
 				Aliases:  []string{"d"},
-				Value:    "替换成你自己的域名！！！！！",
-				Usage:    "CDN域名",
+				Value:    tr("替换成你自己的域名！！！！！", "replace-with-your-domain"),
+				Usage:    tr("CDN域名", "CDN domain name"),
 				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "start",
 				Aliases:  []string{"s"},
-				Usage:    "开始时间 (格式: 2006-01-02T15:04:05Z)",
-				Required: true,
+				Usage:    tr("开始时间 (格式: 2006-01-02T15:04:05Z)", "start time (format: 2006-01-02T15:04:05Z)"),
+				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "end",
 				Aliases:  []string{"e"},
-				Usage:    "结束时间 (格式: 2006-01-02T15:04:05Z)",
-				Required: true,
+				Usage:    tr("结束时间 (格式: 2006-01-02T15:04:05Z)", "end time (format: 2006-01-02T15:04:05Z)"),
+				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "ip",
 				Aliases:  []string{"i"},
-				Usage:    "要搜索的IP地址",
-				Required: true,
+				Usage:    tr("要搜索的IP地址，多个IP用逗号分隔", "IP address(es) to search for, comma-separated"),
+				Required: false,
 			},
-		},
+			&cli.StringSliceFlag{
+				Name:    "keyword",
+				Aliases: []string{"k"},
+				Usage:   tr("要搜索的关键字（如文件名、请求ID），包含其中任意一个的行即命中，可多次指定，可与 --ip 同时使用", "keyword to search for, such as a filename or request ID; lines containing any keyword match; may be repeated and combined with --ip"),
+			},
+			&cli.StringSliceFlag{
+				Name:  "pattern",
+				Usage: tr("要搜索的正则表达式（Go RE2 语法），可多次指定", "regular expression to search for (Go RE2 syntax); may be repeated"),
+			},
+			&cli.StringFlag{
+				Name:  "ip-file",
+				Usage: tr("从文件读取要搜索的IP和CIDR网段（每行一个，# 开头为注释），按条目统计命中数，可与 --ip 同时使用", "read IPs and CIDR networks to search for from a file (one per line, # for comments) and report hits per entry; may be combined with --ip"),
+			},
+			&cli.StringFlag{
+				Name:  "urls-file",
+				Usage: tr("从文件读取日志下载链接（每行一个，- 表示标准输入），不再调用API查询", "read log download URLs from a file (one per line, - for stdin) instead of querying the API"),
+			},
+			&cli.StringFlag{
+				Name:  "rules",
+				Usage: tr("YAML检测规则文件：对全部日志按过滤条件、分组和时间窗口聚合，超过阈值时输出告警（可不指定 --ip）", "YAML detection rules file: aggregate all log lines by filter, group and time window and report findings above thresholds (--ip becomes optional)"),
+			},
+			&cli.StringFlag{
+				Name:  "template",
+				Usage: tr("使用Go text/template格式化结果：模板文件路径或模板文本，对每条命中执行一次，可定义 header/summary 子模板", "format results with a Go text/template (file path or template text), executed once per match; may define header/summary sub-templates"),
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Value: formatText,
+				Usage: tr("结果文件格式: text 或 json（json 格式定义见 result 包）", "result file format: text or json (the json schema is defined in package result)"),
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   tr("结果文件路径，可使用模板字段，如 reports/{{.Domain}}/{{.Date}}/ip-{{.IP}}.{{.Ext}}；目录不存在时自动创建。默认为带时间戳的 ip_search_results_<时间>.txt", "result file path, may use template fields, e.g. reports/{{.Domain}}/{{.Date}}/ip-{{.IP}}.{{.Ext}}; missing directories are created. Defaults to a timestamped ip_search_results_<time>.txt"),
+			},
+			&cli.BoolFlag{
+				Name:  "append",
+				Usage: tr("追加到结果文件（未指定 --output 时为 ip_search_results.txt）而不是新建文件，仅支持文本格式", "append to the result file (ip_search_results.txt unless --output is given) instead of writing a new one; text format only"),
+			},
+			&cli.IntFlag{
+				Name:    "workers",
+				Aliases: []string{"w"},
+				Value:   maxWorkers,
+				Usage:   tr("同时搜索的文件数，可用 bench 子命令测试合适的值", "number of files searched concurrently; use the bench subcommand to find a good value"),
+			},
+			&cli.BoolFlag{
+				Name:  "ignore-case",
+				Usage: tr("匹配时忽略大小写", "ignore case when matching"),
+			},
+			&cli.IntFlag{
+				Name:    "after-context",
+				Aliases: []string{"A"},
+				Usage:   tr("输出每个命中行之后的N行", "print N lines after each match"),
+			},
+			&cli.IntFlag{
+				Name:    "before-context",
+				Aliases: []string{"B"},
+				Usage:   tr("输出每个命中行之前的N行", "print N lines before each match"),
+			},
+			&cli.IntFlag{
+				Name:    "context",
+				Aliases: []string{"C"},
+				Usage:   tr("输出每个命中行前后各N行", "print N lines before and after each match"),
+			},
+			&cli.BoolFlag{
+				Name:  "count",
+				Usage: tr("只统计每个文件和总的命中行数，不输出命中行内容", "only report per-file and total match counts, without line content"),
+			},
+			&cli.BoolFlag{
+				Name:  "merge-by-time",
+				Usage: tr("把所有文件的命中行按请求时间合并为一个序列输出，而不是按文件分组，便于还原时间线", "merge the matched lines of all files into one stream ordered by request time instead of grouping them by file, to reconstruct timelines"),
+			},
+			&cli.StringFlag{
+				Name:  "sort-buffer",
+				Value: "64MB",
+				Usage: tr("--merge-by-time 排序时每个搜索协程使用的内存，超出后把已排序的部分写入临时文件，最后归并 (0 表示不限制)", "memory each search worker uses to sort lines for --merge-by-time; beyond that sorted runs are spilled to temp files and merged at the end (0 = no limit)"),
+			},
+			&cli.BoolFlag{
+				Name:  "summary-only",
+				Usage: tr("结果文件只写入头部、各文件命中数和聚合报表，不写入命中行（命中行很多时使用）", "write only the header, per-file match counts and aggregate tables to the result file, without the matched lines (for very large result sets)"),
+			},
+			&cli.IntFlag{
+				Name:  "max-matches",
+				Usage: tr("每个文件最多收集的命中行数，超出后停止搜索该文件 (0 表示不限制)", "maximum matches collected per file; searching the file stops after that (0 = unlimited)"),
+			},
+			&cli.IntFlag{
+				Name:  "max-total-matches",
+				Usage: tr("所有文件合计最多收集的命中行数 (0 表示不限制)", "maximum matches collected across all files (0 = unlimited)"),
+			},
+			&cli.StringFlag{
+				Name:  "sample",
+				Usage: tr("采样处理，1/N 表示每N行取一行，0.01 表示随机取1%的行；结果为采样值", "sample lines: 1/N keeps every Nth line, 0.01 keeps a random 1%; results are sampled values"),
+			},
+			&cli.IntFlag{
+				Name:  "split-workers",
+				Value: 0,
+				Usage: tr("将单个大文件按行切分为多个分块并行搜索的协程数 (0 表示不切分)", "goroutines used to search line-aligned chunks of a single large file in parallel (0 = no splitting)"),
+			},
+		}, slices.Concat(providerFlags, accountFlags, apiRetryFlags, listingFlags, downloadFlags, cacheFlags, ossFlags, fieldFlags, crawlerFlags, intelFlags, blocklistFlags, reputationFlags, rdnsFlags, crossCheckFlags, chartFlags, heatmapFlags, typeTimelineFlags, compareWeekFlags, ipTimelineFlags, reportFlags, timeFlags, jobFlags,
+			exportFlags, syslogFlags, fluentFlags, lokiFlags, splunkFlags, gelfFlags, influxFlags, sqlSinkFlags, slsFlags, odpsFlags, encryptFlags, anonymizeFlags, retentionFlags, profileFlags, tracingFlags)...),
+		Before: beforeRun,
+		After:  afterRun,
 		Action: run,
+		Commands: []*cli.Command{
+			benchCommand,
+			serveCommand,
+			listLogsCommand,
+			downloadCommand,
+			verifyCommand,
+			pruneCommand,
+			cacheCommand,
+			mirrorCommand,
+			analyzeCommand,
+			doctorCommand,
+		},
 	}
 
+	bindFlagEnvVars(flagEnvPrefix, app.Flags, app.Commands)
+	// 与grep一致的退出码：0 有命中，1 无命中，2 出错；--job 时没有命中也为 0，部分输出失败为 3
 	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, tr("错误: %v\n", "Error: %v\n"), err)
+		stopJSONLogs()
+		os.Exit(exitError)
 	}
+	stopJSONLogs()
+	os.Exit(exitCode)
 }
 
-func run(c *cli.Context) error {
-	// 解析配置
-	config.domainName = c.String("domain")
-	config.startTime = c.String("start")
-	config.endTime = c.String("end")
-	config.searchIP = c.String("ip")
-
-	fmt.Printf("开始CDN日志分析任务\n")
-	fmt.Printf("域名: %s\n", config.domainName)
-	fmt.Printf("时间范围: %s 至 %s\n", config.startTime, config.endTime)
-	fmt.Printf("搜索IP: %s\n", config.searchIP)
-
-	// 创建临时目录
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return fmt.Errorf("创建临时目录失败: %w", err)
+// 命令执行前的初始化：性能分析与链路追踪
+func beforeRun(c *cli.Context) error {
+	// 语言已在包初始化时确定，这里只校验取值
+	if l := c.String("lang"); l != "zh" && l != "en" {
+		return fmt.Errorf(tr("不支持的语言 %q，可选 zh 或 en", "unsupported language %q, use zh or en"), l)
 	}
-	// 创建日志保存目录
-	if err := os.MkdirAll("onlice-log", 0755); err != nil {
-		return fmt.Errorf("创建日志保存目录失败: %w", err)
+	if jobMode = c.Bool("job"); jobMode {
+		if err := startJSONLogs(); err != nil {
+			return err
+		}
 	}
-	defer os.RemoveAll(tempDir)
+	if dir := c.String("work-dir"); dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf(tr("--work-dir 无效: %w", "invalid --work-dir: %w"), err)
+		}
+	}
+	if err := startProfiling(c); err != nil {
+		return err
+	}
+	return startTracing(c)
+}
 
-	// 获取日志下载链接并写入文件
-	if err := fetchAndSaveCDNLogURLs(); err != nil {
-		return fmt.Errorf("获取日志链接失败: %w", err)
+// 命令执行后的清理：上报追踪数据、写入性能数据
+func afterRun(c *cli.Context) error {
+	// 出错提前退出时关闭导出文件
+	logExport.finish(nil)
+	closePartialResults(false)
+	cleanupTimeMerge()
+	cleanupMatchStores()
+	if err := stopTracing(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 	}
+	return stopProfiling(c)
+}
 
-	// 从文件读取日志链接
-	logURLs, err := readLogURLsFromFile("log-url.log")
-	if err != nil {
-		return fmt.Errorf("读取日志链接失败: %w", err)
+func run(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	if len(splitPatterns(config.searchIP)) == 0 && len(config.keywords) == 0 && len(config.regexps) == 0 &&
+		suspects == nil && ruleSet == nil && intelReport == nil && (logExport == nil || !logExport.all) {
+		return errors.New(tr("需要指定 --ip、--ip-file、--keyword、--pattern、--rules 或 --export-all", "one of --ip, --ip-file, --keyword, --pattern, --rules or --export-all is required"))
 	}
 
-	fmt.Printf("获取到 %d 个日志文件链接\n", len(logURLs))
+	runStats.reset()
+	ctx, span := startSpan(c.Context, "analyze",
+		attribute.String("cdn.domain", config.domainName),
+		attribute.String("search.patterns", displaySearchIP()))
+	defer span.End()
+
+	fmt.Print(tr("开始CDN日志分析任务\n", "Starting CDN log analysis\n"))
+	if len(accounts) > 0 {
+		fmt.Printf(tr("账号: %s\n", "Accounts: %s\n"), accountsSummary())
+	} else {
+		fmt.Printf(tr("域名: %s\n", "Domain: %s\n"), config.domainName)
+	}
+	fmt.Printf(tr("时间范围: %s 至 %s\n", "Time range: %s to %s\n"), config.startTime, config.endTime)
+	if config.searchIP != "" {
+		fmt.Printf(tr("搜索IP: %s\n", "Search IP: %s\n"), config.searchIP)
+	}
+	if len(config.keywords) > 0 {
+		fmt.Printf(tr("关键字: %s\n", "Keywords: %s\n"), strings.Join(config.keywords, ", "))
+	}
+	if len(config.regexps) > 0 {
+		fmt.Printf(tr("正则表达式: %s\n", "Patterns: %s\n"), strings.Join(config.regexps, ", "))
+	}
+	if suspects != nil {
+		fmt.Printf(tr("IP列表: %s (%d 个IP/网段)\n", "IP file: %s (%d IPs/networks)\n"), config.ipFile, suspects.len())
+	}
+	if len(intelFeeds) > 0 {
+		fmt.Printf(tr("威胁情报源: %s\n", "Threat-intel feeds: %s\n"), intelFeedSummary())
+	}
 
-	// 下载日志文件
-	downloadedFiles, err := downloadLogs(logURLs)
+	if err := loadMatchedIPs(); err != nil {
+		return err
+	}
+	if err := openPartialResults(); err != nil {
+		return err
+	}
+	results, err := analyze(ctx, c.String("urls-file"))
 	if err != nil {
-		return fmt.Errorf("下载日志失败: %w", err)
+		return err
 	}
 
-	fmt.Printf("成功下载 %d/%d 个日志文件\n", len(downloadedFiles), len(logURLs))
+	// 仅统计模式：直接在终端输出各文件命中数
+	if config.countOnly {
+		for _, file := range sortedFiles(results) {
+			fmt.Printf("%s: %d\n", fileLabel(file), results[file].matches)
+		}
+		fmt.Printf(tr("总命中行数: %d\n", "Total matches: %d\n"), totalMatches(results))
+	}
+	if lineSampler != nil {
+		fmt.Printf(tr("采样 %s: 采样命中 %d 行，估算总命中约 %.0f 行\n", "Sample %s: %d sampled matches, about %.0f estimated in total\n"),
+			lineSampler.spec, totalMatches(results), float64(totalMatches(results))*lineSampler.scale())
+	}
+	printRequestChart()
 
-	// 搜索IP
-	results, err := searchLogsForIP(downloadedFiles)
-	if err != nil {
-		return fmt.Errorf("搜索日志失败: %w", err)
+	findings, alerts := ruleSet.findings(), ruleSet.alerts()
+	// 信誉查询失败不影响告警，只给出警告
+	if reputationEnabled() && len(findings) > 0 {
+		if err := enrichReputation(ctx, findings); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: IP信誉查询失败: %v\n", "Warning: IP reputation lookup failed: %v\n"), err)
+		}
+		findings = ruleSet.findings()
+	}
+	resolveReportIPs(ctx, findings, aggregates())
+	for _, ip := range splitPatterns(config.searchIP) {
+		if host := hostnameOf(ip); host != "" {
+			fmt.Printf("  %s: %s\n", ip, host)
+		}
+	}
+	if ruleSet.has(false) {
+		printFindings(findings)
+	}
+	if ruleSet.has(true) {
+		printAlerts(alerts)
+	}
+	printSuspectsReport()
+	printIntelReport()
+	printMatchedIPs()
+	printIPTimeline()
+	if err := printHeatmap(); err != nil {
+		return err
+	}
+	if err := printTypeTimeline(); err != nil {
+		return err
+	}
+	if err := writeIPTimelineCSV(); err != nil {
+		return fmt.Errorf(tr("写入请求时间线失败: %w", "write request timeline: %w"), err)
+	} else if ipTimeline != nil && ipTimeline.csv != "" {
+		fmt.Printf(tr("请求时间线已写入 %s\n", "Request timeline written to %s\n"), ipTimeline.csv)
+	}
+	if blocklistConfig.dir != "" {
+		n, err := writeBlocklists(findings)
+		if err != nil {
+			return fmt.Errorf(tr("生成封禁列表失败: %w", "write blocklists: %w"), err)
+		}
+		fmt.Printf(tr("封禁列表: %d 个IP/网段已写入 %s\n", "Blocklists: %d IPs/networks written to %s\n"), n, blocklistConfig.dir)
 	}
+	// 推送黑名单失败（如 API 限流）不影响保存分析结果，只给出警告
+	if blocklistConfig.push {
+		if err := pushBlackList(ctx, findings, blocklistConfig.confirm); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 推送IP黑名单失败: %v\n", "Warning: push IP blacklist: %v\n"), err)
+			markPartialFailure()
+		}
+	}
+	// 监控数据查询失败不影响搜索结果，只给出警告
+	crossCheckResult = nil
+	if len(crossCheckConfig.metrics) > 0 {
+		check, err := runCrossCheck(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 与监控数据对比失败: %v\n", "Warning: cross-check with monitoring data failed: %v\n"), err)
+		} else {
+			crossCheckResult = check
+			printCrossCheck(check)
+		}
+	}
+	compareWithPreviousWeek(ctx)
 
 	// 保存结果
-	if err := saveResults(results); err != nil {
-		return fmt.Errorf("保存结果失败: %w", err)
+	if err := saveResults(ctx, results); err != nil {
+		return fmt.Errorf(tr("保存结果失败: %w", "save results: %w"), err)
 	}
 
-	fmt.Printf("\n分析完成! 结果已保存到 %s\n", resultsFile)
+	if resultsTruncated(results) {
+		fmt.Print(tr("\n注意: 已达到命中数上限，结果被截断\n", "\nNote: match limit reached, results are truncated\n"))
+	}
+	fmt.Printf(tr("\n处理统计:\n%s", "\nProcessing statistics:\n%s"), runStats.summary("  ", totalMatches(results)))
+	printResultsSaved()
+	if totalMatches(results) == 0 && len(findings) == 0 && len(alerts) == 0 && !jobMode {
+		exitCode = exitNoMatches
+	}
 	return nil
 }
 
-// 获取CDN日志下载链接并写入log-url.log文件
-func fetchAndSaveCDNLogURLs() error {
-	client, err := createClient()
+// 从命令行参数读取一次分析的配置，run 和 analyze 子命令共用
+func loadRunConfig(c *cli.Context) error {
+	// 解析配置
+	config.domainName = c.String("domain")
+	config.startTime = c.String("start")
+	config.endTime = c.String("end")
+	config.searchIP = c.String("ip")
+	loadOSSConfig(c)
+	tmpl, err := loadOutputTemplate(c.String("template"))
+	if err != nil {
+		return err
+	}
+	outputTemplate = tmpl
+	config.format = c.String("format")
+	if config.format != formatText && config.format != formatJSON {
+		return fmt.Errorf(tr("不支持的结果格式 %q，可选 text 或 json", "unsupported result format %q, use text or json"), config.format)
+	}
+	if outputTemplate != nil && config.format == formatJSON {
+		return errors.New(tr("--template 不能与 --format json 同时使用", "--template cannot be combined with --format json"))
+	}
+	config.ignoreCase = c.Bool("ignore-case")
+	config.workers = max(c.Int("workers"), 1)
+	config.splitWorkers = c.Int("split-workers")
+	config.countOnly = c.Bool("count")
+	config.summaryOnly = c.Bool("summary-only")
+	config.mergeByTime = c.Bool("merge-by-time")
+	if config.sortBuffer, err = parseSize(c.String("sort-buffer")); err != nil {
+		return fmt.Errorf(tr("--sort-buffer 格式错误: %w", "invalid --sort-buffer: %w"), err)
+	}
+	config.maxMatches = c.Int("max-matches")
+	config.maxTotalMatches = c.Int("max-total-matches")
+	globalBudget = newMatchBudget(config.maxTotalMatches)
+	sampler, err := parseSampler(c.String("sample"))
+	if err != nil {
+		return err
+	}
+	lineSampler = sampler
+	aggregateReports, postAggregates, matchedIPs, queryParams, streams = nil, nil, nil, nil, nil
+	if err := loadCrawlerSignatures(c.Context, c.String("signatures")); err != nil {
+		return err
+	}
+	resetDerivedFields()
+	for _, def := range c.StringSlice("field") {
+		if err := defineField(def); err != nil {
+			return err
+		}
+	}
+	config.ipFile = c.String("ip-file")
+	if err := loadSuspects(config.ipFile); err != nil {
+		return err
+	}
+	if err := loadIntelFeeds(c); err != nil {
+		return err
+	}
+	ruleSet, err = loadRules(c.String("rules"))
+	if err != nil {
+		return err
+	}
+	if err := loadBlocklistConfig(c); err != nil {
+		return err
+	}
+	if err := loadProviderConfig(c); err != nil {
+		return err
+	}
+	if err := loadAccounts(c); err != nil {
+		return err
+	}
+	if err := loadAPIRetryConfig(c); err != nil {
+		return err
+	}
+	if err := loadListingConfig(c); err != nil {
+		return err
+	}
+	if err := loadDownloadConfig(c); err != nil {
+		return err
+	}
+	if err := loadCacheConfig(c); err != nil {
+		return err
+	}
+	if err := loadReputationConfig(c); err != nil {
+		return err
+	}
+	if err := loadRDNSConfig(c); err != nil {
+		return err
+	}
+	trafficCounter = nil
+	if err := loadCrossCheckConfig(c); err != nil {
+		return err
+	}
+	if err := loadChartConfig(c); err != nil {
+		return err
+	}
+	if err := loadInfluxConfig(c); err != nil {
+		return err
+	}
+	if err := loadHeatmapConfig(c); err != nil {
+		return err
+	}
+	if err := loadTypeTimelineConfig(c); err != nil {
+		return err
+	}
+	if err := loadCompareWeekConfig(c); err != nil {
+		return err
+	}
+	if err := loadReportConfig(c); err != nil {
+		return err
+	}
+	if err := loadTimeConfig(c); err != nil {
+		return err
+	}
+	if err := loadRetentionConfig(c); err != nil {
+		return err
+	}
+	config.beforeContext = c.Int("before-context")
+	config.afterContext = c.Int("after-context")
+	// -C 为 -A/-B 的默认值，单独指定 -A/-B 时优先
+	if n := c.Int("context"); n > 0 {
+		if !c.IsSet("before-context") {
+			config.beforeContext = n
+		}
+		if !c.IsSet("after-context") {
+			config.afterContext = n
+		}
+	}
+
+	// 子命令出现后这些参数不能再由cli检查必填，在这里校验
+	if config.startTime == "" || config.endTime == "" {
+		return errors.New(tr("必须指定开始时间 --start 和结束时间 --end", "--start and --end are required"))
+	}
+	config.keywords = slices.DeleteFunc(c.StringSlice("keyword"), func(k string) bool { return k == "" })
+	config.regexps = c.StringSlice("pattern")
+	lineMatcher, err = newLineMatcher(splitPatterns(config.searchIP), config.keywords, config.regexps, config.ignoreCase)
 	if err != nil {
 		return err
 	}
+	if err := loadAnonymizeConfig(c); err != nil {
+		return err
+	}
+	if err := loadIPTimelineConfig(c); err != nil {
+		return err
+	}
+	if config.output, err = renderOutputPath(c.String("output")); err != nil {
+		return err
+	}
+	if config.mergeByTime && (config.countOnly || config.summaryOnly) {
+		return errors.New(tr("--merge-by-time 不能与 --count 或 --summary-only 同时使用", "--merge-by-time cannot be combined with --count or --summary-only"))
+	}
+	if config.mergeByTime && (config.beforeContext > 0 || config.afterContext > 0) {
+		return errors.New(tr("--merge-by-time 不支持输出上下文行（-A/-B/-C）", "--merge-by-time does not support context lines (-A/-B/-C)"))
+	}
+	if err := loadEncryptConfig(c); err != nil {
+		return err
+	}
+	if err := loadExportConfig(c); err != nil {
+		return err
+	}
+	if err := loadSinkConfig(c); err != nil {
+		return err
+	}
+	config.noLocalResults = jobMode && !c.IsSet("output") && (len(outputSinks) > 0 || influxConfig.endpoint != "")
+	config.appendResults = c.Bool("append")
+	if config.appendResults && config.format == formatJSON {
+		return errors.New(tr("--append 只支持文本格式的结果，不能与 --format json 同时使用", "--append only supports text results and cannot be combined with --format json"))
+	}
+	// 不追加时默认每次运行写入新的带时间戳的文件，不覆盖之前的结果
+	if config.output == "" && !config.appendResults {
+		config.output = timestampedResultsPath(time.Now())
+	}
+	config.output = encryptedPath(config.output)
+	return nil
+}
+
+// 获取日志文件（OSS、链接文件或API）并搜索，urlsFile 为空时通过API查询下载链接
+func analyze(ctx context.Context, urlsFile string) (map[string]*fileResult, error) {
+	var err error
+
+	// 创建临时目录
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, fmt.Errorf(tr("创建临时目录失败: %w", "create temp directory: %w"), err)
+	}
+	// 创建日志保存目录
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, fmt.Errorf(tr("创建日志保存目录失败: %w", "create log directory: %w"), err)
+	}
+	defer os.RemoveAll(tempDir)
 
-	req := &cdn20180510.DescribeCdnDomainLogsRequest{
-		DomainName: tea.String(config.domainName),
-		StartTime:  tea.String(config.startTime),
-		EndTime:    tea.String(config.endTime),
+	var downloadedFiles []string
+	urlByFile := make(map[string]string)
+	if ossConfig.bucket != "" {
+		// 日志已转存到OSS：直接列出并以流的方式读取对象
+		endList := runStats.beginStage(stageList)
+		downloadedFiles, err = listOSSLogObjects(ctx)
+		endList()
+		if err != nil {
+			return nil, fmt.Errorf(tr("获取OSS日志列表失败: %w", "list OSS logs: %w"), err)
+		}
+		runStats.filesListed.Store(int64(len(downloadedFiles)))
+		fmt.Printf(tr("OSS中找到 %d 个日志文件\n", "Found %d log files in OSS\n"), len(downloadedFiles))
+	} else {
+		logURLs, files, err := fetchAndDownloadLogs(ctx, urlsFile)
+		if err != nil {
+			return nil, err
+		}
+		downloadedFiles = files
+
+		// 记录每个本地文件对应的下载链接，用于损坏文件的重新下载
+		for _, url := range logURLs {
+			urlByFile[localLogPath(url)] = url
+		}
 	}
 
-	resp, err := client.DescribeCdnDomainLogsWithOptions(req, &util.RuntimeOptions{})
+	// 搜索IP
+	runStats.filesTotal.Store(int64(len(downloadedFiles)))
+	results, err := searchLogsForIP(ctx, downloadedFiles, urlByFile)
 	if err != nil {
-		return fmt.Errorf("API调用失败: %w", err)
+		return results, fmt.Errorf(tr("搜索日志失败: %w", "search logs: %w"), err)
 	}
+	return results, nil
+}
 
-	var urls []string
-	for _, log := range resp.Body.DomainLogDetails.DomainLogDetail {
-		for _, detail := range log.LogInfos.LogInfoDetail {
-			if detail.LogPath != nil {
-				urls = append(urls, tea.StringValue(detail.LogPath))
-			}
+// 获取日志下载链接（urlsFile 为空时通过API查询）并下载到本地缓存
+func fetchAndDownloadLogs(ctx context.Context, urlsFile string) (logURLs, downloaded []string, err error) {
+	// 未指定链接文件时，通过API获取日志下载链接
+	endList := runStats.beginStage(stageList)
+	if urlsFile == "" {
+		if logURLs, err = fetchCDNLogURLs(ctx); err != nil {
+			return nil, nil, fmt.Errorf(tr("获取日志链接失败: %w", "fetch log URLs: %w"), err)
 		}
+	} else if logURLs, err = readLogURLsFromFile(urlsFile); err != nil {
+		return nil, nil, fmt.Errorf(tr("读取日志链接失败: %w", "read log URLs: %w"), err)
 	}
+	endList()
+	runStats.filesListed.Store(int64(len(logURLs)))
 
-	// 写入到 log-url.log 文件
-	f, err := os.Create("log-url.log")
+	fmt.Printf(tr("获取到 %d 个日志文件链接\n", "Got %d log file URLs\n"), len(logURLs))
+	if err := confirmDownload(logURLs); err != nil {
+		return nil, nil, err
+	}
+
+	// 下载日志文件
+	endDownload := runStats.beginStage(stageDownload)
+	downloaded, err = downloadLogs(ctx, logURLs)
+	endDownload()
 	if err != nil {
-		return fmt.Errorf("保存日志链接失败: %w", err)
+		return nil, nil, fmt.Errorf(tr("下载日志失败: %w", "download logs: %w"), err)
 	}
-	defer f.Close()
-	for _, url := range urls {
-		f.WriteString(url + "\n")
+
+	fmt.Printf(tr("成功下载 %d/%d 个日志文件\n", "Downloaded %d/%d log files\n"), len(downloaded), len(logURLs))
+	// 缓存清理失败不影响本次分析，只给出警告
+	if err := evictLogCache(downloaded); err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 清理日志缓存失败: %v\n", "Warning: log cache eviction failed: %v\n"), err)
 	}
+	return logURLs, downloaded, nil
+}
 
-	return nil
+// 通过API获取日志下载链接，并记录到日志目录库；指定 --accounts 时依次查询每个账号的每个域名
+func fetchCDNLogURLs(ctx context.Context) ([]string, error) {
+	logs, err := listAllLogs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(logs))
+	counts := make(map[string]int)
+	for i, l := range logs {
+		urls[i] = l.URL
+		setLogSize(l.URL, l.Size)
+		if l.Account != "" {
+			setURLAccount(l.URL, l.Account)
+			counts[l.Account+"\x00"+l.Domain]++
+		}
+	}
+	for i := range accounts {
+		for _, domain := range accounts[i].Domains {
+			fmt.Printf(tr("账号 %s 域名 %s: %d 个日志文件\n", "Account %s, domain %s: %d log files\n"), accounts[i].Name, domain, counts[accounts[i].Name+"\x00"+domain])
+		}
+	}
+	return urls, nil
 }
 
-// 读取log-url.log文件中的日志链接
+// 读取文件中的日志链接，path 为 - 时从标准输入读取
+// 空行和 # 开头的注释行会被忽略
 func readLogURLsFromFile(path string) ([]string, error) {
-	data, err := os.ReadFile(path)
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -185,6 +729,9 @@ func readLogURLsFromFile(path string) ([]string, error) {
 	var fixed []string
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
 		if !strings.HasPrefix(line, "http") {
 			line = "https://" + line
 		}
@@ -200,21 +747,15 @@ func createClient() (*cdn20180510.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	config := &openapi.Config{
-		Credential: cred,
-		Endpoint:   tea.String("cdn.aliyuncs.com"),
-	}
-
-	return cdn20180510.NewClient(config)
+	return newCDNClient(cred)
 }
 
 // 下载日志文件
-func downloadLogs(urls []string) ([]string, error) {
+func downloadLogs(ctx context.Context, urls []string) ([]string, error) {
 	var wg sync.WaitGroup
 	workers := make(chan struct{}, maxWorkers)
 	results := make(chan string, len(urls))
-	errChan := make(chan error, len(urls))
+	failures := make(chan failedDownload, len(urls))
 
 	for _, url := range urls {
 		wg.Add(1)
@@ -224,20 +765,19 @@ func downloadLogs(urls []string) ([]string, error) {
 			defer wg.Done()
 			defer func() { <-workers }()
 
-			filename := filepath.Join("onlice-log", filepath.Base(url))
-			if strings.Contains(filename, "?") {
-				filename = strings.Split(filename, "?")[0]
-			}
+			filename := localLogPath(url)
 
-			// 如果文件已存在则跳过
-			if _, err := os.Stat(filename); err == nil {
+			// 如果文件已存在（且大小与API返回的一致）则跳过
+			if isCachedLog(filename) {
+				touchLogFile(filename)
+				runStats.filesCached.Add(1)
 				results <- filename
 				time.Sleep(1 * time.Second)
 				return
 			}
 
-			if err := downloadFile(url, filename); err != nil {
-				errChan <- fmt.Errorf("下载失败 %s: %w", url, err)
+			if err := downloadFile(ctx, url, filename); err != nil {
+				failures <- failedDownload{URL: url, Error: err.Error()}
 				time.Sleep(1 * time.Second)
 				return
 			}
@@ -249,12 +789,17 @@ func downloadLogs(urls []string) ([]string, error) {
 
 	wg.Wait()
 	close(results)
-	close(errChan)
+	close(failures)
 
-	// 处理错误
+	// 处理错误，失败的链接记录到重试队列
 	var errs []error
-	for err := range errChan {
-		errs = append(errs, err)
+	var failed []failedDownload
+	for f := range failures {
+		errs = append(errs, fmt.Errorf(tr("下载失败 %s: %s", "download %s: %s"), f.URL, f.Error))
+		failed = append(failed, f)
+	}
+	if err := updateRetryQueue(urls, failed); err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 保存下载失败记录失败: %v\n", "Warning: save failed-download queue: %v\n"), err)
 	}
 
 	// 收集结果
@@ -264,15 +809,33 @@ func downloadLogs(urls []string) ([]string, error) {
 	}
 
 	if len(errs) > 0 {
-		return downloaded, fmt.Errorf("部分文件下载失败: %v", errs)
+		return downloaded, fmt.Errorf(tr("部分文件下载失败: %v", "some files failed to download: %v"), errs)
 	}
 
 	return downloaded, nil
 }
 
+// 根据下载链接计算本地保存路径
+func localLogPath(url string) string {
+	migrateLogLayout()
+	name := filepath.Base(url)
+	if strings.Contains(name, "?") {
+		name = strings.Split(name, "?")[0]
+	}
+	return partitionedLogPath(name)
+}
+
 // 下载单个文件
-func downloadFile(url, filename string) error {
-	req, err := http.NewRequest("GET", url, nil)
+func downloadFile(ctx context.Context, url, filename string) (err error) {
+	ctx, span := startSpan(ctx, "download", attribute.String("file", filepath.Base(filename)))
+	defer func() {
+		if err != nil {
+			runStats.filesFailed.Add(1)
+		}
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
@@ -289,32 +852,55 @@ func downloadFile(url, filename string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP错误: %s", resp.Status)
+		return fmt.Errorf(tr("HTTP错误: %s", "HTTP error: %s"), resp.Status)
 	}
 
-	file, err := os.Create(filename)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	// 先写入临时文件，下载完整后再重命名，避免中断的下载被当作已缓存文件
+	tmpName := filename + ".part"
+	file, err := os.Create(tmpName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, resp.Body)
-	return err
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if err != nil {
+		file.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	runStats.filesDownloaded.Add(1)
+	runStats.bytesDownloaded.Add(size)
+	catalogDownloaded(filename, url, size, hex.EncodeToString(hash.Sum(nil)))
+	return nil
 }
 
 // 在日志中搜索IP
-func searchLogsForIP(files []string) (map[string][]string, error) {
+func searchLogsForIP(ctx context.Context, files []string, urlByFile map[string]string) (map[string]*fileResult, error) {
 	var wg sync.WaitGroup
-	workers := make(chan struct{}, maxWorkers)
+	workers := make(chan struct{}, config.workers)
 	results := make(chan struct {
-		file  string
-		lines []string
+		file   string
+		result *fileResult
 	}, len(files))
 	errChan := make(chan error, len(files))
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	runStats.beginScan()
+	defer runStats.endScan()
+
 	for _, file := range files {
 		wg.Add(1)
 		workers <- struct{}{}
@@ -323,16 +909,30 @@ func searchLogsForIP(files []string) (map[string][]string, error) {
 			defer wg.Done()
 			defer func() { <-workers }()
 
-			lines, err := searchInFile(ctx, file)
+			result, err := searchInFile(ctx, file)
+			if err != nil && isCorruptGzip(err) {
+				result, err = redownloadAndSearch(ctx, file, urlByFile[file], err)
+			}
+			// 重新扫描的文件只计一次
+			runStats.filesScanned.Add(1)
+			if !strings.HasPrefix(file, ossScheme) && ctx.Err() == nil {
+				catalogScanned(file, scanStatus(err))
+			}
+			if err == nil && config.mergeByTime && result.matches > 0 {
+				err = spillMatches(file, result)
+			}
+			if err == nil && result.matches > 0 {
+				addPartialResult(file, result)
+			}
 			if err != nil {
-				errChan <- fmt.Errorf("搜索 %s 失败: %w", file, err)
+				errChan <- fmt.Errorf(tr("搜索 %s 失败: %w", "search %s: %w"), file, err)
 				return
 			}
 
 			results <- struct {
-				file  string
-				lines []string
-			}{file: file, lines: lines}
+				file   string
+				result *fileResult
+			}{file: file, result: result}
 		}(file)
 	}
 
@@ -347,52 +947,241 @@ func searchLogsForIP(files []string) (map[string][]string, error) {
 	}
 
 	// 收集结果
-	allResults := make(map[string][]string)
+	allResults := make(map[string]*fileResult)
 	for res := range results {
-		if len(res.lines) > 0 {
-			allResults[res.file] = res.lines
+		if res.result.matches > 0 {
+			allResults[res.file] = res.result
 		}
 	}
 
 	if len(errs) > 0 {
-		return allResults, fmt.Errorf("部分文件搜索失败: %v", errs)
+		return allResults, fmt.Errorf(tr("部分文件搜索失败: %v", "some files failed to search: %v"), errs)
 	}
 
 	return allResults, nil
 }
 
-// 在单个文件中搜索IP
-func searchInFile(ctx context.Context, filename string) ([]string, error) {
-	file, err := os.Open(filename)
+// 扫描结果对应的目录库状态
+func scanStatus(err error) string {
+	switch {
+	case err == nil:
+		return scanOK
+	case isCorruptGzip(err):
+		return scanCorrupt
+	default:
+		return scanError
+	}
+}
+
+// 判断错误是否由gzip文件损坏（下载不完整、校验失败等）引起
+func isCorruptGzip(err error) bool {
+	var corrupt flate.CorruptInputError
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, gzip.ErrHeader) ||
+		errors.As(err, &corrupt)
+}
+
+// 删除损坏的文件，重新下载一次后再次搜索
+func redownloadAndSearch(ctx context.Context, file, url string, cause error) (*fileResult, error) {
+	// OSS对象以流的方式读取，没有本地文件，重新读取一次即可
+	if strings.HasPrefix(file, ossScheme) {
+		fmt.Printf(tr("读取 %s 时数据损坏 (%v)，正在重新读取\n", "Data corrupted while reading %s (%v), reading again\n"), filepath.Base(file), cause)
+		return searchInFile(ctx, file)
+	}
+
+	if url == "" {
+		return nil, fmt.Errorf(tr("文件已损坏且无下载链接: %w", "file is corrupt and has no download URL: %w"), cause)
+	}
+
+	fmt.Printf(tr("文件 %s 已损坏 (%v)，正在重新下载\n", "File %s is corrupt (%v), downloading again\n"), filepath.Base(file), cause)
+	if err := removeLogFile(file); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf(tr("删除损坏文件失败: %w", "remove corrupt file: %w"), err)
+	}
+	if err := downloadFile(ctx, url, file); err != nil {
+		return nil, fmt.Errorf(tr("重新下载失败: %w", "download again: %w"), err)
+	}
+
+	result, err := searchInFile(ctx, file)
+	if err != nil && isCorruptGzip(err) {
+		// 重新下载后仍然损坏，删除文件以免下次运行被当作缓存跳过
+		removeLogFile(file)
+		return nil, fmt.Errorf(tr("重新下载后文件仍然损坏: %w", "file still corrupt after downloading again: %w"), err)
+	}
+	return result, err
+}
+
+// 单个文件的搜索结果
+type fileResult struct {
+	// 输出的行（包含上下文行和分隔符）所在的临时文件，没有保留任何行时为 nil
+	store *matchStore
+	// 创建临时文件失败时的错误
+	storeErr error
+	// 命中行数
+	matches int
+	// 是否因达到命中数上限而截断
+	truncated bool
+}
+
+// 打开日志文件并返回解压后的数据流，stats 不为 nil 时累加读取的字节数
+func openLogReader(filename string, stats *processStats) (io.Reader, func(), error) {
+	var file io.ReadCloser
+	var err error
+	if strings.HasPrefix(filename, ossScheme) {
+		file, err = openOSSObject(filename)
+	} else {
+		file, err = os.Open(filename)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer file.Close()
 
 	var reader io.Reader = file
-	var matches []string
+	if stats != nil {
+		reader = countingReader{reader, &stats.compressedBytes}
+	}
 
 	// 处理gzip压缩文件
+	closeReader := func() { file.Close() }
 	if strings.HasSuffix(filename, ".gz") {
-		gzReader, err := gzip.NewReader(file)
+		gzReader, err := gzip.NewReaderN(reader, gzipBlockSize, gzipBlocks)
 		if err != nil {
-			return nil, err
+			file.Close()
+			return nil, nil, err
+		}
+		closeReader = func() {
+			gzReader.Close()
+			file.Close()
 		}
-		defer gzReader.Close()
 		reader = gzReader
 	}
 
+	if stats != nil {
+		reader = countingReader{reader, &stats.decompressedBytes}
+	}
+	return reader, closeReader, nil
+}
+
+// 保留一行输出，match 表示是否为命中行（否则为上下文行或分隔符）
+func (r *fileResult) addLine(line string, match bool) {
+	if r.store == nil && r.storeErr == nil {
+		r.store, r.storeErr = newMatchStore()
+	}
+	if r.store != nil {
+		r.store.add(line, match)
+	}
+}
+
+// 扫描结束，写完临时文件；返回扫描过程中的写入错误
+func (r *fileResult) finish() error {
+	if r.storeErr != nil {
+		return r.storeErr
+	}
+	if r.store == nil {
+		return nil
+	}
+	return r.store.finish()
+}
+
+// 删除保留的行，扫描失败或不再需要时调用
+func (r *fileResult) discard() {
+	if r != nil && r.store != nil {
+		r.store.remove()
+		r.store = nil
+	}
+}
+
+// 按顺序读取保留的全部行，包含上下文行和分隔符
+func (r *fileResult) eachLine(fn func(line string, match bool) error) error {
+	if r.store == nil {
+		return nil
+	}
+	return r.store.each(fn)
+}
+
+// 按顺序读取不含上下文行的命中行
+func (r *fileResult) eachMatch(fn func(line string) error) error {
+	return r.eachLine(func(line string, match bool) error {
+		if !match {
+			return nil
+		}
+		return fn(line)
+	})
+}
+
+// 在单个文件中搜索IP
+func searchInFile(ctx context.Context, filename string) (result *fileResult, err error) {
+	ctx, span := startSpan(ctx, "scan", attribute.String("file", filepath.Base(filename)))
+	// 本次扫描的结果和统计，只在整个文件扫描成功后合并；
+	// 失败时丢弃，已申请的全局命中额度退回，重新扫描时不会重复占用
+	var scanned *fileResult
+	var scans []*scanState
+	defer func() {
+		if result != nil && err == nil {
+			err = result.finish()
+		}
+		if err != nil {
+			if scanned != nil {
+				globalBudget.release(scanned.matches)
+				scanned.discard()
+			}
+			result = nil
+		}
+		if result != nil {
+			for _, s := range scans {
+				s.merge()
+			}
+			span.SetAttributes(attribute.Int("search.matches", result.matches))
+		}
+		endSpan(span, err)
+	}()
+	reader, closeReader, err := openLogReader(filename, &runStats)
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader()
+
+	// 仅统计和仅汇总时都不需要保留命中行
+	countOnly := config.countOnly || config.summaryOnly
+
+	// 超大文件：切分为按行对齐的分块并行搜索（需要上下文时仍按顺序搜索）
+	if config.splitWorkers > 1 && (countOnly || config.beforeContext == 0 && config.afterContext == 0) {
+		result, scans, err = searchInChunks(ctx, reader, config.splitWorkers, countOnly, config.maxMatches)
+		scanned = result
+		return result, err
+	}
+
+	result = &fileResult{}
+	scanned = result
+	collector := newContextCollector(result, config.beforeContext, config.afterContext, countOnly, config.maxMatches)
+
 	scanner := bufio.NewScanner(reader)
 	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024) // 1MB初始，最大10MB
 
+	sample := lineSampler.newState()
+	scan := newScanState()
+	scans = append(scans, scan)
+	collecting := true
 	for scanner.Scan() {
+		scan.lines++
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		default:
+			if !sample.keep() {
+				continue
+			}
+			// 先按原始IP匹配，再匿名化后用于统计和保存
 			line := scanner.Text()
-			if strings.Contains(line, config.searchIP) {
-				matches = append(matches, line)
+			matched := collecting && matchLine(line)
+			line = anonymizeLine(line)
+			scan.observe(line, matched)
+			if collecting && !collector.add(line, matched) {
+				// 全量统计需要读完全部日志，达到命中数上限后只停止收集命中行
+				if scan.detect == nil {
+					return result, nil
+				}
+				collecting = false
 			}
 		}
 	}
@@ -401,66 +1190,260 @@ func searchInFile(ctx context.Context, filename string) ([]string, error) {
 		return nil, err
 	}
 
-	return matches, nil
+	return result, nil
+}
+
+// 判断一行日志是否命中搜索条件
+func matchLine(line string) bool {
+	return lineMatcher.Match(line)
 }
 
 // 保存结果
-func saveResults(results map[string][]string) error {
-	file, err := os.Create(resultsFile)
+func saveResults(ctx context.Context, results map[string]*fileResult) (err error) {
+	_, span := startSpan(ctx, "write-report", attribute.String("file", resultsPath()))
+	defer func() { endSpan(span, err) }()
+	defer cleanupTimeMerge()
+	defer cleanupMatchStores()
+
+	if !config.noLocalResults {
+		if err := writeResultsFile(results); err != nil {
+			return err
+		}
+		closePartialResults(true)
+	}
+	if err := logExport.finish(results); err != nil {
+		return err
+	}
+	sendToSinks(results)
+	writeInfluxPoints()
+	if config.noLocalResults {
+		return nil
+	}
+	// 索引写入失败不影响结果文件，只给出警告
+	if err := appendResultsIndex(results); err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 写入结果索引 %s 失败: %v\n", "Warning: write result index %s: %v\n"), resultsIndexFile, err)
+	}
+	applyRetention()
+	return nil
+}
+
+// 按 --format/--template 写入结果文件
+func writeResultsFile(results map[string]*fileResult) error {
+	if dir := filepath.Dir(resultsPath()); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if config.appendResults {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(resultsPath(), flag, 0o644)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	out, err := encryptWriter(file)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(out)
+	switch {
+	case outputTemplate != nil:
+		err = writeTemplateResults(writer, results)
+	case config.format == formatJSON:
+		err = writeJSONResults(writer, results)
+	default:
+		err = writeTextReport(writer, results)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
 
+// 写入默认格式的文本报告
+func writeTextReport(writer *bufio.Writer, results map[string]*fileResult) error {
 	// 写入头部
-	header := fmt.Sprintf("# CDN日志IP分析报告\n"+
+	header := fmt.Sprintf(tr("# CDN日志IP分析报告\n"+
 		"# 域名: %s\n"+
 		"# 时间范围: %s 至 %s\n"+
 		"# 搜索IP: %s\n"+
 		"# 生成时间: %s\n"+
 		"# 匹配文件数: %d\n"+
-		"# 总匹配行数: %d\n"+
-		"========================================\n\n",
-		config.domainName, config.startTime, config.endTime, config.searchIP,
+		"# 总匹配行数: %d\n",
+		"# CDN Log IP Analysis Report\n"+
+			"# Domain: %s\n"+
+			"# Time range: %s to %s\n"+
+			"# Search IP: %s\n"+
+			"# Generated at: %s\n"+
+			"# Files with matches: %d\n"+
+			"# Total matches: %d\n"),
+		config.domainName, config.startTime, config.endTime, displaySearchIP(),
 		time.Now().Format(time.RFC3339),
 		len(results), totalMatches(results))
+	if len(accounts) > 0 {
+		header += fmt.Sprintf(tr("# 账号: %s\n", "# Accounts: %s\n"), accountsSummary())
+	}
+	header += missingLogDaysHeader()
+	if anonymizeConfig.mode != "" {
+		header += fmt.Sprintf(tr("# IP匿名化: %s\n", "# IP anonymization: %s\n"), anonymizeConfig.mode)
+	}
+	if config.ipFile != "" {
+		header += fmt.Sprintf(tr("# IP列表: %s\n", "# IP file: %s\n"), config.ipFile)
+	}
+	if len(config.keywords) > 0 {
+		header += fmt.Sprintf(tr("# 关键字: %s\n", "# Keywords: %s\n"), strings.Join(config.keywords, ", "))
+	}
+	if len(config.regexps) > 0 {
+		header += fmt.Sprintf(tr("# 正则表达式: %s\n", "# Patterns: %s\n"), strings.Join(config.regexps, ", "))
+	}
+	if config.countOnly {
+		header += tr("# 模式: 仅统计命中数\n", "# Mode: count only\n")
+	} else if config.summaryOnly {
+		header += tr("# 模式: 仅汇总，不包含命中行\n", "# Mode: summary only, matched lines omitted\n")
+	}
+	if lineSampler != nil {
+		header += fmt.Sprintf(tr("# 采样: %s (以下均为采样结果，估算总量需乘以 %.0f，估算总匹配行数: %.0f)\n", "# Sampling: %s (all figures below are sampled; multiply by %.0f for estimates, estimated total matches: %.0f)\n"),
+			lineSampler.spec, lineSampler.scale(), float64(totalMatches(results))*lineSampler.scale())
+	}
+	if config.maxMatches > 0 || config.maxTotalMatches > 0 {
+		header += fmt.Sprintf(tr("# 命中数上限: 每文件 %s, 全局 %s\n", "# Match limits: per file %s, global %s\n"),
+			limitString(config.maxMatches), limitString(config.maxTotalMatches))
+		if resultsTruncated(results) {
+			header += tr("# 注意: 已达到命中数上限，结果被截断\n", "# Note: match limit reached, results are truncated\n")
+		}
+	}
+	header += "========================================\n\n"
 
 	if _, err := writer.WriteString(header); err != nil {
 		return err
 	}
 
 	// 写入结果
-	for file, lines := range results {
-		section := fmt.Sprintf("## 文件: %s\n匹配行数: %d\n", filepath.Base(file), len(lines))
-		if _, err := writer.WriteString(section); err != nil {
+	for _, file := range sortedFiles(results) {
+		if err := writeFileSection(writer, file, results[file]); err != nil {
+			return err
+		}
+	}
+	if config.mergeByTime && len(results) > 0 {
+		writer.WriteString(tr("## 按请求时间合并的命中行\n", "## Matched lines merged by request time\n"))
+		err := mergedMatches(results, func(file, line string, _ time.Time) error {
+			_, err := writer.WriteString(fileLabel(file) + ": " + normalizeLineTime(line) + "\n")
+			return err
+		})
+		if err != nil {
 			return err
 		}
+		writer.WriteString("\n")
+	}
 
-		for _, line := range lines {
-			if _, err := writer.WriteString(line + "\n"); err != nil {
-				return err
+	if ruleSet.has(false) {
+		findings := ruleSet.findings()
+		fmt.Fprintf(writer, tr("## 规则告警: %d 条\n", "## Rule findings: %d\n"), len(findings))
+		for _, f := range findings {
+			fmt.Fprintln(writer, formatFinding(f))
+		}
+		writer.WriteString("\n")
+	}
+	if ruleSet.has(true) {
+		alerts := ruleSet.alerts()
+		fmt.Fprintf(writer, tr("## 指标告警: %d 条\n", "## Metric alerts: %d\n"), len(alerts))
+		for _, a := range alerts {
+			fmt.Fprintln(writer, formatAlert(a))
+			for _, iv := range a.Intervals {
+				fmt.Fprintln(writer, "  "+formatInterval(iv))
 			}
 		}
 		writer.WriteString("\n")
 	}
+	if crossCheckResult != nil {
+		writeCrossCheckReport(writer, crossCheckResult)
+	}
+	if weekComparison != nil {
+		writeWeekComparisonReport(writer, weekComparison)
+	}
+	writeIPTimelineReport(writer)
+	writeHeatmapReport(writer)
+	writeTypeTimelineReport(writer)
+	for _, agg := range aggregates() {
+		writeAggregateReport(writer, agg)
+	}
 
-	// 写入尾部
+	// 写入尾部；运行信息以固定的 "# run: " 开头、单行JSON写出，不随语言变化，便于脚本读取
+	run, err := json.Marshal(runStats.metadata())
+	if err != nil {
+		return err
+	}
 	footer := fmt.Sprintf("========================================\n"+
-		"# 分析完成时间: %s\n",
-		time.Now().Format(time.RFC3339))
+		tr("# 处理统计\n%s# 分析完成时间: %s\n", "# Processing statistics\n%s# Finished at: %s\n")+"# run: %s\n",
+		runStats.summary("# ", totalMatches(results)),
+		time.Now().Format(time.RFC3339), run)
 
 	_, err = writer.WriteString(footer)
 	return err
 }
 
+// 文本报告中一个文件的分组：文件名、命中数和命中行（包括上下文行）
+func writeTextFileSection(writer *bufio.Writer, file string, result *fileResult) error {
+	section := fmt.Sprintf(tr("## 文件: %s\n匹配行数: %d\n", "## File: %s\nMatches: %d\n"), fileLabel(file), result.matches)
+	if result.truncated {
+		section = fmt.Sprintf(tr("## 文件: %s\n匹配行数: %d (已达到上限，结果被截断)\n", "## File: %s\nMatches: %d (limit reached, truncated)\n"), fileLabel(file), result.matches)
+	}
+	if _, err := writer.WriteString(section); err != nil {
+		return err
+	}
+	err := result.eachLine(func(line string, _ bool) error {
+		_, err := writer.WriteString(normalizeLineTime(line) + "\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = writer.WriteString("\n")
+	return err
+}
+
+// 按文件名排序的结果文件列表
+func sortedFiles(results map[string]*fileResult) []string {
+	files := make([]string, 0, len(results))
+	for file := range results {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// 是否有结果因命中数上限被截断
+func resultsTruncated(results map[string]*fileResult) bool {
+	if globalBudget.wasTruncated() {
+		return true
+	}
+	for _, result := range results {
+		if result.truncated {
+			return true
+		}
+	}
+	return false
+}
+
+// 命中数上限的显示文本
+func limitString(n int) string {
+	if n <= 0 {
+		return tr("不限", "unlimited")
+	}
+	return fmt.Sprint(n)
+}
+
 // 计算总匹配行数
-func totalMatches(results map[string][]string) int {
+func totalMatches(results map[string]*fileResult) int {
 	total := 0
-	for _, lines := range results {
-		total += len(lines)
+	for _, result := range results {
+		total += result.matches
 	}
 	return total
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// 行匹配器
+type matcher interface {
+	Match(line string) bool
+}
+
+// 搜索 --ip 等模式的匹配器：IPv6 地址模式先规范化再做子串匹配，
+// 同一地址在日志中可能有其他写法（展开形式、大写、前导零），因此还会比较每行解析出的客户端IP和代理IP
+func newSearchMatcher(patterns []string, ignoreCase bool) matcher {
+	addrs := make(map[netip.Addr]struct{})
+	normalized := make([]string, len(patterns))
+	for i, p := range patterns {
+		normalized[i] = p
+		if addr, ok := parseIPv6(p); ok {
+			// IPv4 映射地址在日志中写作 IPv4，按 IPv4 子串匹配即可
+			if addr = addr.Unmap(); addr.Is6() {
+				addrs[addr] = struct{}{}
+			}
+			normalized[i] = addr.String()
+		}
+	}
+	m := newMatcher(normalized, ignoreCase)
+	if len(addrs) == 0 {
+		return m
+	}
+	return ipv6Matcher{m: m, addrs: addrs}
+}
+
+// 解析 IPv6 地址，允许 [2408::1] 这样带方括号的写法
+func parseIPv6(s string) (netip.Addr, bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if strings.IndexByte(s, ':') < 0 {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone(""), true
+}
+
+// 规范化日志中的IP：IPv6 转为压缩的小写形式，IPv4 映射地址转为 IPv4，其他内容原样返回
+func normalizeIP(s string) string {
+	addr, ok := parseIPv6(s)
+	if !ok {
+		return s
+	}
+	return addr.Unmap().String()
+}
+
+// IPv6 模式的匹配器：子串未命中时比较行中的客户端IP和代理IP
+type ipv6Matcher struct {
+	m     matcher
+	addrs map[netip.Addr]struct{}
+}
+
+func (m ipv6Matcher) Match(line string) bool {
+	if m.m.Match(line) {
+		return true
+	}
+	client, proxy := logIPFields(line)
+	for _, field := range []string{client, proxy} {
+		if addr, ok := parseIPv6(field); ok {
+			if _, found := m.addrs[addr]; found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 一次搜索的完整匹配器：IP、关键字和正则表达式任意一个命中即命中；关键字与IP一起放入同一个自动机
+func newLineMatcher(ips, keywords, regexps []string, ignoreCase bool) (matcher, error) {
+	m := anyMatcher{newSearchMatcher(slices.Concat(ips, keywords), ignoreCase)}
+	if suspects != nil {
+		m = append(m, ipSetMatcher{suspects})
+	}
+	for _, expr := range regexps {
+		if ignoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf(tr("无效的正则表达式 %q: %w", "invalid pattern %q: %w"), expr, err)
+		}
+		m = append(m, regexpMatcher{re})
+	}
+	if len(m) == 1 {
+		return m[0], nil
+	}
+	return m, nil
+}
+
+// 正则表达式匹配
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexpMatcher) Match(line string) bool {
+	return m.re.MatchString(line)
+}
+
+// 命中任意一个匹配器的行
+type anyMatcher []matcher
+
+func (m anyMatcher) Match(line string) bool {
+	for _, sub := range m {
+		if sub.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// 不完整解析日志行，只取出时间字段之后的客户端IP和代理IP
+func logIPFields(line string) (client, proxy string) {
+	_, rest, ok := strings.Cut(line, "] ")
+	if !ok {
+		return "", ""
+	}
+	client, rest, _ = strings.Cut(rest, " ")
+	proxy, _, _ = strings.Cut(rest, " ")
+	return client, proxy
+}
+
+// 根据搜索模式创建匹配器：单个模式直接使用子串查找，多个模式构建Aho-Corasick自动机
+// ignoreCase 时，纯ASCII模式在自动机的转移表中折叠大小写，无需转换每一行
+func newMatcher(patterns []string, ignoreCase bool) matcher {
+	if !ignoreCase {
+		if len(patterns) == 1 {
+			return substringMatcher(patterns[0])
+		}
+		return newAhoCorasick(patterns, false)
+	}
+
+	lowered := make([]string, len(patterns))
+	ascii := true
+	for i, p := range patterns {
+		lowered[i] = strings.ToLower(p)
+		ascii = ascii && isASCII(p)
+	}
+	if ascii {
+		return newAhoCorasick(lowered, true)
+	}
+	return lowerMatcher{newMatcher(lowered, false)}
+}
+
+// 非ASCII模式的忽略大小写匹配：先转换行为小写再匹配
+type lowerMatcher struct {
+	m matcher
+}
+
+func (m lowerMatcher) Match(line string) bool {
+	return m.m.Match(strings.ToLower(line))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// 单模式子串匹配
+type substringMatcher string
+
+func (m substringMatcher) Match(line string) bool {
+	return strings.Contains(line, string(m))
+}
+
+// Aho-Corasick 多模式匹配自动机
+// 每行只扫描一遍，耗时与模式数量无关
+type ahoCorasick struct {
+	// next[state][b] 为读入字节b后的状态（已展开失败转移）
+	next [][256]int32
+	// out[state] 表示到达该状态时至少命中一个模式
+	out []bool
+}
+
+// foldCase 为 true 时 patterns 必须已转换为小写
+func newAhoCorasick(patterns []string, foldCase bool) *ahoCorasick {
+	ac := &ahoCorasick{
+		next: make([][256]int32, 1),
+		out:  make([]bool, 1),
+	}
+
+	// 构建字典树，0 表示尚无转移
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		state := int32(0)
+		for i := 0; i < len(p); i++ {
+			b := p[i]
+			if ac.next[state][b] == 0 {
+				ac.next = append(ac.next, [256]int32{})
+				ac.out = append(ac.out, false)
+				ac.next[state][b] = int32(len(ac.next) - 1)
+			}
+			state = ac.next[state][b]
+		}
+		ac.out[state] = true
+	}
+
+	// 广度优先计算失败指针，并把失败转移直接展开到 next 表中
+	fail := make([]int32, len(ac.next))
+	var queue []int32
+	for b := 0; b < 256; b++ {
+		if s := ac.next[0][b]; s != 0 {
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		ac.out[state] = ac.out[state] || ac.out[fail[state]]
+		for b := 0; b < 256; b++ {
+			s := ac.next[state][b]
+			if s == 0 {
+				ac.next[state][b] = ac.next[fail[state]][b]
+				continue
+			}
+			fail[s] = ac.next[fail[state]][b]
+			queue = append(queue, s)
+		}
+	}
+
+	// 大写字母沿用对应小写字母的转移，扫描时无需转换大小写
+	if foldCase {
+		for state := range ac.next {
+			for b := 'A'; b <= 'Z'; b++ {
+				ac.next[state][b] = ac.next[state][b+'a'-'A']
+			}
+		}
+	}
+
+	return ac
+}
+
+func (ac *ahoCorasick) Match(line string) bool {
+	state := int32(0)
+	for i := 0; i < len(line); i++ {
+		state = ac.next[state][line[i]]
+		if ac.out[state] {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析逗号分隔的搜索模式列表
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// 命中行（及上下文行）在扫描时直接写入临时文件，内存中只保留计数，
+// 搜索一个月内非常活跃的IP时命中行再多也不会耗尽内存
+var matchStores struct {
+	mu  sync.Mutex
+	dir string
+	n   int
+}
+
+// 每行记录的第一个字节：命中行或上下文行（包括分隔符）
+const (
+	storeMatch   = 'm'
+	storeContext = 'c'
+)
+
+// 单个日志文件的命中行临时文件
+type matchStore struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+	// 第一个写入错误，扫描结束时返回
+	err error
+}
+
+// 在临时目录中创建一个命中行文件
+func newMatchStore() (*matchStore, error) {
+	matchStores.mu.Lock()
+	if matchStores.dir == "" {
+		dir, err := os.MkdirTemp("", "cdn-log-matches-")
+		if err != nil {
+			matchStores.mu.Unlock()
+			return nil, err
+		}
+		matchStores.dir = dir
+	}
+	path := filepath.Join(matchStores.dir, strconv.Itoa(matchStores.n))
+	matchStores.n++
+	matchStores.mu.Unlock()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &matchStore{path: path, f: f, w: bufio.NewWriterSize(f, 64*1024)}, nil
+}
+
+func (s *matchStore) add(line string, match bool) {
+	if s.err != nil {
+		return
+	}
+	kind := byte(storeContext)
+	if match {
+		kind = storeMatch
+	}
+	s.w.WriteByte(kind)
+	s.w.WriteString(line)
+	if err := s.w.WriteByte('\n'); err != nil {
+		s.err = err
+	}
+}
+
+// 写完缓冲并关闭文件，之后只能读取
+func (s *matchStore) finish() error {
+	if s.f == nil {
+		return s.err
+	}
+	if err := s.w.Flush(); s.err == nil {
+		s.err = err
+	}
+	if err := s.f.Close(); s.err == nil {
+		s.err = err
+	}
+	s.f, s.w = nil, nil
+	return s.err
+}
+
+// 按写入顺序读取每一行，match 表示是否为命中行
+func (s *matchStore) each(fn func(line string, match bool) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		rec := scanner.Text()
+		if rec == "" {
+			continue
+		}
+		if err := fn(rec[1:], rec[0] == storeMatch); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// 删除命中行文件
+func (s *matchStore) remove() {
+	if s.f != nil {
+		s.f.Close()
+		s.f, s.w = nil, nil
+	}
+	os.Remove(s.path)
+}
+
+// 交出当前的命中行临时目录，之后的命中行文件放在新的目录中；
+// serve 保留已完成任务的命中行时调用，由调用方负责删除返回的目录
+func detachMatchStores() string {
+	matchStores.mu.Lock()
+	defer matchStores.mu.Unlock()
+	dir := matchStores.dir
+	matchStores.dir, matchStores.n = "", 0
+	return dir
+}
+
+// 删除全部命中行临时文件，结果保存后或出错退出时调用
+func cleanupMatchStores() {
+	matchStores.mu.Lock()
+	defer matchStores.mu.Unlock()
+	if matchStores.dir != "" {
+		os.RemoveAll(matchStores.dir)
+	}
+	matchStores.dir, matchStores.n = "", 0
+}
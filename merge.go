@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --merge-by-time：每个文件的命中行按请求时间排序后写入临时文件，生成结果时多路归并。
+// 排序缓冲超过 --sort-buffer 时先写出一段已排序的行（run），一个文件可以有多段；
+// 段数超过 mergeFanIn 时先分批归并为较大的段，内存占用和同时打开的文件数都与结果大小无关
+var timeMerge struct {
+	mu  sync.Mutex
+	dir string
+	n   int
+	// 日志文件 → 按顺序排列的已排序段
+	runs map[string][]string
+	// 分批归并后的段及其对应的文件列表，同一份结果多次输出时复用
+	merged      []mergeRun
+	mergedFiles []string
+}
+
+// 一次最多同时归并的段数
+const mergeFanIn = 64
+
+// 一段已排序的命中行临时文件。单个文件的段每行为 "<Unix纳秒>\t<原始日志行>"，
+// 分批归并得到的段每行为 "<Unix纳秒>\t<文件序号>\t<原始日志行>"
+type mergeRun struct {
+	path string
+	// 单个文件的段对应的文件序号；为 -1 时文件序号写在每一行中
+	fileIndex int
+}
+
+// 在临时目录中分配一个段文件名
+func newRunPath() (string, error) {
+	timeMerge.mu.Lock()
+	defer timeMerge.mu.Unlock()
+	if timeMerge.dir == "" {
+		dir, err := os.MkdirTemp("", "cdn-log-merge-")
+		if err != nil {
+			return "", err
+		}
+		timeMerge.dir, timeMerge.runs = dir, make(map[string][]string)
+	}
+	path := filepath.Join(timeMerge.dir, strconv.Itoa(timeMerge.n))
+	timeMerge.n++
+	return path, nil
+}
+
+// 按请求时间排序文件的命中行并写入一段或多段临时文件；无法解析时间的行排在最前
+func spillMatches(file string, r *fileResult) error {
+	type timedLine struct {
+		t    int64
+		line string
+	}
+	var lines []timedLine
+	var size int64
+	var runs []string
+	flush := func() error {
+		// 同一时间的行保持在文件中的顺序
+		slices.SortStableFunc(lines, func(a, b timedLine) int { return cmp.Compare(a.t, b.t) })
+		path, err := newRunPath()
+		if err != nil {
+			return err
+		}
+		err = writeRun(path, func(w *bufio.Writer) {
+			for _, l := range lines {
+				w.WriteString(strconv.FormatInt(l.t, 10))
+				w.WriteByte('\t')
+				w.WriteString(l.line)
+				w.WriteByte('\n')
+			}
+		})
+		if err != nil {
+			return err
+		}
+		runs = append(runs, path)
+		lines, size = lines[:0], 0
+		return nil
+	}
+	var rec logRecord
+	err := r.eachMatch(func(line string) error {
+		l := timedLine{line: line}
+		if parseLogLine(line, &rec) == nil {
+			l.t = rec.Time.UnixNano()
+		}
+		lines = append(lines, l)
+		// 行内容加上切片元素本身的大小
+		size += int64(len(line)) + 24
+		if config.sortBuffer > 0 && size >= config.sortBuffer {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(lines) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(runs) > 0 {
+		timeMerge.mu.Lock()
+		timeMerge.runs[file] = runs
+		timeMerge.mu.Unlock()
+	}
+	r.discard()
+	return nil
+}
+
+// 创建并写入一个段文件
+func writeRun(path string, write func(w *bufio.Writer)) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	write(w)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 归并过程中一段当前的命中行
+type mergeCursor struct {
+	run       mergeRun
+	t         int64
+	fileIndex int
+	line      string
+	scanner   *bufio.Scanner
+	f         *os.File
+	// 段的顺序：各段按文件顺序、文件内按段的顺序排列，时间相同时保持该顺序
+	order int
+}
+
+// 按时间最早的行排序的最小堆，时间相同时按段的顺序
+type mergeHeap []*mergeCursor
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].t != h[j].t {
+		return h[i].t < h[j].t
+	}
+	return h[i].order < h[j].order
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeCursor)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// 读取下一行，文件读完时返回 false
+func (c *mergeCursor) next() (bool, error) {
+	if !c.scanner.Scan() {
+		return false, c.scanner.Err()
+	}
+	ts, line, _ := strings.Cut(c.scanner.Text(), "\t")
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf(tr("合并临时文件格式错误: %w", "corrupt merge run file: %w"), err)
+	}
+	c.fileIndex = c.run.fileIndex
+	if c.fileIndex < 0 {
+		var idx string
+		idx, line, _ = strings.Cut(line, "\t")
+		if c.fileIndex, err = strconv.Atoi(idx); err != nil {
+			return false, fmt.Errorf(tr("合并临时文件格式错误: %w", "corrupt merge run file: %w"), err)
+		}
+	}
+	c.t, c.line = t, line
+	return true, nil
+}
+
+// 按时间顺序归并各段，对每一行调用 emit
+func mergeRuns(runs []mergeRun, emit func(fileIndex int, t int64, line string) error) error {
+	h := &mergeHeap{}
+	defer func() {
+		for _, c := range *h {
+			c.f.Close()
+		}
+	}()
+	for i, run := range runs {
+		f, err := os.Open(run.path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+		c := &mergeCursor{run: run, scanner: scanner, f: f, order: i}
+		ok, err := c.next()
+		if err != nil || !ok {
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		heap.Push(h, c)
+	}
+	for h.Len() > 0 {
+		c := (*h)[0]
+		if err := emit(c.fileIndex, c.t, c.line); err != nil {
+			return err
+		}
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+			c.f.Close()
+		}
+	}
+	return nil
+}
+
+// 段数超过 mergeFanIn 时把相邻的段分批归并，直到可以一次归并全部段；相邻分批保证时间相同的行顺序不变
+func compactRuns(runs []mergeRun) ([]mergeRun, error) {
+	for len(runs) > mergeFanIn {
+		var next []mergeRun
+		for start := 0; start < len(runs); start += mergeFanIn {
+			batch := runs[start:min(start+mergeFanIn, len(runs))]
+			if len(batch) == 1 {
+				next = append(next, batch[0])
+				continue
+			}
+			path, err := newRunPath()
+			if err != nil {
+				return nil, err
+			}
+			var mergeErr error
+			err = writeRun(path, func(w *bufio.Writer) {
+				mergeErr = mergeRuns(batch, func(fileIndex int, t int64, line string) error {
+					w.WriteString(strconv.FormatInt(t, 10))
+					w.WriteByte('\t')
+					w.WriteString(strconv.Itoa(fileIndex))
+					w.WriteByte('\t')
+					w.WriteString(line)
+					return w.WriteByte('\n')
+				})
+			})
+			if mergeErr != nil {
+				return nil, mergeErr
+			}
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, mergeRun{path: path, fileIndex: -1})
+		}
+		runs = next
+	}
+	return runs, nil
+}
+
+// 按请求时间顺序对全部文件的命中行调用 fn，t 为零值表示无法解析时间
+func mergedMatches(results map[string]*fileResult, fn func(file, line string, t time.Time) error) error {
+	files := sortedFiles(results)
+	timeMerge.mu.Lock()
+	runs, cached := timeMerge.merged, slices.Equal(timeMerge.mergedFiles, files)
+	if !cached {
+		runs = nil
+		for i, file := range files {
+			for _, path := range timeMerge.runs[file] {
+				runs = append(runs, mergeRun{path: path, fileIndex: i})
+			}
+		}
+	}
+	timeMerge.mu.Unlock()
+
+	if !cached {
+		var err error
+		if runs, err = compactRuns(runs); err != nil {
+			return err
+		}
+		timeMerge.mu.Lock()
+		timeMerge.merged, timeMerge.mergedFiles = runs, files
+		timeMerge.mu.Unlock()
+	}
+	return mergeRuns(runs, func(fileIndex int, ns int64, line string) error {
+		var t time.Time
+		if ns != 0 {
+			t = time.Unix(0, ns)
+		}
+		return fn(files[fileIndex], line, t)
+	})
+}
+
+// 删除合并用的临时文件
+func cleanupTimeMerge() {
+	timeMerge.mu.Lock()
+	defer timeMerge.mu.Unlock()
+	if timeMerge.dir != "" {
+		os.RemoveAll(timeMerge.dir)
+	}
+	timeMerge.dir, timeMerge.n, timeMerge.runs = "", 0, nil
+	timeMerge.merged, timeMerge.mergedFiles = nil, nil
+}
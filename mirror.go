@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/urfave/cli/v2"
+)
+
+// mirror：持续同步新发布的日志到本地缓存（可同时上传到 OSS），不做分析
+var mirrorCommand = &cli.Command{
+	Name:  "mirror",
+	Usage: tr("持续发现并下载域名新发布的日志文件到本地缓存（可同时上传到OSS），用于归档，不做分析", "continuously discover newly published log files of the domains and download them into the local cache (optionally also to OSS) for archiving, without analysis"),
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "interval",
+			Value: time.Hour,
+			Usage: tr("两次同步之间的间隔", "interval between two syncs"),
+		},
+		&cli.BoolFlag{
+			Name:  "once",
+			Usage: tr("只同步一次后退出，适合由 cron 等定时任务调用", "sync once and exit, for use from cron or other schedulers"),
+		},
+		&cli.DurationFlag{
+			Name:  "lookback",
+			Value: 48 * time.Hour,
+			Usage: tr("每次同步查询最近多长时间的日志；日志发布有延迟，不宜小于几个小时", "how far back each sync lists logs; logs are published with a delay, so keep this at several hours or more"),
+		},
+		&cli.StringFlag{
+			Name:  "upload-oss-bucket",
+			Usage: tr("同时把日志上传到该 OSS Bucket，已存在的对象不会重复上传；地域和 Endpoint 与 --oss-region/--oss-endpoint 相同", "also upload the logs to this OSS bucket, skipping objects that already exist; region and endpoint follow --oss-region/--oss-endpoint"),
+		},
+		&cli.StringFlag{
+			Name:  "upload-oss-prefix",
+			Usage: tr("上传到 OSS 的对象前缀，如 cdn-archive/", "object prefix of the uploads, e.g. cdn-archive/"),
+		},
+	},
+	Action: runMirror,
+}
+
+func runMirror(c *cli.Context) error {
+	if err := loadListingCommandConfig(c); err != nil {
+		return err
+	}
+	if err := loadDownloadConfig(c); err != nil {
+		return err
+	}
+	if err := loadCacheConfig(c); err != nil {
+		return err
+	}
+	loadOSSConfig(c)
+	if ossConfig.bucket != "" {
+		return errors.New(tr("mirror 通过API查询日志，不能与 --oss-bucket 同时使用", "mirror lists logs through the API and cannot be combined with --oss-bucket"))
+	}
+	lookback, interval := c.Duration("lookback"), c.Duration("interval")
+	if lookback <= 0 {
+		return errors.New(tr("--lookback 必须大于0", "--lookback must be positive"))
+	}
+	if interval <= 0 {
+		return errors.New(tr("--interval 必须大于0", "--interval must be positive"))
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf(tr("创建日志保存目录失败: %w", "create log directory: %w"), err)
+	}
+	var upload *oss.Bucket
+	if name := c.String("upload-oss-bucket"); name != "" {
+		bucket, err := newOSSBucket(name)
+		if err != nil {
+			return fmt.Errorf(tr("创建OSS客户端失败: %w", "create OSS client: %w"), err)
+		}
+		upload = bucket
+	}
+
+	// 收到中断信号时结束当前的等待，正在下载的文件作为 .part 丢弃
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		err := mirrorOnce(ctx, lookback, upload, c.String("upload-oss-prefix"))
+		if ctx.Err() != nil {
+			return nil
+		}
+		if c.Bool("once") {
+			return err
+		}
+		// 持续运行时单次失败不退出，下次同步会重试
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 同步失败: %v\n", "Warning: sync failed: %v\n"), err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// 同步一次：查询最近 lookback 内的日志，下载本地没有的文件，并上传到 OSS
+func mirrorOnce(ctx context.Context, lookback time.Duration, upload *oss.Bucket, prefix string) error {
+	now := time.Now().UTC()
+	config.startTime = now.Add(-lookback).Truncate(time.Hour).Format(time.RFC3339)
+	config.endTime = now.Format(time.RFC3339)
+	urls, err := fetchCDNLogURLs(ctx)
+	if err != nil {
+		return fmt.Errorf(tr("获取日志链接失败: %w", "fetch log URLs: %w"), err)
+	}
+
+	var pending []string
+	var total int64
+	for _, url := range urls {
+		if file := localLogPath(url); !isCachedLog(file) {
+			pending = append(pending, url)
+			size, _ := logSize(file)
+			total += size
+		}
+	}
+	fmt.Printf(tr("[%s] 最近 %s 共 %d 个日志文件，新增 %d 个（%s）\n", "[%s] last %s: %d log files, %d new (%s)\n"),
+		now.Local().Format(time.DateTime), lookback, len(urls), len(pending), formatBytes(total))
+	var errs []error
+	if len(pending) > 0 {
+		if err := checkDiskSpace(total); err != nil {
+			return err
+		}
+		downloaded, err := downloadLogs(ctx, pending)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		fmt.Printf(tr("成功下载 %d/%d 个日志文件\n", "Downloaded %d/%d log files\n"), len(downloaded), len(pending))
+		if err := evictLogCache(downloaded); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 清理日志缓存失败: %v\n", "Warning: log cache eviction failed: %v\n"), err)
+		}
+	}
+	if upload != nil {
+		if err := uploadLogs(upload, prefix, urls); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 把本地缓存中的日志上传到 OSS，对象名为前缀加上日志目录中的相对路径；已存在的对象跳过
+func uploadLogs(bucket *oss.Bucket, prefix string, urls []string) error {
+	uploaded := 0
+	var errs []error
+	for _, url := range urls {
+		file := localLogPath(url)
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(logDir, file)
+		if err != nil {
+			continue
+		}
+		key := prefix + filepath.ToSlash(rel)
+		exists, err := bucket.IsObjectExist(key)
+		if err == nil && !exists {
+			err = bucket.PutObjectFromFile(key, file)
+			if err == nil {
+				uploaded++
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf(tr("上传 %s 失败: %w", "upload %s: %w"), key, err))
+		}
+	}
+	if uploaded > 0 {
+		fmt.Printf(tr("上传 %d 个日志文件到 OSS Bucket %s\n", "Uploaded %d log files to OSS bucket %s\n"), uploaded, bucket.BucketName)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze 404：按URL、来源页面和客户端IP统计 404 响应，找出失效链接和扫描器
+var notFoundCommand = &cli.Command{
+	Name:  "404",
+	Usage: tr("按缺失的URL、来源页面（Referer）和客户端IP统计 404 响应，列出每个缺失资源的主要来源页面", "aggregate 404 responses by missing URL, referer and client IP, listing the top referring pages of each missing resource"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的 404 响应，表达式语法同检测规则", "only aggregate 404 responses matching this expression (same syntax as rule filters)"),
+		},
+		&cli.IntFlag{
+			Name:  "referers",
+			Value: 3,
+			Usage: tr("每个缺失资源列出的来源页面数，0 表示不列出", "number of referring pages listed for each missing resource; 0 disables the listing"),
+		},
+	},
+	Action: runNotFoundReport,
+}
+
+func runNotFoundReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	filter := "status == 404"
+	if f := c.String("filter"); f != "" {
+		filter += " && (" + f + ")"
+	}
+	var reports []*groupBy
+	for _, r := range []struct{ name, by, metrics string }{
+		{"notfound", "host,path", "count,distinct(client_ip),distinct(referer),first_seen,last_seen"},
+		// 链接到缺失资源的页面；referer 为 - 的多为直接访问或扫描器
+		{"notfound-referers", "referer", "count,distinct(path),distinct(client_ip)"},
+		// 请求了很多不同的缺失路径的IP多半是扫描器
+		{"notfound-ips", "client_ip", "count,distinct(path),first_seen,last_seen"},
+	} {
+		g, err := newGroupBy(r.name, r.by, r.metrics, filter)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, g)
+	}
+
+	limit := c.Int("referers")
+	if limit <= 0 {
+		return runAggregates(c, reports, nil)
+	}
+	pairs, err := newGroupBy("notfound-pairs", "host,path,referer", "count", filter)
+	if err != nil {
+		return err
+	}
+	pairs.hidden = true
+	return runAggregates(c, append(reports, pairs), func(ctx context.Context) {
+		links := topReferers(reports[0].aggregate(), pairs, limit)
+		if len(links.Rows) > 0 {
+			printAggregate(links)
+		}
+		postAggregates = append(postAggregates, *links)
+	})
+}
+
+// notfound 报表中每个缺失资源（按报表的顺序）请求数最多的 limit 个来源页面；
+// 不受 --top 限制，只列出 notfound 报表中保留的资源
+func topReferers(missing *result.Aggregate, pairs *groupBy, limit int) *result.Aggregate {
+	pairs.mu.Lock()
+	defer pairs.mu.Unlock()
+	byResource := make(map[string][]result.AggregateRow)
+	for _, v := range pairs.groups {
+		key := v.keys[0] + "\x00" + v.keys[1]
+		byResource[key] = append(byResource[key], result.AggregateRow{Keys: v.keys, Values: []float64{float64(v.count)}})
+	}
+	links := &result.Aggregate{
+		Name:    "notfound-top-referers",
+		By:      []string{"host", "path", "referer"},
+		Metrics: []string{"count"},
+		Groups:  len(pairs.groups),
+		Rows:    []result.AggregateRow{},
+	}
+	if pairs.pruned > 0 {
+		links.Approximate, links.ErrorBound = true, pairs.pruned
+	}
+	for _, m := range missing.Rows {
+		rows := byResource[strings.Join(m.Keys, "\x00")]
+		slices.SortStableFunc(rows, func(a, b result.AggregateRow) int {
+			if c := compareFloat(b.Values[0], a.Values[0]); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Keys[2], b.Keys[2])
+		})
+		links.Rows = append(links.Rows, rows[:min(len(rows), limit)]...)
+	}
+	return links
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/urfave/cli/v2"
+)
+
+// 把命中行写入 MaxCompute（ODPS）表
+var odpsFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "odps-project",
+		Usage: tr("通过 Tunnel 把命中行写入该 MaxCompute 项目中的表，需要同时指定 --odps-table 和 --odps-endpoint", "write matched lines into a table of this MaxCompute project through the tunnel; requires --odps-table and --odps-endpoint"),
+	},
+	&cli.StringFlag{
+		Name:  "odps-table",
+		Usage: tr("MaxCompute 表名，表需要预先创建，按列名写入（列见文档）", "MaxCompute table, created beforehand; columns are filled by name (see the docs)"),
+	},
+	&cli.StringFlag{
+		Name:  "odps-endpoint",
+		Usage: tr("MaxCompute 的服务地址，如 https://service.cn-hangzhou.maxcompute.aliyun.com/api", "MaxCompute endpoint, e.g. https://service.cn-hangzhou.maxcompute.aliyun.com/api"),
+	},
+	&cli.StringFlag{
+		Name:  "odps-tunnel-endpoint",
+		Usage: tr("Tunnel 服务地址，如 https://dt.cn-hangzhou.maxcompute.aliyun.com；不指定时向 --odps-endpoint 查询", "tunnel endpoint, e.g. https://dt.cn-hangzhou.maxcompute.aliyun.com; looked up from --odps-endpoint when not set"),
+	},
+	&cli.StringFlag{
+		Name:  "odps-partition",
+		Usage: tr("写入的分区，如 dt=20250515 或 dt=20250515,domain=cdn；分区需要预先创建", "partition to write into, e.g. dt=20250515 or dt=20250515,domain=cdn; the partition must exist"),
+	},
+}
+
+// Tunnel 协议版本
+const odpsTunnelVersion = "5"
+
+// 单个数据块的最大字节数，超过后上传并开始下一个块
+const odpsBlockSize = 64 << 20
+
+// Tunnel 记录流中的特殊字段号：记录结束（后跟该记录的校验和）、记录数和全部记录的校验和
+const (
+	odpsTagEndRecord = 33553408
+	odpsTagCount     = 33554430
+	odpsTagChecksum  = 33554431
+)
+
+var odpsCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+type odpsSink struct {
+	project        string
+	table          string
+	endpoint       string
+	tunnelEndpoint string
+	partition      string
+
+	cred credential.Credential
+	// 上传会话ID和表结构，第一条命中行写入时创建
+	uploadID string
+	columns  []odpsColumn
+	// 当前块的记录流和已上传的块数
+	block  *odpsRecordWriter
+	blocks int
+	// 上传失败后关闭时不提交，表中不会留下部分结果
+	failed bool
+}
+
+// 表的一列及其在命中行中对应的值
+type odpsColumn struct {
+	name, typ string
+	value     func(ev *sinkEvent) any
+}
+
+// 可以写入的列：列名同 --db-driver 的 cdn_matches 表，没有的列写为 NULL
+var odpsMatchValues = map[string]func(ev *sinkEvent) any{
+	"analysis_id":      func(ev *sinkEvent) any { return analysisID },
+	"domain":           func(ev *sinkEvent) any { return ev.domain() },
+	"file":             func(ev *sinkEvent) any { return ev.fileLabel() },
+	"line":             func(ev *sinkEvent) any { return ev.line },
+	"request_time":     odpsRecordValue(func(r *logRecord) any { return r.Time }),
+	"client_ip":        odpsRecordValue(func(r *logRecord) any { return r.ClientIP }),
+	"proxy_ip":         odpsRecordValue(func(r *logRecord) any { return r.ProxyIP }),
+	"method":           odpsRecordValue(func(r *logRecord) any { return r.Method }),
+	"url":              odpsRecordValue(func(r *logRecord) any { return r.URL }),
+	"status":           odpsRecordValue(func(r *logRecord) any { return int64(r.Status) }),
+	"request_size":     odpsRecordValue(func(r *logRecord) any { return r.RequestSize }),
+	"response_size":    odpsRecordValue(func(r *logRecord) any { return r.ResponseSize }),
+	"response_time_ms": odpsRecordValue(func(r *logRecord) any { return int64(r.ResponseTime) }),
+	"referer":          odpsRecordValue(func(r *logRecord) any { return r.Referer }),
+	"user_agent":       odpsRecordValue(func(r *logRecord) any { return r.UserAgent }),
+	"hit_info":         odpsRecordValue(func(r *logRecord) any { return r.HitInfo }),
+	"content_type":     odpsRecordValue(func(r *logRecord) any { return r.ContentType }),
+}
+
+// 解析后的字段，无法解析的行为 NULL
+func odpsRecordValue(f func(r *logRecord) any) func(ev *sinkEvent) any {
+	return func(ev *sinkEvent) any {
+		if ev.rec == nil {
+			return nil
+		}
+		return f(ev.rec)
+	}
+}
+
+func loadODPSSink(c *cli.Context) (outputSink, error) {
+	project := c.String("odps-project")
+	if project == "" {
+		return nil, nil
+	}
+	s := &odpsSink{project: project, table: c.String("odps-table"), endpoint: strings.TrimSuffix(c.String("odps-endpoint"), "/"),
+		tunnelEndpoint: strings.TrimSuffix(c.String("odps-tunnel-endpoint"), "/"), partition: c.String("odps-partition")}
+	if s.table == "" || s.endpoint == "" {
+		return nil, errors.New(tr("使用 --odps-project 时需要指定 --odps-table 和 --odps-endpoint", "--odps-project requires --odps-table and --odps-endpoint"))
+	}
+	if s.partition != "" {
+		partition, err := odpsPartitionSpec(s.partition)
+		if err != nil {
+			return nil, err
+		}
+		s.partition = partition
+	}
+	return s, nil
+}
+
+// 把 dt=20250515,domain=cdn 规范为 Tunnel 使用的 dt='20250515',domain='cdn'
+func odpsPartitionSpec(spec string) (string, error) {
+	var parts []string
+	for _, kv := range strings.Split(spec, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		k, v = strings.TrimSpace(k), strings.Trim(strings.TrimSpace(v), `'"`)
+		if !ok || k == "" || v == "" {
+			return "", fmt.Errorf(tr("无效的 --odps-partition %q，格式为 列=值[,列=值]", "invalid --odps-partition %q, use col=value[,col=value]"), spec)
+		}
+		parts = append(parts, k+"='"+v+"'")
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func (s *odpsSink) String() string { return "maxcompute " + s.project + "." + s.table }
+
+// 只写入命中行，告警请使用 --db-driver 或 --sls-project
+func (s *odpsSink) send(ev *sinkEvent) error {
+	if ev.kind != "match" {
+		return nil
+	}
+	if s.failed {
+		return errors.New(tr("上传会话已失败", "upload session failed"))
+	}
+	if s.uploadID == "" {
+		if err := s.open(); err != nil {
+			s.failed = true
+			return err
+		}
+	}
+	values := make([]any, len(s.columns))
+	for i, col := range s.columns {
+		if col.value != nil {
+			values[i] = col.value(ev)
+		}
+	}
+	if err := s.block.write(s.columns, values); err != nil {
+		s.failed = true
+		return err
+	}
+	if s.block.buf.Len() >= odpsBlockSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// 查询 Tunnel 地址并创建上传会话，按会话返回的表结构确定每列的值
+func (s *odpsSink) open() error {
+	cred, err := credential.NewCredential(nil)
+	if err != nil {
+		return err
+	}
+	s.cred = cred
+	if s.tunnelEndpoint == "" {
+		var host []byte
+		if err := s.do(http.MethodGet, s.endpoint, "/projects/"+s.project+"/tunnel", url.Values{"service": {""}}, "", nil, func(body io.Reader) (err error) {
+			host, err = io.ReadAll(body)
+			return err
+		}); err != nil {
+			return fmt.Errorf(tr("查询 Tunnel 地址失败: %w", "look up tunnel endpoint: %w"), err)
+		}
+		scheme, _, _ := strings.Cut(s.endpoint, "://")
+		s.tunnelEndpoint = scheme + "://" + strings.TrimSpace(string(host))
+	}
+	var session odpsSession
+	if err := s.tunnel(http.MethodPost, url.Values{"uploads": {""}}, "", nil, &session); err != nil {
+		return fmt.Errorf(tr("创建上传会话失败: %w", "create upload session: %w"), err)
+	}
+	s.uploadID = session.UploadID
+	s.columns = nil
+	for _, col := range session.Schema.Columns {
+		c := odpsColumn{name: col.Name, typ: odpsBaseType(col.Type), value: odpsMatchValues[strings.ToLower(col.Name)]}
+		if c.value != nil && !slices.Contains(odpsTypes, c.typ) {
+			return fmt.Errorf(tr("列 %s 的类型 %s 不支持，可用 STRING、BIGINT、DOUBLE、BOOLEAN 或 DATETIME", "column %s has unsupported type %s, use STRING, BIGINT, DOUBLE, BOOLEAN or DATETIME"), col.Name, col.Type)
+		}
+		s.columns = append(s.columns, c)
+	}
+	s.block = newODPSRecordWriter()
+	return nil
+}
+
+// 上传会话的状态
+type odpsSession struct {
+	UploadID string `json:"UploadID"`
+	Status   string `json:"Status"`
+	Schema   struct {
+		Columns []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"columns"`
+	} `json:"Schema"`
+}
+
+// 支持写入的列类型
+var odpsTypes = []string{"string", "varchar", "char", "bigint", "int", "smallint", "tinyint", "double", "boolean", "datetime"}
+
+// 去掉类型参数，如 varchar(255) → varchar
+func odpsBaseType(t string) string {
+	t, _, _ = strings.Cut(strings.ToLower(t), "(")
+	return t
+}
+
+// 上传当前块
+func (s *odpsSink) flush() error {
+	if s.block == nil || s.block.count == 0 {
+		return nil
+	}
+	data := s.block.close()
+	s.block = newODPSRecordWriter()
+	params := url.Values{"uploadid": {s.uploadID}, "blockid": {strconv.Itoa(s.blocks)}}
+	if err := s.tunnel(http.MethodPut, params, "application/octet-stream", data, nil); err != nil {
+		s.failed = true
+		return fmt.Errorf(tr("上传数据块失败: %w", "upload block: %w"), err)
+	}
+	s.blocks++
+	return nil
+}
+
+// 上传剩余记录并提交会话，提交后全部块一次生效
+func (s *odpsSink) close() error {
+	if s.uploadID == "" || s.failed {
+		return nil
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	params := url.Values{"uploadid": {s.uploadID}}
+	var session odpsSession
+	if err := s.tunnel(http.MethodPost, params, "", nil, &session); err != nil {
+		return fmt.Errorf(tr("提交上传会话失败: %w", "commit upload session: %w"), err)
+	}
+	// 服务端异步提交时状态为 committing，等待完成
+	for range 20 {
+		switch strings.ToLower(session.Status) {
+		case "committing":
+			time.Sleep(3 * time.Second)
+			if err := s.tunnel(http.MethodGet, params, "", nil, &session); err != nil {
+				return fmt.Errorf(tr("查询上传会话失败: %w", "reload upload session: %w"), err)
+			}
+			continue
+		case "committed", "normal", "":
+			return nil
+		}
+		return fmt.Errorf(tr("上传会话状态为 %s", "upload session is %s"), session.Status)
+	}
+	return errors.New(tr("等待上传会话提交超时", "timed out waiting for the upload session to commit"))
+}
+
+// 调用表的 Tunnel 接口，响应为 JSON 时解析到 out
+func (s *odpsSink) tunnel(method string, params url.Values, contentType string, body []byte, out any) error {
+	if s.partition != "" {
+		params.Set("partition", s.partition)
+	}
+	resource := "/projects/" + s.project + "/tables/" + s.table
+	return s.do(method, s.tunnelEndpoint, resource, params, contentType, body, func(r io.Reader) error {
+		if out == nil {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		}
+		return json.NewDecoder(r).Decode(out)
+	})
+}
+
+// 发送签名的请求，2xx 响应交给 read 处理
+func (s *odpsSink) do(method, endpoint, resource string, params url.Values, contentType string, body []byte, read func(io.Reader) error) error {
+	req, err := http.NewRequest(method, endpoint+resource+"?"+odpsQuery(params, url.QueryEscape), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-odps-tunnel-version", odpsTunnelVersion)
+	model, err := s.cred.GetCredential()
+	if err != nil {
+		return err
+	}
+	if token := tea.StringValue(model.SecurityToken); token != "" {
+		req.Header.Set("authorization-sts-token", token)
+	}
+	req.Header.Set("Authorization", odpsAuthorization(tea.StringValue(model.AccessKeyId), tea.StringValue(model.AccessKeySecret), method, resource, params, req.Header))
+	resp, err := sinkHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return checkSinkResponse(resp)
+	}
+	defer resp.Body.Close()
+	return read(resp.Body)
+}
+
+// MaxCompute 的 Authorization 头：对方法、Content-MD5、Content-Type、Date、x-odps-* 头和资源路径（带排序后的参数）做 HMAC-SHA1
+func odpsAuthorization(id, secret, method, resource string, params url.Values, header http.Header) string {
+	lines := []string{method, header.Get("Content-MD5"), header.Get("Content-Type"), header.Get("Date")}
+	var odpsHeaders []string
+	for k := range header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-odps-") {
+			odpsHeaders = append(odpsHeaders, k+":"+header.Get(k))
+		}
+	}
+	slices.Sort(odpsHeaders)
+	lines = append(lines, odpsHeaders...)
+	if len(params) > 0 {
+		resource += "?" + odpsQuery(params, func(s string) string { return s })
+	}
+	lines = append(lines, resource)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return "ODPS " + id + ":" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 按参数名排序的查询字符串，值为空的参数只写参数名（如 ?uploads）；签名时参数值不转义
+func odpsQuery(params url.Values, escape func(string) string) string {
+	var query []string
+	for _, k := range slices.Sorted(maps.Keys(params)) {
+		if v := params.Get(k); v != "" {
+			query = append(query, escape(k)+"="+escape(v))
+		} else {
+			query = append(query, escape(k))
+		}
+	}
+	return strings.Join(query, "&")
+}
+
+// Tunnel 的记录流：每条记录按列序号（从1开始）以 protobuf 编码非空的列，之后是结束标记和该记录的 CRC32C；
+// 流的末尾是记录数和全部记录校验和的 CRC32C
+type odpsRecordWriter struct {
+	buf   bytes.Buffer
+	crc   hash.Hash32
+	total hash.Hash32
+	count int64
+}
+
+func newODPSRecordWriter() *odpsRecordWriter {
+	return &odpsRecordWriter{crc: crc32.New(odpsCRCTable), total: crc32.New(odpsCRCTable)}
+}
+
+func (w *odpsRecordWriter) write(columns []odpsColumn, values []any) error {
+	w.crc.Reset()
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		field := uint64(i + 1)
+		w.crc.Write(binary.LittleEndian.AppendUint32(nil, uint32(field)))
+		switch columns[i].typ {
+		case "string", "varchar", "char":
+			s := fmt.Sprint(v)
+			if t, ok := v.(time.Time); ok {
+				s = t.UTC().Format(time.RFC3339)
+			}
+			w.tag(field, 2)
+			w.varint(uint64(len(s)))
+			w.buf.WriteString(s)
+			w.crc.Write([]byte(s))
+		case "bigint", "int", "smallint", "tinyint":
+			n, ok := v.(int64)
+			if !ok {
+				return fmt.Errorf(tr("列 %s 需要整数", "column %s needs an integer"), columns[i].name)
+			}
+			w.tag(field, 0)
+			w.varint(uint64(n<<1) ^ uint64(n>>63))
+			w.crc.Write(binary.LittleEndian.AppendUint64(nil, uint64(n)))
+		case "double":
+			var f float64
+			switch v := v.(type) {
+			case int64:
+				f = float64(v)
+			case float64:
+				f = v
+			default:
+				return fmt.Errorf(tr("列 %s 需要数值", "column %s needs a number"), columns[i].name)
+			}
+			w.tag(field, 1)
+			bits := binary.LittleEndian.AppendUint64(nil, math.Float64bits(f))
+			w.buf.Write(bits)
+			w.crc.Write(bits)
+		case "boolean":
+			b, ok := v.(bool)
+			if !ok {
+				return fmt.Errorf(tr("列 %s 需要布尔值", "column %s needs a boolean"), columns[i].name)
+			}
+			var n byte
+			if b {
+				n = 1
+			}
+			w.tag(field, 0)
+			w.buf.WriteByte(n)
+			w.crc.Write([]byte{n})
+		case "datetime":
+			t, ok := v.(time.Time)
+			if !ok {
+				return fmt.Errorf(tr("列 %s 需要时间", "column %s needs a time"), columns[i].name)
+			}
+			ms := t.UnixMilli()
+			w.tag(field, 0)
+			w.varint(uint64(ms<<1) ^ uint64(ms>>63))
+			w.crc.Write(binary.LittleEndian.AppendUint64(nil, uint64(ms)))
+		}
+	}
+	sum := w.crc.Sum32()
+	w.tag(odpsTagEndRecord, 0)
+	w.varint(uint64(sum))
+	w.total.Write(binary.LittleEndian.AppendUint32(nil, sum))
+	w.count++
+	return nil
+}
+
+// 写入记录数和总校验和，返回整个记录流
+func (w *odpsRecordWriter) close() []byte {
+	w.tag(odpsTagCount, 0)
+	w.varint(uint64(w.count<<1) ^ uint64(w.count>>63))
+	w.tag(odpsTagChecksum, 0)
+	w.varint(uint64(w.total.Sum32()))
+	return w.buf.Bytes()
+}
+
+func (w *odpsRecordWriter) tag(field uint64, wireType uint64) {
+	w.varint(field<<3 | wireType)
+}
+
+func (w *odpsRecordWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 期望的签名和记录流按 MaxCompute 签名和 Tunnel 记录格式另行用 Python（hmac、逐位计算的 CRC32C）算出
+func TestODPSAuthorization(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		resource    string
+		params      url.Values
+		contentType string
+		want        string
+	}{
+		{
+			name:        "上传数据块，参数按名称排序且不转义",
+			method:      http.MethodPut,
+			resource:    "/projects/traffic/tables/cdn_matches",
+			params:      url.Values{"uploadid": {"abc"}, "blockid": {"0"}, "partition": {"dt='20250515'"}},
+			contentType: "application/octet-stream",
+			want:        "ODPS id:jSptDPRPZzkCIiFOzOWs0PMgxn0=",
+		},
+		{
+			name:     "查询 Tunnel 地址，空值参数只写参数名",
+			method:   http.MethodGet,
+			resource: "/projects/traffic/tunnel",
+			params:   url.Values{"service": {""}},
+			want:     "ODPS id:gIg7zRIQLzcuYbgc1rfejC9QAwQ=",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.contentType != "" {
+				header.Set("Content-Type", tt.contentType)
+			}
+			header.Set("Date", "Thu, 15 May 2025 00:00:00 GMT")
+			header.Set("x-odps-tunnel-version", odpsTunnelVersion)
+			// STS 令牌不参与签名
+			header.Set("authorization-sts-token", "token")
+			if got := odpsAuthorization("id", "secret", tt.method, tt.resource, tt.params, header); got != tt.want {
+				t.Errorf("odpsAuthorization = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestODPSRecordWriter(t *testing.T) {
+	columns := []odpsColumn{
+		{name: "client_ip", typ: "string"},
+		{name: "status", typ: "bigint"},
+		{name: "request_time", typ: "datetime"},
+		{name: "url", typ: "varchar"},
+		{name: "ratio", typ: "double"},
+		{name: "hit", typ: "boolean"},
+	}
+	w := newODPSRecordWriter()
+	// 负数的 bigint 和 datetime 按 zigzag 编码，空值的列不写入
+	if err := w.write(columns, []any{"1.2.3.4", int64(-3), time.Date(2025, 5, 15, 0, 0, 0, 123e6, time.UTC), nil, 1.5, true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.write(columns, []any{"::1", int64(200), nil, "a", nil, false}); err != nil {
+		t.Fatal(err)
+	}
+	// 每条记录后是字段号 33553408 和该记录的 CRC32C（1e1d7a3c、47d39128），
+	// 流末尾是字段号 33554430 的记录数和 33554431 的总校验和（e1eb0e3f）
+	want := "0a07312e322e332e34100518f691ed93da6529000000000000f83f300180c0ff7fbcf4f5f001" +
+		"0a033a3a31109003220161300080c0ff7fa8a2cebe04" +
+		"f0ffff7f04f8ffff7fbf9cac8f0e"
+	if got := hex.EncodeToString(w.close()); got != want {
+		t.Errorf("record stream:\n got %s\nwant %s", got, want)
+	}
+
+	if err := newODPSRecordWriter().write(columns[1:2], []any{"200"}); err == nil {
+		t.Error("write: string value for a bigint column accepted")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// OSS 对象在搜索流程中的路径前缀，形如 oss://bucket/key
+const ossScheme = "oss://"
+
+// 日志投递到 OSS 存在延迟，按修改时间筛选对象时结束时间向后放宽
+const ossDeliveryLag = 24 * time.Hour
+
+// OSS 数据源相关的命令行参数
+var ossFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "oss-bucket",
+		Usage: tr("直接从该 OSS Bucket 读取CDN日志（需开启日志转存），不再调用 DescribeCdnDomainLogs", "read CDN logs directly from this OSS bucket (requires log delivery to OSS) instead of calling DescribeCdnDomainLogs"),
+	},
+	&cli.StringFlag{
+		Name:  "oss-prefix",
+		Usage: tr("OSS 日志对象的前缀，如 cdn_log/example.com/", "OSS log object prefix, e.g. cdn_log/example.com/"),
+	},
+	&cli.StringFlag{
+		Name:  "oss-region",
+		Value: "cn-hangzhou",
+		Usage: tr("OSS Bucket 所在地域", "region of the OSS bucket"),
+	},
+	&cli.StringFlag{
+		Name:  "oss-endpoint",
+		Usage: tr("OSS Endpoint，默认根据 --oss-region 生成", "OSS endpoint, derived from --oss-region by default"),
+	},
+	&cli.BoolFlag{
+		Name:  "oss-internal",
+		Usage: tr("使用 OSS 内网 Endpoint（在同地域 ECS 上运行时免流量费且更快）", "use the internal OSS endpoint (free and faster on ECS in the same region)"),
+	},
+}
+
+// OSS 数据源配置
+var ossConfig struct {
+	bucket   string
+	prefix   string
+	endpoint string
+}
+
+var (
+	ossBucketOnce sync.Once
+	ossBucket     *oss.Bucket
+	ossBucketErr  error
+)
+
+// 从命令行参数读取 OSS 配置
+func loadOSSConfig(c *cli.Context) {
+	ossConfig.bucket = c.String("oss-bucket")
+	ossConfig.prefix = c.String("oss-prefix")
+	ossConfig.endpoint = c.String("oss-endpoint")
+	if ossConfig.endpoint == "" {
+		ossConfig.endpoint = fmt.Sprintf("oss-%s.aliyuncs.com", c.String("oss-region"))
+		if c.Bool("oss-internal") {
+			ossConfig.endpoint = fmt.Sprintf("oss-%s-internal.aliyuncs.com", c.String("oss-region"))
+		}
+	}
+}
+
+// 创建 OSS Bucket 客户端，凭证与CDN API相同
+func getOSSBucket() (*oss.Bucket, error) {
+	ossBucketOnce.Do(func() {
+		ossBucket, ossBucketErr = newOSSBucket(ossConfig.bucket)
+	})
+	return ossBucket, ossBucketErr
+}
+
+// 创建指定 Bucket 的客户端，Endpoint 取自 --oss-region/--oss-endpoint
+func newOSSBucket(name string) (*oss.Bucket, error) {
+	cred, err := credential.NewCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	provider := ossCredentialsProvider{cred: cred}
+	// 创建时先取一次，凭证配置有误时尽早报错
+	if _, err := provider.GetCredentialsE(); err != nil {
+		return nil, err
+	}
+
+	client, err := oss.New(ossConfig.endpoint, "", "", oss.SetCredentialsProvider(provider))
+	if err != nil {
+		return nil, err
+	}
+	return client.Bucket(name)
+}
+
+// 每次请求都从凭证链取凭证：STS、RAM 角色等临时凭证在长时间扫描、serve 和 mirror 中会过期，
+// 由 credentials-go 在过期前刷新
+type ossCredentialsProvider struct {
+	cred credential.Credential
+}
+
+func (p ossCredentialsProvider) GetCredentialsE() (oss.Credentials, error) {
+	model, err := p.cred.GetCredential()
+	if err != nil {
+		return nil, fmt.Errorf(tr("获取OSS凭证失败: %w", "get OSS credentials: %w"), err)
+	}
+	return ossCredentials{
+		id:     tea.StringValue(model.AccessKeyId),
+		secret: tea.StringValue(model.AccessKeySecret),
+		token:  tea.StringValue(model.SecurityToken),
+	}, nil
+}
+
+// SDK 优先调用 GetCredentialsE，这里只为满足 oss.CredentialsProvider 接口
+func (p ossCredentialsProvider) GetCredentials() oss.Credentials {
+	c, err := p.GetCredentialsE()
+	if err != nil {
+		return ossCredentials{}
+	}
+	return c
+}
+
+type ossCredentials struct {
+	id, secret, token string
+}
+
+func (c ossCredentials) GetAccessKeyID() string     { return c.id }
+func (c ossCredentials) GetAccessKeySecret() string { return c.secret }
+func (c ossCredentials) GetSecurityToken() string   { return c.token }
+
+// 列出 OSS 中时间范围内的日志对象，返回 oss://bucket/key 形式的路径
+func listOSSLogObjects(ctx context.Context) (files []string, err error) {
+	_, span := startSpan(ctx, "ListObjectsV2", attribute.String("oss.bucket", ossConfig.bucket))
+	defer func() { endSpan(span, err) }()
+
+	bucket, err := getOSSBucket()
+	if err != nil {
+		return nil, fmt.Errorf(tr("创建OSS客户端失败: %w", "create OSS client: %w"), err)
+	}
+
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	token := ""
+	for {
+		res, err := bucket.ListObjectsV2(oss.Prefix(ossConfig.prefix), oss.ContinuationToken(token), oss.MaxKeys(1000))
+		if err != nil {
+			return nil, fmt.Errorf(tr("列出OSS对象失败: %w", "list OSS objects: %w"), err)
+		}
+		for _, obj := range res.Objects {
+			if strings.HasSuffix(obj.Key, "/") || obj.Size == 0 {
+				continue
+			}
+			if obj.LastModified.Before(start) || obj.LastModified.After(end.Add(ossDeliveryLag)) {
+				continue
+			}
+			files = append(files, ossScheme+ossConfig.bucket+"/"+obj.Key)
+		}
+		if !res.IsTruncated {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+
+	span.SetAttributes(attribute.Int("oss.objects", len(files)))
+	return files, nil
+}
+
+// 以流的方式打开 OSS 对象
+func openOSSObject(path string) (io.ReadCloser, error) {
+	bucket, err := getOSSBucket()
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(path, ossScheme), ossConfig.bucket+"/")
+	return bucket.GetObject(key)
+}
+
+// 解析开始和结束时间
+func parseTimeRange(startTime, endTime string) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, startTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf(tr("开始时间格式错误: %w", "invalid start time: %w"), err)
+	}
+	end, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf(tr("结束时间格式错误: %w", "invalid end time: %w"), err)
+	}
+	return start, end, nil
+}
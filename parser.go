@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 阿里云CDN离线日志的时间格式
+const logTimeLayout = "2/Jan/2006:15:04:05 -0700"
+
+// 阿里云CDN离线日志的一条记录
+// 格式: [时间] 客户端IP 代理IP 响应时间 "Referer" "方法 URL" 状态码 请求大小 响应大小 命中信息 "User-Agent" "Content-Type"
+// 例如: [9/Jun/2015:01:58:09 +0800] 188.165.15.75 - 1542 "-" "GET http://www.aliyun.com/index.html" 200 191 2830 MISS "Mozilla/5.0" "text/html"
+type logRecord struct {
+	Time         time.Time
+	ClientIP     string
+	ProxyIP      string
+	ResponseTime int // 毫秒
+	Referer      string
+	Method       string
+	URL          string
+	Status       int
+	RequestSize  int64
+	ResponseSize int64
+	HitInfo      string
+	UserAgent    string
+	ContentType  string
+}
+
+var errMalformedLine = errors.New(tr("日志格式无法识别", "unrecognized log line format"))
+
+// 解析一行日志到rec中，rec会被整体覆盖；按行首识别阿里云、腾讯云或华为云的日志格式
+func parseLogLine(line string, rec *logRecord) error {
+	*rec = logRecord{}
+	line = strings.TrimSpace(line)
+	if isTencentLine(line) {
+		return parseTencentLine(line, rec)
+	}
+	if isHuaweiLine(line) {
+		return parseHuaweiLine(line, rec)
+	}
+	return parseAliyunLine(line, rec)
+}
+
+// 解析一行阿里云CDN离线日志
+func parseAliyunLine(line string, rec *logRecord) error {
+	var fields [12]string
+	n := 0
+	for rest := line; rest != "" && n < len(fields); n++ {
+		var field string
+		var ok bool
+		field, rest, ok = nextField(rest)
+		if !ok {
+			return errMalformedLine
+		}
+		fields[n] = field
+	}
+	if n < 10 {
+		return errMalformedLine
+	}
+
+	t, err := time.Parse(logTimeLayout, fields[0])
+	if err != nil {
+		return errMalformedLine
+	}
+	rec.Time = t
+	rec.ClientIP = normalizeIP(fields[1])
+	rec.ProxyIP = normalizeIP(fields[2])
+	rec.ResponseTime, _ = strconv.Atoi(fields[3])
+	rec.Referer = fields[4]
+	rec.Method, rec.URL, _ = strings.Cut(fields[5], " ")
+	if rec.Status, err = strconv.Atoi(fields[6]); err != nil {
+		return errMalformedLine
+	}
+	rec.RequestSize, _ = strconv.ParseInt(fields[7], 10, 64)
+	rec.ResponseSize, _ = strconv.ParseInt(fields[8], 10, 64)
+	rec.HitInfo = fields[9]
+	rec.UserAgent = fields[10]
+	rec.ContentType = fields[11]
+	return nil
+}
+
+// 取出下一个字段：[...]、"..." 或以空格分隔的普通字段
+func nextField(s string) (field, rest string, ok bool) {
+	switch s[0] {
+	case '[':
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return "", "", false
+		}
+		field, rest = s[1:end], s[end+1:]
+	case '"':
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return "", "", false
+		}
+		field, rest = s[1:end+1], s[end+2:]
+	default:
+		end := strings.IndexByte(s, ' ')
+		if end < 0 {
+			end = len(s)
+		}
+		field, rest = s[:end], s[end:]
+	}
+	return field, strings.TrimLeft(rest, " "), true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 性能分析相关的命令行参数
+var profileFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "pprof",
+		Usage: tr("在指定地址启动 pprof HTTP 服务，如 :6060", "serve pprof over HTTP on this address, e.g. :6060"),
+	},
+	&cli.StringFlag{
+		Name:  "cpuprofile",
+		Usage: tr("将CPU性能数据写入指定文件", "write a CPU profile to this file"),
+	},
+	&cli.StringFlag{
+		Name:  "memprofile",
+		Usage: tr("运行结束时将内存性能数据写入指定文件", "write a heap profile to this file when the run ends"),
+	},
+}
+
+// 正在写入的CPU性能数据文件
+var cpuProfileFile *os.File
+
+// 在命令执行前启动性能分析
+func startProfiling(c *cli.Context) error {
+	if addr := c.String("pprof"); addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, nil); err != nil {
+				fmt.Fprintf(os.Stderr, tr("pprof 服务启动失败: %v\n", "pprof server failed: %v\n"), err)
+			}
+		}()
+		fmt.Printf(tr("pprof 服务已启动: http://%s/debug/pprof/\n", "pprof server listening: http://%s/debug/pprof/\n"), addr)
+	}
+
+	if path := c.String("cpuprofile"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf(tr("创建CPU性能数据文件失败: %w", "create CPU profile: %w"), err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf(tr("启动CPU性能分析失败: %w", "start CPU profile: %w"), err)
+		}
+		cpuProfileFile = f
+	}
+	return nil
+}
+
+// 在命令执行后停止性能分析并写入数据
+func stopProfiling(c *cli.Context) error {
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		cpuProfileFile.Close()
+		cpuProfileFile = nil
+	}
+
+	if path := c.String("memprofile"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf(tr("创建内存性能数据文件失败: %w", "create heap profile: %w"), err)
+		}
+		defer f.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return fmt.Errorf(tr("写入内存性能数据失败: %w", "write heap profile: %w"), err)
+		}
+	}
+	return nil
+}
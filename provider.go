@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	cdn20180510 "github.com/alibabacloud-go/cdn-20180510/v6/client"
+	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/urfave/cli/v2"
+)
+
+// 日志来源的参数
+var providerFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "provider",
+		Value: "aliyun",
+		Usage: tr("CDN厂商，决定通过哪个接口查询日志列表: aliyun、tencent 或 huawei；--accounts 中可以为每个账号单独指定", "CDN vendor whose API lists the log files: aliyun, tencent or huawei; accounts in --accounts can set their own"),
+	},
+}
+
+// CDN厂商的离线日志接口。新增厂商时实现该接口并加入 logProviders，查询、缓存、下载和分析流程不需要修改
+type logProvider interface {
+	// 厂商名，同 --provider
+	name() string
+	// 查询域名一个UTC日期的全部日志文件
+	listDayLogs(ctx context.Context, domain string, day time.Time) ([]logFile, error)
+}
+
+// 厂商名 → 使用账号的凭证创建日志来源，账号为 nil 时使用默认凭证
+var logProviders = map[string]func(a *account) (logProvider, error){
+	"aliyun":  newAliyunProvider,
+	"tencent": newTencentProvider,
+	"huawei":  newHuaweiProvider,
+}
+
+// 各厂商的CDN API地址，doctor 检查网络时使用
+var providerEndpoints = map[string]string{
+	"aliyun":  "cdn.aliyuncs.com",
+	"tencent": tencentCDNEndpoint,
+	"huawei":  huaweiCDNEndpoint,
+}
+
+// 腾讯云和华为云的日志和接口使用北京时间
+var beijingTime = time.FixedZone("", 8*60*60)
+
+// 只支持阿里云的参数：调用阿里云的监控、域名配置接口或读取 OSS 转存的日志
+var aliyunOnlyFlags = []string{"oss-bucket", "cross-check", "push-blacklist"}
+
+// --provider 选择的厂商
+var providerName = "aliyun"
+
+func loadProviderConfig(c *cli.Context) error {
+	name := c.String("provider")
+	if _, ok := logProviders[name]; !ok {
+		return fmt.Errorf(tr("不支持的CDN厂商 %q，可选 %s", "unsupported CDN provider %q, use %s"), name, strings.Join(slices.Sorted(maps.Keys(logProviders)), ", "))
+	}
+	if name != "aliyun" {
+		for _, flag := range aliyunOnlyFlags {
+			if c.IsSet(flag) {
+				return fmt.Errorf(tr("--%s 只支持阿里云CDN", "--%s is only supported for Aliyun CDN"), flag)
+			}
+		}
+	}
+	providerName = name
+	return nil
+}
+
+// 使用默认凭证创建 --provider 的日志来源
+func newLogProvider() (logProvider, error) {
+	return logProviders[providerName](nil)
+}
+
+// 阿里云CDN，通过 DescribeCdnDomainLogs 查询
+type aliyunProvider struct {
+	client *cdn20180510.Client
+}
+
+func newAliyunProvider(a *account) (logProvider, error) {
+	cred, err := credential.NewCredential(nil)
+	if a != nil {
+		cred, err = a.credential()
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := newCDNClient(cred)
+	if err != nil {
+		return nil, err
+	}
+	return &aliyunProvider{client: client}, nil
+}
+
+func (p *aliyunProvider) name() string { return "aliyun" }
+
+func (p *aliyunProvider) listDayLogs(ctx context.Context, domain string, day time.Time) ([]logFile, error) {
+	return describeDayLogs(ctx, p.client, domain, day)
+}
+
+// 阿里云以外的厂商的接口返回的错误
+type cloudAPIError struct {
+	status        int
+	code, message string
+	requestID     string
+}
+
+func (e *cloudAPIError) Error() string {
+	s := e.code + ": " + e.message
+	if e.requestID != "" {
+		s += " (RequestId: " + e.requestID + ")"
+	}
+	return s
+}
+
+// 是否为限流错误，如腾讯云的 RequestLimitExceeded
+func (e *cloudAPIError) throttled() bool {
+	return e.status == http.StatusTooManyRequests || strings.Contains(e.code, "LimitExceeded") || strings.Contains(e.code, "Throttling")
+}
+
+// 阿里云以外的厂商的API密钥，token 为临时密钥的令牌，使用永久密钥时为空
+type apiKey struct {
+	id, secret, token string
+}
+
+// 阿里云以外的厂商的凭证来源：默认的环境变量名，以及用户目录下的凭证文件（INI 格式）及其中的键名
+type apiKeySource struct {
+	vendor                  string
+	idEnv, keyEnv, tokenEnv string
+	file                    string
+	idKey, keyKey, tokenKey string
+}
+
+// 账号的凭证：账号配置中的环境变量或 profile；默认为厂商的环境变量，其次为凭证文件中的 default
+func (s apiKeySource) load(a *account) (apiKey, error) {
+	if a != nil && a.AccessKeyIDEnv != "" {
+		id, secret := os.Getenv(a.AccessKeyIDEnv), os.Getenv(a.AccessKeySecretEnv)
+		if id == "" || secret == "" {
+			return apiKey{}, fmt.Errorf(tr("环境变量 %s 或 %s 未设置", "environment variable %s or %s is not set"), a.AccessKeyIDEnv, a.AccessKeySecretEnv)
+		}
+		return apiKey{id: id, secret: secret}, nil
+	}
+	profile := "default"
+	if a != nil && a.Profile != "" {
+		profile = a.Profile
+	} else if id, secret := os.Getenv(s.idEnv), os.Getenv(s.keyEnv); id != "" && secret != "" {
+		return apiKey{id: id, secret: secret, token: os.Getenv(s.tokenEnv)}, nil
+	}
+	return s.profile(profile)
+}
+
+// 读取凭证文件中的一个 profile
+func (s apiKeySource) profile(profile string) (apiKey, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return apiKey{}, err
+	}
+	path := filepath.Join(home, s.file)
+	file, err := os.Open(path)
+	if err != nil {
+		return apiKey{}, fmt.Errorf(tr("未找到 %s 的凭证：设置环境变量 %s 和 %s，或创建 %s: %w", "no %s credentials: set %s and %s or create %s: %w"), s.vendor, s.idEnv, s.keyEnv, path, err)
+	}
+	defer file.Close()
+	var key apiKey
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case s.idKey:
+			key.id = strings.TrimSpace(value)
+		case s.keyKey:
+			key.secret = strings.TrimSpace(value)
+		case s.tokenKey:
+			key.token = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return apiKey{}, err
+	}
+	if key.id == "" || key.secret == "" {
+		return apiKey{}, fmt.Errorf(tr("%s 中的 [%s] 缺少 %s 或 %s", "%s: [%s] lacks %s or %s"), path, profile, s.idKey, s.keyKey)
+	}
+	return key, nil
+}
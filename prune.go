@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// prune：删除超过保留期的缓存日志和结果文件
+var pruneCommand = &cli.Command{
+	Name:  "prune",
+	Usage: tr("删除超过保留期的缓存日志（onlice-log 目录）和生成的结果文件", "delete cached logs (the onlice-log directory) and generated result files older than a retention period"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "older-than",
+			Required: true,
+			Usage:    tr("保留期，如 30d、12h；缓存日志按最近使用时间、结果文件按生成时间计算", "retention period such as 30d or 12h; cached logs are aged by last use, result files by when they were written"),
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: tr("只列出将被删除的文件，不删除", "only list the files that would be deleted"),
+		},
+	},
+	Action: runPrune,
+}
+
+func runPrune(c *cli.Context) error {
+	age, err := parseAge(c.String("older-than"))
+	if err != nil {
+		return fmt.Errorf(tr("--older-than 格式错误: %w", "invalid --older-than: %w"), err)
+	}
+	dryRun := c.Bool("dry-run")
+	cutoff := time.Now().Add(-age)
+
+	// 缓存日志按目录库记录的最近使用时间，结果文件按修改时间
+	candidates := cachedLogs()
+	for _, path := range resultFiles() {
+		if info, err := os.Stat(path); err == nil {
+			candidates = append(candidates, catalogEntry{file: path, localSize: info.Size(), lastUsed: info.ModTime()})
+		}
+	}
+
+	var rows [][]string
+	var freed int64
+	removed := make(map[string]bool)
+	for _, f := range candidates {
+		if !f.lastUsed.Before(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := removeLogFile(f.file); err != nil {
+				return err
+			}
+			removed[f.file] = true
+		}
+		rows = append(rows, []string{f.file, formatBytes(f.localSize), f.lastUsed.Local().Format(time.DateTime)})
+		freed += f.localSize
+	}
+	if len(removed) > 0 {
+		if err := pruneResultsIndex(removed, time.Time{}); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 更新结果索引 %s 失败: %v\n", "Warning: update result index %s: %v\n"), resultsIndexFile, err)
+		}
+	}
+	if len(rows) > 0 {
+		writeTable(os.Stdout, "", []string{"file", "size", "last used"}, rows, []bool{false, true, false})
+	}
+	if dryRun {
+		fmt.Printf(tr("预览: 将删除 %d 个文件，释放 %s（去掉 --dry-run 后执行）\n", "Dry run: %d files, %s would be deleted (run without --dry-run to delete)\n"), len(rows), formatBytes(freed))
+	} else {
+		fmt.Printf(tr("已删除 %d 个文件，释放 %s\n", "Deleted %d files, freed %s\n"), len(rows), formatBytes(freed))
+	}
+	return nil
+}
+
+// 当前目录中生成的结果文件，如 ip_search_results.txt、ip_search_results.json，以及 --encrypt-to 加密后的文件
+func resultFiles() []string {
+	var files []string
+	for _, name := range []string{resultsFile, jsonResultsFile} {
+		ext := filepath.Ext(name)
+		for _, suffix := range []string{"", ".age", ".gpg"} {
+			matches, _ := filepath.Glob(strings.TrimSuffix(name, ext) + "*" + ext + suffix)
+			files = append(files, matches...)
+		}
+	}
+	return files
+}
+
+// 解析保留期：支持 time.ParseDuration 的格式，以及以 d（天）、w（周）为单位的整数
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	var age time.Duration
+	if unit > 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return 0, fmt.Errorf(tr("无效的时长 %q", "invalid duration %q"), s)
+		}
+		age = time.Duration(n) * unit
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		age = d
+	}
+	if age <= 0 {
+		return 0, errors.New(tr("保留期必须大于0", "retention period must be positive"))
+	}
+	return age, nil
+}
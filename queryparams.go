@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze query：分析查询字符串，找出使缓存键数量膨胀的参数
+var queryCommand = &cli.Command{
+	Name:  "query",
+	Usage: tr("按URL统计不同查询字符串的组合数，按参数统计不同取值数，并估算缓存破坏参数（如时间戳）浪费的回源流量", "count distinct query string combinations per URL and distinct values per parameter, estimating the origin bytes wasted on cache-busting parameters such as timestamps"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+		&cli.Float64Flag{
+			Name:  "busting-ratio",
+			Value: 25,
+			Usage: tr("不同取值数至少为出现次数的该百分比的参数视为缓存破坏参数", "treat parameters whose distinct values are at least this percent of their occurrences as cache-busting"),
+		},
+	},
+	Action: runQueryReport,
+}
+
+// 本次分析按参数名的统计，未运行 analyze query 时为 nil
+var queryParams *queryParamStats
+
+// 统计的参数名个数上限，超过后新出现的参数名不再统计（如攻击请求中的随机参数名）
+const maxQueryParams = 1000
+
+type queryParamStats struct {
+	filter expr
+
+	mu     sync.Mutex
+	params map[string]*paramStats
+	// 因超过 maxQueryParams 而未统计的参数出现次数
+	dropped int64
+}
+
+// 一个参数的累计值
+type paramStats struct {
+	requests int64
+	values   distinctSet
+	paths    distinctSet
+	// 带该参数且未命中缓存的请求数和流量
+	misses, missBytes int64
+	// 未命中的请求去掉该参数后的不同URL：缓存键忽略该参数时，每个这样的URL只需回源一次
+	keys distinctSet
+}
+
+// 单次扫描的统计
+type queryParamState struct {
+	params  map[string]*paramStats
+	dropped int64
+}
+
+func runQueryReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	filter := `query != ""`
+	if f := c.String("filter"); f != "" {
+		filter += " && (" + f + ")"
+	}
+	urls, err := newGroupBy("query-urls", "host,path", "distinct(query),count,bytes,miss_bytes", filter)
+	if err != nil {
+		return err
+	}
+	queryParams = &queryParamStats{filter: urls.filter, params: make(map[string]*paramStats)}
+	bustingRatio := c.Float64("busting-ratio")
+	return runAggregates(c, []*groupBy{urls}, func(ctx context.Context) {
+		params, wasted := queryParams.aggregate(bustingRatio)
+		printAggregate(params)
+		if wasted > 0 {
+			fmt.Printf(tr("  缓存键忽略缓存破坏参数后估计可减少回源流量 %s\n", "  Ignoring the cache-busting parameters in the cache key could save an estimated %s of origin traffic\n"), formatBytes(wasted))
+		}
+		postAggregates = append(postAggregates, *params)
+	})
+}
+
+func (q *queryParamStats) newState() *queryParamState {
+	if q == nil {
+		return nil
+	}
+	return &queryParamState{params: make(map[string]*paramStats)}
+}
+
+// 统计一行日志的每个查询参数
+func (st *queryParamState) observe(rec *logRecord) {
+	if st == nil || !queryParams.filter.eval(rec).truthy() {
+		return
+	}
+	host, path, query := splitURL(rec.URL)
+	pairs := strings.Split(query, "&")
+	hit := cacheHit(rec)
+	for i, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		if name == "" {
+			continue
+		}
+		p := st.params[name]
+		if p == nil {
+			if len(st.params) >= maxQueryParams {
+				st.dropped++
+				continue
+			}
+			p = &paramStats{}
+			st.params[name] = p
+		}
+		p.requests++
+		p.values.add(value)
+		p.paths.add(host + path)
+		if hit {
+			continue
+		}
+		p.misses++
+		p.missBytes += rec.ResponseSize
+		rest := slices.Delete(slices.Clone(pairs), i, i+1)
+		p.keys.add(host + path + "?" + strings.Join(rest, "&"))
+	}
+}
+
+func (q *queryParamStats) merge(st *queryParamState) {
+	if q == nil || st == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dropped += st.dropped
+	for name, sp := range st.params {
+		p := q.params[name]
+		if p == nil {
+			if len(q.params) >= maxQueryParams {
+				q.dropped += sp.requests
+				continue
+			}
+			q.params[name] = sp
+			continue
+		}
+		p.requests += sp.requests
+		p.values.merge(&sp.values)
+		p.paths.merge(&sp.paths)
+		p.misses += sp.misses
+		p.missBytes += sp.missBytes
+		p.keys.merge(&sp.keys)
+	}
+}
+
+// 按参数的报表，按估算的浪费流量排序；同时返回缓存破坏参数浪费的流量之和
+func (q *queryParamStats) aggregate(bustingRatio float64) (*result.Aggregate, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	agg := &result.Aggregate{
+		Name:    "query-params",
+		By:      []string{"param", "cache_busting"},
+		Metrics: []string{"wasted_bytes", "count", "distinct(value)", "distinct(path)", "miss_bytes"},
+		Groups:  len(q.params),
+		Rows:    []result.AggregateRow{},
+	}
+	var total int64
+	for name, p := range q.params {
+		values := p.values.count()
+		busting, wasted := "no", int64(0)
+		if values >= float64(p.requests)*bustingRatio/100 && p.requests > 1 {
+			busting = "yes"
+			// 每个去掉该参数后的URL只需回源一次，其余未命中的流量（按平均大小）估算为浪费
+			if keys := p.keys.count(); keys < float64(p.misses) {
+				wasted = int64(float64(p.missBytes) * (1 - keys/float64(p.misses)))
+			}
+			total += wasted
+		}
+		agg.Approximate = agg.Approximate || p.values.approximate() || p.paths.approximate() || p.keys.approximate()
+		if !hiddenGroup(p.requests) {
+			agg.Rows = append(agg.Rows, result.AggregateRow{Keys: []string{name, busting}, Values: []float64{float64(wasted), float64(p.requests), values, p.paths.count(), float64(p.missBytes)}})
+		}
+	}
+	if q.dropped > 0 {
+		agg.Approximate = true
+	}
+	sortAggregate(agg)
+	limitAggregate(agg)
+	return agg, total
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 反向解析的参数
+var rdnsFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "rdns",
+		Usage: tr("反向解析（PTR）搜索IP、规则告警和报表中的IP，在终端、文本报告和JSON结果中附上域名", "reverse-resolve (PTR) the searched IPs and the IPs in findings and reports, showing hostnames in the terminal, text report and JSON results"),
+	},
+	&cli.IntFlag{
+		Name:  "rdns-limit",
+		Value: 200,
+		Usage: tr("最多反向解析的IP数，按告警和报表中的顺序选取", "maximum number of IPs to reverse-resolve, in the order they appear in findings and reports"),
+	},
+}
+
+// 反向解析配置
+var rdnsConfig struct {
+	enabled bool
+	limit   int
+}
+
+func loadRDNSConfig(c *cli.Context) error {
+	rdnsConfig.enabled = c.Bool("rdns")
+	rdnsConfig.limit = c.Int("rdns-limit")
+	hostnames.m = nil
+	if rdnsConfig.limit < 0 {
+		return errors.New(tr("--rdns-limit 不能为负数", "--rdns-limit must not be negative"))
+	}
+	return nil
+}
+
+// 反向解析的并发数和单次查询超时
+const (
+	rdnsWorkers = 16
+	rdnsTimeout = 5 * time.Second
+)
+
+// 爬虫IP的验证结果
+const (
+	verifiedYes   = "yes"
+	verifiedNo    = "no"
+	verifiedError = "error"
+)
+
+// PTR 查询结果的缓存，键为IP文本；同一次运行中爬虫验证和 --rdns 共用
+var ptrCache struct {
+	mu sync.Mutex
+	m  map[string][]string
+}
+
+// 反向解析IP，返回去掉末尾点的域名；没有PTR记录时返回空列表
+func lookupPTR(ctx context.Context, ip string) ([]string, error) {
+	ptrCache.mu.Lock()
+	names, ok := ptrCache.m[ip]
+	ptrCache.mu.Unlock()
+	if ok {
+		return names, nil
+	}
+	names, err := resolvePTR(ctx, ip)
+	// 解析失败（如超时）时不缓存，下次重新查询
+	if err == nil {
+		ptrCache.mu.Lock()
+		if ptrCache.m == nil {
+			ptrCache.m = make(map[string][]string)
+		}
+		ptrCache.m[ip] = names
+		ptrCache.mu.Unlock()
+	}
+	return names, err
+}
+
+func resolvePTR(ctx context.Context, ip string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, rdnsTimeout)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSuffix(name, ".")
+	}
+	return names, nil
+}
+
+// 验证IP的反向解析域名属于 domains，且该域名正向解析后包含同一IP（防止伪造PTR记录）
+func verifyHost(ctx context.Context, ip string, domains []string) (host, status string) {
+	names, err := lookupPTR(ctx, ip)
+	if err != nil {
+		return "", verifiedError
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(domains, func(d string) bool { return name == d || strings.HasSuffix(name, "."+d) }) {
+			continue
+		}
+		lctx, cancel := context.WithTimeout(ctx, rdnsTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(lctx, name)
+		cancel()
+		if err != nil {
+			return name, verifiedError
+		}
+		if slices.ContainsFunc(addrs, func(a string) bool { return sameIP(a, ip) }) {
+			return name, verifiedYes
+		}
+	}
+	if len(names) > 0 {
+		return names[0], verifiedNo
+	}
+	return "", verifiedNo
+}
+
+// 两个IP文本是否为同一地址（IPv6 可能有不同写法）
+func sameIP(a, b string) bool {
+	x, y := net.ParseIP(a), net.ParseIP(b)
+	return x != nil && x.Equal(y)
+}
+
+// 由 --rdns 解析得到的域名，键为IP文本；没有PTR记录或解析失败的IP不在其中
+var hostnames struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+// IP的反向解析域名，未解析或没有PTR记录时为空
+func hostnameOf(ip string) string {
+	hostnames.mu.Lock()
+	defer hostnames.mu.Unlock()
+	return hostnames.m[ip]
+}
+
+// 结果中的反向解析域名，未启用 --rdns 时为 nil
+func resolvedHostnames() map[string]string {
+	hostnames.mu.Lock()
+	defer hostnames.mu.Unlock()
+	if !rdnsConfig.enabled {
+		return nil
+	}
+	m := make(map[string]string, len(hostnames.m))
+	for ip, host := range hostnames.m {
+		m[ip] = host
+	}
+	return m
+}
+
+// 报表中出现的IP：搜索的IP、告警分组的 client_ip 和聚合报表的 client_ip 列，去重后保持顺序
+func reportIPs(findings []result.Finding, aggs []result.Aggregate) []string {
+	var ips []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		addr, err := netip.ParseAddr(s)
+		if err != nil || seen[addr.String()] {
+			return
+		}
+		seen[addr.String()] = true
+		ips = append(ips, addr.String())
+	}
+	for _, p := range splitPatterns(config.searchIP) {
+		add(p)
+	}
+	for _, f := range findings {
+		add(f.Group["client_ip"])
+	}
+	for _, agg := range aggs {
+		col := slices.Index(agg.By, "client_ip")
+		if col < 0 {
+			continue
+		}
+		for _, row := range agg.Rows {
+			add(row.Keys[col])
+		}
+	}
+	return ips
+}
+
+// 并发反向解析报表中的IP（最多 --rdns-limit 个），结果供 hostnameOf 使用
+func resolveReportIPs(ctx context.Context, findings []result.Finding, aggs []result.Aggregate) {
+	if !rdnsConfig.enabled {
+		return
+	}
+	ips := reportIPs(findings, aggs)
+	ips = ips[:min(len(ips), rdnsConfig.limit)]
+	if len(ips) == 0 {
+		return
+	}
+	ctx, span := startSpan(ctx, "rdns")
+	defer span.End()
+
+	var wg sync.WaitGroup
+	failed := 0
+	sem := make(chan struct{}, rdnsWorkers)
+	for _, ip := range ips {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			names, err := lookupPTR(ctx, ip)
+			hostnames.mu.Lock()
+			defer hostnames.mu.Unlock()
+			if err != nil {
+				failed++
+				return
+			}
+			if len(names) > 0 {
+				if hostnames.m == nil {
+					hostnames.m = make(map[string]string)
+				}
+				hostnames.m[ip] = names[0]
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Printf(tr("反向解析: %d 个IP，%d 个有PTR记录，%d 个解析失败\n", "Reverse DNS: %d IPs, %d with PTR records, %d failed\n"), len(ips), len(hostnames.m), failed)
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"example.com/mod/result"
+)
+
+// 结果文件格式
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// JSON格式的结果文件名
+const jsonResultsFile = "ip_search_results.json"
+
+// 当前结果格式对应的结果文件，指定 --output 时为渲染后的路径
+func resultsPath() string {
+	if config.output != "" {
+		return config.output
+	}
+	if config.format == formatJSON {
+		return jsonResultsFile
+	}
+	return resultsFile
+}
+
+// --output 路径模板中可用的字段，值中的路径分隔符等字符会替换为 _
+type outputPathData struct {
+	// 域名，多个域名时为逗号分隔的列表
+	Domain string
+	// 开始时间所在的日期（UTC），如 2025-05-15
+	Date string
+	// 开始和结束时间，如 20250515T000000Z
+	Start string
+	End   string
+	// 搜索的IP或网段
+	IP string
+	// 结果格式 text/json 和对应的扩展名 txt/json
+	Format string
+	Ext    string
+	// 运行时间（本地时间），如 20250515_103000，用于每次运行生成不同的文件
+	Time string
+}
+
+// 文件名中不能出现或不便使用的字符
+var unsafePathChars = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_", " ", "_", ",", "_")
+
+// 渲染 --output 路径模板；未指定时返回空字符串
+func renderOutputPath(text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf(tr("--output 模板错误: %w", "invalid --output template: %w"), err)
+	}
+	data := outputPathData{
+		Domain: config.domainName,
+		IP:     displaySearchIP(),
+		Format: config.format,
+		Ext:    "txt",
+		Time:   time.Now().Format("20060102_150405"),
+	}
+	if config.format == formatJSON {
+		data.Ext = "json"
+	}
+	if start, end, err := parseTimeRange(config.startTime, config.endTime); err == nil {
+		data.Date = start.UTC().Format(time.DateOnly)
+		data.Start = start.UTC().Format("20060102T150405Z")
+		data.End = end.UTC().Format("20060102T150405Z")
+	}
+	data.Domain = unsafePathChars.Replace(data.Domain)
+	data.IP = unsafePathChars.Replace(data.IP)
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf(tr("--output 模板错误: %w", "invalid --output template: %w"), err)
+	}
+	return filepath.Clean(b.String()), nil
+}
+
+// 按 result 包定义的格式写入JSON结果。files 和 timeline 逐行从命中行临时文件读取并写出，
+// 不在内存中生成完整的结果；其余字段按 result.Report 的字段顺序写出
+func writeJSONResults(writer *bufio.Writer, results map[string]*fileResult) error {
+	return writeJSONReport(writer, reportHeader(results), results, writeFileSection)
+}
+
+// 按 report 写出除命中行以外的部分，files 的每个元素由 fileSection 从 results 中逐行写出
+func writeJSONReport(writer *bufio.Writer, report result.Report, results map[string]*fileResult, fileSection func(w *bufio.Writer, file string, r *fileResult) error) error {
+	v := reflect.ValueOf(report)
+	writer.WriteString("{")
+	sep := ""
+	for i := range v.NumField() {
+		name, opts, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		field := v.Field(i)
+		switch {
+		case name == "timeline":
+			// 逐行写出前不知道是否为空，按命中数判断
+			if !config.mergeByTime || totalMatches(results) == 0 {
+				continue
+			}
+		case opts == "omitempty" && emptyJSONValue(field):
+			continue
+		}
+		fmt.Fprintf(writer, "%s\n  %q: ", sep, name)
+		sep = ","
+		var err error
+		switch name {
+		case "files":
+			files := &jsonArrayWriter{w: writer, indent: "    "}
+			for _, file := range sortedFiles(results) {
+				files.next()
+				if err = fileSection(writer, file, results[file]); err != nil {
+					return err
+				}
+			}
+			err = files.close()
+		case "timeline":
+			timeline := &jsonArrayWriter{w: writer, indent: "    "}
+			err = mergedMatches(results, func(file, line string, _ time.Time) error {
+				return timeline.add(timelineMatch(file, line))
+			})
+			if err == nil {
+				err = timeline.close()
+			}
+		default:
+			var data []byte
+			if data, err = json.MarshalIndent(field.Interface(), "  ", "  "); err == nil {
+				_, err = writer.Write(data)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := writer.WriteString("\n}\n")
+	return err
+}
+
+// 逐个写出JSON数组的元素，indent 为元素的缩进，格式与 json.MarshalIndent 一致
+type jsonArrayWriter struct {
+	w      *bufio.Writer
+	indent string
+	n      int
+}
+
+// 开始下一个元素，之后由调用方写出元素内容
+func (a *jsonArrayWriter) next() {
+	if a.n == 0 {
+		a.w.WriteString("[")
+	} else {
+		a.w.WriteString(",")
+	}
+	a.n++
+	a.w.WriteString("\n" + a.indent)
+}
+
+func (a *jsonArrayWriter) add(v any) error {
+	data, err := json.MarshalIndent(v, a.indent, "  ")
+	if err != nil {
+		return err
+	}
+	a.next()
+	_, err = a.w.Write(data)
+	return err
+}
+
+func (a *jsonArrayWriter) close() error {
+	if a.n == 0 {
+		_, err := a.w.WriteString("[]")
+		return err
+	}
+	_, err := a.w.WriteString("\n" + strings.TrimSuffix(a.indent, "  ") + "]")
+	return err
+}
+
+// 写出一个文件的结果，命中行（result.File 的最后一个字段）逐行读取并写出，单个文件的命中行再多也不占用内存
+func writeJSONFile(writer *bufio.Writer, file string, r *fileResult) error {
+	data, err := json.MarshalIndent(result.File{
+		Name:       filepath.Base(file),
+		Account:    fileAccount(file),
+		MatchCount: r.matches,
+		Truncated:  r.truncated,
+	}, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	// 只统计或命中行已用于按时间合并时没有保留的命中行，与 omitempty 一致不写出 matches
+	if r.store == nil {
+		_, err = writer.Write(data)
+		return err
+	}
+	end := []byte("\n    }")
+	writer.Write(bytes.TrimSuffix(data, end))
+	writer.WriteString(",\n      \"matches\": ")
+	matches := &jsonArrayWriter{w: writer, indent: "        "}
+	if err := r.eachMatch(func(line string) error { return matches.add(resultMatch(line)) }); err != nil {
+		return err
+	}
+	if err := matches.close(); err != nil {
+		return err
+	}
+	_, err = writer.Write(end)
+	return err
+}
+
+// 与 encoding/json 的 omitempty 一致：空的切片、映射和 nil 指针不输出
+func emptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// 完整的结果，包含全部命中行，用于网页控制台等需要整个结果的场景
+func buildReport(results map[string]*fileResult) (result.Report, error) {
+	report := reportHeader(results)
+	for _, file := range sortedFiles(results) {
+		f, err := reportFile(file, results[file])
+		if err != nil {
+			return report, err
+		}
+		report.Files = append(report.Files, f)
+	}
+	if config.mergeByTime {
+		err := mergedMatches(results, func(file, line string, _ time.Time) error {
+			report.Timeline = append(report.Timeline, timelineMatch(file, line))
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// 除命中行以外的结果
+func reportHeader(results map[string]*fileResult) result.Report {
+	report := result.Report{
+		SchemaVersion: result.SchemaVersion,
+		Tool:          "cdn-log-analyzer",
+		GeneratedAt:   time.Now(),
+		Query: result.Query{
+			Domain:          config.domainName,
+			StartTime:       config.startTime,
+			EndTime:         config.endTime,
+			Accounts:        accountsResult(),
+			Patterns:        anonymizePatterns(splitPatterns(config.searchIP)),
+			Anonymize:       anonymizeConfig.mode,
+			IPFile:          config.ipFile,
+			Keywords:        config.keywords,
+			Regexps:         config.regexps,
+			IgnoreCase:      config.ignoreCase,
+			SampleScale:     lineSampler.scale(),
+			MaxMatches:      config.maxMatches,
+			MaxTotalMatches: config.maxTotalMatches,
+		},
+		Summary: result.Summary{
+			FilesMatched: len(results),
+			TotalMatches: totalMatches(results),
+			Truncated:    resultsTruncated(results),
+			CountOnly:    config.countOnly,
+			SummaryOnly:  config.summaryOnly,
+		},
+		Files:            []result.File{},
+		Stats:            runStats.report(),
+		Findings:         ruleSet.findings(),
+		Alerts:           ruleSet.alerts(),
+		CrossCheck:       crossCheckResult,
+		Aggregates:       aggregates(),
+		Hostnames:        resolvedHostnames(),
+		MissingLogDays:   missingLogDaysResult(),
+		RequestTimelines: ipTimeline.result(),
+		Heatmap:          heatmapResult(),
+		WeekComparison:   weekComparison,
+		TypeTimeline:     typeTimelineResult(),
+		Run:              runStats.metadata(),
+	}
+	if lineSampler != nil {
+		report.Query.Sample = lineSampler.spec
+	}
+
+	return report
+}
+
+// 单个文件的结果及其命中行
+func reportFile(file string, r *fileResult) (result.File, error) {
+	f := result.File{
+		Name:       filepath.Base(file),
+		Account:    fileAccount(file),
+		MatchCount: r.matches,
+		Truncated:  r.truncated,
+	}
+	err := r.eachMatch(func(line string) error {
+		f.Matches = append(f.Matches, resultMatch(line))
+		return nil
+	})
+	return f, err
+}
+
+func resultMatch(line string) result.Match {
+	m := result.Match{Line: normalizeLineTime(line)}
+	var rec logRecord
+	if parseLogLine(line, &rec) == nil {
+		m.Record = rec.toResult()
+	}
+	return m
+}
+
+func timelineMatch(file, line string) result.TimelineMatch {
+	return result.TimelineMatch{File: filepath.Base(file), Match: resultMatch(line)}
+}
+
+// 转换为结果格式中的日志字段
+func (r *logRecord) toResult() *result.Record {
+	return &result.Record{
+		Time:         normalizeTime(r.Time),
+		ClientIP:     r.ClientIP,
+		ProxyIP:      r.ProxyIP,
+		ResponseTime: r.ResponseTime,
+		Referer:      r.Referer,
+		Method:       r.Method,
+		URL:          r.URL,
+		Status:       r.Status,
+		RequestSize:  r.RequestSize,
+		ResponseSize: r.ResponseSize,
+		HitInfo:      r.HitInfo,
+		UserAgent:    r.UserAgent,
+		ContentType:  r.ContentType,
+		Fields:       r.derivedValues(),
+	}
+}
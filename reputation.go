@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// IP信誉查询的参数
+var reputationFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "abuseipdb-key",
+		EnvVars: []string{"ABUSEIPDB_API_KEY"},
+		Usage:   tr("AbuseIPDB API Key，设置后查询规则告警中请求最多的IP的恶意置信度和被举报次数", "AbuseIPDB API key; when set, the top IPs of rule findings are checked for abuse confidence and report counts"),
+	},
+	&cli.StringSliceFlag{
+		Name:  "reputation-list",
+		Usage: tr("本地IP信誉列表，每行 IP[,分数[,举报次数]]，分数为0-100（默认100），可多次指定", "local IP reputation list with lines of IP[,score[,reports]], score 0-100 (default 100); may be repeated"),
+	},
+	&cli.IntFlag{
+		Name:  "reputation-top",
+		Value: 20,
+		Usage: tr("通过 AbuseIPDB 查询的IP数上限，按告警级别从高到低选取", "maximum number of IPs checked with AbuseIPDB, taken in order of finding severity"),
+	},
+}
+
+// AbuseIPDB 接口地址、请求间隔和缓存有效期
+const (
+	abuseIPDBURL      = "https://api.abuseipdb.com/api/v2/check"
+	abuseIPDBInterval = 200 * time.Millisecond
+	// 服务端要求等待更久时不再重试，剩余的IP留到下次运行
+	abuseIPDBMaxWait   = time.Minute
+	reputationCacheTTL = 24 * time.Hour
+)
+
+// IP信誉查询配置
+var reputationConfig struct {
+	apiKey string
+	lists  []string
+	top    int
+}
+
+// 已查询到的信誉，键为规范化的IP文本；findings() 据此填充 Finding.Reputation
+var reputations struct {
+	mu sync.Mutex
+	m  map[string][]result.Reputation
+}
+
+func loadReputationConfig(c *cli.Context) error {
+	reputationConfig.apiKey = c.String("abuseipdb-key")
+	reputationConfig.lists = c.StringSlice("reputation-list")
+	reputationConfig.top = c.Int("reputation-top")
+	reputations.m = nil
+	if reputationConfig.top < 0 {
+		return errors.New(tr("--reputation-top 不能为负数", "--reputation-top must not be negative"))
+	}
+	return nil
+}
+
+func reputationEnabled() bool {
+	return reputationConfig.apiKey != "" || len(reputationConfig.lists) > 0
+}
+
+// IP的信誉查询结果，未查询过时为 nil
+func reputationOf(ip string) []result.Reputation {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	reputations.mu.Lock()
+	defer reputations.mu.Unlock()
+	return reputations.m[addr.Unmap().String()]
+}
+
+func addReputation(addr netip.Addr, rep result.Reputation) {
+	reputations.mu.Lock()
+	defer reputations.mu.Unlock()
+	if reputations.m == nil {
+		reputations.m = make(map[string][]result.Reputation)
+	}
+	key := addr.Unmap().String()
+	reputations.m[key] = append(reputations.m[key], rep)
+}
+
+// 查询规则告警中 client_ip 的信誉：本地列表匹配全部IP，AbuseIPDB 只查询前 --reputation-top 个
+func enrichReputation(ctx context.Context, findings []result.Finding) error {
+	ips := rankOffenders(findings)
+	if len(ips) == 0 {
+		return nil
+	}
+	seen := make(map[netip.Addr]bool, len(ips))
+	for _, addr := range ips {
+		seen[addr] = true
+	}
+
+	for _, path := range reputationConfig.lists {
+		if err := matchReputationList(path, seen); err != nil {
+			return fmt.Errorf(tr("读取信誉列表 %s 失败: %w", "read reputation list %s: %w"), path, err)
+		}
+	}
+	if reputationConfig.apiKey != "" {
+		return checkAbuseIPDB(ctx, ips[:min(len(ips), reputationConfig.top)])
+	}
+	return nil
+}
+
+// 告警中的 client_ip，按最高告警级别、告警条数从多到少排序
+func rankOffenders(findings []result.Finding) []netip.Addr {
+	type offender struct {
+		level, findings int
+	}
+	byAddr := make(map[netip.Addr]*offender)
+	var ips []netip.Addr
+	for _, f := range findings {
+		addr, err := netip.ParseAddr(f.Group["client_ip"])
+		if err != nil {
+			continue
+		}
+		addr = addr.Unmap()
+		o := byAddr[addr]
+		if o == nil {
+			o = &offender{}
+			byAddr[addr] = o
+			ips = append(ips, addr)
+		}
+		o.level = max(o.level, slices.Index(severities, f.Severity))
+		o.findings++
+	}
+	slices.SortStableFunc(ips, func(a, b netip.Addr) int {
+		if c := byAddr[b].level - byAddr[a].level; c != 0 {
+			return c
+		}
+		return byAddr[b].findings - byAddr[a].findings
+	})
+	return ips
+}
+
+// 读取本地信誉列表，记录其中出现在 ips 中的IP
+func matchReputationList(path string, ips map[netip.Addr]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		addr, err := netip.ParseAddr(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return fmt.Errorf(tr("第 %d 行: 无效的IP %q", "line %d: invalid IP %q"), n, fields[0])
+		}
+		if !ips[addr.Unmap()] {
+			continue
+		}
+		rep := result.Reputation{Source: filepath.Base(path), Score: 100, CheckedAt: info.ModTime()}
+		for i, p := range []*int{&rep.Score, &rep.Reports} {
+			if len(fields) <= i+1 {
+				break
+			}
+			if *p, err = strconv.Atoi(strings.TrimSpace(fields[i+1])); err != nil {
+				return fmt.Errorf(tr("第 %d 行: 无效的数字 %q", "line %d: invalid number %q"), n, fields[i+1])
+			}
+		}
+		addReputation(addr, rep)
+	}
+	return scanner.Err()
+}
+
+// 用户缓存目录中的 AbuseIPDB 查询缓存
+func reputationCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdn-log-analyzer", "abuseipdb.json"), nil
+}
+
+// 读取 AbuseIPDB 查询缓存，键为IP，丢弃超过有效期的项
+func loadReputationCache(path string) map[string]result.Reputation {
+	cache := make(map[string]result.Reputation)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	// 缓存损坏时当作空缓存，下次保存时覆盖
+	if json.Unmarshal(data, &cache) != nil {
+		return make(map[string]result.Reputation)
+	}
+	for ip, rep := range cache {
+		if time.Since(rep.CheckedAt) > reputationCacheTTL {
+			delete(cache, ip)
+		}
+	}
+	return cache
+}
+
+func saveReputationCache(path string, cache map[string]result.Reputation) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// 逐个查询 AbuseIPDB，缓存有效期内的IP不再查询；达到调用上限时停止并给出警告
+func checkAbuseIPDB(ctx context.Context, ips []netip.Addr) error {
+	path, err := reputationCachePath()
+	if err != nil {
+		return err
+	}
+	cache := loadReputationCache(path)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	queried, cached := 0, 0
+	var queryErr error
+	for _, addr := range ips {
+		if rep, ok := cache[addr.String()]; ok {
+			addReputation(addr, rep)
+			cached++
+			continue
+		}
+		if queried > 0 {
+			time.Sleep(abuseIPDBInterval)
+		}
+		rep, err := queryAbuseIPDB(ctx, client, addr)
+		var limited *rateLimitError
+		if errors.As(err, &limited) {
+			fmt.Fprintf(os.Stderr, tr("警告: %v，剩余 %d 个IP未查询\n", "Warning: %v, %d IPs left unchecked\n"), err, len(ips)-queried-cached)
+			break
+		}
+		if err != nil {
+			queryErr = err
+			break
+		}
+		queried++
+		cache[addr.String()] = rep
+		addReputation(addr, rep)
+	}
+	fmt.Printf(tr("AbuseIPDB: 查询 %d 个IP，%d 个来自缓存\n", "AbuseIPDB: %d IPs checked, %d from cache\n"), queried, cached)
+	// 出错前已查询的结果同样写入缓存
+	if queried > 0 {
+		if err := saveReputationCache(path, cache); err != nil {
+			return err
+		}
+	}
+	return queryErr
+}
+
+// AbuseIPDB 返回 429 且要求等待超过 abuseIPDBMaxWait
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf(tr("已达到 AbuseIPDB 调用上限，需等待 %s", "AbuseIPDB rate limit reached, retry after %s"), e.retryAfter)
+}
+
+// 查询一个IP；收到 429 时按 Retry-After 等待后重试一次
+func queryAbuseIPDB(ctx context.Context, client *http.Client, addr netip.Addr) (result.Reputation, error) {
+	for attempt := 0; ; attempt++ {
+		rep, retryAfter, err := doAbuseIPDBRequest(ctx, client, addr)
+		if retryAfter == 0 {
+			return rep, err
+		}
+		if attempt > 0 || retryAfter > abuseIPDBMaxWait {
+			return rep, &rateLimitError{retryAfter: retryAfter}
+		}
+		select {
+		case <-ctx.Done():
+			return rep, ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// 发送一次查询请求，被限流时返回需要等待的时间
+func doAbuseIPDBRequest(ctx context.Context, client *http.Client, addr netip.Addr) (result.Reputation, time.Duration, error) {
+	rep := result.Reputation{Source: "abuseipdb"}
+	query := url.Values{"ipAddress": {addr.String()}, "maxAgeInDays": {"90"}}
+	req, err := http.NewRequestWithContext(ctx, "GET", abuseIPDBURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return rep, 0, err
+	}
+	req.Header.Set("Key", reputationConfig.apiKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return rep, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil || seconds <= 0 {
+			seconds = int(abuseIPDBMaxWait/time.Second) + 1
+		}
+		return rep, time.Duration(seconds) * time.Second, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return rep, 0, fmt.Errorf(tr("AbuseIPDB 查询 %s 失败: %s", "AbuseIPDB check of %s failed: %s"), addr, resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			AbuseConfidenceScore int        `json:"abuseConfidenceScore"`
+			TotalReports         int        `json:"totalReports"`
+			CountryCode          string     `json:"countryCode"`
+			ISP                  string     `json:"isp"`
+			LastReportedAt       *time.Time `json:"lastReportedAt"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return rep, 0, fmt.Errorf(tr("解析 AbuseIPDB 响应失败: %w", "decode AbuseIPDB response: %w"), err)
+	}
+	d := body.Data
+	rep.Score, rep.Reports = d.AbuseConfidenceScore, d.TotalReports
+	rep.CountryCode, rep.ISP, rep.LastReport = d.CountryCode, d.ISP, d.LastReportedAt
+	rep.CheckedAt = time.Now()
+	return rep, 0, nil
+}
+
+// 信誉的文本形式，如 abuseipdb 95% 123次举报 CN
+func formatReputation(rep result.Reputation) string {
+	s := fmt.Sprintf(tr("%s %d%% %d次举报", "%s %d%% %d reports"), rep.Source, rep.Score, rep.Reports)
+	if rep.CountryCode != "" {
+		s += " " + rep.CountryCode
+	}
+	return s
+}
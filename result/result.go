@@ -0,0 +1,389 @@
+// Package result 定义 cdn-log-analyzer 的 JSON 结果格式（--format json）。
+//
+// 下游程序可以直接导入本包反序列化结果文件。格式的兼容性约定：
+//   - 新增字段只增加 SchemaVersion 的次版本号（如 1.0 -> 1.1），已有字段的名称和含义不变；
+//   - 删除、重命名字段或改变含义时增加主版本号（如 1.x -> 2.0）。
+//
+// 消费方应检查 SchemaVersion 的主版本号，并忽略不认识的字段。
+package result
+
+import "time"
+
+// SchemaVersion 为当前结果格式的版本号
+const SchemaVersion = "1.23"
+
+// Report 为一次分析的完整结果
+type Report struct {
+	// 结果格式版本，见 SchemaVersion
+	SchemaVersion string `json:"schema_version"`
+	// 生成结果的工具名
+	Tool string `json:"tool"`
+	// 结果生成时间
+	GeneratedAt time.Time `json:"generated_at"`
+	// 本次分析的查询条件
+	Query Query `json:"query"`
+	// 汇总信息
+	Summary Summary `json:"summary"`
+	// 有命中的文件，按文件名排序
+	Files []File `json:"files"`
+	// 处理统计
+	Stats Stats `json:"stats"`
+	// 检测规则（--rules）的告警，按级别从高到低排序。1.1 起新增
+	Findings []Finding `json:"findings,omitempty"`
+	// 整体指标告警（规则文件的 alerts），按级别从高到低排序。1.2 起新增
+	Alerts []Alert `json:"alerts,omitempty"`
+	// 日志统计与CDN监控数据的对比（--cross-check）。1.3 起新增
+	CrossCheck *CrossCheck `json:"cross_check,omitempty"`
+	// 聚合报表（如 analyze groupby）。1.6 起新增
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+	// 反向解析（--rdns）得到的域名，键为IP；没有PTR记录的IP不列出。1.9 起新增
+	Hostnames map[string]string `json:"hostnames,omitempty"`
+	// 按请求时间合并的全部命中行（--merge-by-time，此时 File.Matches 为空）。1.14 起新增
+	Timeline []TimelineMatch `json:"timeline,omitempty"`
+	// 通过API查询日志列表时没有任何日志文件的日期（UTC），按域名和日期排列。1.16 起新增
+	MissingLogDays []MissingLogDay `json:"missing_log_days,omitempty"`
+	// 运行信息，用于自动化检查本次运行是否完整。1.17 起新增
+	Run RunMetadata `json:"run"`
+	// 每个搜索IP的命中请求数按时间段的计数（--ip-timeline），只列出有命中的IP。1.20 起新增
+	RequestTimelines []RequestTimeline `json:"request_timelines,omitempty"`
+	// 全部日志按星期和小时统计的请求数和流量（--heatmap）。1.21 起新增
+	Heatmap *Heatmap `json:"heatmap,omitempty"`
+	// 与一周前同一时间范围的对比（--compare-week）。1.22 起新增
+	WeekComparison *WeekComparison `json:"week_comparison,omitempty"`
+	// 全部日志按时间段和资源类型统计的流量（--type-timeline）。1.23 起新增
+	TypeTimeline *TypeTimeline `json:"type_timeline,omitempty"`
+}
+
+// TypeTimeline 为按时间段和资源类型统计的流量，采样时为采样值
+type TypeTimeline struct {
+	// 时间段长度，秒
+	IntervalSeconds int64 `json:"interval_seconds"`
+	// 时间范围内每个时间段的开始时间，包括没有日志的时间段
+	Times []time.Time `json:"times"`
+	// 每种资源类型的流量，按总流量从多到少排序
+	Series []TypeSeries `json:"series"`
+}
+
+// TypeSeries 为一种资源类型的流量
+type TypeSeries struct {
+	// 资源类型：image、video、audio、script、font、document、api、download 或 other
+	Type       string `json:"type"`
+	TotalBytes int64  `json:"total_bytes"`
+	// 每个时间段的字节数，与 Times 一一对应
+	Bytes []int64 `json:"bytes"`
+}
+
+// WeekComparison 为本次时间范围与一周前同一时间范围的按域名对比
+type WeekComparison struct {
+	// 一周前的时间范围
+	PreviousStart time.Time `json:"previous_start"`
+	PreviousEnd   time.Time `json:"previous_end"`
+	// 两个时间范围中出现过的域名（URL中的主机名），按名称排序
+	Domains []DomainComparison `json:"domains"`
+}
+
+// DomainComparison 为一个域名各项指标的对比
+type DomainComparison struct {
+	Domain  string             `json:"domain"`
+	Metrics []MetricComparison `json:"metrics"`
+}
+
+// MetricComparison 为一项指标的对比
+type MetricComparison struct {
+	// 指标：requests、bytes、unique_ips、4xx_rate、5xx_rate、hit_rate（百分比）、avg_response_time（毫秒）
+	Name     string  `json:"name"`
+	Current  float64 `json:"current"`
+	Previous float64 `json:"previous"`
+	// 变化的百分比 (current/previous - 1) * 100，一周前为 0 时为空
+	Change *float64 `json:"change_percent,omitempty"`
+}
+
+// Heatmap 为按星期和小时统计的请求数和流量，采样时为采样值
+type Heatmap struct {
+	// 统计使用的时区，如 +0800、Asia/Shanghai
+	TimeZone string `json:"time_zone"`
+	// 下标为 [星期][小时]，星期 0 为周一、6 为周日，小时为 0-23
+	Requests [][]int64 `json:"requests"`
+	Bytes    [][]int64 `json:"bytes"`
+}
+
+// RequestTimeline 为一个搜索IP的请求时间线
+type RequestTimeline struct {
+	IP string `json:"ip"`
+	// 时间段长度，秒
+	IntervalSeconds int64 `json:"interval_seconds"`
+	// 命中请求总数，以及请求最多的时间段的开始时间和请求数
+	Requests     int64     `json:"requests"`
+	PeakTime     time.Time `json:"peak_time"`
+	PeakRequests int64     `json:"peak_requests"`
+	// 有请求的时间段，按时间排序；没有请求的时间段不列出
+	Points []TimelinePoint `json:"points"`
+}
+
+// TimelinePoint 为时间线中的一个时间段
+type TimelinePoint struct {
+	// 时间段的开始时间
+	Time     time.Time `json:"time"`
+	Requests int64     `json:"requests"`
+}
+
+// MissingLogDay 为没有日志文件的一天
+type MissingLogDay struct {
+	Domain string `json:"domain"`
+	// 日期（UTC），如 2025-05-15
+	Date string `json:"date"`
+	// 原因：expired 超出离线日志的保留期，pending 当天尚未结束，empty 保留期内没有日志
+	Reason string `json:"reason"`
+}
+
+// Query 为本次分析的查询条件
+type Query struct {
+	// 单账号时的域名；多账号（--accounts）时见 Accounts
+	Domain string `json:"domain"`
+	// 多账号时的账号及其域名。1.12 起新增
+	Accounts  []Account `json:"accounts,omitempty"`
+	StartTime string    `json:"start_time"`
+	EndTime   string    `json:"end_time"`
+	// 搜索的模式（IP等）
+	Patterns []string `json:"patterns"`
+	// --ip-file 指定的IP列表文件，各条目的命中数见 suspects 聚合报表。1.10 起新增
+	IPFile string `json:"ip_file,omitempty"`
+	// --keyword 的关键字和 --pattern 的正则表达式。1.11 起新增
+	Keywords   []string `json:"keywords,omitempty"`
+	Regexps    []string `json:"regexps,omitempty"`
+	IgnoreCase bool     `json:"ignore_case"`
+	// 采样参数，如 "1/100"；为空表示未采样
+	Sample string `json:"sample,omitempty"`
+	// 采样时的放大倍数，未采样时为 1
+	SampleScale float64 `json:"sample_scale"`
+	// 单文件与全局命中数上限，0 表示不限制
+	MaxMatches      int `json:"max_matches"`
+	MaxTotalMatches int `json:"max_total_matches"`
+	// 客户端IP和代理IP的匿名化方式（--anonymize-ip）：mask 或 hmac，为空表示未匿名化；
+	// 此时 Patterns 及全部命中行、记录和报表中的IP均为匿名化后的值。1.15 起新增
+	Anonymize string `json:"anonymize,omitempty"`
+}
+
+// Account 为多账号分析中的一个阿里云账号
+type Account struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"`
+}
+
+// Summary 为汇总信息
+type Summary struct {
+	// 有命中的文件数
+	FilesMatched int `json:"files_matched"`
+	// 总命中行数（采样时为采样值）
+	TotalMatches int `json:"total_matches"`
+	// 是否因命中数上限被截断
+	Truncated bool `json:"truncated"`
+	// 是否为仅统计模式（此时 File.Matches 为空）
+	CountOnly bool `json:"count_only"`
+	// 是否为仅汇总模式（--summary-only，此时 File.Matches 为空）。1.13 起新增
+	SummaryOnly bool `json:"summary_only,omitempty"`
+}
+
+// File 为单个日志文件的命中结果
+type File struct {
+	// 日志文件名
+	Name string `json:"name"`
+	// 多账号时日志所属的账号名。1.12 起新增
+	Account string `json:"account,omitempty"`
+	// 命中行数
+	MatchCount int  `json:"match_count"`
+	Truncated  bool `json:"truncated"`
+	// 命中行，仅统计模式下为空
+	Matches []Match `json:"matches,omitempty"`
+}
+
+// Match 为一条命中的日志
+type Match struct {
+	// 原始日志行
+	Line string `json:"line"`
+	// 解析后的字段，日志格式无法识别时为空
+	Record *Record `json:"record,omitempty"`
+}
+
+// TimelineMatch 为按时间合并输出的一条命中日志
+type TimelineMatch struct {
+	// 所在的日志文件名
+	File string `json:"file"`
+	Match
+}
+
+// Record 为解析后的阿里云CDN日志字段
+type Record struct {
+	Time     time.Time `json:"time"`
+	ClientIP string    `json:"client_ip"`
+	ProxyIP  string    `json:"proxy_ip"`
+	// 响应时间，毫秒
+	ResponseTime int    `json:"response_time_ms"`
+	Referer      string `json:"referer"`
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	Status       int    `json:"status"`
+	RequestSize  int64  `json:"request_size"`
+	ResponseSize int64  `json:"response_size"`
+	// 缓存命中信息，HIT/MISS
+	HitInfo     string `json:"hit_info"`
+	UserAgent   string `json:"user_agent"`
+	ContentType string `json:"content_type"`
+	// 派生字段（--field 或规则文件的 fields）的取值。1.5 起新增
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Finding 为一条规则告警：某个分组在某个时间窗口内的聚合值超过了阈值
+type Finding struct {
+	// 规则名称及说明
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	// 告警级别：info、low、medium、high、critical
+	Severity string `json:"severity"`
+	// 分组字段及其取值，如 {"client_ip": "1.2.3.4"}；整体统计时为空
+	Group map[string]string `json:"group,omitempty"`
+	// 统计窗口 [WindowStart, WindowEnd)，规则未设置窗口时为空
+	WindowStart *time.Time `json:"window_start,omitempty"`
+	WindowEnd   *time.Time `json:"window_end,omitempty"`
+	// 聚合方式（如 count、sum(response_size)）、聚合值和阈值
+	Aggregate string  `json:"aggregate"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	// 规则按 client_ip 分组时，该分组在窗口内请求的不同URL数，超过 256 个后为估算值（此时
+	// DistinctURLsApproximate 为 true）。1.19 起新增
+	DistinctURLs            int64 `json:"distinct_urls,omitempty"`
+	DistinctURLsApproximate bool  `json:"distinct_urls_approximate,omitempty"`
+	// Group 中 client_ip 的信誉查询结果，每个来源一项。1.8 起新增
+	Reputation []Reputation `json:"reputation,omitempty"`
+}
+
+// Reputation 为一个来源对IP的信誉评价
+type Reputation struct {
+	// 来源：abuseipdb 或本地信誉列表的文件名
+	Source string `json:"source"`
+	// 恶意置信度，0-100
+	Score int `json:"score"`
+	// 被举报次数，来源未提供时为 0
+	Reports     int        `json:"reports"`
+	CountryCode string     `json:"country_code,omitempty"`
+	ISP         string     `json:"isp,omitempty"`
+	LastReport  *time.Time `json:"last_reported_at,omitempty"`
+	// 查询时间，来自缓存时早于本次分析
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Alert 为一条整体指标告警：整个时间范围的指标（如5xx比例、带宽）超过了阈值
+type Alert struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Severity    string `json:"severity"`
+	// 指标（如 rate(status >= 500)、bandwidth）、整体取值和阈值
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	// 明细的时间粒度，如 5m0s
+	Interval string `json:"interval"`
+	// 指标超过阈值的时间段，按时间排序
+	Intervals []Interval `json:"intervals"`
+}
+
+// Interval 为指标在一个时间段内的取值
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// 该时间段内参与统计的日志行数
+	Lines int64   `json:"lines"`
+	Value float64 `json:"value"`
+}
+
+// Aggregate 为一个聚合报表：按 By 中的字段分组后的各项指标
+type Aggregate struct {
+	// 报表名，如 groupby
+	Name string `json:"name"`
+	// 分组字段和指标名，与每行的 Keys、Values 一一对应
+	By      []string `json:"by"`
+	Metrics []string `json:"metrics"`
+	// 分组总数，Rows 可能因 MinCount 和 Top 少于该值；近似统计时为保留的分组数
+	Groups int `json:"groups"`
+	// 是否为近似统计：分组数超过 --max-groups 时只保留出现最多的分组，distinct 取值很多时为估算值。1.18 起新增
+	Approximate bool `json:"approximate,omitempty"`
+	// 近似统计时各分组的行数（count、share，以及 bytes、sum 等累加值对应的行）最多少计的行数；0 表示计数精确。1.18 起新增
+	ErrorBound int64 `json:"error_bound,omitempty"`
+	// 生成报表时的 --top 和 --min-count，0 表示不限制。1.7 起新增
+	Top      int            `json:"top,omitempty"`
+	MinCount int            `json:"min_count,omitempty"`
+	Rows     []AggregateRow `json:"rows"`
+}
+
+// AggregateRow 为聚合报表中的一个分组
+type AggregateRow struct {
+	Keys   []string  `json:"keys"`
+	Values []float64 `json:"values"`
+}
+
+// CrossCheck 为按时间段对比日志统计值与CDN监控API返回值的结果，
+// 日志明显偏少的时间段通常意味着日志文件缺失或投递延迟
+type CrossCheck struct {
+	// 对比的时间粒度，如 5m0s
+	Interval string `json:"interval"`
+	// 允许的相对偏差，|日志/API - 1| 超过该值的时间段被标记
+	Tolerance float64 `json:"tolerance"`
+	// 带宽对比（DescribeDomainBpsData），单位 bit/s
+	Bandwidth *Comparison `json:"bandwidth,omitempty"`
+	// 每秒请求数对比（DescribeDomainQpsData）。1.4 起新增
+	Requests *Comparison `json:"requests,omitempty"`
+}
+
+// Comparison 为一项指标的逐时间段对比
+type Comparison struct {
+	// 数据来源的API
+	Source string `json:"source"`
+	// 被标记的时间段数
+	Flagged   int                  `json:"flagged"`
+	Intervals []ComparisonInterval `json:"intervals"`
+}
+
+// ComparisonInterval 为一个时间段的对比
+type ComparisonInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// API返回值与由日志计算的值（采样时已按比例放大）
+	API float64 `json:"api"`
+	Log float64 `json:"log"`
+	// 日志/API，API 为 0 时为空
+	Ratio   *float64 `json:"ratio,omitempty"`
+	Flagged bool     `json:"flagged"`
+}
+
+// RunMetadata 为本次运行各阶段的计数和耗时
+type RunMetadata struct {
+	// 列出的日志文件数（API、--urls-file 或 OSS）
+	FilesListed int64 `json:"files_listed"`
+	// 本地缓存中已有、无需下载的文件数
+	FilesCached int64 `json:"files_cached"`
+	// 本次下载的文件数（包括损坏后重新下载的文件）
+	FilesDownloaded int64 `json:"files_downloaded"`
+	// 下载失败的文件数
+	FilesFailed int64 `json:"files_failed"`
+	// 本次下载的字节数
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	FilesScanned    int64 `json:"files_scanned"`
+	LinesScanned    int64 `json:"lines_scanned"`
+	// 解析的行数；只有检测规则、统计、导出等需要处理全部日志行时才会解析，否则为 0
+	LinesParsed int64 `json:"lines_parsed"`
+	// 格式无法识别的行数
+	ParseErrors int64 `json:"parse_errors"`
+	// 各阶段耗时（秒）：list 列出日志，download 下载，scan 搜索，post_process 搜索结束到生成结果；未执行的阶段不列出
+	StageSeconds map[string]float64 `json:"stage_seconds"`
+	TotalSeconds float64            `json:"total_seconds"`
+}
+
+// Stats 为处理统计
+type Stats struct {
+	FilesScanned      int64   `json:"files_scanned"`
+	CompressedBytes   int64   `json:"compressed_bytes"`
+	DecompressedBytes int64   `json:"decompressed_bytes"`
+	LinesProcessed    int64   `json:"lines_processed"`
+	SearchSeconds     float64 `json:"search_seconds"`
+	TotalSeconds      float64 `json:"total_seconds"`
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 记录每次运行的结果文件，每行一条JSON
+const resultsIndexFile = "ip_search_results_index.jsonl"
+
+// 结果索引中的一次运行
+type resultsIndexEntry struct {
+	Time         time.Time `json:"time"`
+	File         string    `json:"file"`
+	Appended     bool      `json:"appended,omitempty"`
+	Domain       string    `json:"domain"`
+	StartTime    string    `json:"start_time"`
+	EndTime      string    `json:"end_time"`
+	Patterns     []string  `json:"patterns,omitempty"`
+	Keywords     []string  `json:"keywords,omitempty"`
+	Regexps      []string  `json:"regexps,omitempty"`
+	Format       string    `json:"format"`
+	FilesMatched int       `json:"files_matched"`
+	TotalMatches int       `json:"total_matches"`
+}
+
+// 带时间戳的默认结果文件名，如 ip_search_results_20250515_103000.txt；同一秒内已存在时加序号
+func timestampedResultsPath(now time.Time) string {
+	name := resultsFile
+	if config.format == formatJSON {
+		name = jsonResultsFile
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext) + "_" + now.Format("20060102_150405")
+	path := base + ext
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+}
+
+// 把本次运行追加到结果索引
+func appendResultsIndex(results map[string]*fileResult) error {
+	entry := resultsIndexEntry{
+		Time:         time.Now(),
+		File:         resultsPath(),
+		Appended:     config.appendResults,
+		Domain:       config.domainName,
+		StartTime:    config.startTime,
+		EndTime:      config.endTime,
+		Patterns:     anonymizePatterns(splitPatterns(config.searchIP)),
+		Keywords:     config.keywords,
+		Regexps:      config.regexps,
+		Format:       config.format,
+		FilesMatched: len(results),
+		TotalMatches: totalMatches(results),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(resultsIndexFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 结果索引中记录的全部结果文件（可能已被删除），按记录顺序去重
+func resultsIndexFiles() []string {
+	f, err := os.Open(resultsIndexFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var files []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry resultsIndexEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.File != "" && !seen[entry.File] {
+			seen[entry.File] = true
+			files = append(files, entry.File)
+		}
+	}
+	return files
+}
+
+// 从结果索引中移除已删除的结果文件，以及 before 之前的记录（before 为零值时不按时间移除）；
+// 索引不存在或没有需要移除的记录时不做任何事
+func pruneResultsIndex(removed map[string]bool, before time.Time) error {
+	f, err := os.Open(resultsIndexFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var kept []string
+	dropped := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry resultsIndexEntry
+		// 无法解析的行原样保留
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && (removed[entry.File] || entry.Time.Before(before)) {
+			dropped++
+			continue
+		}
+		kept = append(kept, scanner.Text())
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if dropped == 0 {
+		return nil
+	}
+	if len(kept) == 0 {
+		return os.Remove(resultsIndexFile)
+	}
+	return os.WriteFile(resultsIndexFile, []byte(strings.Join(kept, "\n")+"\n"), 0o644)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 每次运行后自动清理生成的文件，长期定时运行时不会无限增长
+var retentionFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "retention",
+		Usage: tr("每次运行结束后删除超过该时长的结果文件、结果索引记录和日志列表缓存，如 30d、12h；默认不清理", "after each run, delete result files, result index entries and log listing caches older than this, e.g. 30d or 12h; nothing is deleted by default"),
+	},
+	&cli.IntFlag{
+		Name:  "retention-count",
+		Usage: tr("每次运行结束后只保留最新的N个结果文件 (0 表示不限制)", "after each run, keep only the newest N result files (0 = unlimited)"),
+	},
+}
+
+// 保留策略，age 和 count 为 0 表示不按该条件清理
+var retentionConfig struct {
+	age   time.Duration
+	count int
+}
+
+func loadRetentionConfig(c *cli.Context) error {
+	retentionConfig.age, retentionConfig.count = 0, c.Int("retention-count")
+	if retentionConfig.count < 0 {
+		return errors.New(tr("--retention-count 不能为负数", "--retention-count must not be negative"))
+	}
+	if s := c.String("retention"); s != "" {
+		age, err := parseAge(s)
+		if err != nil {
+			return fmt.Errorf(tr("--retention 格式错误: %w", "invalid --retention: %w"), err)
+		}
+		retentionConfig.age = age
+	}
+	return nil
+}
+
+// 按保留策略清理结果文件、结果索引和日志列表缓存；清理失败只给出警告，不影响本次结果
+func applyRetention() {
+	if retentionConfig.age <= 0 && retentionConfig.count <= 0 {
+		return
+	}
+	var cutoff time.Time
+	if retentionConfig.age > 0 {
+		cutoff = time.Now().Add(-retentionConfig.age)
+	}
+	removed, err := pruneOldResults(cutoff, retentionConfig.count)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 清理结果文件失败: %v\n", "Warning: delete old result files: %v\n"), err)
+	}
+	if err := pruneResultsIndex(removed, cutoff); err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 更新结果索引 %s 失败: %v\n", "Warning: update result index %s: %v\n"), resultsIndexFile, err)
+	}
+	listings := 0
+	if !cutoff.IsZero() {
+		if listings, err = pruneListingCache(cutoff); err != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 清理日志列表缓存失败: %v\n", "Warning: delete old log listing caches: %v\n"), err)
+		}
+	}
+	if len(removed) > 0 || listings > 0 {
+		fmt.Printf(tr("保留策略: 删除 %d 个旧结果文件、%d 个日志列表缓存\n", "Retention: deleted %d old result files and %d log listing caches\n"), len(removed), listings)
+	}
+}
+
+// 删除 cutoff 之前生成的结果文件，以及最新的 count 个之外的结果文件；本次的结果文件不会被删除。
+// 结果文件包括当前目录中默认文件名的文件和结果索引中记录的文件（如 --output 指定的路径）
+func pruneOldResults(cutoff time.Time, count int) (map[string]bool, error) {
+	type resultFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []resultFile
+	seen := make(map[string]bool)
+	for _, path := range slices.Concat(resultFiles(), resultsIndexFiles()) {
+		if seen[filepath.Clean(path)] {
+			continue
+		}
+		seen[filepath.Clean(path)] = true
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			files = append(files, resultFile{path, info.ModTime()})
+		}
+	}
+	slices.SortFunc(files, func(a, b resultFile) int { return b.modTime.Compare(a.modTime) })
+
+	current := filepath.Clean(resultsPath())
+	removed := make(map[string]bool)
+	var errs []error
+	for i, f := range files {
+		if filepath.Clean(f.path) == current || !(f.modTime.Before(cutoff) || count > 0 && i >= count) {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed[f.path] = true
+	}
+	return removed, errors.Join(errs...)
+}
+
+// 删除 cutoff 之前写入的日志列表缓存，以及因此变空的域名目录
+func pruneListingCache(cutoff time.Time) (int, error) {
+	root, err := listingCacheDir()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var dirs []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !strings.HasSuffix(path, ".json") || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	// 先删除最深的目录；不为空时删除失败，保留
+	for _, dir := range slices.Backward(dirs) {
+		os.Remove(dir)
+	}
+	return removed, err
+}
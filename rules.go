@@ -0,0 +1,618 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"gopkg.in/yaml.v3"
+)
+
+// 当前加载的检测规则，nil 表示未指定 --rules
+var ruleSet *rules
+
+// 规则告警级别，按严重程度从低到高
+var severities = []string{"info", "low", "medium", "high", "critical"}
+
+// 规则文件格式
+type rulesFile struct {
+	// 派生字段，形式同 --field，在规则之前定义
+	Fields []string    `yaml:"fields"`
+	Rules  []ruleSpec  `yaml:"rules"`
+	Alerts []alertSpec `yaml:"alerts"`
+}
+
+// 单条规则，例如“同一IP 5分钟内请求 /login 超过1000次为 high”：
+//
+//	name: login-bruteforce
+//	filter: path startswith "/login"
+//	group_by: [client_ip]
+//	window: 5m
+//	aggregate: count
+//	threshold: 1000
+//	severity: high
+type ruleSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// 过滤表达式，为空时统计全部日志
+	Filter string `yaml:"filter"`
+	// 分组字段，为空时整体统计
+	GroupBy []string `yaml:"group_by"`
+	// 统计窗口，如 5m、1h；为空时统计整个时间范围
+	Window string `yaml:"window"`
+	// 聚合方式：count、sum(字段)、avg(字段)、distinct(字段)
+	Aggregate string  `yaml:"aggregate"`
+	Threshold float64 `yaml:"threshold"`
+	Severity  string  `yaml:"severity"`
+}
+
+// 整体指标告警，例如“全站5xx比例超过5%为 critical”：
+//
+//	name: high-5xx-rate
+//	metric: rate(status >= 500)
+//	interval: 5m
+//	threshold: 0.05
+//	severity: critical
+//
+// 整个时间范围的指标超过阈值时告警，告警中列出超过阈值的各个时间段
+type alertSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Filter      string `yaml:"filter"`
+	// 指标，与规则的 aggregate 相同
+	Metric string `yaml:"metric"`
+	// 分时段明细的粒度，默认 5m
+	Interval  string  `yaml:"interval"`
+	Threshold float64 `yaml:"threshold"`
+	Severity  string  `yaml:"severity"`
+}
+
+// 解析后的规则
+type rule struct {
+	ruleSpec
+	filter  expr
+	groupBy []fieldExpr
+	// 按 client_ip 分组时同时统计每个分组的不同URL数
+	byClientIP bool
+	window     time.Duration
+	// 聚合方式及其字段或条件
+	aggFunc  string
+	aggField *fieldExpr
+	aggCond  expr
+	// 来自 alerts 的整体指标告警
+	alert bool
+}
+
+// 全部规则及合并后的聚合结果
+type rules struct {
+	list []*rule
+
+	mu sync.Mutex
+	// 每条规则的分组窗口聚合值
+	groups []map[groupKey]*accumulator
+}
+
+// 分组与窗口，group 为分组字段值以 \x00 连接
+type groupKey struct {
+	group  string
+	window int64
+}
+
+// 一个分组窗口内的聚合值
+type accumulator struct {
+	count int64
+	// rate() 中满足条件的行数
+	hits     int64
+	sum      float64
+	distinct map[string]struct{}
+	// 规则按 client_ip 分组时的不同URL
+	urls distinctSet
+}
+
+// 加载 --rules 指定的YAML规则文件
+func loadRules(path string) (*rules, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("读取规则文件失败: %w", "read rules file: %w"), err)
+	}
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf(tr("解析规则文件失败: %w", "parse rules file: %w"), err)
+	}
+	for _, def := range file.Fields {
+		if err := defineField(def); err != nil {
+			return nil, err
+		}
+	}
+	if len(file.Rules) == 0 && len(file.Alerts) == 0 {
+		if len(file.Fields) > 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf(tr("规则文件 %s 中没有规则", "no rules in %s"), path)
+	}
+
+	rs := &rules{}
+	for i, spec := range file.Rules {
+		r, err := compileRule(spec)
+		if err != nil {
+			name := spec.Name
+			if name == "" {
+				name = "#" + strconv.Itoa(i+1)
+			}
+			return nil, fmt.Errorf(tr("规则 %s: %w", "rule %s: %w"), name, err)
+		}
+		rs.list = append(rs.list, r)
+		rs.groups = append(rs.groups, make(map[groupKey]*accumulator))
+	}
+	for i, spec := range file.Alerts {
+		if spec.Interval == "" {
+			spec.Interval = "5m"
+		}
+		r, err := compileRule(ruleSpec{
+			Name:        spec.Name,
+			Description: spec.Description,
+			Filter:      spec.Filter,
+			Window:      spec.Interval,
+			Aggregate:   spec.Metric,
+			Threshold:   spec.Threshold,
+			Severity:    spec.Severity,
+		})
+		if err != nil {
+			name := spec.Name
+			if name == "" {
+				name = "#" + strconv.Itoa(i+1)
+			}
+			return nil, fmt.Errorf(tr("告警 %s: %w", "alert %s: %w"), name, err)
+		}
+		r.alert = true
+		rs.list = append(rs.list, r)
+		rs.groups = append(rs.groups, make(map[groupKey]*accumulator))
+	}
+	return rs, nil
+}
+
+func compileRule(spec ruleSpec) (*rule, error) {
+	if spec.Name == "" {
+		return nil, errors.New(tr("缺少 name", "missing name"))
+	}
+	if spec.Severity == "" {
+		spec.Severity = "medium"
+	}
+	if !slices.Contains(severities, spec.Severity) {
+		return nil, fmt.Errorf(tr("无效的级别 %q，可选 %s", "invalid severity %q, use one of %s"), spec.Severity, strings.Join(severities, ", "))
+	}
+
+	r := &rule{ruleSpec: spec}
+	if spec.Filter != "" {
+		e, err := parseExpr(spec.Filter)
+		if err != nil {
+			return nil, err
+		}
+		r.filter = e
+	}
+	for _, name := range spec.GroupBy {
+		get, ok := exprFields[name]
+		if !ok {
+			return nil, fmt.Errorf(tr("未知的分组字段 %q", "unknown group_by field %q"), name)
+		}
+		r.groupBy = append(r.groupBy, fieldExpr{name: name, get: get})
+		r.byClientIP = r.byClientIP || name == "client_ip"
+	}
+	if spec.Window != "" {
+		d, err := time.ParseDuration(spec.Window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf(tr("无效的窗口 %q", "invalid window %q"), spec.Window)
+		}
+		r.window = d
+	}
+
+	if err := r.parseAggregate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 解析聚合方式：count、bandwidth，或 函数(字段)、rate(条件)
+func (r *rule) parseAggregate() error {
+	agg := strings.TrimSpace(r.Aggregate)
+	if agg == "" {
+		agg = "count"
+	}
+	r.aggFunc = agg
+	if fn, arg, ok := strings.Cut(agg, "("); ok && strings.HasSuffix(arg, ")") {
+		r.aggFunc = strings.TrimSpace(fn)
+		arg = strings.TrimSpace(strings.TrimSuffix(arg, ")"))
+		if r.aggFunc == "rate" {
+			cond, err := parseExpr(arg)
+			if err != nil {
+				return err
+			}
+			r.aggCond = cond
+			return nil
+		}
+		get, found := exprFields[arg]
+		if !found {
+			return fmt.Errorf(tr("未知的聚合字段 %q", "unknown aggregate field %q"), arg)
+		}
+		r.aggField = &fieldExpr{name: arg, get: get}
+	}
+	switch {
+	case (r.aggFunc == "count" || r.aggFunc == "bandwidth") && r.aggField == nil:
+	case (r.aggFunc == "sum" || r.aggFunc == "avg" || r.aggFunc == "distinct") && r.aggField != nil:
+	default:
+		return fmt.Errorf(tr("无效的聚合方式 %q，可选 count、bandwidth、sum(字段)、avg(字段)、distinct(字段)、rate(条件)", "invalid aggregate %q, use count, bandwidth, sum(field), avg(field), distinct(field) or rate(condition)"), r.Aggregate)
+	}
+	return nil
+}
+
+// 是否包含分组规则（alert=false）或整体指标告警（alert=true）
+func (rs *rules) has(alert bool) bool {
+	if rs == nil {
+		return false
+	}
+	for _, r := range rs.list {
+		if r.alert == alert {
+			return true
+		}
+	}
+	return false
+}
+
+// 为一次扫描创建独立的聚合状态，扫描结束后用 merge 合并
+func (rs *rules) newState() *ruleState {
+	if rs == nil {
+		return nil
+	}
+	st := &ruleState{rules: rs, groups: make([]map[groupKey]*accumulator, len(rs.list))}
+	for i := range st.groups {
+		st.groups[i] = make(map[groupKey]*accumulator)
+	}
+	return st
+}
+
+// 单次扫描的聚合状态
+type ruleState struct {
+	*rules
+	groups []map[groupKey]*accumulator
+}
+
+// 用一条日志更新所有规则的聚合值
+func (st *ruleState) observe(rec *logRecord) {
+	if st == nil {
+		return
+	}
+
+	var group strings.Builder
+	for i, r := range st.list {
+		if r.filter != nil && !r.filter.eval(rec).truthy() {
+			continue
+		}
+
+		group.Reset()
+		for j, g := range r.groupBy {
+			if j > 0 {
+				group.WriteByte(0)
+			}
+			group.WriteString(g.eval(rec).String())
+		}
+		key := groupKey{group: group.String()}
+		if r.window > 0 {
+			key.window = rec.Time.Truncate(r.window).Unix()
+		}
+
+		acc := st.groups[i][key]
+		if acc == nil {
+			acc = &accumulator{}
+			st.groups[i][key] = acc
+		}
+		acc.count++
+		if r.byClientIP {
+			acc.urls.add(rec.URL)
+		}
+		switch r.aggFunc {
+		case "sum", "avg":
+			acc.sum += r.aggField.eval(rec).num
+		case "bandwidth":
+			acc.sum += float64(rec.ResponseSize)
+		case "rate":
+			if r.aggCond.eval(rec).truthy() {
+				acc.hits++
+			}
+		case "distinct":
+			if acc.distinct == nil {
+				acc.distinct = make(map[string]struct{})
+			}
+			acc.distinct[r.aggField.eval(rec).String()] = struct{}{}
+		}
+	}
+}
+
+// 将一次扫描的聚合状态合并到全局结果
+func (rs *rules) merge(st *ruleState) {
+	if rs == nil || st == nil {
+		return
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for i, groups := range st.groups {
+		for key, acc := range groups {
+			total := rs.groups[i][key]
+			if total == nil {
+				rs.groups[i][key] = acc
+				continue
+			}
+			total.add(acc)
+		}
+	}
+}
+
+// 累加另一个聚合值
+func (a *accumulator) add(other *accumulator) {
+	a.count += other.count
+	a.hits += other.hits
+	a.sum += other.sum
+	for v := range other.distinct {
+		if a.distinct == nil {
+			a.distinct = make(map[string]struct{})
+		}
+		a.distinct[v] = struct{}{}
+	}
+	a.urls.merge(&other.urls)
+}
+
+// 聚合值，seconds 为统计时长，用于计算带宽（bit/s）
+func (r *rule) value(acc *accumulator, seconds float64) float64 {
+	switch r.aggFunc {
+	case "sum":
+		return acc.sum
+	case "avg":
+		return acc.sum / float64(acc.count)
+	case "distinct":
+		return float64(len(acc.distinct))
+	case "rate":
+		return float64(acc.hits) / float64(acc.count)
+	case "bandwidth":
+		if seconds <= 0 {
+			return 0
+		}
+		return acc.sum * 8 / seconds
+	}
+	return float64(acc.count)
+}
+
+// 未设置窗口时的统计时长：整个查询时间范围
+func rangeSeconds() float64 {
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return 0
+	}
+	return end.Sub(start).Seconds()
+}
+
+// 超过阈值的分组窗口，按级别从高到低、规则、窗口、分组排序
+func (rs *rules) findings() []result.Finding {
+	if rs == nil {
+		return nil
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var findings []result.Finding
+	for i, r := range rs.list {
+		if r.alert {
+			continue
+		}
+		seconds := r.window.Seconds()
+		if r.window == 0 {
+			seconds = rangeSeconds()
+		}
+		for key, acc := range rs.groups[i] {
+			v := r.value(acc, seconds)
+			if v <= r.Threshold {
+				continue
+			}
+			f := result.Finding{
+				Rule:        r.Name,
+				Description: r.Description,
+				Severity:    r.Severity,
+				Aggregate:   r.Aggregate,
+				Value:       v,
+				Threshold:   r.Threshold,
+			}
+			if f.Aggregate == "" {
+				f.Aggregate = "count"
+			}
+			if len(r.groupBy) > 0 {
+				f.Group = make(map[string]string, len(r.groupBy))
+				for j, value := range strings.Split(key.group, "\x00") {
+					f.Group[r.groupBy[j].name] = value
+				}
+			}
+			if r.window > 0 {
+				start := time.Unix(key.window, 0)
+				end := start.Add(r.window)
+				f.WindowStart, f.WindowEnd = &start, &end
+			}
+			if r.byClientIP {
+				f.DistinctURLs, f.DistinctURLsApproximate = int64(acc.urls.count()), acc.urls.approximate()
+			}
+			f.Reputation = reputationOf(f.Group["client_ip"])
+			findings = append(findings, f)
+		}
+	}
+
+	slices.SortFunc(findings, func(a, b result.Finding) int {
+		if c := slices.Index(severities, b.Severity) - slices.Index(severities, a.Severity); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Rule, b.Rule); c != 0 {
+			return c
+		}
+		if a.WindowStart != nil && b.WindowStart != nil {
+			if c := a.WindowStart.Compare(*b.WindowStart); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(formatGroup(a.Group), formatGroup(b.Group))
+	})
+	return findings
+}
+
+// 分组的文本形式，如 client_ip=1.2.3.4
+func formatGroup(group map[string]string) string {
+	keys := make([]string, 0, len(group))
+	for k := range group {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + group[k]
+	}
+	return strings.Join(parts, " ")
+}
+
+// 在终端输出告警，最多显示 maxPrintedFindings 条
+func printFindings(findings []result.Finding) {
+	fmt.Printf(tr("\n规则告警: %d 条\n", "\nRule findings: %d\n"), len(findings))
+	for i, f := range findings {
+		if i == maxPrintedFindings {
+			fmt.Printf(tr("  ... 其余 %d 条见结果文件\n", "  ... %d more in the results file\n"), len(findings)-i)
+			break
+		}
+		fmt.Println("  " + formatFinding(f))
+	}
+}
+
+// 终端最多显示的告警数
+const maxPrintedFindings = 20
+
+// 告警的单行文本形式
+func formatFinding(f result.Finding) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s", f.Severity, f.Rule)
+	if len(f.Group) > 0 {
+		b.WriteString(" " + formatGroup(f.Group))
+		if host := hostnameOf(f.Group["client_ip"]); host != "" {
+			b.WriteString(" (" + host + ")")
+		}
+	}
+	if f.WindowStart != nil {
+		fmt.Fprintf(&b, " %s~%s", f.WindowStart.Format("2006-01-02 15:04:05"), f.WindowEnd.Format("15:04:05"))
+	}
+	fmt.Fprintf(&b, " %s=%s (> %s)", f.Aggregate, formatNumber(f.Value), formatNumber(f.Threshold))
+	if f.DistinctURLs > 0 {
+		op := "="
+		if f.DistinctURLsApproximate {
+			op = "≈"
+		}
+		fmt.Fprintf(&b, tr(" 不同URL%s%d", " urls%s%d"), op, f.DistinctURLs)
+	}
+	for _, rep := range f.Reputation {
+		b.WriteString(" [" + formatReputation(rep) + "]")
+	}
+	return b.String()
+}
+
+// 整体指标超过阈值的告警，附带超过阈值的各时间段明细
+func (rs *rules) alerts() []result.Alert {
+	if rs == nil {
+		return nil
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	var alerts []result.Alert
+	for i, r := range rs.list {
+		if !r.alert {
+			continue
+		}
+		total := &accumulator{}
+		for _, acc := range rs.groups[i] {
+			total.add(acc)
+		}
+		if total.count == 0 {
+			continue
+		}
+		v := r.value(total, rangeSeconds())
+		if v <= r.Threshold {
+			continue
+		}
+
+		a := result.Alert{
+			Name:        r.Name,
+			Description: r.Description,
+			Severity:    r.Severity,
+			Metric:      r.Aggregate,
+			Value:       v,
+			Threshold:   r.Threshold,
+			Interval:    r.window.String(),
+			Intervals:   []result.Interval{},
+		}
+		for key, acc := range rs.groups[i] {
+			iv := r.value(acc, r.window.Seconds())
+			if iv <= r.Threshold {
+				continue
+			}
+			start := time.Unix(key.window, 0)
+			a.Intervals = append(a.Intervals, result.Interval{
+				Start: start,
+				End:   start.Add(r.window),
+				Lines: acc.count,
+				Value: iv,
+			})
+		}
+		slices.SortFunc(a.Intervals, func(x, y result.Interval) int { return x.Start.Compare(y.Start) })
+		alerts = append(alerts, a)
+	}
+
+	slices.SortFunc(alerts, func(a, b result.Alert) int {
+		if c := slices.Index(severities, b.Severity) - slices.Index(severities, a.Severity); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return alerts
+}
+
+// 在终端输出整体指标告警
+func printAlerts(alerts []result.Alert) {
+	fmt.Printf(tr("\n指标告警: %d 条\n", "\nMetric alerts: %d\n"), len(alerts))
+	for _, a := range alerts {
+		fmt.Println("  " + formatAlert(a))
+		for i, iv := range a.Intervals {
+			if i == maxPrintedFindings {
+				fmt.Printf(tr("    ... 其余 %d 个时间段见结果文件\n", "    ... %d more intervals in the results file\n"), len(a.Intervals)-i)
+				break
+			}
+			fmt.Println("    " + formatInterval(iv))
+		}
+	}
+}
+
+// 指标告警的单行文本形式
+func formatAlert(a result.Alert) string {
+	return fmt.Sprintf(tr("[%s] %s %s=%s (> %s)，%d 个 %s 时间段超过阈值", "[%s] %s %s=%s (> %s), %d %s intervals above threshold"),
+		a.Severity, a.Name, a.Metric, formatNumber(a.Value), formatNumber(a.Threshold), len(a.Intervals), a.Interval)
+}
+
+// 时间段明细的单行文本形式
+func formatInterval(iv result.Interval) string {
+	return fmt.Sprintf(tr("%s~%s %s (%d 行)", "%s~%s %s (%d lines)"),
+		iv.Start.Format("2006-01-02 15:04:05"), iv.End.Format("15:04:05"), formatNumber(iv.Value), iv.Lines)
+}
+
+// 数值的文本形式，最多保留4位小数
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// 当前使用的采样配置，nil 表示处理全部行
+var lineSampler *sampler
+
+// 行采样配置
+// every>0 时每 every 行取一行；否则按 fraction 的概率随机取样
+type sampler struct {
+	every    int
+	fraction float64
+	// 原始参数，用于报告展示
+	spec string
+}
+
+// 解析 --sample 参数，支持 "1/100"（每100行取1行）和 "0.01"（随机取1%）
+func parseSampler(spec string) (*sampler, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	if num, den, ok := strings.Cut(spec, "/"); ok {
+		n, err1 := strconv.Atoi(strings.TrimSpace(num))
+		d, err2 := strconv.Atoi(strings.TrimSpace(den))
+		if err1 != nil || err2 != nil || n != 1 || d < 1 {
+			return nil, fmt.Errorf(tr("无效的采样参数 %q，格式应为 1/N", "invalid sample %q, expected 1/N"), spec)
+		}
+		if d == 1 {
+			return nil, nil
+		}
+		return &sampler{every: d, spec: spec}, nil
+	}
+
+	f, err := strconv.ParseFloat(spec, 64)
+	if err != nil || f <= 0 || f > 1 {
+		return nil, fmt.Errorf(tr("无效的采样参数 %q，比例应在 (0, 1] 之间", "invalid sample %q, fraction must be in (0, 1]"), spec)
+	}
+	if f == 1 {
+		return nil, nil
+	}
+	return &sampler{fraction: f, spec: spec}, nil
+}
+
+// 估算总量时使用的放大倍数
+func (s *sampler) scale() float64 {
+	if s == nil {
+		return 1
+	}
+	if s.every > 0 {
+		return float64(s.every)
+	}
+	return 1 / s.fraction
+}
+
+// 为一次扫描创建独立的采样状态，各协程之间互不影响
+func (s *sampler) newState() *sampleState {
+	if s == nil {
+		return nil
+	}
+	st := &sampleState{sampler: s}
+	if s.every == 0 {
+		st.rnd = rand.New(rand.NewSource(rand.Int63()))
+	}
+	return st
+}
+
+// 单次扫描的采样状态
+type sampleState struct {
+	*sampler
+	n   int
+	rnd *rand.Rand
+}
+
+// 当前行是否被采样
+func (st *sampleState) keep() bool {
+	if st == nil {
+		return true
+	}
+	if st.every > 0 {
+		st.n++
+		return st.n%st.every == 0
+	}
+	return st.rnd.Float64() < st.fraction
+}
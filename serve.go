@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+//go:embed web
+var webAssets embed.FS
+
+// serve 子命令：服务模式，提供网页控制台和 gRPC 接口，在浏览器中发起分析、查看进度和浏览结果
+var serveCommand = &cli.Command{
+	Name:  "serve",
+	Usage: tr("启动网页控制台和 gRPC 接口，在浏览器中发起分析、查看进度和浏览结果", "start the web dashboard and gRPC API to run analyses, watch progress and browse results in a browser"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Value: "127.0.0.1:8080",
+			Usage: tr("网页控制台的HTTP监听地址，默认只监听本机；监听其他地址时应同时设置 --token", "HTTP listen address of the web dashboard, local only by default; set --token when listening on other addresses"),
+		},
+		&cli.StringFlag{
+			Name:  "grpc-listen",
+			Value: "127.0.0.1:9090",
+			Usage: tr("gRPC 接口（jobpb/jobs.proto）的监听地址，默认只监听本机，为空时不启动；监听其他地址时应同时设置 --token", "listen address of the gRPC API (jobpb/jobs.proto), local only by default, disabled when empty; set --token when listening on other addresses"),
+		},
+		&cli.StringFlag{
+			Name:  "token",
+			Usage: tr("访问令牌：设置后 /api/* 接口需要带 Authorization: Bearer <令牌> 请求头（gRPC 为 authorization 元数据），页面首次访问时会要求输入", "access token: when set, /api/* requires an Authorization: Bearer <token> header (the authorization metadata for gRPC); the page asks for it on first use"),
+		},
+		&cli.IntFlag{
+			Name:  "keep-jobs",
+			Value: 20,
+			Usage: tr("保留的已完成任务数，超出后删除最早的任务及其结果", "number of finished jobs to keep; the oldest jobs and their results are dropped"),
+		},
+	},
+	Action: runServe,
+}
+
+// 任务状态
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+var (
+	errJobNotFound = errors.New(tr("任务不存在", "job not found"))
+	errQueueFull   = errors.New(tr("排队的任务过多，请稍后再试", "too many queued jobs, try again later"))
+)
+
+// 网页或 gRPC 提交的分析参数
+type jobRequest struct {
+	Domain          string `json:"domain"`
+	Start           string `json:"start"`
+	End             string `json:"end"`
+	IP              string `json:"ip"`
+	IgnoreCase      bool   `json:"ignore_case"`
+	MaxMatches      int    `json:"max_matches"`
+	MaxTotalMatches int    `json:"max_total_matches"`
+	Sample          string `json:"sample"`
+	// 统计全部日志的星期 × 小时热力图
+	Heatmap bool `json:"heatmap"`
+	// 统计全部日志每小时按资源类型的流量
+	TypeTimeline bool `json:"type_timeline"`
+}
+
+// 一次分析任务
+type job struct {
+	ID         string     `json:"id"`
+	Request    jobRequest `json:"request"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// 搜索进度，文件数为 0 时表示仍在获取日志
+	FilesTotal   int64 `json:"files_total"`
+	FilesScanned int64 `json:"files_scanned"`
+	Matches      int   `json:"matches"`
+
+	result *jobResult
+}
+
+// 已结束任务的结果。命中行留在任务自己的临时目录中，获取结果时再逐行写出，
+// 保留的任务不会占用与命中行数成正比的内存
+type jobResult struct {
+	// 读取命中行时持有读锁，删除临时目录时持有写锁
+	mu      sync.RWMutex
+	header  result.Report
+	results map[string]*fileResult
+	dir     string
+	removed bool
+}
+
+// 写出 --format json 格式的完整结果
+func (r *jobResult) writeJSON(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.removed {
+		return errJobNotFound
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeJSONReport(bw, r.header, r.results, writeJSONFile); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// 删除命中行临时目录，等待正在写出的结果完成
+func (r *jobResult) remove() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dir != "" {
+		os.RemoveAll(r.dir)
+	}
+	r.removed = true
+}
+
+// 服务模式的任务队列。搜索流程使用全局配置，任务按提交顺序逐个执行
+type server struct {
+	mu       sync.Mutex
+	jobs     []*job
+	nextID   int
+	keepJobs int
+	queue    chan *job
+}
+
+func runServe(c *cli.Context) error {
+	// 与命令行模式共用 --workers、--split-workers 和 OSS 等全局参数
+	loadOSSConfig(c)
+	config.workers = max(c.Int("workers"), 1)
+	config.splitWorkers = c.Int("split-workers")
+	config.format = formatJSON
+
+	s := &server{keepJobs: max(c.Int("keep-jobs"), 1), queue: make(chan *job, 100)}
+	go s.worker(c.Context)
+
+	static, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		return err
+	}
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/info", s.handleInfo)
+	api.HandleFunc("GET /api/jobs", s.handleListJobs)
+	api.HandleFunc("POST /api/jobs", s.handleSubmitJob)
+	api.HandleFunc("GET /api/jobs/{id}", s.handleGetJob)
+	api.HandleFunc("GET /api/jobs/{id}/result", s.handleJobResult)
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	protected := requireToken(c.String("token"), api)
+	mux.Handle("GET /api/", protected)
+	mux.Handle("POST /api/", protected)
+
+	listen, grpcListen := c.String("listen"), c.String("grpc-listen")
+	for _, addr := range []string{listen, grpcListen} {
+		if addr != "" && c.String("token") == "" && !loopbackAddr(addr) {
+			fmt.Fprintf(os.Stderr, tr("警告: 监听 %s 且未设置 --token，能访问该端口的任何人都可以用本机的凭证下载日志并查看结果\n", "Warning: listening on %s without --token; anyone who can reach the port can download logs with this host's credentials and read the results\n"), addr)
+		}
+	}
+	errc := make(chan error, 2)
+	if grpcListen != "" {
+		lis, err := net.Listen("tcp", grpcListen)
+		if err != nil {
+			return err
+		}
+		go func() { errc <- newGRPCServer(s, c.String("token")).Serve(lis) }()
+		fmt.Printf(tr("gRPC 接口已启动: %s\n", "gRPC API listening on %s\n"), grpcListen)
+	}
+	go func() { errc <- http.ListenAndServe(listen, mux) }()
+	fmt.Printf(tr("网页控制台已启动: %s\n", "Web dashboard listening on %s\n"), listen)
+	return <-errc
+}
+
+// 设置了令牌时，只允许带 Authorization: Bearer <令牌> 的请求
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New(tr("需要访问令牌", "access token required")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 监听地址是否只在本机可访问
+func loopbackAddr(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// 按提交顺序执行任务
+func (s *server) worker(ctx context.Context) {
+	for j := range s.queue {
+		s.mu.Lock()
+		j.Status = jobRunning
+		s.mu.Unlock()
+
+		res, err := executeJob(ctx, j.Request)
+
+		s.mu.Lock()
+		now := time.Now()
+		j.FinishedAt = &now
+		j.result = res
+		j.Status = jobDone
+		if err != nil {
+			j.Status = jobFailed
+			j.Error = err.Error()
+		}
+		j.FilesTotal = runStats.filesTotal.Load()
+		j.FilesScanned = runStats.filesScanned.Load()
+		if res != nil {
+			j.Matches = res.header.Summary.TotalMatches
+		}
+		s.prune()
+		s.mu.Unlock()
+	}
+}
+
+// 使用提交的参数执行一次分析，部分文件失败时同时返回已有的结果和错误
+func executeJob(ctx context.Context, req jobRequest) (*jobResult, error) {
+	config.domainName = req.Domain
+	config.startTime = req.Start
+	config.endTime = req.End
+	config.searchIP = req.IP
+	config.ignoreCase = req.IgnoreCase
+	config.countOnly = false
+	config.summaryOnly = false
+	config.mergeByTime = false
+	logExport = nil
+	outputSinks = nil
+	influxConfig.endpoint = ""
+	heatmapConfig.enabled, heatmapConfig.csv = req.Heatmap, ""
+	typeTimelineConfig.interval, typeTimelineConfig.csv = 0, ""
+	if req.TypeTimeline {
+		typeTimelineConfig.interval = time.Hour
+	}
+	trafficCounter = nil
+	if req.Heatmap || req.TypeTimeline {
+		trafficCounter = newTraffic(time.Hour)
+	}
+	config.beforeContext = 0
+	config.afterContext = 0
+	config.maxMatches = req.MaxMatches
+	config.maxTotalMatches = req.MaxTotalMatches
+	globalBudget = newMatchBudget(config.maxTotalMatches)
+	sampler, err := parseSampler(req.Sample)
+	if err != nil {
+		return nil, err
+	}
+	lineSampler = sampler
+	lineMatcher = newSearchMatcher(splitPatterns(req.IP), req.IgnoreCase)
+
+	runStats.reset()
+	ctx, span := startSpan(ctx, "analyze",
+		attribute.String("cdn.domain", config.domainName),
+		attribute.String("search.patterns", displaySearchIP()))
+	defer span.End()
+
+	defer cleanupMatchStores()
+	results, err := analyze(ctx, "")
+	if results == nil {
+		return nil, err
+	}
+	return &jobResult{header: reportHeader(results), results: results, dir: detachMatchStores()}, err
+}
+
+// 校验任务参数，避免无效任务进入队列
+func (r *jobRequest) validate() error {
+	if r.Start == "" || r.End == "" {
+		return errors.New(tr("必须指定开始时间和结束时间", "start and end time are required"))
+	}
+	if _, _, err := parseTimeRange(r.Start, r.End); err != nil {
+		return err
+	}
+	if len(splitPatterns(r.IP)) == 0 {
+		return errors.New(tr("搜索IP不能为空", "no IP to search for"))
+	}
+	_, err := parseSampler(r.Sample)
+	return err
+}
+
+func (s *server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"lang":           lang,
+		"schema_version": result.SchemaVersion,
+	})
+}
+
+func (s *server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.list())
+}
+
+func (s *server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf(tr("请求格式错误: %w", "invalid request: %w"), err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	j, err := s.submit(req)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+func (s *server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errJobNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+func (s *server) handleJobResult(w http.ResponseWriter, r *http.Request) {
+	res := s.result(r.PathValue("id"))
+	if res == nil {
+		writeError(w, http.StatusNotFound, errors.New(tr("任务不存在或尚未完成", "job not found or not finished")))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	res.writeJSON(w)
+}
+
+// 把已校验的任务加入队列，返回任务的副本；HTTP 和 gRPC 接口共用
+func (s *server) submit(req jobRequest) (job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	j := &job{ID: strconv.Itoa(s.nextID), Request: req, Status: jobQueued, CreatedAt: time.Now()}
+	select {
+	case s.queue <- j:
+	default:
+		return job{}, errQueueFull
+	}
+	s.jobs = append(s.jobs, j)
+	s.prune()
+	return s.snapshot(j), nil
+}
+
+// 按ID查询任务的副本
+func (s *server) get(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.find(id)
+	if j == nil {
+		return job{}, false
+	}
+	return s.snapshot(j), true
+}
+
+// 全部任务的副本，最新的在前
+func (s *server) list() []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]job, 0, len(s.jobs))
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.snapshot(s.jobs[i]))
+	}
+	return jobs
+}
+
+// 已结束任务的结果，任务不存在或尚未结束时为 nil
+func (s *server) result(id string) *jobResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j := s.find(id); j != nil {
+		return j.result
+	}
+	return nil
+}
+
+// 任务的副本，运行中的任务从全局统计读取实时进度；调用方需持有 s.mu
+func (s *server) snapshot(j *job) job {
+	c := *j
+	if c.Status == jobRunning {
+		c.FilesTotal = runStats.filesTotal.Load()
+		c.FilesScanned = runStats.filesScanned.Load()
+	}
+	return c
+}
+
+// 按ID查找任务；调用方需持有 s.mu
+func (s *server) find(id string) *job {
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// 删除超出保留数量的最早的已完成任务及其命中行；调用方需持有 s.mu
+func (s *server) prune() {
+	finished := 0
+	for _, j := range s.jobs {
+		if j.FinishedAt != nil {
+			finished++
+		}
+	}
+	kept := s.jobs[:0]
+	for _, j := range s.jobs {
+		if j.FinishedAt != nil && finished > s.keepJobs {
+			finished--
+			if j.result != nil {
+				// 可能正在写出结果，不持有 s.mu 等待
+				go j.result.remove()
+			}
+			continue
+		}
+		kept = append(kept, j)
+	}
+	s.jobs = kept
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
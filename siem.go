@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"example.com/mod/result"
+)
+
+// CEF/LEEF 记录头中的设备信息
+const (
+	siemVendor  = "qingfengjack"
+	siemProduct = "ali-cdn-log-analyzer"
+	siemVersion = "1.0"
+)
+
+// 告警级别对应的 CEF/LEEF 严重程度（0-10）
+var siemSeverity = map[string]int{"info": 1, "low": 3, "medium": 5, "high": 8, "critical": 10}
+
+// 命中的日志行没有级别，按 low 处理
+const siemMatchSeverity = 3
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefHeaderEscaper   = strings.NewReplacer(`|`, `\|`)
+	// LEEF 以制表符分隔属性，值中的制表符和换行替换为空格
+	leefValueEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+// 一个扩展属性；值为空或日志中的 - 时不输出
+type siemField struct {
+	key, value string
+}
+
+// CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension
+func cefRecord(signature, name string, severity int, fields []siemField) string {
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	for _, s := range []string{siemVendor, siemProduct, siemVersion, signature, name} {
+		b.WriteString(cefHeaderEscaper.Replace(s))
+		b.WriteByte('|')
+	}
+	b.WriteString(strconv.Itoa(severity))
+	b.WriteByte('|')
+	first := true
+	for _, f := range fields {
+		if f.value == "" || f.value == "-" {
+			continue
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(cefExtensionEscaper.Replace(f.value))
+	}
+	return b.String()
+}
+
+// LEEF:1.0|Vendor|Product|Version|EventID|属性（制表符分隔）
+func leefRecord(eventID string, fields []siemField) string {
+	var b strings.Builder
+	b.WriteString("LEEF:1.0|")
+	for _, s := range []string{siemVendor, siemProduct, siemVersion, eventID} {
+		b.WriteString(leefHeaderEscaper.Replace(s))
+		b.WriteByte('|')
+	}
+	first := true
+	for _, f := range fields {
+		if f.value == "" || f.value == "-" {
+			continue
+		}
+		if !first {
+			b.WriteByte('\t')
+		}
+		first = false
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(leefValueEscaper.Replace(f.value))
+	}
+	return b.String()
+}
+
+// LEEF 的 devTime 格式，对应 Java 的 MMM dd yyyy HH:mm:ss.SSS Z
+const (
+	leefTimeLayout = "Jan 02 2006 15:04:05.000 -0700"
+	leefTimeFormat = "MMM dd yyyy HH:mm:ss.SSS Z"
+)
+
+func formatInt(n int64) string { return strconv.FormatInt(n, 10) }
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+// 命中的日志行转换为 CEF 记录
+func cefLogLine(rec *logRecord) string {
+	return cefRecord("match", "CDN log match", siemMatchSeverity, []siemField{
+		{"rt", formatInt(rec.Time.UnixMilli())},
+		{"src", rec.ClientIP},
+		{"requestMethod", rec.Method},
+		{"request", rec.URL},
+		{"requestClientApplication", rec.UserAgent},
+		{"requestContext", rec.Referer},
+		{"in", formatInt(rec.RequestSize)},
+		{"out", formatInt(rec.ResponseSize)},
+		{"cn1Label", "status"}, {"cn1", strconv.Itoa(rec.Status)},
+		{"cn2Label", "responseTimeMs"}, {"cn2", strconv.Itoa(rec.ResponseTime)},
+		{"cs1Label", "hitInfo"}, {"cs1", rec.HitInfo},
+		{"cs2Label", "contentType"}, {"cs2", rec.ContentType},
+		{"cs3Label", "proxyIp"}, {"cs3", rec.ProxyIP},
+	})
+}
+
+// 命中的日志行转换为 LEEF 记录
+func leefLogLine(rec *logRecord) string {
+	return leefRecord("match", []siemField{
+		{"cat", "match"},
+		{"devTime", rec.Time.Format(leefTimeLayout)},
+		{"devTimeFormat", leefTimeFormat},
+		{"sev", strconv.Itoa(siemMatchSeverity)},
+		{"src", rec.ClientIP},
+		{"method", rec.Method},
+		{"url", rec.URL},
+		{"status", strconv.Itoa(rec.Status)},
+		{"srcBytes", formatInt(rec.RequestSize)},
+		{"dstBytes", formatInt(rec.ResponseSize)},
+		{"responseTimeMs", strconv.Itoa(rec.ResponseTime)},
+		{"userAgent", rec.UserAgent},
+		{"referer", rec.Referer},
+		{"hitInfo", rec.HitInfo},
+		{"contentType", rec.ContentType},
+		{"proxyIp", rec.ProxyIP},
+	})
+}
+
+// 规则告警转换为 CEF 记录，签名为规则名称
+func cefFinding(f *result.Finding) string {
+	name := f.Description
+	if name == "" {
+		name = f.Rule
+	}
+	fields := []siemField{
+		{"cat", "finding"},
+		{"src", f.Group["client_ip"]},
+		{"msg", f.Description},
+		{"cs1Label", "aggregate"}, {"cs1", f.Aggregate},
+		{"cs2Label", "group"}, {"cs2", formatGroup(f.Group)},
+		{"cfp1Label", "value"}, {"cfp1", formatFloat(f.Value)},
+		{"cfp2Label", "threshold"}, {"cfp2", formatFloat(f.Threshold)},
+	}
+	if f.WindowStart != nil && f.WindowEnd != nil {
+		fields = append(fields,
+			siemField{"start", formatInt(f.WindowStart.UnixMilli())},
+			siemField{"end", formatInt(f.WindowEnd.UnixMilli())})
+	}
+	return cefRecord(f.Rule, name, siemSeverity[f.Severity], fields)
+}
+
+// 规则告警转换为 LEEF 记录，事件ID为规则名称
+func leefFinding(f *result.Finding) string {
+	fields := []siemField{
+		{"cat", "finding"},
+		{"sev", strconv.Itoa(siemSeverity[f.Severity])},
+		{"src", f.Group["client_ip"]},
+		{"severity", f.Severity},
+		{"description", f.Description},
+		{"aggregate", f.Aggregate},
+		{"group", formatGroup(f.Group)},
+		{"value", formatFloat(f.Value)},
+		{"threshold", formatFloat(f.Threshold)},
+	}
+	if f.WindowStart != nil && f.WindowEnd != nil {
+		fields = append(fields,
+			siemField{"devTime", f.WindowStart.Format(leefTimeLayout)},
+			siemField{"devTimeFormat", leefTimeFormat},
+			siemField{"windowEnd", f.WindowEnd.Format(leefTimeLayout)})
+	}
+	return leefRecord(f.Rule, fields)
+}
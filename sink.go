@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 命中行和告警的外部输出，结果保存后逐条发送
+type outputSink interface {
+	// 用于提示信息的名称，如 syslog udp://127.0.0.1:514
+	String() string
+	send(ev *sinkEvent) error
+	// 发送缓冲中的记录并关闭连接
+	close() error
+}
+
+// 需要接收分析汇总的外部输出
+type summarySink interface {
+	summary(fields map[string]any) error
+}
+
+// 启用的外部输出
+var outputSinks []outputSink
+
+// 本次分析的ID，发送到外部输出的每条记录都带有该ID，便于在外部系统中区分不同的运行
+var analysisID string
+
+// 生成分析ID，如 20250515T103000-1a2b3c4d
+func newAnalysisID() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return time.Now().Format("20060102T150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// 发送到外部输出的一条记录：命中行、规则告警或指标告警
+type sinkEvent struct {
+	// match、finding 或 alert
+	kind string
+	// 命中行的请求时间；告警为统计窗口的开始时间，没有窗口时为生成时间
+	time time.Time
+	// 告警级别，命中行为 info
+	severity string
+	// 命中行所在的日志文件及原文，rec 为解析后的字段（无法解析时为 nil）
+	file string
+	line string
+	rec  *logRecord
+
+	finding *result.Finding
+	alert   *result.Alert
+}
+
+// 记录的单行文本形式
+func (ev *sinkEvent) message() string {
+	switch ev.kind {
+	case "finding":
+		return formatFinding(*ev.finding)
+	case "alert":
+		return formatAlert(*ev.alert)
+	}
+	return ev.line
+}
+
+// 记录所属的域名：命中行取自日志文件名，无法识别时为 --domain
+func (ev *sinkEvent) domain() string {
+	if ev.file != "" {
+		if domain, _, ok := parseLogFileName(filepath.Base(ev.file)); ok {
+			return domain
+		}
+	}
+	return config.domainName
+}
+
+// 命中行所在日志文件的显示名称，告警为空
+func (ev *sinkEvent) fileLabel() string {
+	if ev.file == "" {
+		return ""
+	}
+	return fileLabel(ev.file)
+}
+
+// 记录的客户端IP，没有时为空
+func (ev *sinkEvent) clientIP() string {
+	switch {
+	case ev.rec != nil:
+		return ev.rec.ClientIP
+	case ev.finding != nil:
+		return ev.finding.Group["client_ip"]
+	}
+	return ""
+}
+
+// 告警的规则名称，命中行为空
+func (ev *sinkEvent) rule() string {
+	switch {
+	case ev.finding != nil:
+		return ev.finding.Rule
+	case ev.alert != nil:
+		return ev.alert.Name
+	}
+	return ""
+}
+
+// 记录的结构化字段，命中行的字段名与 JSON 结果中的 record 一致
+func (ev *sinkEvent) fields() map[string]any {
+	m := map[string]any{"kind": ev.kind, "severity": ev.severity, "domain": ev.domain(), "message": ev.message(), "analysis_id": analysisID}
+	switch {
+	case ev.rec != nil:
+		r := ev.rec
+		m["file"] = ev.fileLabel()
+		m["client_ip"] = r.ClientIP
+		m["proxy_ip"] = r.ProxyIP
+		m["response_time_ms"] = r.ResponseTime
+		m["referer"] = r.Referer
+		m["method"] = r.Method
+		m["url"] = r.URL
+		m["status"] = r.Status
+		m["request_size"] = r.RequestSize
+		m["response_size"] = r.ResponseSize
+		m["hit_info"] = r.HitInfo
+		m["user_agent"] = r.UserAgent
+		m["content_type"] = r.ContentType
+	case ev.finding != nil:
+		f := ev.finding
+		m["rule"] = f.Rule
+		m["description"] = f.Description
+		m["aggregate"] = f.Aggregate
+		m["value"] = f.Value
+		m["threshold"] = f.Threshold
+		for k, v := range f.Group {
+			m[k] = v
+		}
+	case ev.alert != nil:
+		a := ev.alert
+		m["rule"] = a.Name
+		m["description"] = a.Description
+		m["metric"] = a.Metric
+		m["value"] = a.Value
+		m["threshold"] = a.Threshold
+		m["intervals"] = len(a.Intervals)
+	default:
+		m["file"] = ev.fileLabel()
+	}
+	return m
+}
+
+func matchEvent(file, line string) *sinkEvent {
+	ev := &sinkEvent{kind: "match", severity: "info", file: file, line: line, time: time.Now()}
+	var rec logRecord
+	if parseLogLine(line, &rec) == nil {
+		ev.rec, ev.time = &rec, rec.Time
+	}
+	return ev
+}
+
+func findingEvent(f *result.Finding) *sinkEvent {
+	ev := &sinkEvent{kind: "finding", severity: f.Severity, finding: f, time: time.Now()}
+	if f.WindowStart != nil {
+		ev.time = *f.WindowStart
+	}
+	return ev
+}
+
+func alertEvent(a *result.Alert) *sinkEvent {
+	ev := &sinkEvent{kind: "alert", severity: a.Severity, alert: a, time: time.Now()}
+	if len(a.Intervals) > 0 {
+		ev.time = a.Intervals[0].Start
+	}
+	return ev
+}
+
+// 各外部输出的配置加载函数，未启用时返回 nil
+var sinkLoaders = []func(c *cli.Context) (outputSink, error){
+	loadSyslogSink,
+	loadFluentSink,
+	loadLokiSink,
+	loadSplunkSink,
+	loadGELFSink,
+	loadSQLSink,
+	loadSLSSink,
+	loadODPSSink,
+}
+
+func loadSinkConfig(c *cli.Context) error {
+	outputSinks = nil
+	analysisID = newAnalysisID()
+	for _, load := range sinkLoaders {
+		sink, err := load(c)
+		if err != nil {
+			return err
+		}
+		if sink != nil {
+			outputSinks = append(outputSinks, sink)
+		}
+	}
+	return nil
+}
+
+// 基于 HTTP 的外部输出共用的客户端
+var sinkHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// 使用共用的客户端发送请求
+func doSinkRequest(req *http.Request) error {
+	resp, err := sinkHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkSinkResponse(resp)
+}
+
+// 非 2xx 响应作为错误返回并附带响应内容的开头部分
+func checkSinkResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// 把命中行、规则告警和指标告警发送到全部外部输出；某个输出失败后不再向它发送，只给出警告
+func sendToSinks(results map[string]*fileResult) {
+	if len(outputSinks) == 0 {
+		return
+	}
+	sent := make([]int, len(outputSinks))
+	errs := make([]error, len(outputSinks))
+	emit := func(ev *sinkEvent) {
+		for i, sink := range outputSinks {
+			if errs[i] != nil {
+				continue
+			}
+			if err := sink.send(ev); err != nil {
+				errs[i] = err
+				continue
+			}
+			sent[i]++
+		}
+	}
+	if config.mergeByTime {
+		mergedMatches(results, func(file, line string, _ time.Time) error {
+			emit(matchEvent(file, line))
+			return nil
+		})
+	} else {
+		for _, file := range sortedFiles(results) {
+			results[file].eachMatch(func(line string) error {
+				emit(matchEvent(file, line))
+				return nil
+			})
+		}
+	}
+	findings := ruleSet.findings()
+	for i := range findings {
+		emit(findingEvent(&findings[i]))
+	}
+	alerts := ruleSet.alerts()
+	for i := range alerts {
+		emit(alertEvent(&alerts[i]))
+	}
+	summary := map[string]any{
+		"analysis_id":   analysisID,
+		"domain":        config.domainName,
+		"start_time":    config.startTime,
+		"end_time":      config.endTime,
+		"search":        displaySearchIP(),
+		"files_matched": len(results),
+		"total_matches": totalMatches(results),
+		"findings":      len(findings),
+		"alerts":        len(alerts),
+	}
+	// 运行信息，便于在日志系统中检查每次运行是否完整
+	run := runStats.metadata()
+	summary["files_listed"] = run.FilesListed
+	summary["files_downloaded"] = run.FilesDownloaded
+	summary["files_failed"] = run.FilesFailed
+	summary["bytes_downloaded"] = run.BytesDownloaded
+	summary["lines_scanned"] = run.LinesScanned
+	summary["parse_errors"] = run.ParseErrors
+	if !config.noLocalResults {
+		summary["results_file"] = resultsPath()
+	}
+	for i, sink := range outputSinks {
+		if s, ok := sink.(summarySink); ok && errs[i] == nil {
+			if errs[i] = s.summary(summary); errs[i] == nil {
+				sent[i]++
+			}
+		}
+	}
+
+	for i, sink := range outputSinks {
+		if err := sink.close(); errs[i] == nil {
+			errs[i] = err
+		}
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, tr("警告: 发送到 %s 失败: %v\n", "Warning: sending to %s failed: %v\n"), sink, errs[i])
+			markPartialFailure()
+			continue
+		}
+		fmt.Printf(tr("已发送 %d 条记录到 %s\n", "Sent %d records to %s\n"), sent[i], sink)
+	}
+}
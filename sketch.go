@@ -0,0 +1,207 @@
+package main
+
+import (
+	"hash/maphash"
+	"maps"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// 不同取值较少时精确记录，超过 distinctExactLimit 后改用 HyperLogLog 估算，
+// 每个集合的内存不超过约 1KB 加上 distinctExactLimit 个取值
+const (
+	distinctExactLimit = 256
+	// HyperLogLog 的精度：2^10 个寄存器，标准误差约 3.3%
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+)
+
+// 同一进程内所有集合使用相同的种子，合并时哈希值一致
+var distinctSeed = maphash.MakeSeed()
+
+// 统计不同取值的个数，零值可直接使用
+type distinctSet struct {
+	exact map[string]struct{}
+	hll   []uint8
+}
+
+func (d *distinctSet) add(s string) {
+	if d.hll != nil {
+		d.addHash(maphash.String(distinctSeed, s))
+		return
+	}
+	if d.exact == nil {
+		d.exact = make(map[string]struct{})
+	}
+	d.exact[s] = struct{}{}
+	if len(d.exact) > distinctExactLimit {
+		d.toSketch()
+	}
+}
+
+// 精确集合转为 HyperLogLog
+func (d *distinctSet) toSketch() {
+	d.hll = make([]uint8, hllRegisters)
+	for s := range d.exact {
+		d.addHash(maphash.String(distinctSeed, s))
+	}
+	d.exact = nil
+}
+
+func (d *distinctSet) addHash(h uint64) {
+	j := h >> (64 - hllPrecision)
+	rho := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rho > d.hll[j] {
+		d.hll[j] = rho
+	}
+}
+
+// 把 o 合并到 d
+func (d *distinctSet) merge(o *distinctSet) {
+	if o.hll != nil {
+		if d.hll == nil {
+			d.toSketch()
+		}
+		for j, r := range o.hll {
+			d.hll[j] = max(d.hll[j], r)
+		}
+		return
+	}
+	for s := range o.exact {
+		d.add(s)
+	}
+}
+
+// 是否为估算值
+func (d *distinctSet) approximate() bool {
+	return d.hll != nil
+}
+
+// 不同取值的个数
+func (d *distinctSet) count() float64 {
+	if d.hll == nil {
+		return float64(len(d.exact))
+	}
+	const m = float64(hllRegisters)
+	sum, zeros := 0.0, 0
+	for _, r := range d.hll {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// 小基数修正
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return math.Round(estimate)
+}
+
+// 百分位数的估算：取值较少时精确记录，超过 quantileExactLimit 后改为按对数分桶计数（DDSketch），
+// 估算值的相对误差不超过 quantileAccuracy，桶数只与取值范围有关
+const (
+	quantileExactLimit = 256
+	quantileAccuracy   = 0.01
+)
+
+var quantileGamma = (1 + quantileAccuracy) / (1 - quantileAccuracy)
+
+// 统计一组非负数的百分位数，零值可直接使用
+type quantileSketch struct {
+	exact []float64
+	// 分桶后：桶下标 → 个数，桶 i 包含 (γ^(i-1), γ^i]；zeros 为小于等于 0 的个数
+	buckets map[int]int64
+	zeros   int64
+	n       int64
+	// 最小值和最大值，估算值不超出此范围
+	min, max float64
+}
+
+func (q *quantileSketch) add(v float64) {
+	if q.n == 0 {
+		q.min, q.max = v, v
+	} else {
+		q.min, q.max = min(q.min, v), max(q.max, v)
+	}
+	q.n++
+	if q.buckets == nil {
+		q.exact = append(q.exact, v)
+		if len(q.exact) > quantileExactLimit {
+			q.toSketch()
+		}
+		return
+	}
+	q.addBucket(v, 1)
+}
+
+func (q *quantileSketch) addBucket(v float64, n int64) {
+	if v <= 0 {
+		q.zeros += n
+		return
+	}
+	q.buckets[int(math.Ceil(math.Log(v)/math.Log(quantileGamma)))] += n
+}
+
+// 精确记录的取值转为分桶计数
+func (q *quantileSketch) toSketch() {
+	q.buckets = make(map[int]int64)
+	for _, v := range q.exact {
+		q.addBucket(v, 1)
+	}
+	q.exact = nil
+}
+
+// 把 o 合并到 q
+func (q *quantileSketch) merge(o *quantileSketch) {
+	if o.buckets == nil {
+		for _, v := range o.exact {
+			q.add(v)
+		}
+		return
+	}
+	if q.buckets == nil {
+		q.toSketch()
+	}
+	if q.n == 0 {
+		q.min, q.max = o.min, o.max
+	} else {
+		q.min, q.max = min(q.min, o.min), max(q.max, o.max)
+	}
+	for i, n := range o.buckets {
+		q.buckets[i] += n
+	}
+	q.zeros += o.zeros
+	q.n += o.n
+}
+
+// 是否为估算值
+func (q *quantileSketch) approximate() bool {
+	return q.buckets != nil
+}
+
+// 第 p（0 到 1）百分位数：从小到大第 ceil(p*n) 个取值，没有取值时为 0
+func (q *quantileSketch) quantile(p float64) float64 {
+	if q.n == 0 {
+		return 0
+	}
+	rank := max(int64(math.Ceil(p*float64(q.n))), 1)
+	if q.buckets == nil {
+		values := slices.Clone(q.exact)
+		slices.Sort(values)
+		return values[rank-1]
+	}
+	if rank <= q.zeros {
+		return 0
+	}
+	seen := q.zeros
+	for _, i := range slices.Sorted(maps.Keys(q.buckets)) {
+		if seen += q.buckets[i]; seen >= rank {
+			// 桶的代表值，与桶内任意取值的相对误差不超过 quantileAccuracy
+			v := 2 * math.Pow(quantileGamma, float64(i)) / (quantileGamma + 1)
+			return min(max(v, q.min), q.max)
+		}
+	}
+	return 0
+}
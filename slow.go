@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze slow：按URL统计响应时间的百分位数，找出边缘节点上暴露出的源站延迟问题
+var slowCommand = &cli.Command{
+	Name:  "slow",
+	Usage: tr("按URL统计响应时间的 p95 和最大值，以及未命中率和响应大小，列出最慢的URL", "list the slowest URLs by p95 and maximum response time, with their cache miss ratio and response sizes"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+	},
+	Action: runSlowReport,
+}
+
+func runSlowReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	var reports []*groupBy
+	for _, r := range []struct{ name, by, metrics string }{
+		{"slow", "host,path", "p95(response_time),max(response_time),p50(response_time),count,miss_ratio,avg(response_size),max(response_size)"},
+		// 命中与未命中的响应时间对比：只有 MISS 慢时多为源站的问题
+		{"slow-hit-info", "hit_info", "p50(response_time),p95(response_time),p99(response_time),max(response_time),count"},
+	} {
+		g, err := newGroupBy(r.name, r.by, r.metrics, c.String("filter"))
+		if err != nil {
+			return err
+		}
+		reports = append(reports, g)
+	}
+	return runAggregates(c, reports, func(ctx context.Context) {
+		// 日志中没有响应时间（全部为 0）时报表没有意义
+		if agg := reports[1].aggregate(); len(agg.Rows) > 0 && !slowReportHasTimes(agg.Rows) {
+			fmt.Fprint(os.Stderr, tr("警告: 日志中的响应时间都为 0，请确认日志格式包含响应时间\n", "Warning: all response times in the logs are 0, check that the log format includes the response time\n"))
+		}
+	})
+}
+
+// slow-hit-info 报表中是否有大于 0 的最大响应时间
+func slowReportHasTimes(rows []result.AggregateRow) bool {
+	for _, row := range rows {
+		if row.Values[3] > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	credential "github.com/aliyun/credentials-go/credentials"
+	"github.com/urfave/cli/v2"
+)
+
+// 把命中行、告警和分析汇总写入阿里云日志服务（SLS）
+var slsFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "sls-project",
+		Usage: tr("把命中行、告警和分析汇总写入该日志服务 Project，需要同时指定 --sls-logstore 和 --sls-endpoint", "write matched lines, alerts and the analysis summary into this Log Service project; requires --sls-logstore and --sls-endpoint"),
+	},
+	&cli.StringFlag{
+		Name:  "sls-logstore",
+		Usage: tr("日志服务 Logstore", "Log Service logstore"),
+	},
+	&cli.StringFlag{
+		Name:  "sls-endpoint",
+		Usage: tr("日志服务的服务地址，如 cn-hangzhou.log.aliyuncs.com", "Log Service endpoint, e.g. cn-hangzhou.log.aliyuncs.com"),
+	},
+}
+
+// 每个 LogGroup 的最多日志条数（服务端限制为 4096）
+const slsBatchSize = 1000
+
+type slsSink struct {
+	project  string
+	logstore string
+	endpoint string
+	source   string
+
+	client sls.ClientInterface
+	// 按主题（match、finding、alert、summary）缓冲的日志
+	pending map[string][]*sls.Log
+}
+
+func loadSLSSink(c *cli.Context) (outputSink, error) {
+	project := c.String("sls-project")
+	if project == "" {
+		return nil, nil
+	}
+	s := &slsSink{project: project, logstore: c.String("sls-logstore"), endpoint: c.String("sls-endpoint"), pending: make(map[string][]*sls.Log)}
+	if s.logstore == "" || s.endpoint == "" {
+		return nil, errors.New(tr("使用 --sls-project 时需要指定 --sls-logstore 和 --sls-endpoint", "--sls-project requires --sls-logstore and --sls-endpoint"))
+	}
+	if host, err := os.Hostname(); err == nil {
+		s.source = host
+	}
+	return s, nil
+}
+
+func (s *slsSink) String() string { return "sls " + s.project + "/" + s.logstore }
+
+func (s *slsSink) send(ev *sinkEvent) error {
+	return s.add(ev.kind, ev.time, ev.fields())
+}
+
+// 分析汇总作为主题为 summary 的一条日志
+func (s *slsSink) summary(fields map[string]any) error {
+	return s.add("summary", time.Now(), fields)
+}
+
+func (s *slsSink) add(topic string, t time.Time, fields map[string]any) error {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	log := &sls.Log{Time: tea.Uint32(uint32(t.Unix())), TimeNs: tea.Uint32(uint32(t.Nanosecond()))}
+	for _, k := range keys {
+		log.Contents = append(log.Contents, &sls.LogContent{Key: tea.String(k), Value: tea.String(slsValue(fields[k]))})
+	}
+	s.pending[topic] = append(s.pending[topic], log)
+	if len(s.pending[topic]) >= slsBatchSize {
+		return s.flush(topic)
+	}
+	return nil
+}
+
+// 日志服务的字段值均为字符串
+func slsValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return formatNumber(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprint(v)
+}
+
+func (s *slsSink) flush(topic string) error {
+	logs := s.pending[topic]
+	if len(logs) == 0 {
+		return nil
+	}
+	delete(s.pending, topic)
+	if s.client == nil {
+		cred, err := credential.NewCredential(nil)
+		if err != nil {
+			return err
+		}
+		model, err := cred.GetCredential()
+		if err != nil {
+			return err
+		}
+		s.client = sls.CreateNormalInterface(s.endpoint, tea.StringValue(model.AccessKeyId),
+			tea.StringValue(model.AccessKeySecret), tea.StringValue(model.SecurityToken))
+	}
+	return s.client.PutLogs(s.project, s.logstore, &sls.LogGroup{
+		Topic:  tea.String(topic),
+		Source: tea.String(s.source),
+		Logs:   logs,
+	})
+}
+
+func (s *slsSink) close() error {
+	topics := make([]string, 0, len(s.pending))
+	for topic := range s.pending {
+		topics = append(topics, topic)
+	}
+	slices.Sort(topics)
+	for _, topic := range topics {
+		if err := s.flush(topic); err != nil {
+			return err
+		}
+	}
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 通过 Splunk HTTP Event Collector 发送命中行和告警
+var splunkFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "splunk-hec",
+		Usage: tr("把命中行和告警发送到该 Splunk HEC 地址，如 https://splunk.example.com:8088", "send matched lines and alerts to this Splunk HTTP Event Collector, e.g. https://splunk.example.com:8088"),
+	},
+	&cli.StringFlag{
+		Name:    "splunk-token",
+		Usage:   tr("HEC 令牌", "HEC token"),
+		EnvVars: []string{"SPLUNK_HEC_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:  "splunk-sourcetype",
+		Value: "aliyun:cdn",
+		Usage: tr("事件的 sourcetype", "sourcetype of the events"),
+	},
+	&cli.StringFlag{
+		Name:  "splunk-index",
+		Usage: tr("写入的索引，默认使用令牌配置的索引", "index to write to; defaults to the token's index"),
+	},
+	&cli.IntFlag{
+		Name:  "splunk-batch-size",
+		Value: 100,
+		Usage: tr("每次请求发送的事件数", "events per request"),
+	},
+	&cli.BoolFlag{
+		Name:  "splunk-insecure",
+		Usage: tr("不校验 HEC 的 TLS 证书（自签名证书时使用）", "skip TLS certificate verification of the HEC (for self-signed certificates)"),
+	},
+}
+
+type splunkSink struct {
+	endpoint   string
+	token      string
+	sourcetype string
+	index      string
+	batchSize  int
+	client     *http.Client
+
+	batch bytes.Buffer
+	count int
+}
+
+// HEC 事件格式，time 为带小数的 Unix 秒
+type splunkEvent struct {
+	Time       float64        `json:"time"`
+	Host       string         `json:"host,omitempty"`
+	Source     string         `json:"source"`
+	Sourcetype string         `json:"sourcetype"`
+	Index      string         `json:"index,omitempty"`
+	Event      map[string]any `json:"event"`
+}
+
+func loadSplunkSink(c *cli.Context) (outputSink, error) {
+	target := c.String("splunk-hec")
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(tr("--splunk-hec 地址无效 %q，格式如 https://splunk.example.com:8088", "invalid --splunk-hec address %q, use e.g. https://splunk.example.com:8088"), target)
+	}
+	s := &splunkSink{
+		token:      c.String("splunk-token"),
+		sourcetype: c.String("splunk-sourcetype"),
+		index:      c.String("splunk-index"),
+		batchSize:  max(c.Int("splunk-batch-size"), 1),
+		client:     sinkHTTPClient,
+	}
+	if s.token == "" {
+		return nil, errors.New(tr("使用 --splunk-hec 时需要 --splunk-token 或环境变量 SPLUNK_HEC_TOKEN", "--splunk-hec requires --splunk-token or SPLUNK_HEC_TOKEN"))
+	}
+	if !strings.Contains(u.Path, "/services/collector") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/services/collector/event"
+	}
+	s.endpoint = u.String()
+	if c.Bool("splunk-insecure") {
+		s.client = &http.Client{
+			Timeout:   sinkHTTPClient.Timeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		}
+	}
+	return s, nil
+}
+
+func (s *splunkSink) String() string { return "splunk " + s.endpoint }
+
+func (s *splunkSink) send(ev *sinkEvent) error {
+	source := "cdn-log-analyzer"
+	if label := ev.fileLabel(); label != "" {
+		source = label
+	}
+	data, err := json.Marshal(splunkEvent{
+		Time:       float64(ev.time.UnixMilli()) / 1000,
+		Host:       ev.domain(),
+		Source:     source,
+		Sourcetype: s.sourcetype,
+		Index:      s.index,
+		Event:      ev.fields(),
+	})
+	if err != nil {
+		return err
+	}
+	// HEC 支持在一个请求中发送多个首尾相接的 JSON 事件
+	s.batch.Write(data)
+	s.count++
+	if s.count >= s.batchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *splunkSink) flush() error {
+	if s.count == 0 {
+		return nil
+	}
+	defer func() {
+		s.batch.Reset()
+		s.count = 0
+	}()
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(s.batch.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkSinkResponse(resp)
+}
+
+func (s *splunkSink) close() error { return s.flush() }
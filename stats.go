@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/mod/result"
+)
+
+// 本次运行的处理统计
+var runStats processStats
+
+// 处理统计，扫描过程中由多个协程并发累加
+type processStats struct {
+	start time.Time
+	// 搜索阶段耗时，吞吐量按此计算
+	scanStart    time.Time
+	scanEnd      time.Time
+	scanDuration time.Duration
+
+	// 待搜索的文件数，用于显示进度
+	filesTotal        atomic.Int64
+	filesScanned      atomic.Int64
+	compressedBytes   atomic.Int64
+	decompressedBytes atomic.Int64
+	linesProcessed    atomic.Int64
+
+	// 运行信息中的计数
+	filesListed     atomic.Int64
+	filesCached     atomic.Int64
+	filesDownloaded atomic.Int64
+	filesFailed     atomic.Int64
+	bytesDownloaded atomic.Int64
+	linesParsed     atomic.Int64
+	parseErrors     atomic.Int64
+
+	// 各阶段累计耗时
+	stageMu sync.Mutex
+	stages  map[string]time.Duration
+}
+
+// 运行阶段的名称，与结果中 stage_seconds 的键一致
+const (
+	stageList        = "list"
+	stageDownload    = "download"
+	stageScan        = "scan"
+	stagePostProcess = "post_process"
+)
+
+// 开始计时并清零计数
+func (s *processStats) reset() {
+	s.start = time.Now()
+	s.scanDuration = 0
+	s.filesTotal.Store(0)
+	s.filesScanned.Store(0)
+	s.compressedBytes.Store(0)
+	s.decompressedBytes.Store(0)
+	s.linesProcessed.Store(0)
+	for _, n := range []*atomic.Int64{&s.filesListed, &s.filesCached, &s.filesDownloaded, &s.filesFailed,
+		&s.bytesDownloaded, &s.linesParsed, &s.parseErrors} {
+		n.Store(0)
+	}
+	s.stageMu.Lock()
+	s.stages = nil
+	s.scanEnd = time.Time{}
+	s.stageMu.Unlock()
+}
+
+// 搜索阶段开始与结束
+func (s *processStats) beginScan() { s.scanStart = time.Now() }
+func (s *processStats) endScan() {
+	s.scanEnd = time.Now()
+	s.scanDuration = s.scanEnd.Sub(s.scanStart)
+	s.addStage(stageScan, s.scanDuration)
+}
+
+// 开始一个阶段，返回结束该阶段的函数；同一阶段多次执行时耗时累加
+func (s *processStats) beginStage(name string) func() {
+	start := time.Now()
+	return func() { s.addStage(name, time.Since(start)) }
+}
+
+func (s *processStats) addStage(name string, d time.Duration) {
+	s.stageMu.Lock()
+	defer s.stageMu.Unlock()
+	if s.stages == nil {
+		s.stages = make(map[string]time.Duration)
+	}
+	s.stages[name] += d
+}
+
+// 统计结果的文本形式，每行一项，prefix 用于报告中的注释前缀
+func (s *processStats) summary(prefix string, matches int) string {
+	elapsed := time.Since(s.start)
+	decompressed := s.decompressedBytes.Load()
+	throughput := 0.0
+	if secs := s.scanDuration.Seconds(); secs > 0 {
+		throughput = float64(decompressed) / 1024 / 1024 / secs
+	}
+
+	return fmt.Sprintf(tr("%s扫描文件数: %d\n"+
+		"%s压缩数据量: %s\n"+
+		"%s解压数据量: %s\n"+
+		"%s处理行数: %d\n"+
+		"%s命中行数: %d\n"+
+		"%s搜索耗时: %s\n"+
+		"%s总耗时: %s\n"+
+		"%s吞吐量: %.1f MB/s\n",
+		"%sFiles scanned: %d\n"+
+			"%sCompressed bytes: %s\n"+
+			"%sDecompressed bytes: %s\n"+
+			"%sLines processed: %d\n"+
+			"%sMatches: %d\n"+
+			"%sSearch time: %s\n"+
+			"%sTotal time: %s\n"+
+			"%sThroughput: %.1f MB/s\n"),
+		prefix, s.filesScanned.Load(),
+		prefix, formatBytes(s.compressedBytes.Load()),
+		prefix, formatBytes(decompressed),
+		prefix, s.linesProcessed.Load(),
+		prefix, matches,
+		prefix, s.scanDuration.Round(time.Millisecond),
+		prefix, elapsed.Round(time.Millisecond),
+		prefix, throughput)
+}
+
+// 转换为结果格式中的处理统计
+func (s *processStats) report() result.Stats {
+	return result.Stats{
+		FilesScanned:      s.filesScanned.Load(),
+		CompressedBytes:   s.compressedBytes.Load(),
+		DecompressedBytes: s.decompressedBytes.Load(),
+		LinesProcessed:    s.linesProcessed.Load(),
+		SearchSeconds:     s.scanDuration.Seconds(),
+		TotalSeconds:      time.Since(s.start).Seconds(),
+	}
+}
+
+// 转换为结果格式中的运行信息
+func (s *processStats) metadata() result.RunMetadata {
+	s.stageMu.Lock()
+	stages := make(map[string]float64, len(s.stages)+1)
+	for name, d := range s.stages {
+		stages[name] = d.Seconds()
+	}
+	if !s.scanEnd.IsZero() {
+		stages[stagePostProcess] = time.Since(s.scanEnd).Seconds()
+	}
+	s.stageMu.Unlock()
+	return result.RunMetadata{
+		FilesListed:     s.filesListed.Load(),
+		FilesCached:     s.filesCached.Load(),
+		FilesDownloaded: s.filesDownloaded.Load(),
+		FilesFailed:     s.filesFailed.Load(),
+		BytesDownloaded: s.bytesDownloaded.Load(),
+		FilesScanned:    s.filesScanned.Load(),
+		LinesScanned:    s.linesProcessed.Load(),
+		LinesParsed:     s.linesParsed.Load(),
+		ParseErrors:     s.parseErrors.Load(),
+		StageSeconds:    stages,
+		TotalSeconds:    time.Since(s.start).Seconds(),
+	}
+}
+
+// 统计读取字节数的 reader
+type countingReader struct {
+	r       io.Reader
+	counter *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.counter.Add(int64(n))
+	return n, err
+}
+
+// 格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
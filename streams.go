@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze streams：识别 HLS/DASH 请求，按流和观看会话统计观看人数、观看时长和重复请求的分片
+var streamsCommand = &cli.Command{
+	Name:  "streams",
+	Usage: tr("识别 HLS/DASH（.m3u8、.ts、.mpd、.m4s）请求，按流统计观看人数、平均观看时长和重复请求同一分片（可能卡顿）的会话", "recognize HLS/DASH (.m3u8, .ts, .mpd, .m4s) requests and report per stream the viewers, estimated average watch time and sessions refetching the same segment (suggesting rebuffering)"),
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "segment-duration",
+			Value: 6 * time.Second,
+			Usage: tr("每个分片的播放时长，用于按观看的分片数估算观看时长", "playback duration of each segment, used to estimate watch time from the number of segments watched"),
+		},
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+		&cli.StringFlag{
+			Name:  "viewers",
+			Usage: tr("按时间段估算该流（报表中的 stream，或不含域名的目录，如 /live/room1）的并发观看人数，输出观看人数时间线", "estimate the concurrent viewers of this stream (the stream column of the report, or the directory without the domain such as /live/room1) per time span and output a viewer count timeline"),
+		},
+		&cli.DurationFlag{
+			Name:  "viewers-interval",
+			Value: time.Minute,
+			Usage: tr("观看人数时间线的时间段长度", "time span of the viewer count timeline"),
+		},
+		&cli.StringFlag{
+			Name:  "viewers-csv",
+			Usage: tr("把观看人数时间线写入CSV文件：每行一个时间段（需要 --viewers）", "write the viewer count timeline to a CSV file, one row per time span (requires --viewers)"),
+		},
+	},
+	Action: runStreamsReport,
+}
+
+// 本次分析按流的统计，未运行 analyze streams 时为 nil
+var streams *streamStats
+
+type streamStats struct {
+	filter          expr
+	segmentDuration time.Duration
+	// 统计并发观看人数的流（--viewers），为空时不统计
+	viewerStream   string
+	viewerInterval time.Duration
+	viewerCSV      string
+
+	mu      sync.Mutex
+	streams map[string]*streamData
+}
+
+// 一个流（播放列表和分片所在的目录）的累计值
+type streamData struct {
+	protocol        string
+	requests, bytes int64
+	// 观看会话：客户端IP和 User-Agent 相同的请求视为同一观众
+	sessions map[string]*streamSession
+	// 统计并发观看人数的流：时间段开始的 Unix 时间 → 其中在观看的会话，其他流为 nil
+	viewers map[int64]*distinctSet
+}
+
+type streamSession struct {
+	// 分片请求数，以及其中重复请求最近几个分片之一的次数（播放器重试或卡顿后重新请求）
+	segmentRequests, refetches int64
+	// 最近请求的分片，next 为下一个写入的位置
+	recent [recentSegments]string
+	next   int
+	// 第一个和最后一个请求的时间（Unix 秒）
+	first, last int64
+}
+
+// 检查重复请求时记住的最近分片数；只比较最近的分片，每个会话的内存固定
+const recentSegments = 8
+
+// 流媒体文件的扩展名 → 协议和是否为播放列表
+var streamExts = map[string]struct {
+	protocol string
+	playlist bool
+}{
+	"m3u8": {"hls", true},
+	"ts":   {"hls", false},
+	"mpd":  {"dash", true},
+	"m4s":  {"dash", false},
+}
+
+func runStreamsReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	s := &streamStats{segmentDuration: c.Duration("segment-duration"), streams: make(map[string]*streamData)}
+	if s.segmentDuration <= 0 {
+		return errors.New(tr("--segment-duration 必须大于0", "--segment-duration must be positive"))
+	}
+	if f := c.String("filter"); f != "" {
+		e, err := parseExpr(f)
+		if err != nil {
+			return fmt.Errorf(tr("过滤条件: %w", "filter: %w"), err)
+		}
+		s.filter = e
+	}
+	s.viewerStream, s.viewerInterval, s.viewerCSV = strings.TrimSuffix(c.String("viewers"), "/"), c.Duration("viewers-interval"), c.String("viewers-csv")
+	if s.viewerStream == "" && s.viewerCSV != "" {
+		return errors.New(tr("--viewers-csv 需要同时指定 --viewers", "--viewers-csv requires --viewers"))
+	}
+	if s.viewerInterval < time.Second {
+		return fmt.Errorf(tr("无效的时间线时间段 %s，最小为 1s", "invalid timeline interval %s, the minimum is 1s"), s.viewerInterval)
+	}
+	streams = s
+	var csvErr error
+	err := runAggregates(c, nil, func(ctx context.Context) {
+		agg := streams.aggregate()
+		printAggregate(agg)
+		postAggregates = append(postAggregates, *agg)
+		if streams.viewerStream == "" {
+			return
+		}
+		timeline := streams.viewerTimeline()
+		printViewerTimeline(timeline, streams.viewerInterval)
+		postAggregates = append(postAggregates, *timeline)
+		if streams.viewerCSV == "" {
+			return
+		}
+		if csvErr = writeViewerCSV(timeline, streams.viewerCSV, streams.viewerInterval); csvErr == nil {
+			fmt.Printf(tr("观看人数时间线已写入 %s\n", "Viewer timeline written to %s\n"), streams.viewerCSV)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if csvErr != nil {
+		return fmt.Errorf(tr("写入观看人数时间线失败: %w", "write viewer timeline: %w"), csvErr)
+	}
+	return nil
+}
+
+func (s *streamStats) newState() map[string]*streamData {
+	if s == nil {
+		return nil
+	}
+	return make(map[string]*streamData)
+}
+
+// 统计一行日志，不是流媒体文件的请求跳过
+func observeStream(st map[string]*streamData, rec *logRecord) {
+	if st == nil || streams.filter != nil && !streams.filter.eval(rec).truthy() {
+		return
+	}
+	host, p, _ := splitURL(rec.URL)
+	kind, ok := streamExts[fileExtension(p)]
+	if !ok {
+		return
+	}
+	dir := path.Dir(p)
+	key := host + dir
+	d := st[key]
+	if d == nil {
+		d = &streamData{protocol: kind.protocol, sessions: make(map[string]*streamSession)}
+		if streams.viewerStream != "" && (streams.viewerStream == key || streams.viewerStream == dir) {
+			d.viewers = make(map[int64]*distinctSet)
+		}
+		st[key] = d
+	}
+	d.requests++
+	d.bytes += rec.ResponseSize
+	session := rec.ClientIP + "\x00" + rec.UserAgent
+	v := d.sessions[session]
+	t := rec.Time.Unix()
+	if v == nil {
+		v = &streamSession{first: t, last: t}
+		d.sessions[session] = v
+	}
+	v.first, v.last = min(v.first, t), max(v.last, t)
+	if d.viewers != nil {
+		streams.observeViewer(d, session, rec.Time)
+	}
+	if kind.playlist {
+		return
+	}
+	v.segmentRequests++
+	if segment := path.Base(p); slices.Contains(v.recent[:], segment) {
+		v.refetches++
+	} else {
+		v.recent[v.next] = segment
+		v.next = (v.next + 1) % recentSegments
+	}
+}
+
+// 播放器大约每个分片时长请求一次，请求之后的一个分片时长内视为在观看，计入覆盖的每个时间段
+func (s *streamStats) observeViewer(d *streamData, session string, t time.Time) {
+	for b := t.Truncate(s.viewerInterval); b.Before(t.Add(s.segmentDuration)); b = b.Add(s.viewerInterval) {
+		set := d.viewers[b.Unix()]
+		if set == nil {
+			set = &distinctSet{}
+			d.viewers[b.Unix()] = set
+		}
+		set.add(session)
+	}
+}
+
+func (s *streamStats) merge(st map[string]*streamData) {
+	if s == nil || st == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, sd := range st {
+		d := s.streams[key]
+		if d == nil {
+			s.streams[key] = sd
+			continue
+		}
+		d.requests += sd.requests
+		d.bytes += sd.bytes
+		for id, sv := range sd.sessions {
+			v := d.sessions[id]
+			if v == nil {
+				d.sessions[id] = sv
+				continue
+			}
+			v.segmentRequests += sv.segmentRequests
+			v.refetches += sv.refetches
+			v.first, v.last = min(v.first, sv.first), max(v.last, sv.last)
+		}
+		for b, set := range sd.viewers {
+			if d.viewers[b] == nil {
+				d.viewers[b] = set
+				continue
+			}
+			d.viewers[b].merge(set)
+		}
+	}
+}
+
+// 按流的报表：观看人数、请求数、流量、平均观看时长（秒），以及重复请求的分片数和有重复请求的会话数
+func (s *streamStats) aggregate() *result.Aggregate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agg := &result.Aggregate{
+		Name:    "streams",
+		By:      []string{"stream", "protocol"},
+		Metrics: []string{"viewers", "requests", "bytes", "avg_watch", "refetches", "refetch_sessions"},
+		Groups:  len(s.streams),
+		Rows:    []result.AggregateRow{},
+	}
+	for key, d := range s.streams {
+		var watch, refetches, refetchSessions float64
+		for _, v := range d.sessions {
+			// 按观看的不同分片数估算，只请求了播放列表的会话按请求的时间跨度
+			if segments := v.segmentRequests - v.refetches; segments > 0 {
+				watch += float64(segments) * s.segmentDuration.Seconds()
+			} else {
+				watch += float64(v.last - v.first)
+			}
+			if v.refetches > 0 {
+				refetches += float64(v.refetches)
+				refetchSessions++
+			}
+		}
+		viewers := float64(len(d.sessions))
+		if hiddenGroup(int64(viewers)) {
+			continue
+		}
+		row := result.AggregateRow{Keys: []string{key, d.protocol}, Values: []float64{viewers, float64(d.requests), float64(d.bytes), watch / viewers, refetches, refetchSessions}}
+		agg.Rows = append(agg.Rows, row)
+	}
+	sortAggregate(agg)
+	limitAggregate(agg)
+	return agg
+}
+
+// 并发观看人数时间线：有观看的时间段按时间排列；--viewers 不含域名时合并各域名下的同名目录
+func (s *streamStats) viewerTimeline() *result.Aggregate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buckets := make(map[int64]*distinctSet)
+	for _, d := range s.streams {
+		for b, set := range d.viewers {
+			if buckets[b] == nil {
+				buckets[b] = &distinctSet{}
+			}
+			buckets[b].merge(set)
+		}
+	}
+	agg := &result.Aggregate{
+		Name:    "stream-viewers",
+		By:      []string{"time"},
+		Metrics: []string{"viewers"},
+		Groups:  len(buckets),
+		Rows:    []result.AggregateRow{},
+	}
+	for _, b := range slices.Sorted(maps.Keys(buckets)) {
+		agg.Approximate = agg.Approximate || buckets[b].approximate()
+		agg.Rows = append(agg.Rows, result.AggregateRow{Keys: []string{time.Unix(b, 0).UTC().Format(time.RFC3339)}, Values: []float64{buckets[b].count()}})
+	}
+	return agg
+}
+
+// 时间范围内每个时间段的观看人数，没有观看的时间段为 0
+func viewerCounts(timeline *result.Aggregate, interval time.Duration) ([]time.Time, []int64) {
+	counts := make(map[string]int64, len(timeline.Rows))
+	for _, row := range timeline.Rows {
+		counts[row.Keys[0]] = int64(row.Values[0])
+	}
+	buckets := timeBuckets(interval)
+	values := make([]int64, len(buckets))
+	for i, b := range buckets {
+		values[i] = counts[b.UTC().Format(time.RFC3339)]
+	}
+	return buckets, values
+}
+
+// 在终端输出观看人数的峰值和迷你图
+func printViewerTimeline(timeline *result.Aggregate, interval time.Duration) {
+	if len(timeline.Rows) == 0 {
+		fmt.Fprintf(os.Stderr, tr("警告: 没有流 %s 的请求\n", "Warning: no requests for stream %s\n"), streams.viewerStream)
+		return
+	}
+	layout := "01-02 15:04"
+	if interval < time.Minute {
+		layout = "01-02 15:04:05"
+	}
+	peak := slices.MaxFunc(timeline.Rows, func(a, b result.AggregateRow) int { return cmp.Compare(a.Values[0], b.Values[0]) })
+	peakTime, _ := time.Parse(time.RFC3339, peak.Keys[0])
+	fmt.Printf(tr("\n%s 的并发观看人数 (每 %s): 峰值 %s (%s)%s\n", "\nConcurrent viewers of %s (per %s): peak %s (%s)%s\n"),
+		streams.viewerStream, compactDuration(interval), formatNumber(peak.Values[0]), peakTime.Local().Format(layout), approximateNote(timeline))
+	buckets, values := viewerCounts(timeline, interval)
+	if len(buckets) == 0 {
+		return
+	}
+	per := max(1, (len(buckets)+sparklineWidth-1)/sparklineWidth)
+	fmt.Printf(tr("  %s ~ %s，每格 %s\n", "  %s ~ %s, %s per column\n"),
+		buckets[0].Local().Format(layout), buckets[len(buckets)-1].Add(interval).Local().Format(layout), compactDuration(interval*time.Duration(per)))
+	fmt.Printf("  |%s|\n", sparkline(values, per))
+}
+
+// 把观看人数时间线写入 --viewers-csv：每行为时间段的开始时间（RFC3339）和观看人数
+func writeViewerCSV(timeline *result.Aggregate, file string, interval time.Duration) error {
+	buckets, values := viewerCounts(timeline, interval)
+	return writeFileWith(file, func(w *bufio.Writer) {
+		w.WriteString("time,viewers\n")
+		for i, b := range buckets {
+			fmt.Fprintf(w, "%s,%d\n", b.UTC().Format(time.RFC3339), values[i])
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// --ip-file 中的IP和网段，未指定时为 nil
+var suspects *ipSet
+
+// 按 --ip-file 条目统计的命中报表，未指定 --ip-file 时为 nil
+var suspectsReport *groupBy
+
+// 读取 --ip-file 并创建 suspects 报表
+func loadSuspects(path string) error {
+	suspects, suspectsReport = nil, nil
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf(tr("读取IP列表失败: %w", "read IP file: %w"), err)
+	}
+	set, err := parseIPSet(data)
+	if err != nil {
+		return fmt.Errorf(tr("解析IP列表 %s 失败: %w", "parse IP file %s: %w"), path, err)
+	}
+	g, err := newGroupBy("suspects", "suspect,client_ip", "count,bytes,distinct(url),first_seen,last_seen,active", `suspect != ""`)
+	if err != nil {
+		return err
+	}
+	suspects, suspectsReport = set, g
+	aggregateReports = append(aggregateReports, g)
+	return nil
+}
+
+// suspect 字段：包含客户端IP（其次为代理IP）的 --ip-file 条目，不在列表中时为空
+func suspectOf(rec *logRecord) string {
+	if suspects == nil {
+		return ""
+	}
+	for _, ip := range []string{rec.ClientIP, rec.ProxyIP} {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			if p, ok := suspects.lookup(addr); ok {
+				return formatIPEntry(p)
+			}
+		}
+	}
+	return ""
+}
+
+// 客户端IP或代理IP在IP集合中的行
+type ipSetMatcher struct {
+	set *ipSet
+}
+
+func (m ipSetMatcher) Match(line string) bool {
+	client, proxy := logIPFields(line)
+	for _, field := range []string{client, proxy} {
+		if addr, err := netip.ParseAddr(strings.Trim(field, "[]")); err == nil && m.set.contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 在终端输出各条目的命中统计，以及列表中有命中的条目数
+func printSuspectsReport() {
+	if suspectsReport == nil {
+		return
+	}
+	agg := suspectsReport.aggregate()
+	hit := make(map[string]bool)
+	suspectsReport.mu.Lock()
+	for _, v := range suspectsReport.groups {
+		hit[v.keys[0]] = true
+	}
+	suspectsReport.mu.Unlock()
+	fmt.Printf(tr("\nIP列表: %d 个IP/网段中 %d 个有命中\n", "\nIP file: %d IPs/networks, %d seen\n"), suspects.len(), len(hit))
+	if len(agg.Rows) > 0 {
+		printAggregate(agg)
+	}
+}
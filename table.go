@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 聚合报表的输出参数
+var reportFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "sort-by",
+		Usage: tr("聚合报表按该列排序（分组字段或指标名，如 count），默认按第一项指标从大到小", "sort aggregate reports by this column (a group field or metric such as count); default is the first metric, largest first"),
+	},
+	&cli.BoolFlag{
+		Name:  "desc",
+		Usage: tr("配合 --sort-by 从大到小排序", "sort descending, used with --sort-by"),
+	},
+	&cli.IntFlag{
+		Name:  "top",
+		Usage: tr("聚合报表只保留排序后的前N行 (0 表示不限制，终端默认显示前20行)", "keep only the first N rows of aggregate reports after sorting (0 = no limit; the terminal shows 20 by default)"),
+	},
+	&cli.IntFlag{
+		Name:  "min-count",
+		Usage: tr("聚合报表中隐藏日志行数少于M的分组", "hide groups seen in fewer than M log lines from aggregate reports"),
+	},
+	&cli.IntFlag{
+		Name:  "max-groups",
+		Value: 100000,
+		Usage: tr("每个聚合报表在内存中最多保留的分组数，超出后只保留出现最多的分组，结果标记为近似 (0 表示不限制)", "groups each aggregate report keeps in memory; beyond that only the most frequent are kept and the report is marked approximate (0 = no limit)"),
+	},
+}
+
+// 聚合报表的排序和行数配置
+var reportConfig struct {
+	sortBy    string
+	desc      bool
+	top       int
+	minCount  int
+	maxGroups int
+}
+
+func loadReportConfig(c *cli.Context) error {
+	reportConfig.sortBy = c.String("sort-by")
+	reportConfig.desc = c.Bool("desc")
+	reportConfig.top = c.Int("top")
+	reportConfig.minCount = c.Int("min-count")
+	reportConfig.maxGroups = c.Int("max-groups")
+	if reportConfig.top < 0 || reportConfig.minCount < 0 || reportConfig.maxGroups < 0 {
+		return errors.New(tr("--top、--min-count 和 --max-groups 不能为负数", "--top, --min-count and --max-groups must not be negative"))
+	}
+	// 剪枝后保留的分组不少于 --top，排在前面的行才可信
+	if reportConfig.maxGroups > 0 && reportConfig.top > reportConfig.maxGroups {
+		reportConfig.maxGroups = reportConfig.top
+	}
+	return nil
+}
+
+// 日志行数为 count 的分组是否因 --min-count 被隐藏
+func hiddenGroup(count int64) bool {
+	return count < int64(reportConfig.minCount)
+}
+
+// 排序后按 --top 截断报表的行
+func limitAggregate(agg *result.Aggregate) {
+	agg.Top, agg.MinCount = reportConfig.top, reportConfig.minCount
+	if reportConfig.top > 0 && len(agg.Rows) > reportConfig.top {
+		agg.Rows = agg.Rows[:reportConfig.top]
+	}
+}
+
+// 终端显示的行：指定 --top 时全部显示，否则最多 maxPrintedFindings 行
+func printedRows(agg *result.Aggregate) []result.AggregateRow {
+	if reportConfig.top > 0 {
+		return agg.Rows
+	}
+	return agg.Rows[:min(len(agg.Rows), maxPrintedFindings)]
+}
+
+// 检查 --sort-by 是否为报表中的列
+func checkSortColumn(columns []string) error {
+	if reportConfig.sortBy == "" || slices.Contains(columns, reportConfig.sortBy) {
+		return nil
+	}
+	return fmt.Errorf(tr("--sort-by 的列 %q 不存在，可选 %s", "--sort-by column %q not found, use one of %s"), reportConfig.sortBy, strings.Join(columns, ", "))
+}
+
+// 排序使用的列：分组字段返回 (下标, false)，指标返回 (下标, true)
+func sortColumn(agg *result.Aggregate) (int, bool) {
+	if i := slices.Index(agg.By, reportConfig.sortBy); i >= 0 && reportConfig.sortBy != "" {
+		return i, false
+	}
+	if i := slices.Index(agg.Metrics, reportConfig.sortBy); i >= 0 {
+		return i, true
+	}
+	return 0, true
+}
+
+// 按 --sort-by/--desc 排序报表的行，未指定时按第一项指标从大到小；取值相同时按分组字段排序
+func sortAggregate(agg *result.Aggregate) {
+	col, metric := sortColumn(agg)
+	desc := reportConfig.desc || reportConfig.sortBy == ""
+	slices.SortFunc(agg.Rows, func(a, b result.AggregateRow) int {
+		var c int
+		if metric {
+			c = compareFloat(a.Values[col], b.Values[col])
+		} else {
+			c = compareKeys(a.Keys[col], b.Keys[col])
+		}
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return slices.Compare(a.Keys, b.Keys)
+	})
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// 分组字段的比较：两侧都是数字（如状态码）时按数值比较
+func compareKeys(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return compareFloat(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+// 聚合报表中一个指标值的文本形式
+func formatMetric(metric string, v float64) string {
+	switch metric {
+	case "bytes", "miss_bytes", "wasted_bytes":
+		return formatBytes(int64(v))
+	case "avg(response_size)", "max(response_size)", "p50(response_size)", "p90(response_size)", "p95(response_size)", "p99(response_size)":
+		return formatBytes(int64(v))
+	case "share", "miss_ratio":
+		return fmt.Sprintf("%.1f%%", v)
+	case "first_seen", "last_seen":
+		return time.Unix(int64(v), 0).Local().Format("2006-01-02 15:04:05")
+	case "active", "avg_watch":
+		return compactDuration(time.Duration(v) * time.Second)
+	}
+	return formatNumber(v)
+}
+
+// 以对齐的表格写入聚合报表的行，指标列右对齐；启用 --rdns 时在 client_ip 后增加 hostname 列
+func writeAggregateTable(w io.Writer, indent string, agg *result.Aggregate, rows []result.AggregateRow) {
+	by := agg.By
+	ipCol := slices.Index(by, "client_ip")
+	if !rdnsConfig.enabled || slices.Contains(by, "hostname") {
+		ipCol = -1
+	}
+	if ipCol >= 0 {
+		by = slices.Insert(slices.Clone(by), ipCol+1, "hostname")
+	}
+	header := slices.Concat(by, agg.Metrics)
+	rightAlign := make([]bool, len(header))
+	for i := len(by); i < len(header); i++ {
+		rightAlign[i] = true
+	}
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = slices.Clone(row.Keys)
+		if ipCol >= 0 {
+			cells[i] = slices.Insert(cells[i], ipCol+1, hostnameOf(row.Keys[ipCol]))
+		}
+		for j, v := range row.Values {
+			cells[i] = append(cells[i], formatMetric(agg.Metrics[j], v))
+		}
+	}
+	writeTable(w, indent, header, cells, rightAlign)
+}
+
+// 写入对齐的表格：表头、分隔线和各行，列宽按字符数计算
+func writeTable(w io.Writer, indent string, header []string, rows [][]string, rightAlign []bool) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	line := func(cells []string) {
+		var b strings.Builder
+		b.WriteString(indent)
+		for i, cell := range cells {
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if rightAlign[i] {
+				b.WriteString(pad + cell)
+			} else if i < len(cells)-1 {
+				b.WriteString(cell + pad)
+			} else {
+				b.WriteString(cell)
+			}
+		}
+		fmt.Fprintln(w, b.String())
+	}
+
+	line(header)
+	sep := make([]string, len(header))
+	for i := range header {
+		sep[i] = strings.Repeat("-", widths[i])
+	}
+	line(sep)
+	for _, row := range rows {
+		line(row)
+	}
+}
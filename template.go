@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"example.com/mod/result"
+)
+
+// 用户指定的结果模板，nil 表示使用默认的文本报告
+var outputTemplate *template.Template
+
+// 模板中每条命中记录的数据，解析成功时可直接使用 .ClientIP、.URL、.Status 等字段
+type templateMatch struct {
+	logRecord
+	// 命中所在的日志文件名
+	File string
+	// 原始日志行
+	Line string
+	// 日志行是否解析成功
+	Parsed bool
+}
+
+// 按名称取字段的值，可用于派生字段，如 {{.Field "ext"}}；未知字段为空字符串
+func (m templateMatch) Field(name string) string {
+	get, ok := exprFields[name]
+	if !ok || !m.Parsed {
+		return ""
+	}
+	return get(&m.logRecord).String()
+}
+
+// 模板中 summary/header 子模板的数据
+type templateSummary struct {
+	Domain      string
+	StartTime   string
+	EndTime     string
+	Patterns    string
+	GeneratedAt time.Time
+	Files       []templateFileSummary
+	Matches     int
+	Truncated   bool
+	// 采样时的放大倍数，未采样时为 1
+	SampleScale float64
+	// 运行信息，字段见 JSON 结果的 run
+	Run result.RunMetadata
+}
+
+// 单个文件的汇总
+type templateFileSummary struct {
+	File      string
+	Matches   int
+	Truncated bool
+}
+
+// 模板中可用的辅助函数
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"base":  filepath.Base,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"time": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// 加载结果模板，spec 为已存在的文件路径时读取文件内容，否则作为模板文本
+func loadOutputTemplate(spec string) (*template.Template, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	text := spec
+	if data, err := os.ReadFile(spec); err == nil {
+		text = string(data)
+	}
+
+	tmpl, err := template.New("match").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf(tr("解析结果模板失败: %w", "parse result template: %w"), err)
+	}
+	return tmpl, nil
+}
+
+// 使用模板写入结果：header 子模板（可选）、每条命中、summary 子模板（可选）
+func writeTemplateResults(writer *bufio.Writer, results map[string]*fileResult) error {
+	summary := buildTemplateSummary(results)
+
+	if t := outputTemplate.Lookup("header"); t != nil {
+		if err := t.Execute(writer, summary); err != nil {
+			return fmt.Errorf(tr("执行 header 模板失败: %w", "execute header template: %w"), err)
+		}
+	}
+
+	if config.mergeByTime {
+		err := mergedMatches(results, func(file, line string, _ time.Time) error {
+			return executeTemplateMatch(writer, file, line)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, file := range sortedFiles(results) {
+		if err := writeFileSection(writer, file, results[file]); err != nil {
+			return err
+		}
+	}
+
+	if t := outputTemplate.Lookup("summary"); t != nil {
+		if err := t.Execute(writer, summary); err != nil {
+			return fmt.Errorf(tr("执行 summary 模板失败: %w", "execute summary template: %w"), err)
+		}
+	}
+	return nil
+}
+
+// 对一条命中执行结果模板
+func executeTemplateMatch(writer *bufio.Writer, file, line string) error {
+	m := templateMatch{File: fileLabel(file), Line: normalizeLineTime(line)}
+	m.Parsed = parseLogLine(line, &m.logRecord) == nil
+	m.Time = normalizeTime(m.Time)
+	if err := outputTemplate.Execute(writer, m); err != nil {
+		return fmt.Errorf(tr("执行结果模板失败: %w", "execute result template: %w"), err)
+	}
+	return nil
+}
+
+// 一个文件的全部命中行依次执行结果模板
+func writeTemplateFileSection(writer *bufio.Writer, file string, r *fileResult) error {
+	return r.eachMatch(func(line string) error {
+		return executeTemplateMatch(writer, file, line)
+	})
+}
+
+func buildTemplateSummary(results map[string]*fileResult) templateSummary {
+	summary := templateSummary{
+		Domain:      config.domainName,
+		StartTime:   config.startTime,
+		EndTime:     config.endTime,
+		Patterns:    displaySearchIP(),
+		GeneratedAt: time.Now(),
+		Matches:     totalMatches(results),
+		Truncated:   resultsTruncated(results),
+		SampleScale: lineSampler.scale(),
+		Run:         runStats.metadata(),
+	}
+	for _, file := range sortedFiles(results) {
+		r := results[file]
+		summary.Files = append(summary.Files, templateFileSummary{
+			File:      fileLabel(file),
+			Matches:   r.matches,
+			Truncated: r.truncated,
+		})
+	}
+	return summary
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 腾讯云CDN的API地址和版本
+const (
+	tencentCDNEndpoint = "cdn.tencentcloudapi.com"
+	tencentCDNVersion  = "2018-06-06"
+)
+
+// DescribeCdnDomainLogs 单页最多返回的日志数（接口上限）
+const tencentListingPageSize = 1000
+
+// 腾讯云CDN，通过 DescribeCdnDomainLogs（cdn.tencentcloudapi.com）查询
+type tencentProvider struct {
+	cred   apiKey
+	client *http.Client
+}
+
+// 腾讯云凭证的来源：环境变量 TENCENTCLOUD_SECRET_ID/TENCENTCLOUD_SECRET_KEY 或 ~/.tencentcloud/credentials
+var tencentKeySource = apiKeySource{
+	vendor:   "tencent",
+	idEnv:    "TENCENTCLOUD_SECRET_ID",
+	keyEnv:   "TENCENTCLOUD_SECRET_KEY",
+	tokenEnv: "TENCENTCLOUD_SESSION_TOKEN",
+	file:     filepath.Join(".tencentcloud", "credentials"),
+	idKey:    "secret_id",
+	keyKey:   "secret_key",
+	tokenKey: "token",
+}
+
+// 使用账号（为 nil 时为默认凭证）创建腾讯云的日志来源
+func newTencentProvider(a *account) (logProvider, error) {
+	cred, err := tencentKeySource.load(a)
+	if err != nil {
+		return nil, err
+	}
+	return &tencentProvider{cred: cred, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (p *tencentProvider) name() string { return "tencent" }
+
+// 分页查询一天（UTC）的全部日志文件，境内和境外的日志都查询
+func (p *tencentProvider) listDayLogs(ctx context.Context, domain string, day time.Time) ([]logFile, error) {
+	var files []logFile
+	for offset := 0; ; offset += tencentListingPageSize {
+		// 接口的结束时间包含在范围内，减去1秒避免与下一天重复
+		params := map[string]any{
+			"Domain":    domain,
+			"StartTime": day.In(beijingTime).Format(time.DateTime),
+			"EndTime":   day.Add(24*time.Hour - time.Second).In(beijingTime).Format(time.DateTime),
+			"Offset":    offset,
+			"Limit":     tencentListingPageSize,
+			"Area":      "global",
+		}
+		var resp struct {
+			DomainLogs []struct {
+				StartTime string `json:"StartTime"`
+				EndTime   string `json:"EndTime"`
+				LogPath   string `json:"LogPath"`
+				LogName   string `json:"LogName"`
+				FileSize  int64  `json:"FileSize"`
+			} `json:"DomainLogs"`
+			TotalCount int `json:"TotalCount"`
+		}
+		err := withAPIRetry(ctx, "DescribeCdnDomainLogs", func() error {
+			return p.call(ctx, "DescribeCdnDomainLogs", params, &resp)
+		})
+		if err != nil {
+			return nil, fmt.Errorf(tr("API调用失败: %w", "API call failed: %w"), err)
+		}
+		for _, l := range resp.DomainLogs {
+			if l.LogPath == "" {
+				continue
+			}
+			f := logFile{Name: l.LogName, URL: l.LogPath, Size: l.FileSize}
+			f.Start, _ = time.ParseInLocation(time.DateTime, l.StartTime, beijingTime)
+			f.End, _ = time.ParseInLocation(time.DateTime, l.EndTime, beijingTime)
+			files = append(files, f)
+		}
+		if len(resp.DomainLogs) < tencentListingPageSize || offset+tencentListingPageSize >= resp.TotalCount {
+			return files, nil
+		}
+	}
+}
+
+// 调用腾讯云API（TC3-HMAC-SHA256 签名），把响应中的 Response 解析到 out
+func (p *tencentProvider) call(ctx context.Context, action string, params, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+tencentCDNEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", tencentCDNVersion)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	if p.cred.token != "" {
+		req.Header.Set("X-TC-Token", p.cred.token)
+	}
+	req.Header.Set("Authorization", tencentAuthorization(p.cred, tencentCDNEndpoint, "cdn", action, body, now))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Response json.RawMessage `json:"Response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("HTTP %d: %w", resp.StatusCode, err)
+	}
+	var status struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+		RequestID string `json:"RequestId"`
+	}
+	if err := json.Unmarshal(envelope.Response, &status); err != nil {
+		return fmt.Errorf("HTTP %d: %w", resp.StatusCode, err)
+	}
+	if status.Error != nil {
+		return &cloudAPIError{status: resp.StatusCode, code: status.Error.Code, message: status.Error.Message, requestID: status.RequestID}
+	}
+	return json.Unmarshal(envelope.Response, out)
+}
+
+// TC3-HMAC-SHA256 签名的 Authorization 头，与官方示例一样签名 content-type、host 和 x-tc-action 三个头
+func tencentAuthorization(c apiKey, host, service, action string, payload []byte, t time.Time) string {
+	date := t.UTC().Format(time.DateOnly)
+	canonical := "POST\n/\n\ncontent-type:application/json; charset=utf-8\nhost:" + host + "\nx-tc-action:" + strings.ToLower(action) + "\n\ncontent-type;host;x-tc-action\n" + sha256Hex(payload)
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(t.Unix(), 10) + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	key := hmacSHA256([]byte("TC3"+c.secret), date)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return "TC3-HMAC-SHA256 Credential=" + c.id + "/" + scope + ", SignedHeaders=content-type;host;x-tc-action, Signature=" + signature
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// 腾讯云CDN访问日志的时间格式（北京时间）
+const tencentTimeLayout = "20060102150405"
+
+// 是否为腾讯云CDN的日志行：以14位数字的请求时间开头
+func isTencentLine(line string) bool {
+	if len(line) <= len(tencentTimeLayout) || line[len(tencentTimeLayout)] != ' ' {
+		return false
+	}
+	for _, c := range line[:len(tencentTimeLayout)] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 解析一行腾讯云CDN访问日志
+// 格式: 请求时间 客户端IP 域名 文件路径 字节数 省份 运营商 状态码 Referer 响应时间 "User-Agent" "Range" 方法 协议 命中信息 客户端端口
+// 例如: 20190605104722 123.123.123.123 www.test.com /test.mp4 1024 22 2 200 - 36 "Mozilla/5.0" "-" GET HTTP/1.1 hit 56232
+func parseTencentLine(line string, rec *logRecord) error {
+	var fields [16]string
+	n := 0
+	for rest := line; rest != "" && n < len(fields); n++ {
+		var field string
+		var ok bool
+		field, rest, ok = nextField(rest)
+		if !ok {
+			return errMalformedLine
+		}
+		fields[n] = field
+	}
+	if n < 15 {
+		return errMalformedLine
+	}
+	t, err := time.ParseInLocation(tencentTimeLayout, fields[0], beijingTime)
+	if err != nil {
+		return errMalformedLine
+	}
+	rec.Time = t
+	rec.ClientIP = normalizeIP(fields[1])
+	rec.ProxyIP = "-"
+	rec.URL = "http://" + fields[2] + fields[3]
+	rec.ResponseSize, _ = strconv.ParseInt(fields[4], 10, 64)
+	if rec.Status, err = strconv.Atoi(fields[7]); err != nil {
+		return errMalformedLine
+	}
+	rec.Referer = fields[8]
+	rec.ResponseTime, _ = strconv.Atoi(fields[9])
+	rec.UserAgent = fields[10]
+	rec.Method = fields[12]
+	rec.HitInfo = strings.ToUpper(fields[14])
+	return nil
+}
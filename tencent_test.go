@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// 腾讯云 API 3.0 签名文档（TC3-HMAC-SHA256）中的示例：DescribeInstances，请求体中的中文按 \uXXXX 转义
+func TestTencentAuthorization(t *testing.T) {
+	c := apiKey{id: "AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE", secret: "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE"}
+	payload := []byte(`{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`)
+	got := tencentAuthorization(c, "cvm.tencentcloudapi.com", "cvm", "DescribeInstances", payload, time.Unix(1551113065, 0))
+	want := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, SignedHeaders=content-type;host;x-tc-action, Signature=644be983de9a8a3f00db8eadaba61467c3b429e2215758ba897b738ca469fd26"
+	if got != want {
+		t.Errorf("tencentAuthorization:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestParseTencentLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    logRecord
+		wantErr bool
+	}{
+		{
+			name: "文档示例",
+			line: `20190605104722 123.123.123.123 www.test.com /test.mp4 1024 22 2 200 - 36 "Mozilla/5.0 (Windows NT 10.0; Win64; x64)" "-" GET HTTP/1.1 hit 56232`,
+			want: logRecord{
+				Time:         time.Date(2019, 6, 5, 2, 47, 22, 0, time.UTC),
+				ClientIP:     "123.123.123.123",
+				ProxyIP:      "-",
+				ResponseTime: 36,
+				Referer:      "-",
+				Method:       "GET",
+				URL:          "http://www.test.com/test.mp4",
+				Status:       200,
+				ResponseSize: 1024,
+				HitInfo:      "HIT",
+				UserAgent:    "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+			},
+		},
+		{
+			name: "带查询参数和Referer，没有客户端端口",
+			line: `20190605104722 2001:db8::1 www.test.com /a.js?v=1 512 22 2 404 https://www.test.com/ 5 "curl/8.0" "bytes=0-1" HEAD HTTP/2.0 miss`,
+			want: logRecord{
+				Time:         time.Date(2019, 6, 5, 2, 47, 22, 0, time.UTC),
+				ClientIP:     "2001:db8::1",
+				ProxyIP:      "-",
+				ResponseTime: 5,
+				Referer:      "https://www.test.com/",
+				Method:       "HEAD",
+				URL:          "http://www.test.com/a.js?v=1",
+				Status:       404,
+				ResponseSize: 512,
+				HitInfo:      "MISS",
+				UserAgent:    "curl/8.0",
+			},
+		},
+		{name: "字段不足", line: `20190605104722 123.123.123.123 www.test.com /test.mp4 1024`, wantErr: true},
+		{name: "状态码不是数字", line: `20190605104722 123.123.123.123 www.test.com /test.mp4 1024 22 2 - - 36 "-" "-" GET HTTP/1.1 hit 56232`, wantErr: true},
+		{name: "时间格式错误", line: `20191305104722 123.123.123.123 www.test.com /test.mp4 1024 22 2 200 - 36 "-" "-" GET HTTP/1.1 hit 56232`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec logRecord
+			err := parseTencentLine(tt.line, &rec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTencentLine() = %+v, want error", rec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTencentLine() error: %v", err)
+			}
+			if !rec.Time.Equal(tt.want.Time) {
+				t.Errorf("Time = %v, want %v", rec.Time, tt.want.Time)
+			}
+			rec.Time, tt.want.Time = time.Time{}, time.Time{}
+			if rec != tt.want {
+				t.Errorf("parseTencentLine():\n got %+v\nwant %+v", rec, tt.want)
+			}
+		})
+	}
+}
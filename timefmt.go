@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 输出中日志时间的时区和格式
+var timeFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "time-zone",
+		Usage: tr("把命中行和 JSON/模板结果中的日志时间转换到该时区，如 UTC、Asia/Shanghai、Local；默认保持日志中的 +0800", "convert log timestamps in matched lines and JSON/template results to this time zone, e.g. UTC, Asia/Shanghai or Local; logs keep their native +0800 by default"),
+	},
+	&cli.StringFlag{
+		Name:  "time-format",
+		Usage: tr("输出中日志时间的格式: iso8601（指定 --time-zone 时的默认值）、datetime、unix、native（CDN原始格式）或 Go 时间格式，如 2006-01-02 15:04:05", "format of log timestamps in the output: iso8601 (the default with --time-zone), datetime, unix, native (the CDN format) or a Go layout such as 2006-01-02 15:04:05"),
+	},
+}
+
+// 输出时间的转换配置；layout 为空表示不改写
+var outputTime struct {
+	loc    *time.Location
+	layout string
+}
+
+// --time-format 的预设格式
+var timeFormatPresets = map[string]string{
+	"iso8601":  time.RFC3339,
+	"datetime": time.DateTime,
+	"native":   logTimeLayout,
+	"unix":     "unix",
+}
+
+func loadTimeConfig(c *cli.Context) error {
+	outputTime.loc, outputTime.layout = nil, ""
+	if name := c.String("time-zone"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf(tr("--time-zone 无效: %w", "invalid --time-zone: %w"), err)
+		}
+		outputTime.loc = loc
+		outputTime.layout = time.RFC3339
+	}
+	if f := c.String("time-format"); f != "" {
+		layout, ok := timeFormatPresets[f]
+		if !ok {
+			// 不是预设名称时按 Go 时间格式处理，至少要包含年份
+			if !strings.Contains(f, "2006") && !strings.Contains(f, "06") {
+				return fmt.Errorf(tr("不支持的 --time-format %q，可选 iso8601、datetime、unix、native 或包含 2006 的 Go 时间格式", "unsupported --time-format %q, use iso8601, datetime, unix, native or a Go layout containing 2006"), f)
+			}
+			layout = f
+		}
+		outputTime.layout = layout
+	}
+	return nil
+}
+
+// 按 --time-zone 转换时间，未指定时原样返回
+func normalizeTime(t time.Time) time.Time {
+	if outputTime.loc == nil || t.IsZero() {
+		return t
+	}
+	return t.In(outputTime.loc)
+}
+
+// 按 --time-zone/--time-format 改写日志行开头的 [时间]（腾讯云的日志为不带括号的时间）；未指定或行首不是可解析的时间时原样返回
+func normalizeLineTime(line string) string {
+	if outputTime.layout != "" && isTencentLine(line) {
+		t, err := time.ParseInLocation(tencentTimeLayout, line[:len(tencentTimeLayout)], beijingTime)
+		if err != nil {
+			return line
+		}
+		return formatLogTime(normalizeTime(t)) + line[len(tencentTimeLayout):]
+	}
+	if outputTime.layout == "" || !strings.HasPrefix(line, "[") {
+		return line
+	}
+	end := strings.IndexByte(line, ']')
+	if end < 0 {
+		return line
+	}
+	t, err := time.Parse(logTimeLayout, line[1:end])
+	if err != nil {
+		return line
+	}
+	return "[" + formatLogTime(normalizeTime(t)) + "]" + line[end+1:]
+}
+
+// 按 --time-format 格式化时间
+func formatLogTime(t time.Time) string {
+	if outputTime.layout == "unix" {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.Format(outputTime.layout)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 链路追踪相关的命令行参数
+var tracingFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "otlp-endpoint",
+		Usage: tr("OTLP/HTTP 追踪数据上报地址，如 localhost:4318 或 http://collector:4318（不带路径时上报到 /v1/traces）；设置后启用链路追踪，未设置时使用环境变量 OTEL_EXPORTER_OTLP_ENDPOINT 或 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTLP/HTTP endpoint for traces, e.g. localhost:4318 or http://collector:4318 (/v1/traces is used when no path is given); enables tracing when set, otherwise OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used"),
+	},
+	&cli.BoolFlag{
+		Name:  "otlp-insecure",
+		Usage: tr("使用 HTTP 而非 HTTPS 上报追踪数据", "export traces over HTTP instead of HTTPS"),
+	},
+}
+
+// 未启用追踪时为 OTel 默认的空实现，不产生任何开销
+var tracer = otel.Tracer("cdn-log-analyzer")
+
+// 追踪数据导出器，运行结束时需要刷新
+var tracerProvider *sdktrace.TracerProvider
+
+// 根据参数初始化链路追踪
+func startTracing(c *cli.Context) error {
+	endpoint := c.String("otlp-endpoint")
+	if endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil
+	}
+
+	// 只有环境变量时由导出器按 OTel 规范读取：OTEL_EXPORTER_OTLP_ENDPOINT 为基础地址，自动加上 /v1/traces
+	var opts []otlptracehttp.Option
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpointURL(endpoint, c.Bool("otlp-insecure"))))
+	} else if c.Bool("otlp-insecure") {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf(tr("创建追踪数据导出器失败: %w", "create trace exporter: %w"), err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("cdn-log-analyzer"),
+	))
+	if err != nil {
+		return fmt.Errorf(tr("创建追踪资源失败: %w", "create trace resource: %w"), err)
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	tracer = tracerProvider.Tracer("cdn-log-analyzer")
+	return nil
+}
+
+// 刷新并关闭链路追踪
+func stopTracing() error {
+	if tracerProvider == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		return fmt.Errorf(tr("上报追踪数据失败: %w", "export traces: %w"), err)
+	}
+	return nil
+}
+
+// 补全上报地址的协议和路径，没有路径时使用 /v1/traces
+func endpointURL(endpoint string, insecure bool) string {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		scheme := "https://"
+		if insecure {
+			scheme = "http://"
+		}
+		endpoint = scheme + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || strings.Trim(u.Path, "/") != "" {
+		return endpoint
+	}
+	u.Path = "/v1/traces"
+	return u.String()
+}
+
+// 开始一个span
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// 结束span，出错时记录错误状态
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 按时间段统计的日志请求数和流量，用于与CDN监控数据对比、终端图表和导出到 InfluxDB；nil 表示未启用
+var trafficCounter *traffic
+
+// 各时间段的请求数和响应字节数
+type traffic struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	buckets map[int64]*trafficBucket
+}
+
+// 一个时间段的统计，键为时间段开始的Unix时间
+type trafficBucket struct {
+	requests int64
+	bytes    int64
+	// 状态码为 4xx、5xx 的请求数
+	clientErrors int64
+	serverErrors int64
+	// 资源类型 → 响应字节数，只在 --type-timeline 时统计，否则为 nil
+	types map[string]int64
+}
+
+func (b *trafficBucket) add(o trafficBucket) {
+	b.requests += o.requests
+	b.bytes += o.bytes
+	b.clientErrors += o.clientErrors
+	b.serverErrors += o.serverErrors
+	if o.types != nil && b.types == nil {
+		b.types = make(map[string]int64, len(o.types))
+	}
+	for t, n := range o.types {
+		b.types[t] += n
+	}
+}
+
+func newTraffic(interval time.Duration) *traffic {
+	return &traffic{interval: interval, buckets: make(map[int64]*trafficBucket)}
+}
+
+// 为一次扫描创建独立的统计状态
+func (t *traffic) newState() *trafficState {
+	if t == nil {
+		return nil
+	}
+	return &trafficState{interval: t.interval, buckets: make(map[int64]*trafficBucket)}
+}
+
+// 单次扫描的统计状态
+type trafficState struct {
+	interval time.Duration
+	buckets  map[int64]*trafficBucket
+}
+
+func (st *trafficState) observe(rec *logRecord) {
+	if st == nil {
+		return
+	}
+	key := rec.Time.Truncate(st.interval).Unix()
+	b := st.buckets[key]
+	if b == nil {
+		b = &trafficBucket{}
+		st.buckets[key] = b
+	}
+	b.requests++
+	b.bytes += rec.ResponseSize
+	switch rec.Status / 100 {
+	case 4:
+		b.clientErrors++
+	case 5:
+		b.serverErrors++
+	}
+	if typeTimelineConfig.interval > 0 {
+		if b.types == nil {
+			b.types = make(map[string]int64)
+		}
+		_, p, _ := splitURL(rec.URL)
+		b.types[fileType(p, rec.ContentType)] += rec.ResponseSize
+	}
+}
+
+// 将一次扫描的统计合并到全局结果
+func (t *traffic) merge(st *trafficState) {
+	if t == nil || st == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, b := range st.buckets {
+		total := t.buckets[key]
+		if total == nil {
+			t.buckets[key] = b
+			continue
+		}
+		total.add(*b)
+	}
+}
+
+// 指定时间段的统计，没有日志时返回零值
+func (t *traffic) bucket(start time.Time) trafficBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b := t.buckets[start.Unix()]; b != nil {
+		return *b
+	}
+	return trafficBucket{}
+}
+
+// 从 start 开始、长度为 d 的时间段内各统计段的合计，d 应为统计粒度的整数倍
+func (t *traffic) sum(start time.Time, d time.Duration) trafficBucket {
+	var total trafficBucket
+	for s := start; s.Before(start.Add(d)); s = s.Add(t.interval) {
+		total.add(t.bucket(s))
+	}
+	return total
+}
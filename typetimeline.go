@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+)
+
+// 按资源类型的流量时间线的参数
+var typeTimelineFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "type-timeline",
+		Usage: tr("按该时间段（如 1h、10m）和资源类型（视频、图片、脚本/样式等，同 file_type 字段）统计全部日志的流量，在终端和文本报告中以迷你图显示，并写入JSON结果的 type_timeline 和网页控制台的堆叠图", "aggregate the bytes of all log lines per time span (e.g. 1h, 10m) and resource type (video, images, scripts/styles and so on, as the file_type field), shown as sparklines in the terminal and text report and written to type_timeline in JSON results and the web dashboard's stacked chart"),
+	},
+	&cli.StringFlag{
+		Name:  "type-timeline-csv",
+		Usage: tr("把按资源类型的流量时间线写入CSV文件：每行一个时间段，每列一种资源类型的字节数（需要 --type-timeline）", "write the traffic by resource type timeline to a CSV file: one row per time span, one column of bytes per resource type (requires --type-timeline)"),
+	},
+}
+
+// 按资源类型的流量时间线配置，interval 为 0 表示不统计
+var typeTimelineConfig struct {
+	interval time.Duration
+	csv      string
+}
+
+// 读取按资源类型的流量时间线参数，复用按时间段的流量统计（需要在 loadHeatmapConfig 之后调用）
+func loadTypeTimelineConfig(c *cli.Context) error {
+	typeTimelineConfig.interval = c.Duration("type-timeline")
+	typeTimelineConfig.csv = c.String("type-timeline-csv")
+	if typeTimelineConfig.interval == 0 {
+		if typeTimelineConfig.csv != "" {
+			return errors.New(tr("--type-timeline-csv 需要同时指定 --type-timeline", "--type-timeline-csv requires --type-timeline"))
+		}
+		return nil
+	}
+	if typeTimelineConfig.interval < time.Second {
+		return fmt.Errorf(tr("无效的时间线时间段 %s，最小为 1s", "invalid timeline interval %s, the minimum is 1s"), typeTimelineConfig.interval)
+	}
+	if trafficCounter == nil {
+		trafficCounter = newTraffic(typeTimelineConfig.interval)
+	} else if typeTimelineConfig.interval%trafficCounter.interval != 0 {
+		return errors.New(tr("--type-timeline 必须是 --cross-check-interval、--chart-interval 或 --influx-interval 的整数倍（同时使用 --heatmap 时为1小时的整数倍）", "--type-timeline must be a multiple of --cross-check-interval, --chart-interval or --influx-interval (of one hour together with --heatmap)"))
+	}
+	return nil
+}
+
+// 结果中的按资源类型的流量时间线，未启用时为 nil
+func typeTimelineResult() *result.TypeTimeline {
+	interval := typeTimelineConfig.interval
+	if interval == 0 || trafficCounter == nil {
+		return nil
+	}
+	buckets := timeBuckets(interval)
+	tl := &result.TypeTimeline{IntervalSeconds: int64(interval / time.Second), Times: make([]time.Time, len(buckets)), Series: []result.TypeSeries{}}
+	series := make(map[string]*result.TypeSeries)
+	for i, b := range buckets {
+		tl.Times[i] = b.UTC()
+		for t, n := range trafficCounter.sum(b, interval).types {
+			s := series[t]
+			if s == nil {
+				s = &result.TypeSeries{Type: t, Bytes: make([]int64, len(buckets))}
+				series[t] = s
+			}
+			s.Bytes[i] += n
+			s.TotalBytes += n
+		}
+	}
+	for _, s := range series {
+		tl.Series = append(tl.Series, *s)
+	}
+	slices.SortFunc(tl.Series, func(a, b result.TypeSeries) int {
+		return cmp.Or(cmp.Compare(b.TotalBytes, a.TotalBytes), strings.Compare(a.Type, b.Type))
+	})
+	return tl
+}
+
+// 写入每种资源类型的总流量、占比和迷你图，每行以 prefix 开头；返回是否有数据
+func writeTypeTimeline(w io.Writer, prefix string, tl *result.TypeTimeline) bool {
+	if len(tl.Series) == 0 || len(tl.Times) == 0 {
+		return false
+	}
+	interval := time.Duration(tl.IntervalSeconds) * time.Second
+	layout := "01-02 15:04"
+	if interval < time.Minute {
+		layout = "01-02 15:04:05"
+	}
+	per := max(1, (len(tl.Times)+sparklineWidth-1)/sparklineWidth)
+	fmt.Fprintf(w, tr("%s%s ~ %s，每格 %s\n", "%s%s ~ %s, %s per column\n"), prefix,
+		tl.Times[0].Local().Format(layout), tl.Times[len(tl.Times)-1].Add(interval).Local().Format(layout), compactDuration(interval*time.Duration(per)))
+	var total int64
+	for _, s := range tl.Series {
+		total += s.TotalBytes
+	}
+	width := 0
+	for _, s := range tl.Series {
+		width = max(width, len(s.Type))
+	}
+	for _, s := range tl.Series {
+		fmt.Fprintf(w, "%s%-*s  |%s|  %s (%.1f%%)\n", prefix, width, s.Type, sparkline(s.Bytes, per), formatBytes(s.TotalBytes), percentOf(s.TotalBytes, total))
+	}
+	return true
+}
+
+// 在终端输出按资源类型的流量时间线，指定 --type-timeline-csv 时同时写入CSV
+func printTypeTimeline() error {
+	tl := typeTimelineResult()
+	if tl == nil {
+		return nil
+	}
+	var b strings.Builder
+	if writeTypeTimeline(&b, "  ", tl) {
+		fmt.Printf(tr("\n按资源类型的流量 (每 %s):\n%s", "\nTraffic by resource type (per %s):\n%s"), compactDuration(typeTimelineConfig.interval), b.String())
+	}
+	if typeTimelineConfig.csv == "" {
+		return nil
+	}
+	if err := writeTypeTimelineCSV(tl); err != nil {
+		return fmt.Errorf(tr("写入按资源类型的流量时间线失败: %w", "write traffic by resource type timeline: %w"), err)
+	}
+	fmt.Printf(tr("按资源类型的流量时间线已写入 %s\n", "Traffic by resource type timeline written to %s\n"), typeTimelineConfig.csv)
+	return nil
+}
+
+// 在文本报告中写入按资源类型的流量时间线
+func writeTypeTimelineReport(writer *bufio.Writer) {
+	tl := typeTimelineResult()
+	if tl == nil {
+		return
+	}
+	var b strings.Builder
+	if writeTypeTimeline(&b, "", tl) {
+		fmt.Fprintf(writer, tr("## 按资源类型的流量 (每 %s)\n%s\n", "## Traffic by resource type (per %s)\n%s\n"), compactDuration(typeTimelineConfig.interval), b.String())
+	}
+}
+
+// 把时间线写入 --type-timeline-csv：第一列为时间段的开始时间（RFC3339），其后每列为一种资源类型的字节数，按总流量从多到少
+func writeTypeTimelineCSV(tl *result.TypeTimeline) error {
+	return writeFileWith(typeTimelineConfig.csv, func(w *bufio.Writer) {
+		w.WriteString("time")
+		for _, s := range tl.Series {
+			w.WriteString("," + s.Type)
+		}
+		w.WriteString("\n")
+		for i, t := range tl.Times {
+			w.WriteString(t.Format(time.RFC3339))
+			for _, s := range tl.Series {
+				fmt.Fprintf(w, ",%d", s.Bytes[i])
+			}
+			w.WriteString("\n")
+		}
+	})
+}
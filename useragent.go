@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ua-parser/uap-go/uaparser"
+	"github.com/urfave/cli/v2"
+)
+
+// analyze ua：按浏览器、操作系统和设备类型统计流量
+var uaCommand = &cli.Command{
+	Name:  "ua",
+	Usage: tr("按浏览器、操作系统和设备类型统计请求数、流量和独立IP数", "break down requests, bytes and distinct IPs by browser family, OS and device class"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "filter",
+			Usage: tr("只统计满足条件的行，表达式语法同检测规则", "only aggregate lines matching this expression (same syntax as rule filters)"),
+		},
+	},
+	Action: runUserAgentReport,
+}
+
+func runUserAgentReport(c *cli.Context) error {
+	if err := loadRunConfig(c); err != nil {
+		return err
+	}
+	var reports []*groupBy
+	for _, field := range []string{"browser", "os", "device"} {
+		g, err := newGroupBy(field, field, "count,share,bytes,distinct(client_ip)", c.String("filter"))
+		if err != nil {
+			return err
+		}
+		reports = append(reports, g)
+	}
+	return runAggregates(c, reports, nil)
+}
+
+// User-Agent 的解析结果
+type userAgentInfo struct {
+	browser string
+	os      string
+	device  string
+}
+
+// uap-go 的解析器，首次使用时加载内置的规则
+var userAgentParser = sync.OnceValue(uaparser.NewFromSaved)
+
+// 解析结果的缓存，日志中不同的 User-Agent 通常不多，超过上限时清空
+var userAgentCache struct {
+	mu sync.Mutex
+	m  map[string]userAgentInfo
+}
+
+const userAgentCacheSize = 10000
+
+// 解析 User-Agent 得到浏览器、操作系统和设备类型
+func parseUserAgent(ua string) userAgentInfo {
+	userAgentCache.mu.Lock()
+	info, ok := userAgentCache.m[ua]
+	userAgentCache.mu.Unlock()
+	if ok {
+		return info
+	}
+
+	p := userAgentParser()
+	os, device := p.ParseOs(ua), p.ParseDevice(ua)
+	info = userAgentInfo{
+		browser: p.ParseUserAgent(ua).Family,
+		os:      os.Family,
+		device:  deviceClass(ua, os, device),
+	}
+
+	userAgentCache.mu.Lock()
+	if userAgentCache.m == nil || len(userAgentCache.m) >= userAgentCacheSize {
+		userAgentCache.m = make(map[string]userAgentInfo)
+	}
+	userAgentCache.m[ua] = info
+	userAgentCache.mu.Unlock()
+	return info
+}
+
+// 设备类型：bot、tablet、mobile、desktop 或 other，爬虫特征库中的 User-Agent 也算作 bot
+func deviceClass(ua string, os *uaparser.Os, device *uaparser.Device) string {
+	switch {
+	case device.Family == "Spider" || matchCrawler(ua) != nil:
+		return "bot"
+	case device.Family == "iPad" || strings.Contains(strings.ToLower(device.Family), "tablet"):
+		return "tablet"
+	case os.Family == "Android" && !strings.Contains(ua, "Mobile"):
+		// Android 平板的 User-Agent 中没有 Mobile
+		return "tablet"
+	}
+	switch os.Family {
+	case "iOS", "Android", "Windows Phone", "HarmonyOS", "KaiOS", "BlackBerry OS":
+		return "mobile"
+	case "Windows", "Mac OS X", "Linux", "Ubuntu", "Fedora", "Chrome OS", "FreeBSD":
+		return "desktop"
+	}
+	return "other"
+}
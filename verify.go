@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// verify：对比API的日志列表与本地缓存，列出需要重新下载的文件
+var verifyCommand = &cli.Command{
+	Name:  "verify",
+	Usage: tr("重新查询时间范围内的日志列表并与本地缓存对比，列出缺失、大小不一致和多余的文件", "re-list the logs of the time range and compare them with the local cache, reporting missing, size-mismatched and extra files"),
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "urls-out",
+			Usage: tr("把需要重新下载的文件链接写入该文件，可直接用作 --urls-file", "write the links of files that need re-downloading to this file, usable as --urls-file"),
+		},
+	},
+	Action: runVerify,
+}
+
+// 对比结果中文件的状态
+const (
+	verifyMissing  = "missing"
+	verifyMismatch = "size-mismatch"
+	verifyExtra    = "extra"
+)
+
+// 一个与API列表不一致的文件
+type verifyIssue struct {
+	status   string
+	file     string
+	url      string
+	expected int64
+	local    int64
+}
+
+func runVerify(c *cli.Context) error {
+	if err := loadListingCommandConfig(c); err != nil {
+		return err
+	}
+	logs, err := listAllLogs(c.Context)
+	if err != nil {
+		return err
+	}
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return err
+	}
+
+	var issues []verifyIssue
+	expected := make(map[string]bool)
+	domains := make(map[string]bool)
+	for _, l := range logs {
+		file := localLogPath(l.URL)
+		expected[filepath.Base(file)] = true
+		domains[l.Domain] = true
+		info, err := os.Stat(file)
+		switch {
+		case err != nil:
+			issues = append(issues, verifyIssue{status: verifyMissing, file: file, url: l.URL, expected: l.Size})
+		case l.Size > 0 && info.Size() != l.Size:
+			issues = append(issues, verifyIssue{status: verifyMismatch, file: file, url: l.URL, expected: l.Size, local: info.Size()})
+		}
+	}
+	issues = append(issues, extraLogFiles(expected, domains, start, end)...)
+
+	var urls []string
+	rows := make([][]string, len(issues))
+	for i, is := range issues {
+		rows[i] = []string{is.status, filepath.Base(is.file), "", ""}
+		if is.status != verifyExtra {
+			rows[i][2] = formatBytes(is.expected)
+			urls = append(urls, is.url)
+		}
+		if is.status != verifyMissing {
+			rows[i][3] = formatBytes(is.local)
+		}
+	}
+	if len(rows) > 0 {
+		writeTable(os.Stdout, "", []string{"status", "file", "expected", "local"}, rows, []bool{false, false, true, true})
+	}
+	extra := len(issues) - len(urls)
+	fmt.Printf(tr("API列出 %d 个日志文件，需要重新下载 %d 个，本地多余 %d 个\n", "%d log files listed by the API, %d need re-downloading, %d extra locally\n"), len(logs), len(urls), extra)
+
+	if path := c.String("urls-out"); path != "" {
+		if err := os.WriteFile(path, []byte(strings.Join(urls, "\n")+"\n"), 0o644); err != nil {
+			return fmt.Errorf(tr("写入 %s 失败: %w", "write %s: %w"), path, err)
+		}
+		fmt.Printf(tr("需要重新下载的链接已写入 %s\n", "Links to re-download written to %s\n"), path)
+	}
+	// 与grep一致：本地数据完整时退出码为0，否则为1
+	if len(urls) > 0 {
+		exitCode = exitNoMatches
+	}
+	return nil
+}
+
+// 本地缓存中属于这些域名、时间在范围内，但API列表中没有的文件
+func extraLogFiles(expected, domains map[string]bool, start, end time.Time) []verifyIssue {
+	var issues []verifyIssue
+	for _, e := range cachedLogs() {
+		if expected[filepath.Base(e.file)] || e.start.IsZero() || !domains[e.domain] || e.start.Before(start.Truncate(time.Hour)) || !e.start.Before(end) {
+			continue
+		}
+		issues = append(issues, verifyIssue{status: verifyExtra, file: e.file, local: e.localSize})
+	}
+	return issues
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/mod/result"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// 与一周前对比的参数
+var compareWeekFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "compare-week",
+		Usage: tr("与一周前的同一时间范围对比各域名的请求数、流量、独立IP数、错误率、命中率和平均响应时间；一周前的日志通过API或OSS自动获取", "compare requests, bytes, unique IPs, error rates, hit rate and average response time per domain with the same time range one week earlier; the earlier logs are fetched automatically via the API or OSS"),
+	},
+}
+
+// 本次时间范围内按域名的统计，未指定 --compare-week 时为 nil
+var weekCurrent *periodStats
+
+// 对比结果，在搜索完成后设置
+var weekComparison *result.WeekComparison
+
+// 对比的时间偏移
+const compareOffset = 7 * 24 * time.Hour
+
+// 一个时间范围内按域名（URL中的主机名）的统计
+type periodStats struct {
+	mu      sync.Mutex
+	domains map[string]*domainPeriod
+}
+
+// 一个域名的累计值
+type domainPeriod struct {
+	requests, bytes            int64
+	clientErrors, serverErrors int64
+	hits                       int64
+	// 响应时间之和，毫秒
+	responseTime int64
+	ips          distinctSet
+}
+
+func loadCompareWeekConfig(c *cli.Context) error {
+	weekCurrent, weekComparison = nil, nil
+	if !c.Bool("compare-week") {
+		return nil
+	}
+	if c.String("urls-file") != "" {
+		return errors.New(tr("--compare-week 需要通过API或OSS获取一周前的日志，不能与 --urls-file 同时使用", "--compare-week fetches the earlier logs via the API or OSS and cannot be combined with --urls-file"))
+	}
+	weekCurrent = newPeriodStats()
+	return nil
+}
+
+func newPeriodStats() *periodStats {
+	return &periodStats{domains: make(map[string]*domainPeriod)}
+}
+
+// 统计一行日志，st 为单次扫描的状态
+func observePeriod(st map[string]*domainPeriod, rec *logRecord) {
+	host, _, _ := splitURL(rec.URL)
+	d := st[host]
+	if d == nil {
+		d = &domainPeriod{}
+		st[host] = d
+	}
+	d.requests++
+	d.bytes += rec.ResponseSize
+	switch rec.Status / 100 {
+	case 4:
+		d.clientErrors++
+	case 5:
+		d.serverErrors++
+	}
+	if cacheHit(rec) {
+		d.hits++
+	}
+	d.responseTime += int64(rec.ResponseTime)
+	d.ips.add(rec.ClientIP)
+}
+
+// 将一次扫描的统计合并到全局结果
+func (p *periodStats) merge(st map[string]*domainPeriod) {
+	if p == nil || st == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for host, d := range st {
+		total := p.domains[host]
+		if total == nil {
+			p.domains[host] = d
+			continue
+		}
+		total.requests += d.requests
+		total.bytes += d.bytes
+		total.clientErrors += d.clientErrors
+		total.serverErrors += d.serverErrors
+		total.hits += d.hits
+		total.responseTime += d.responseTime
+		total.ips.merge(&d.ips)
+	}
+}
+
+// 获取并扫描一周前同一时间范围的日志，生成对比结果
+func runWeekComparison(ctx context.Context) (cmp *result.WeekComparison, err error) {
+	ctx, span := startSpan(ctx, "compare-week", attribute.String("cdn.domain", config.domainName))
+	defer func() { endSpan(span, err) }()
+
+	start, end, err := parseTimeRange(config.startTime, config.endTime)
+	if err != nil {
+		return nil, err
+	}
+	prevStart, prevEnd := start.Add(-compareOffset), end.Add(-compareOffset)
+	fmt.Printf(tr("\n对比一周前: %s 至 %s\n", "\nComparing with one week earlier: %s to %s\n"), prevStart.Format(time.RFC3339), prevEnd.Format(time.RFC3339))
+
+	files, err := fetchPreviousWeekLogs(ctx, prevStart, prevEnd)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := scanPeriod(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	return compareWeeks(weekCurrent, previous, prevStart, prevEnd), nil
+}
+
+// 在一周前的时间范围内列出并下载日志；不改变本次分析的日志列表统计和缺失日期
+func fetchPreviousWeekLogs(ctx context.Context, start, end time.Time) ([]string, error) {
+	savedStart, savedEnd := config.startTime, config.endTime
+	listed, missing := runStats.filesListed.Load(), missingLogDays
+	defer func() {
+		config.startTime, config.endTime = savedStart, savedEnd
+		runStats.filesListed.Store(listed)
+		missingLogDays = missing
+	}()
+	config.startTime, config.endTime = start.Format(time.RFC3339), end.Format(time.RFC3339)
+
+	if ossConfig.bucket != "" {
+		files, err := listOSSLogObjects(ctx)
+		if err != nil {
+			return nil, fmt.Errorf(tr("获取OSS日志列表失败: %w", "list OSS logs: %w"), err)
+		}
+		return files, nil
+	}
+	_, files, err := fetchAndDownloadLogs(ctx, "")
+	return files, err
+}
+
+// 并行扫描日志文件，只做按域名的统计；读取失败的文件跳过并给出警告
+func scanPeriod(ctx context.Context, files []string) (*periodStats, error) {
+	stats := newPeriodStats()
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, config.workers)
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(file string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			st, err := scanPeriodFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, tr("警告: 读取 %s 失败: %v\n", "Warning: reading %s failed: %v\n"), file, err)
+				return
+			}
+			stats.merge(st)
+		}(file)
+	}
+	wg.Wait()
+	return stats, ctx.Err()
+}
+
+func scanPeriodFile(file string) (map[string]*domainPeriod, error) {
+	reader, closeReader, err := openLogReader(file, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader()
+	st := make(map[string]*domainPeriod)
+	sample := lineSampler.newState()
+	var rec logRecord
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if !sample.keep() {
+			continue
+		}
+		// 与本次分析一致：匿名化后再统计独立IP
+		if parseLogLine(anonymizeLine(scanner.Text()), &rec) == nil {
+			observePeriod(st, &rec)
+		}
+	}
+	return st, scanner.Err()
+}
+
+// 按域名对比两个时间范围，两个时间范围中出现过的域名都列出
+func compareWeeks(current, previous *periodStats, prevStart, prevEnd time.Time) *result.WeekComparison {
+	cmp := &result.WeekComparison{PreviousStart: prevStart, PreviousEnd: prevEnd, Domains: []result.DomainComparison{}}
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	var hosts []string
+	for host := range current.domains {
+		hosts = append(hosts, host)
+	}
+	for host := range previous.domains {
+		if current.domains[host] == nil {
+			hosts = append(hosts, host)
+		}
+	}
+	slices.Sort(hosts)
+	for _, host := range hosts {
+		cur, prev := current.domains[host], previous.domains[host]
+		if cur == nil {
+			cur = &domainPeriod{}
+		}
+		if prev == nil {
+			prev = &domainPeriod{}
+		}
+		d := result.DomainComparison{Domain: host}
+		for _, m := range periodMetrics {
+			d.Metrics = append(d.Metrics, metricComparison(m.name, m.value(cur), m.value(prev)))
+		}
+		cmp.Domains = append(cmp.Domains, d)
+	}
+	return cmp
+}
+
+// 对比的各项指标
+var periodMetrics = []struct {
+	name  string
+	value func(d *domainPeriod) float64
+}{
+	{"requests", func(d *domainPeriod) float64 { return float64(d.requests) }},
+	{"bytes", func(d *domainPeriod) float64 { return float64(d.bytes) }},
+	{"unique_ips", func(d *domainPeriod) float64 { return d.ips.count() }},
+	{"4xx_rate", func(d *domainPeriod) float64 { return percentOf(d.clientErrors, d.requests) }},
+	{"5xx_rate", func(d *domainPeriod) float64 { return percentOf(d.serverErrors, d.requests) }},
+	{"hit_rate", func(d *domainPeriod) float64 { return percentOf(d.hits, d.requests) }},
+	{"avg_response_time", func(d *domainPeriod) float64 {
+		if d.requests == 0 {
+			return 0
+		}
+		return float64(d.responseTime) / float64(d.requests)
+	}},
+}
+
+// n 占 total 的百分比，total 为 0 时为 0
+func percentOf(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+func metricComparison(name string, current, previous float64) result.MetricComparison {
+	m := result.MetricComparison{Name: name, Current: current, Previous: previous}
+	if previous != 0 {
+		change := (current/previous - 1) * 100
+		m.Change = &change
+	}
+	return m
+}
+
+// 指标值的文本形式
+func formatPeriodMetric(name string, v float64) string {
+	switch {
+	case name == "bytes":
+		return formatBytes(int64(v))
+	case strings.HasSuffix(name, "_rate"):
+		return fmt.Sprintf("%.2f%%", v)
+	case name == "avg_response_time":
+		return fmt.Sprintf("%.0f ms", v)
+	}
+	return formatNumber(v)
+}
+
+// 写入每个域名的对比表格
+func writeWeekComparison(w io.Writer, indent string, cmp *result.WeekComparison) {
+	for _, d := range cmp.Domains {
+		fmt.Fprintf(w, "%s%s\n", indent, d.Domain)
+		rows := make([][]string, len(d.Metrics))
+		for i, m := range d.Metrics {
+			change := "-"
+			if m.Change != nil {
+				change = fmt.Sprintf("%+.1f%%", *m.Change)
+			}
+			rows[i] = []string{m.Name, formatPeriodMetric(m.Name, m.Current), formatPeriodMetric(m.Name, m.Previous), change}
+		}
+		writeTable(w, indent+"  ", []string{tr("指标", "metric"), tr("本期", "current"), tr("一周前", "week before"), tr("变化", "change")}, rows, []bool{false, true, true, true})
+	}
+}
+
+// 在终端输出对比结果
+func printWeekComparison(cmp *result.WeekComparison) {
+	fmt.Printf(tr("\n与一周前对比 (%s 至 %s): %d 个域名\n", "\nWeek-over-week (%s to %s): %d domains\n"),
+		cmp.PreviousStart.Format(time.RFC3339), cmp.PreviousEnd.Format(time.RFC3339), len(cmp.Domains))
+	writeWeekComparison(os.Stdout, "  ", cmp)
+}
+
+// 在文本报告中写入对比结果
+func writeWeekComparisonReport(writer *bufio.Writer, cmp *result.WeekComparison) {
+	fmt.Fprintf(writer, tr("## 与一周前对比 (%s 至 %s)\n", "## Week-over-week (%s to %s)\n"),
+		cmp.PreviousStart.Format(time.RFC3339), cmp.PreviousEnd.Format(time.RFC3339))
+	writeWeekComparison(writer, "", cmp)
+	writer.WriteString("\n")
+}
+
+// 搜索或聚合统计完成后执行对比；获取或读取一周前的日志失败不影响本次结果，只给出警告
+func compareWithPreviousWeek(ctx context.Context) {
+	weekComparison = nil
+	if weekCurrent == nil {
+		return
+	}
+	cmp, err := runWeekComparison(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("警告: 与一周前对比失败: %v\n", "Warning: week-over-week comparison failed: %v\n"), err)
+		return
+	}
+	weekComparison = cmp
+	printWeekComparison(cmp)
+}